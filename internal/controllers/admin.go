@@ -3,7 +3,6 @@ package controllers
 import (
 	"net/http"
 	"proyecto-bd-final/internal/config"
-	"proyecto-bd-final/internal/models"
 	"proyecto-bd-final/internal/repository"
 	"proyecto-bd-final/internal/services"
 	"proyecto-bd-final/pkg/utils"
@@ -15,6 +14,7 @@ import (
 var (
 	bitacoraAdminService = services.NewBitacoraService()
 	adminUserRepo        = repository.NewUserRepository()
+	bloqueoService       = services.NewBloqueoService()
 )
 
 // GetStatistics obtiene estadísticas del sistema (admin)
@@ -98,69 +98,19 @@ func GetBitacora(c *gin.Context) {
 	utils.SuccessResponse(c, http.StatusOK, "Bitácora obtenida", bitacoras)
 }
 
-// GetRoles obtiene todos los roles (admin)
-func GetRoles(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		utils.ErrorResponse(c, http.StatusUnauthorized, "Usuario no autenticado", nil)
-		return
-	}
-
-	query := `SELECT IDROL, NOMBREROL FROM Roles`
-	rows, err := config.DB.Query(query)
+// UnlockUser levanta el bloqueo por intentos fallidos de una cuenta (admin)
+func UnlockUser(c *gin.Context) {
+	usuarioID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener roles", err)
-		return
-	}
-	defer rows.Close()
-
-	var roles []*models.Rol
-	for rows.Next() {
-		var rol models.Rol
-		if err := rows.Scan(&rol.IDRol, &rol.NombreRol); err != nil {
-			utils.ErrorResponse(c, http.StatusInternalServerError, "Error al procesar roles", err)
-			return
-		}
-		roles = append(roles, &rol)
-	}
-
-	// Registrar en bitácora
-	bitacoraAdminService.RegistrarAccion(userID.(int), "READ", "Roles", "Consulta de roles del sistema")
-
-	utils.SuccessResponse(c, http.StatusOK, "Roles obtenidos", roles)
-}
-
-// AssignRole asigna un rol a un usuario (admin)
-func AssignRole(c *gin.Context) {
-	adminID, exists := c.Get("user_id")
-	if !exists {
-		utils.ErrorResponse(c, http.StatusUnauthorized, "Usuario no autenticado", nil)
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de usuario inválido", err)
 		return
 	}
 
-	var assignData struct {
-		UsuarioID int `json:"usuario_id" binding:"required"`
-		RolID     int `json:"rol_id" binding:"required"`
-	}
-
-	if err := c.ShouldBindJSON(&assignData); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+	adminID, _ := c.Get("user_id")
+	if err := bloqueoService.Desbloquear(usuarioID, adminID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Error al desbloquear usuario", err)
 		return
 	}
 
-	// Asignar rol
-	if err := adminUserRepo.AssignRole(assignData.UsuarioID, assignData.RolID); err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al asignar rol", err)
-		return
-	}
-
-	// Registrar en bitácora
-	bitacoraAdminService.RegistrarAccion(
-		adminID.(int),
-		"UPDATE",
-		"UsuarioRol",
-		"Rol ID "+strconv.Itoa(assignData.RolID)+" asignado al usuario ID: "+strconv.Itoa(assignData.UsuarioID),
-	)
-
-	utils.SuccessResponse(c, http.StatusOK, "Rol asignado exitosamente", nil)
+	utils.SuccessResponse(c, http.StatusOK, "Usuario desbloqueado exitosamente", nil)
 }
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"net/http"
+	"proyecto-bd-final/internal/models"
+	"proyecto-bd-final/internal/services"
+	"proyecto-bd-final/pkg/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var bajaService = services.NewBajaService()
+
+// GetDeaccessions obtiene las solicitudes de baja (filtros: ?estado=, ?sucursal=)
+func GetDeaccessions(c *gin.Context) {
+	sucursalID, err := sucursalSolicitada(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Parámetro inválido: sucursal", err)
+		return
+	}
+
+	bajas, err := bajaService.GetBajas(c.Query("estado"), sucursalID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener solicitudes de baja", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Solicitudes de baja obtenidas", bajas)
+}
+
+// GetDeaccession obtiene una solicitud de baja con los ejemplares retirados
+func GetDeaccession(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de baja inválido", err)
+		return
+	}
+
+	baja, err := bajaService.GetByID(id)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Solicitud de baja no encontrada", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Solicitud de baja obtenida", baja)
+}
+
+// RequestDeaccession solicita la baja de un ejemplar (codigo) o de un libro
+// completo (isbn, solo admin)
+func RequestDeaccession(c *gin.Context) {
+	var bajaData struct {
+		Codigo        *int   `json:"codigo"`
+		ISBN          string `json:"isbn"`
+		Motivo        string `json:"motivo" binding:"required"`
+		Observaciones string `json:"observaciones"`
+	}
+
+	if err := c.ShouldBindJSON(&bajaData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	baja, err := bajaService.Solicitar(bajaData.ISBN, bajaData.Codigo, bajaData.Motivo, bajaData.Observaciones,
+		c.GetInt("sucursal_id"), userID.(int))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al solicitar baja", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Solicitud de baja registrada", baja)
+}
+
+// ApproveDeaccession aprueba una solicitud de baja y retira los ejemplares (admin)
+func ApproveDeaccession(c *gin.Context) {
+	resolverBaja(c, bajaService.Aprobar, "Error al aprobar baja", "Baja aprobada exitosamente")
+}
+
+// RejectDeaccession rechaza una solicitud de baja (admin)
+func RejectDeaccession(c *gin.Context) {
+	resolverBaja(c, bajaService.Rechazar, "Error al rechazar baja", "Baja rechazada")
+}
+
+// resolverBaja aplica la resolución a la solicitud indicada en la ruta
+func resolverBaja(c *gin.Context, resolver func(id int, comentario string, userID int) (*models.Baja, error), mensajeError, mensajeExito string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de baja inválido", err)
+		return
+	}
+
+	var resolucionData struct {
+		Comentario string `json:"comentario"`
+	}
+
+	// El cuerpo es opcional al aprobar
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&resolucionData); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+			return
+		}
+	}
+
+	userID, _ := c.Get("user_id")
+	baja, err := resolver(id, resolucionData.Comentario, userID.(int))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, mensajeError, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, mensajeExito, baja)
+}
+
+// GetDeaccessionCandidates lista los candidatos a baja: ejemplares sin
+// préstamos en ?anios= años y libros con varios ejemplares ociosos
+func GetDeaccessionCandidates(c *gin.Context) {
+	anios, err := strconv.Atoi(c.DefaultQuery("anios", strconv.Itoa(services.AniosInactividadBaja)))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Parámetro inválido: anios", err)
+		return
+	}
+
+	sucursalID, err := sucursalSolicitada(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Parámetro inválido: sucursal", err)
+		return
+	}
+
+	reporte, err := bajaService.GetCandidatos(anios, sucursalID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al obtener candidatos a baja", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Candidatos a baja obtenidos", reporte)
+}
@@ -1,36 +1,85 @@
 package controllers
 
 import (
+	"log"
 	"net/http"
 	"proyecto-bd-final/internal/models"
 	"proyecto-bd-final/internal/services"
 	"proyecto-bd-final/pkg/utils"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
 var bookService = services.NewBookService()
 
-// GetBooks obtiene todos los libros
+// GetBooks obtiene los libros del catálogo, opcionalmente filtrados. Devuelve
+// la lista de libros; con facetas=true responde con el total, una página de
+// libros y los conteos de cada faceta
 func GetBooks(c *gin.Context) {
-	// Verificar si hay un parámetro de búsqueda
-	searchTerm := c.Query("q")
+	filtro := services.FiltroCatalogo{Q: c.Query("q")}
 
-	var libros []*models.Libro
-	var err error
+	enteros := []struct {
+		param   string
+		destino *int
+	}{
+		{"editorial", &filtro.EditorialID},
+		{"autor", &filtro.AutorID},
+		{"categoria", &filtro.CategoriaID},
+		{"sucursal", &filtro.SucursalID},
+		{"anio_desde", &filtro.AnioDesde},
+		{"anio_hasta", &filtro.AnioHasta},
+		{"limit", &filtro.Limite},
+		{"offset", &filtro.Desplazamiento},
+	}
+	for _, e := range enteros {
+		valor := c.Query(e.param)
+		if valor == "" {
+			continue
+		}
+		n, err := strconv.Atoi(valor)
+		if err != nil || n < 0 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Parámetro inválido: "+e.param, err)
+			return
+		}
+		*e.destino = n
+	}
+
+	if valor := c.Query("disponible"); valor != "" {
+		disponible, err := strconv.ParseBool(valor)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Parámetro inválido: disponible", err)
+			return
+		}
+		filtro.Disponible = &disponible
+	}
 
-	if searchTerm != "" {
-		libros, err = bookService.SearchBooks(searchTerm)
-	} else {
-		libros, err = bookService.GetAll()
+	facetas, _ := strconv.ParseBool(c.Query("facetas"))
+	filtro.Facetas = facetas
+	if facetas {
+		// La respuesta facetada siempre se pagina
+		if filtro.Limite == 0 {
+			filtro.Limite = services.LimiteCatalogo
+		}
+		if filtro.Limite > services.LimiteCatalogoMaximo {
+			filtro.Limite = services.LimiteCatalogoMaximo
+		}
 	}
 
+	resultado, err := bookService.SearchCatalog(filtro)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener libros", err)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Libros obtenidos", libros)
+	if !facetas {
+		// Forma original de la respuesta: solo la lista de libros
+		c.Header("X-Total-Count", strconv.Itoa(resultado.Total))
+		utils.SuccessResponse(c, http.StatusOK, "Libros obtenidos", resultado.Libros)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Libros obtenidos", resultado)
 }
 
 // GetBookByISBN obtiene un libro por ISBN
@@ -54,6 +103,10 @@ func CreateBook(c *gin.Context) {
 		AnioPublicacion int    `json:"anio_publicacion" binding:"required"`
 		Cantidad        int    `json:"cantidad" binding:"required"`
 		EditorialID     int    `json:"editorial_id" binding:"required"`
+		Signatura       string `json:"signatura"`
+		Sistema         string `json:"sistema_clasificacion"`
+		Localizacion    string `json:"localizacion"`
+		SucursalID      int    `json:"sucursal_id"`
 	}
 
 	if err := c.ShouldBindJSON(&libroData); err != nil {
@@ -62,15 +115,17 @@ func CreateBook(c *gin.Context) {
 	}
 
 	libro := &models.Libro{
-		ISBN:            libroData.ISBN,
-		Titulo:          libroData.Titulo,
-		AnioPublicacion: libroData.AnioPublicacion,
-		Cantidad:        libroData.Cantidad,
-		EditorialID:     libroData.EditorialID,
+		ISBN:                 libroData.ISBN,
+		Titulo:               libroData.Titulo,
+		AnioPublicacion:      libroData.AnioPublicacion,
+		Cantidad:             libroData.Cantidad,
+		EditorialID:          libroData.EditorialID,
+		Signatura:            libroData.Signatura,
+		SistemaClasificacion: libroData.Sistema,
 	}
 
 	userID, _ := c.Get("user_id")
-	err := bookService.Create(libro, userID.(int))
+	err := bookService.Create(libro, libroData.Localizacion, libroData.SucursalID, userID.(int))
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al crear libro", err)
 		return
@@ -84,10 +139,12 @@ func UpdateBook(c *gin.Context) {
 	isbn := c.Param("isbn")
 
 	var libroData struct {
-		Titulo          string `json:"titulo" binding:"required"`
-		AnioPublicacion int    `json:"anio_publicacion" binding:"required"`
-		Cantidad        int    `json:"cantidad" binding:"required"`
-		EditorialID     int    `json:"editorial_id" binding:"required"`
+		Titulo          string  `json:"titulo" binding:"required"`
+		AnioPublicacion int     `json:"anio_publicacion" binding:"required"`
+		Cantidad        int     `json:"cantidad" binding:"required"`
+		EditorialID     int     `json:"editorial_id" binding:"required"`
+		Signatura       *string `json:"signatura"`
+		Sistema         *string `json:"sistema_clasificacion"`
 	}
 
 	if err := c.ShouldBindJSON(&libroData); err != nil {
@@ -95,16 +152,33 @@ func UpdateBook(c *gin.Context) {
 		return
 	}
 
+	actual, err := bookService.GetByISBN(isbn)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Libro no encontrado", err)
+		return
+	}
+
 	libro := &models.Libro{
-		ISBN:            isbn,
-		Titulo:          libroData.Titulo,
-		AnioPublicacion: libroData.AnioPublicacion,
-		Cantidad:        libroData.Cantidad,
-		EditorialID:     libroData.EditorialID,
+		ISBN:                 isbn,
+		Titulo:               libroData.Titulo,
+		AnioPublicacion:      libroData.AnioPublicacion,
+		Cantidad:             libroData.Cantidad,
+		EditorialID:          libroData.EditorialID,
+		Signatura:            actual.Signatura,
+		SistemaClasificacion: actual.SistemaClasificacion,
+	}
+
+	// La signatura solo cambia si se envía en la petición
+	if libroData.Signatura != nil {
+		libro.Signatura = *libroData.Signatura
+		libro.SistemaClasificacion = ""
+	}
+	if libroData.Sistema != nil {
+		libro.SistemaClasificacion = *libroData.Sistema
 	}
 
 	userID, _ := c.Get("user_id")
-	err := bookService.Update(libro, userID.(int))
+	err = bookService.Update(libro, userID.(int))
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al actualizar libro", err)
 		return
@@ -113,16 +187,109 @@ func UpdateBook(c *gin.Context) {
 	utils.SuccessResponse(c, http.StatusOK, "Libro actualizado exitosamente", libro)
 }
 
-// DeleteBook elimina un libro (admin)
+// DeleteBook solicita la baja de todos los ejemplares de un libro con el
+// motivo indicado en ?motivo=; la baja se hace efectiva al aprobarla (admin)
 func DeleteBook(c *gin.Context) {
 	isbn := c.Param("isbn")
 
 	userID, _ := c.Get("user_id")
-	err := bookService.Delete(isbn, userID.(int))
+	baja, err := bajaService.Solicitar(isbn, nil, c.Query("motivo"), c.Query("observaciones"), 0, userID.(int))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al solicitar la baja del libro", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusAccepted, "Solicitud de baja del libro registrada, pendiente de aprobación", baja)
+}
+
+// UpdateCopyLocation cambia la ubicación física de un ejemplar (admin, o
+// personal para los ejemplares de su sucursal)
+func UpdateCopyLocation(c *gin.Context) {
+	codigo, err := strconv.Atoi(c.Param("codigo"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Código de ejemplar inválido", err)
+		return
+	}
+
+	var ubicacionData struct {
+		Localizacion string `json:"localizacion" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&ubicacionData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	sucursalID := c.GetInt("sucursal_id")
+	if err := bookService.UpdateLocalizacionEjemplar(codigo, ubicacionData.Localizacion, sucursalID, userID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al actualizar ubicación", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Ubicación actualizada exitosamente", nil)
+}
+
+// ExportBooks exporta el catálogo completo en CSV, JSON Lines o MARCXML (admin)
+func ExportBooks(c *gin.Context) {
+	formato := c.DefaultQuery("format", services.FormatoCSV)
+
+	contentType, extension, err := services.ExportContentType(formato)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Formato inválido", err)
+		return
+	}
+
+	respuesta := &respuestaExportacion{c: c, contentType: contentType, extension: extension}
+	exporter, err := services.NewCatalogExporter(formato, respuesta)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Formato inválido", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if _, err := bookService.ExportCatalog(exporter, userID.(int)); err != nil {
+		// Una vez iniciada la descarga ya no se puede cambiar el código de estado
+		if !respuesta.iniciada {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Error al exportar catálogo", err)
+			return
+		}
+		log.Printf("Error al exportar catálogo: %v", err)
+		return
+	}
+
+	// Un catálogo vacío en JSON Lines no escribe nada
+	respuesta.Write(nil)
+}
+
+// respuestaExportacion fija los encabezados de la descarga con el primer byte
+// escrito, para poder responder con un error si la consulta falla antes
+type respuestaExportacion struct {
+	c           *gin.Context
+	contentType string
+	extension   string
+	iniciada    bool
+}
+
+func (r *respuestaExportacion) Write(p []byte) (int, error) {
+	if !r.iniciada {
+		r.c.Header("Content-Type", r.contentType)
+		r.c.Header("Content-Disposition", "attachment; filename=catalogo."+r.extension)
+		r.c.Status(http.StatusOK)
+		r.iniciada = true
+	}
+	return r.c.Writer.Write(p)
+}
+
+// ReindexBooks reconstruye el índice de búsqueda del catálogo (admin)
+func ReindexBooks(c *gin.Context) {
+	total, err := bookService.RebuildSearchIndex()
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al eliminar libro", err)
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al reconstruir índice de búsqueda", err)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Libro eliminado exitosamente", nil)
+	utils.SuccessResponse(c, http.StatusOK, "Índice de búsqueda reconstruido", gin.H{
+		"libros_indexados": total,
+	})
 }
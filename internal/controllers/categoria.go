@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"net/http"
+	"proyecto-bd-final/internal/models"
+	"proyecto-bd-final/internal/services"
+	"proyecto-bd-final/pkg/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var categoriaService = services.NewCategoriaService()
+
+// GetCategories obtiene el árbol de categorías con la cantidad de libros
+func GetCategories(c *gin.Context) {
+	arbol, err := categoriaService.GetArbol()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener categorías", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Categorías obtenidas", arbol)
+}
+
+// GetCategoryBooks obtiene los libros de una categoría y sus subcategorías
+func GetCategoryBooks(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de categoría inválido", err)
+		return
+	}
+
+	if _, err := categoriaService.GetByID(id); err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Categoría no encontrada", err)
+		return
+	}
+
+	filtro := services.FiltroCatalogo{CategoriaID: id, Limite: services.LimiteCatalogo, Facetas: true}
+	if valor := c.Query("limit"); valor != "" {
+		if filtro.Limite, err = strconv.Atoi(valor); err != nil || filtro.Limite <= 0 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Parámetro inválido: limit", err)
+			return
+		}
+		if filtro.Limite > services.LimiteCatalogoMaximo {
+			filtro.Limite = services.LimiteCatalogoMaximo
+		}
+	}
+	if valor := c.Query("offset"); valor != "" {
+		if filtro.Desplazamiento, err = strconv.Atoi(valor); err != nil || filtro.Desplazamiento < 0 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Parámetro inválido: offset", err)
+			return
+		}
+	}
+
+	resultado, err := bookService.SearchCatalog(filtro)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener libros", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Libros obtenidos", resultado)
+}
+
+// CreateCategory crea una categoría (admin)
+func CreateCategory(c *gin.Context) {
+	var categoriaData struct {
+		Nombre      string `json:"nombre" binding:"required"`
+		Descripcion string `json:"descripcion"`
+		PadreID     *int   `json:"padre_id"`
+	}
+
+	if err := c.ShouldBindJSON(&categoriaData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	categoria := &models.Categoria{
+		Nombre:      categoriaData.Nombre,
+		Descripcion: categoriaData.Descripcion,
+		PadreID:     categoriaData.PadreID,
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := categoriaService.Create(categoria, userID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al crear categoría", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Categoría creada exitosamente", categoria)
+}
+
+// UpdateCategory actualiza una categoría (admin)
+func UpdateCategory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de categoría inválido", err)
+		return
+	}
+
+	var categoriaData struct {
+		Nombre      string `json:"nombre" binding:"required"`
+		Descripcion string `json:"descripcion"`
+		PadreID     *int   `json:"padre_id"`
+	}
+
+	if err := c.ShouldBindJSON(&categoriaData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	categoria := &models.Categoria{
+		IDCategoria: id,
+		Nombre:      categoriaData.Nombre,
+		Descripcion: categoriaData.Descripcion,
+		PadreID:     categoriaData.PadreID,
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := categoriaService.Update(categoria, userID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al actualizar categoría", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Categoría actualizada exitosamente", categoria)
+}
+
+// DeleteCategory elimina una categoría sin subcategorías (admin)
+func DeleteCategory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de categoría inválido", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := categoriaService.Delete(id, userID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al eliminar categoría", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Categoría eliminada exitosamente", nil)
+}
+
+// SetBookCategories reemplaza las categorías asignadas a un libro (admin)
+func SetBookCategories(c *gin.Context) {
+	isbn := c.Param("isbn")
+
+	var asignacionData struct {
+		Categorias []int `json:"categorias" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&asignacionData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := categoriaService.AsignarALibro(isbn, asignacionData.Categorias, userID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al asignar categorías", err)
+		return
+	}
+
+	categorias, err := categoriaService.GetByISBN(isbn)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener categorías", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Categorías asignadas exitosamente", categorias)
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"net/http"
+	"proyecto-bd-final/internal/services"
+	"proyecto-bd-final/pkg/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var dosFactoresService = services.NewDosFactoresService()
+
+// GetTwoFactorStatus obtiene el estado del segundo factor del usuario actual
+func GetTwoFactorStatus(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	estado, err := dosFactoresService.Estado(userID.(int))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener segundo factor", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Estado del segundo factor obtenido", estado)
+}
+
+// SetupTwoFactor genera el secreto y la URI para el código QR de la
+// aplicación autenticadora
+func SetupTwoFactor(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	inscripcion, err := dosFactoresService.Iniciar(userID.(int))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al configurar segundo factor", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Escanea el código QR y confirma con un código de la aplicación", inscripcion)
+}
+
+// EnableTwoFactor activa el segundo factor y devuelve los códigos de recuperación
+func EnableTwoFactor(c *gin.Context) {
+	var codigoData struct {
+		Codigo string `json:"codigo" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&codigoData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	codigos, err := dosFactoresService.Activar(userID.(int), codigoData.Codigo)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al activar segundo factor", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Segundo factor activado; guarda los códigos de recuperación", gin.H{
+		"codigos_recuperacion": codigos,
+	})
+}
+
+// DisableTwoFactor desactiva el segundo factor del usuario actual
+func DisableTwoFactor(c *gin.Context) {
+	var desactivarData struct {
+		Contrasenia string `json:"contrasenia" binding:"required"`
+		Codigo      string `json:"codigo" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&desactivarData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := dosFactoresService.Desactivar(userID.(int), desactivarData.Contrasenia, desactivarData.Codigo); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al desactivar segundo factor", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Segundo factor desactivado", nil)
+}
+
+// RegenerateRecoveryCodes reemplaza los códigos de recuperación del usuario actual
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var codigoData struct {
+		Codigo string `json:"codigo" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&codigoData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	codigos, err := dosFactoresService.RegenerarCodigos(userID.(int), codigoData.Codigo)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al regenerar códigos", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Códigos de recuperación regenerados", gin.H{
+		"codigos_recuperacion": codigos,
+	})
+}
+
+// ResetUserTwoFactor quita el segundo factor de un usuario que perdió su
+// dispositivo (admin)
+func ResetUserTwoFactor(c *gin.Context) {
+	usuarioID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de usuario inválido", err)
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	if err := dosFactoresService.Restablecer(usuarioID, adminID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al restablecer segundo factor", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Segundo factor restablecido", nil)
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"net/http"
+	"proyecto-bd-final/internal/services"
+	"proyecto-bd-final/pkg/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var duplicadosService = services.NewDuplicadosService()
+
+// GetDuplicateBooks lista los grupos de libros posiblemente duplicados
+// (filtro: ?umbral= de similitud de títulos, entre 0 y 1)
+func GetDuplicateBooks(c *gin.Context) {
+	umbral, err := strconv.ParseFloat(c.DefaultQuery("umbral", strconv.FormatFloat(services.UmbralTituloSimilar, 'f', -1, 64)), 64)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Parámetro inválido: umbral", err)
+		return
+	}
+
+	grupos, err := duplicadosService.BuscarLibros(umbral)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al buscar libros duplicados", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Libros duplicados obtenidos", grupos)
+}
+
+// GetDuplicateAuthors lista los grupos de autores posiblemente duplicados
+func GetDuplicateAuthors(c *gin.Context) {
+	grupos, err := duplicadosService.BuscarAutores()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al buscar autores duplicados", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Autores duplicados obtenidos", grupos)
+}
+
+// MergeBooks fusiona un libro duplicado en el que se conserva
+func MergeBooks(c *gin.Context) {
+	var fusionData struct {
+		Conservar string `json:"conservar" binding:"required"`
+		Duplicado string `json:"duplicado" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&fusionData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	libro, err := duplicadosService.FusionarLibros(fusionData.Conservar, fusionData.Duplicado, userID.(int))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al fusionar libros", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Libros fusionados exitosamente", libro)
+}
+
+// MergeAuthors fusiona un autor duplicado en el que se conserva
+func MergeAuthors(c *gin.Context) {
+	var fusionData struct {
+		Conservar int `json:"conservar" binding:"required"`
+		Duplicado int `json:"duplicado" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&fusionData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	autor, err := duplicadosService.FusionarAutores(fusionData.Conservar, fusionData.Duplicado, userID.(int))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al fusionar autores", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Autores fusionados exitosamente", autor)
+}
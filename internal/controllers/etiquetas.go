@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"proyecto-bd-final/internal/labels"
+	"proyecto-bd-final/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrintCopyLabels genera una hoja de etiquetas en PDF con el código de barras
+// y/o QR de los ejemplares indicados (admin, o personal para los ejemplares
+// de su sucursal)
+func PrintCopyLabels(c *gin.Context) {
+	var etiquetasData struct {
+		Codigos                []int             `json:"codigos"`
+		ISBN                   string            `json:"isbn"`
+		Formato                string            `json:"formato"`
+		Plantilla              string            `json:"plantilla"`
+		PlantillaPersonalizada *labels.Plantilla `json:"plantilla_personalizada"`
+		PosicionInicial        int               `json:"posicion_inicial"`
+		Bordes                 bool              `json:"bordes"`
+	}
+
+	if err := c.ShouldBindJSON(&etiquetasData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	op := labels.Opciones{
+		Formato:         etiquetasData.Formato,
+		PosicionInicial: etiquetasData.PosicionInicial,
+		Bordes:          etiquetasData.Bordes,
+	}
+	if op.Formato == "" {
+		op.Formato = labels.FormatoCode128
+	}
+	if op.PosicionInicial == 0 {
+		op.PosicionInicial = 1
+	}
+
+	if etiquetasData.PlantillaPersonalizada != nil {
+		op.Plantilla = *etiquetasData.PlantillaPersonalizada
+		if op.Plantilla.Nombre == "" {
+			op.Plantilla.Nombre = "personalizada"
+		}
+	} else {
+		nombre := etiquetasData.Plantilla
+		if nombre == "" {
+			nombre = labels.PlantillaPredeterminada
+		}
+		plantilla, ok := labels.BuscarPlantilla(nombre)
+		if !ok {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Plantilla inválida", errors.New("plantilla no encontrada: "+nombre))
+			return
+		}
+		op.Plantilla = plantilla
+	}
+
+	etiquetas, err := bookService.GetEtiquetasEjemplares(etiquetasData.Codigos, etiquetasData.ISBN, c.GetInt("sucursal_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al obtener ejemplares", err)
+		return
+	}
+
+	// Se genera en memoria para poder responder con error si algo falla
+	var pdf bytes.Buffer
+	userID, _ := c.Get("user_id")
+	if err := bookService.ImprimirEtiquetas(&pdf, etiquetas, op, userID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al generar etiquetas", err)
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=etiquetas.pdf")
+	c.Data(http.StatusOK, "application/pdf", pdf.Bytes())
+}
+
+// GetLabelLayouts lista las plantillas de hojas de etiquetas predefinidas
+func GetLabelLayouts(c *gin.Context) {
+	utils.SuccessResponse(c, http.StatusOK, "Plantillas obtenidas exitosamente", labels.Plantillas)
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"proyecto-bd-final/internal/services"
+	"proyecto-bd-final/pkg/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var inventarioService = services.NewInventarioService()
+
+// GetStocktakes obtiene las sesiones de inventario de la sucursal
+func GetStocktakes(c *gin.Context) {
+	sucursalID, err := sucursalSolicitada(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Parámetro inválido: sucursal", err)
+		return
+	}
+
+	inventarios, err := inventarioService.GetInventarios(sucursalID, c.Query("estado"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener inventarios", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Inventarios obtenidos", inventarios)
+}
+
+// StartStocktake abre una sesión de inventario. El personal la abre en su
+// sucursal; el administrador debe indicar sucursal_id
+func StartStocktake(c *gin.Context) {
+	var inventarioData struct {
+		SucursalID   int    `json:"sucursal_id"`
+		Localizacion string `json:"localizacion"`
+	}
+
+	// El cuerpo es opcional: sin él se revisa toda la sucursal
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&inventarioData); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+			return
+		}
+	}
+
+	sucursalID := c.GetInt("sucursal_id")
+	if sucursalID == 0 {
+		sucursalID = inventarioData.SucursalID
+	}
+	if sucursalID == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", errors.New("debe indicar la sucursal"))
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	inventario, err := inventarioService.Iniciar(sucursalID, inventarioData.Localizacion, userID.(int))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al iniciar inventario", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Inventario iniciado exitosamente", inventario)
+}
+
+// ScanStocktake registra los códigos de ejemplar escaneados en una ubicación
+func ScanStocktake(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de inventario inválido", err)
+		return
+	}
+
+	var lecturaData struct {
+		Localizacion string `json:"localizacion" binding:"required"`
+		Codigos      []int  `json:"codigos" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&lecturaData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	registradas, err := inventarioService.RegistrarLecturas(id, lecturaData.Localizacion, lecturaData.Codigos,
+		c.GetInt("sucursal_id"), userID.(int))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al registrar lecturas", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Lecturas registradas exitosamente", gin.H{
+		"lecturas_registradas": registradas,
+	})
+}
+
+// GetStocktakeReport obtiene el reporte de discrepancias de un inventario
+func GetStocktakeReport(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de inventario inválido", err)
+		return
+	}
+
+	reporte, err := inventarioService.GetReporte(id, c.GetInt("sucursal_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al obtener reporte de inventario", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Reporte de inventario generado", reporte)
+}
+
+// CloseStocktake cierra un inventario y guarda su reporte; con
+// marcar_perdidos, los ejemplares faltantes quedan como perdidos
+func CloseStocktake(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de inventario inválido", err)
+		return
+	}
+
+	var cierreData struct {
+		MarcarPerdidos bool `json:"marcar_perdidos"`
+	}
+
+	// El cuerpo es opcional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&cierreData); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+			return
+		}
+	}
+
+	userID, _ := c.Get("user_id")
+	reporte, err := inventarioService.Cerrar(id, cierreData.MarcarPerdidos, c.GetInt("sucursal_id"), userID.(int))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al cerrar inventario", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Inventario cerrado exitosamente", reporte)
+}
+
+// CancelStocktake descarta un inventario abierto
+func CancelStocktake(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de inventario inválido", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := inventarioService.Cancelar(id, c.GetInt("sucursal_id"), userID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al cancelar inventario", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Inventario cancelado exitosamente", nil)
+}
@@ -0,0 +1,15 @@
+package controllers
+
+import (
+	"net/http"
+	"proyecto-bd-final/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS publica las claves públicas de firma de los tokens en el formato
+// estándar JWKS, sin el envoltorio de las demás respuestas
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.JWKS())
+}
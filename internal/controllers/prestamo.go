@@ -40,7 +40,8 @@ func CreateLoan(c *gin.Context) {
 	}
 
 	var loanData struct {
-		ISBN string `json:"isbn" binding:"required"`
+		ISBN       string `json:"isbn" binding:"required"`
+		SucursalID int    `json:"sucursal_id"`
 	}
 
 	if err := c.ShouldBindJSON(&loanData); err != nil {
@@ -48,7 +49,7 @@ func CreateLoan(c *gin.Context) {
 		return
 	}
 
-	prestamo, err := prestamoService.CrearPrestamo(userID.(int), loanData.ISBN)
+	prestamo, err := prestamoService.CrearPrestamo(userID.(int), loanData.ISBN, loanData.SucursalID)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusBadRequest, "Error al crear préstamo", err)
 		return
@@ -96,3 +97,44 @@ func GetAllLoans(c *gin.Context) {
 
 	utils.SuccessResponse(c, http.StatusOK, "Préstamos obtenidos", prestamos)
 }
+
+// GetBranchLoans obtiene los préstamos de la sucursal del personal
+func GetBranchLoans(c *gin.Context) {
+	sucursalID := c.GetInt("sucursal_id")
+	if sucursalID == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Debe indicar la sucursal", nil)
+		return
+	}
+
+	prestamos, err := prestamoService.GetPrestamosSucursal(sucursalID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener préstamos", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Préstamos obtenidos", prestamos)
+}
+
+// ReceiveLoanReturn registra la devolución de un préstamo en el mostrador de
+// la sucursal del personal
+func ReceiveLoanReturn(c *gin.Context) {
+	sucursalID := c.GetInt("sucursal_id")
+	if sucursalID == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Debe indicar la sucursal", nil)
+		return
+	}
+
+	prestamoID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de préstamo inválido", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := prestamoService.RecibirDevolucion(prestamoID, sucursalID, userID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al devolver libro", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Libro devuelto exitosamente", nil)
+}
@@ -11,7 +11,8 @@ import (
 
 var reportsService = services.NewReportsService()
 
-// GetReportePrestamosActivos genera reporte de préstamos activos (admin)
+// GetReportePrestamosActivos genera reporte de préstamos activos (admin, o
+// personal para su sucursal)
 func GetReportePrestamosActivos(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -19,7 +20,13 @@ func GetReportePrestamosActivos(c *gin.Context) {
 		return
 	}
 
-	reporte, err := reportsService.GetReportePrestamosActivos(userID.(int))
+	sucursalID, err := sucursalSolicitada(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Parámetro inválido: sucursal", err)
+		return
+	}
+
+	reporte, err := reportsService.GetReportePrestamosActivos(userID.(int), sucursalID)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al generar reporte", err)
 		return
@@ -67,7 +74,13 @@ func GetReporteLibrosPopulares(c *gin.Context) {
 		limit = 10
 	}
 
-	reporte, err := reportsService.GetReporteLibrosPopulares(userID.(int), limit)
+	sucursalID, err := sucursalSolicitada(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Parámetro inválido: sucursal", err)
+		return
+	}
+
+	reporte, err := reportsService.GetReporteLibrosPopulares(userID.(int), limit, sucursalID)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al generar reporte", err)
 		return
@@ -92,3 +105,27 @@ func GetEstadisticasGenerales(c *gin.Context) {
 
 	utils.SuccessResponse(c, http.StatusOK, "Estadísticas obtenidas exitosamente", estadisticas)
 }
+
+// GetReporteEstanteria genera el listado topográfico de ejemplares (admin, o
+// personal para su sucursal)
+func GetReporteEstanteria(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Usuario no autenticado", nil)
+		return
+	}
+
+	sucursalID, err := sucursalSolicitada(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Parámetro inválido: sucursal", err)
+		return
+	}
+
+	reporte, err := reportsService.GetReporteEstanteria(userID.(int), c.Query("localizacion"), sucursalID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al generar reporte", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Reporte generado exitosamente", reporte)
+}
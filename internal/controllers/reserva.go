@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"net/http"
+	"proyecto-bd-final/internal/services"
+	"proyecto-bd-final/pkg/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var reservaService = services.NewReservaService()
+
+// GetMyHolds obtiene las reservas del usuario actual
+func GetMyHolds(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	reservas, err := reservaService.GetByUsuario(userID.(int))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener reservas", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Reservas obtenidas", reservas)
+}
+
+// CreateHold reserva un libro para retirarlo en una sucursal
+func CreateHold(c *gin.Context) {
+	var reservaData struct {
+		ISBN       string `json:"isbn" binding:"required"`
+		SucursalID int    `json:"sucursal_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&reservaData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	reserva, err := reservaService.Crear(userID.(int), reservaData.ISBN, reservaData.SucursalID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al crear reserva", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Reserva creada exitosamente", reserva)
+}
+
+// CancelHold cancela una reserva del usuario actual
+func CancelHold(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de reserva inválido", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := reservaService.Cancelar(id, userID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al cancelar reserva", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Reserva cancelada exitosamente", nil)
+}
+
+// GetBranchHolds obtiene las reservas a retirar en la sucursal (personal)
+func GetBranchHolds(c *gin.Context) {
+	sucursalID, err := sucursalSolicitada(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Parámetro inválido: sucursal", err)
+		return
+	}
+
+	reservas, err := reservaService.GetBySucursal(sucursalID, c.Query("estado"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener reservas", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Reservas obtenidas", reservas)
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"net/http"
+	"proyecto-bd-final/internal/services"
+	"proyecto-bd-final/pkg/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var rolService = services.NewRolService()
+
+// GetRoles obtiene todos los roles (admin)
+func GetRoles(c *gin.Context) {
+	roles, err := rolService.GetAll()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener roles", err)
+		return
+	}
+
+	// Registrar en bitácora
+	userID, _ := c.Get("user_id")
+	bitacoraAdminService.RegistrarAccion(userID.(int), "READ", "Roles", "Consulta de roles del sistema")
+
+	utils.SuccessResponse(c, http.StatusOK, "Roles obtenidos", roles)
+}
+
+// GetRole obtiene un rol con sus permisos (admin)
+func GetRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de rol inválido", err)
+		return
+	}
+
+	rol, err := rolService.GetByID(id)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Rol no encontrado", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Rol obtenido", rol)
+}
+
+// GetPermissions obtiene todos los permisos del sistema (admin)
+func GetPermissions(c *gin.Context) {
+	permisos, err := rolService.GetPermisos()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener permisos", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Permisos obtenidos", permisos)
+}
+
+// CreateRole crea un rol (admin)
+func CreateRole(c *gin.Context) {
+	var rolData struct {
+		NombreRol string `json:"nombre_rol" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&rolData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	rol, err := rolService.Create(rolData.NombreRol, userID.(int))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al crear rol", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Rol creado exitosamente", rol)
+}
+
+// UpdateRole renombra un rol (admin)
+func UpdateRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de rol inválido", err)
+		return
+	}
+
+	var rolData struct {
+		NombreRol string `json:"nombre_rol" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&rolData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	rol, err := rolService.Update(id, rolData.NombreRol, userID.(int))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al actualizar rol", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Rol actualizado exitosamente", rol)
+}
+
+// DeleteRole elimina un rol sin usuarios asignados (admin)
+func DeleteRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de rol inválido", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := rolService.Delete(id, userID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al eliminar rol", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Rol eliminado exitosamente", nil)
+}
+
+// SetRolePermissions reemplaza los permisos que otorga un rol (admin)
+func SetRolePermissions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de rol inválido", err)
+		return
+	}
+
+	var permisosData struct {
+		Permisos []int `json:"permisos"`
+	}
+
+	if err := c.ShouldBindJSON(&permisosData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	rol, err := rolService.AsignarPermisos(id, permisosData.Permisos, userID.(int))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al asignar permisos", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Permisos asignados exitosamente", rol)
+}
+
+// AssignRole asigna un rol a un usuario (admin)
+func AssignRole(c *gin.Context) {
+	usuarioID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de usuario inválido", err)
+		return
+	}
+
+	var assignData struct {
+		RolID int `json:"rol_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&assignData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	if err := rolService.AsignarAUsuario(usuarioID, assignData.RolID, adminID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al asignar rol", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Rol asignado exitosamente", nil)
+}
+
+// RevokeRole quita un rol a un usuario (admin)
+func RevokeRole(c *gin.Context) {
+	usuarioID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de usuario inválido", err)
+		return
+	}
+
+	rolID, err := strconv.Atoi(c.Param("rolId"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de rol inválido", err)
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	if err := rolService.RevocarDeUsuario(usuarioID, rolID, adminID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al revocar rol", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Rol revocado exitosamente", nil)
+}
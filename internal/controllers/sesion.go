@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"net/http"
+	"proyecto-bd-final/internal/models"
+	"proyecto-bd-final/internal/services"
+	"proyecto-bd-final/pkg/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var sesionService = services.NewSesionService()
+
+// clienteDe obtiene la IP y el agente de usuario de la petición para
+// registrarlos en la sesión
+func clienteDe(c *gin.Context) models.Cliente {
+	return models.Cliente{
+		IP:            c.ClientIP(),
+		AgenteUsuario: c.Request.UserAgent(),
+	}
+}
+
+// GetMySessions lista las sesiones abiertas del usuario actual
+func GetMySessions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	sesiones, err := sesionService.Listar(userID.(int), c.GetInt("sesion_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener sesiones", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Sesiones obtenidas exitosamente", sesiones)
+}
+
+// RevokeMySession cierra una de las sesiones del usuario actual
+func RevokeMySession(c *gin.Context) {
+	sesionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de sesión inválido", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := sesionService.Revocar(sesionID, userID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Error al cerrar sesión", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Sesión cerrada", nil)
+}
+
+// RevokeOtherSessions cierra todas las sesiones del usuario actual salvo
+// aquella desde la que hace la petición
+func RevokeOtherSessions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	cerradas, err := sesionService.CerrarOtras(userID.(int), c.GetInt("sesion_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al cerrar sesiones", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Otras sesiones cerradas", gin.H{
+		"sesiones_cerradas": cerradas,
+	})
+}
+
+// GetUserSessions lista las sesiones abiertas de un usuario (admin)
+func GetUserSessions(c *gin.Context) {
+	usuarioID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de usuario inválido", err)
+		return
+	}
+
+	// La sesión del administrador no pertenece al usuario consultado: ninguna
+	// se marca como actual
+	sesiones, err := sesionService.Listar(usuarioID, 0)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener sesiones", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Sesiones obtenidas exitosamente", sesiones)
+}
+
+// RevokeUserSession cierra una sesión de un usuario (admin)
+func RevokeUserSession(c *gin.Context) {
+	usuarioID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de usuario inválido", err)
+		return
+	}
+
+	sesionID, err := strconv.Atoi(c.Param("sesionId"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de sesión inválido", err)
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	if err := sesionService.RevocarComoAdmin(sesionID, usuarioID, adminID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Error al cerrar sesión", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Sesión cerrada", nil)
+}
+
+// RevokeUserSessions cierra todas las sesiones de un usuario (admin)
+func RevokeUserSessions(c *gin.Context) {
+	usuarioID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de usuario inválido", err)
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	cerradas, err := sesionService.RevocarTodasComoAdmin(usuarioID, adminID.(int))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al cerrar sesiones", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Sesiones del usuario cerradas", gin.H{
+		"sesiones_cerradas": cerradas,
+	})
+}
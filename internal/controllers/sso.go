@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"proyecto-bd-final/internal/services"
+	"proyecto-bd-final/pkg/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ssoService = services.NewSSOService()
+
+// cookieEstadoSSO guarda el hash del state en el navegador que inició el
+// inicio de sesión único; sin ella, un atacante podría enviarle a la víctima
+// su propio enlace de retorno y dejarla dentro de la cuenta del atacante
+const cookieEstadoSSO = "sso_state"
+
+// SSOLogin redirige al proveedor OpenID Connect para iniciar sesión
+func SSOLogin(c *gin.Context) {
+	if !ssoService.Habilitado() {
+		utils.ErrorResponse(c, http.StatusNotFound, "Inicio de sesión único no configurado", nil)
+		return
+	}
+
+	direccion, estado, err := ssoService.Iniciar(c.Request.Context())
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadGateway, "Error al contactar al proveedor de identidad", err)
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(cookieEstadoSSO, utils.HashToken(estado), int(services.DuracionSolicitudSSO.Seconds()),
+		"/api/auth/oidc", "", true, true)
+
+	c.Redirect(http.StatusFound, direccion)
+}
+
+// SSOCallback recibe al usuario de vuelta del proveedor, inicia su sesión y lo
+// redirige al frontend con los tokens
+func SSOCallback(c *gin.Context) {
+	retorno := url.Values{}
+
+	// La cookie sirve una sola vez
+	cookie, errCookie := c.Cookie(cookieEstadoSSO)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(cookieEstadoSSO, "", -1, "/api/auth/oidc", "", true, true)
+
+	if errCookie != nil || subtle.ConstantTimeCompare([]byte(cookie), []byte(utils.HashToken(c.Query("state")))) != 1 {
+		retorno.Set("error", "el inicio de sesión no se inició en este navegador, intente nuevamente")
+		c.Redirect(http.StatusFound, ssoService.URLRetornoAplicacion(retorno))
+		return
+	}
+
+	if motivo := c.Query("error"); motivo != "" {
+		retorno.Set("error", motivo+" "+c.Query("error_description"))
+		c.Redirect(http.StatusFound, ssoService.URLRetornoAplicacion(retorno))
+		return
+	}
+
+	usuario, err := ssoService.Completar(c.Request.Context(), c.Query("state"), c.Query("code"))
+	if err != nil {
+		retorno.Set("error", err.Error())
+		c.Redirect(http.StatusFound, ssoService.URLRetornoAplicacion(retorno))
+		return
+	}
+
+	tokens, usuario, _, err := authService.LoginExterno(usuario, clienteDe(c))
+	var segundoFactor *services.SegundoFactorError
+	switch {
+	case errors.As(err, &segundoFactor):
+		retorno.Set("requiere_2fa", "true")
+		retorno.Set("token_2fa", segundoFactor.Token)
+		retorno.Set("expires_in", strconv.Itoa(int(services.DuracionDesafioDosFactores.Seconds())))
+	case err != nil:
+		retorno.Set("error", err.Error())
+	default:
+		// Registrar en bitácora
+		bitacora.RegistrarAccion(usuario.IDUsuario, "LOGIN", "Usuario", "Inicio de sesión único exitoso")
+
+		retorno.Set("token", tokens.AccessToken)
+		retorno.Set("refresh_token", tokens.RefreshToken)
+		retorno.Set("expires_in", strconv.Itoa(tokens.ExpiraEn))
+	}
+
+	c.Redirect(http.StatusFound, ssoService.URLRetornoAplicacion(retorno))
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"net/http"
+	"proyecto-bd-final/internal/models"
+	"proyecto-bd-final/internal/services"
+	"proyecto-bd-final/pkg/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var sucursalService = services.NewSucursalService()
+
+// GetBranches obtiene todas las sucursales
+func GetBranches(c *gin.Context) {
+	sucursales, err := sucursalService.GetAll()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener sucursales", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Sucursales obtenidas", sucursales)
+}
+
+// GetBookAvailability obtiene los ejemplares de un libro en cada sucursal
+func GetBookAvailability(c *gin.Context) {
+	isbn := c.Param("isbn")
+
+	if _, err := bookService.GetByISBN(isbn); err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Libro no encontrado", err)
+		return
+	}
+
+	disponibilidad, err := sucursalService.GetDisponibilidad(isbn)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener disponibilidad", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Disponibilidad obtenida", disponibilidad)
+}
+
+// CreateBranch crea una sucursal (admin)
+func CreateBranch(c *gin.Context) {
+	var sucursalData struct {
+		Codigo    string `json:"codigo" binding:"required"`
+		Nombre    string `json:"nombre" binding:"required"`
+		Direccion string `json:"direccion"`
+	}
+
+	if err := c.ShouldBindJSON(&sucursalData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	sucursal := &models.Sucursal{
+		Codigo:    sucursalData.Codigo,
+		Nombre:    sucursalData.Nombre,
+		Direccion: sucursalData.Direccion,
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := sucursalService.Create(sucursal, userID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al crear sucursal", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Sucursal creada exitosamente", sucursal)
+}
+
+// UpdateBranch actualiza una sucursal (admin)
+func UpdateBranch(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de sucursal inválido", err)
+		return
+	}
+
+	var sucursalData struct {
+		Codigo    string `json:"codigo" binding:"required"`
+		Nombre    string `json:"nombre" binding:"required"`
+		Direccion string `json:"direccion"`
+	}
+
+	if err := c.ShouldBindJSON(&sucursalData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	sucursal := &models.Sucursal{
+		IDSucursal: id,
+		Codigo:     sucursalData.Codigo,
+		Nombre:     sucursalData.Nombre,
+		Direccion:  sucursalData.Direccion,
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := sucursalService.Update(sucursal, userID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al actualizar sucursal", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Sucursal actualizada exitosamente", sucursal)
+}
+
+// AssignStaffBranch asigna la sucursal de un miembro del personal (admin)
+func AssignStaffBranch(c *gin.Context) {
+	usuarioID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de usuario inválido", err)
+		return
+	}
+
+	var asignacionData struct {
+		SucursalID int `json:"sucursal_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&asignacionData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := sucursalService.AsignarPersonal(usuarioID, asignacionData.SucursalID, userID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al asignar sucursal", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Sucursal asignada exitosamente", nil)
+}
+
+// sucursalSolicitada obtiene la sucursal de la petición: la fijada por
+// middleware.BranchScope o, si no la hay, el parámetro ?sucursal= (0 = todas)
+func sucursalSolicitada(c *gin.Context) (int, error) {
+	if sucursalID, ok := c.Get("sucursal_id"); ok {
+		return sucursalID.(int), nil
+	}
+
+	valor := c.Query("sucursal")
+	if valor == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(valor)
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"net/http"
+	"proyecto-bd-final/internal/services"
+	"proyecto-bd-final/pkg/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var trasladoService = services.NewTrasladoService()
+
+// GetTransfers obtiene los traslados que salen o llegan a la sucursal
+func GetTransfers(c *gin.Context) {
+	sucursalID, err := sucursalSolicitada(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Parámetro inválido: sucursal", err)
+		return
+	}
+
+	traslados, err := trasladoService.GetTraslados(sucursalID, c.Query("estado"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener traslados", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Traslados obtenidos", traslados)
+}
+
+// RequestTransfer solicita el traslado de un ejemplar a otra sucursal
+func RequestTransfer(c *gin.Context) {
+	var trasladoData struct {
+		Codigo            int `json:"codigo" binding:"required"`
+		SucursalDestinoID int `json:"sucursal_destino_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&trasladoData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	traslado, err := trasladoService.Solicitar(trasladoData.Codigo, trasladoData.SucursalDestinoID,
+		c.GetInt("sucursal_id"), userID.(int))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al solicitar traslado", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Traslado solicitado exitosamente", traslado)
+}
+
+// SendTransfer despacha un traslado desde la sucursal de origen
+func SendTransfer(c *gin.Context) {
+	accionTraslado(c, trasladoService.Enviar, "Error al enviar traslado", "Traslado enviado exitosamente")
+}
+
+// ReceiveTransfer confirma la recepción de un traslado en la sucursal de destino
+func ReceiveTransfer(c *gin.Context) {
+	accionTraslado(c, trasladoService.Recibir, "Error al recibir traslado", "Traslado recibido exitosamente")
+}
+
+// CancelTransfer cancela un traslado que aún no se envió
+func CancelTransfer(c *gin.Context) {
+	accionTraslado(c, trasladoService.Cancelar, "Error al cancelar traslado", "Traslado cancelado exitosamente")
+}
+
+// accionTraslado aplica una transición de estado al traslado indicado en la ruta
+func accionTraslado(c *gin.Context, accion func(id, sucursalID, userID int) error, mensajeError, mensajeExito string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "ID de traslado inválido", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := accion(id, c.GetInt("sucursal_id"), userID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, mensajeError, err)
+		return
+	}
+
+	traslado, err := trasladoService.GetByID(id)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener traslado", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, mensajeExito, traslado)
+}
@@ -1,18 +1,24 @@
 package controllers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"proyecto-bd-final/internal/politica"
 	"proyecto-bd-final/internal/repository"
 	"proyecto-bd-final/internal/services"
 	"proyecto-bd-final/pkg/utils"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 var (
-	authService = services.NewAuthService()
-	userRepo    = repository.NewUserRepository()
-	bitacora    = services.NewBitacoraService()
+	authService         = services.NewAuthService()
+	credencialesService = services.NewCredencialesService()
+	userRepo            = repository.NewUserRepository()
+	bitacora            = services.NewBitacoraService()
 )
 
 // Login maneja el inicio de sesión
@@ -28,7 +34,23 @@ func Login(c *gin.Context) {
 	}
 
 	// Autenticar usuario
-	token, usuario, roles, err := authService.Login(loginData.Correo, loginData.Contrasenia)
+	tokens, usuario, roles, err := authService.Login(loginData.Correo, loginData.Contrasenia, clienteDe(c))
+	var bloqueo *services.BloqueoError
+	if errors.As(err, &bloqueo) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(bloqueo.Hasta).Seconds()))))
+		utils.ErrorResponse(c, http.StatusTooManyRequests, "Acceso bloqueado temporalmente", err)
+		return
+	}
+	var segundoFactor *services.SegundoFactorError
+	if errors.As(err, &segundoFactor) {
+		// Primer paso correcto: falta el código de la aplicación autenticadora
+		utils.SuccessResponse(c, http.StatusOK, "Se requiere el segundo factor", gin.H{
+			"requiere_2fa": true,
+			"token_2fa":    segundoFactor.Token,
+			"expires_in":   int(services.DuracionDesafioDosFactores.Seconds()),
+		})
+		return
+	}
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusUnauthorized, "Credenciales inválidas", err)
 		return
@@ -39,9 +61,47 @@ func Login(c *gin.Context) {
 
 	// Respuesta exitosa
 	utils.SuccessResponse(c, http.StatusOK, "Login exitoso", gin.H{
-		"token":   token,
-		"usuario": usuario,
-		"roles":   roles,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiraEn,
+		"usuario":       usuario,
+		"roles":         roles,
+	})
+}
+
+// LoginSecondFactor completa el inicio de sesión con el código del segundo factor
+func LoginSecondFactor(c *gin.Context) {
+	var codigoData struct {
+		Token  string `json:"token_2fa" binding:"required"`
+		Codigo string `json:"codigo" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&codigoData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	tokens, usuario, roles, err := authService.LoginSegundoFactor(codigoData.Token, codigoData.Codigo, clienteDe(c))
+	var bloqueo *services.BloqueoError
+	if errors.As(err, &bloqueo) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(bloqueo.Hasta).Seconds()))))
+		utils.ErrorResponse(c, http.StatusTooManyRequests, "Acceso bloqueado temporalmente", err)
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Código inválido", err)
+		return
+	}
+
+	// Registrar en bitácora
+	bitacora.RegistrarAccion(usuario.IDUsuario, "LOGIN", "Usuario", "Inicio de sesión exitoso con segundo factor")
+
+	utils.SuccessResponse(c, http.StatusOK, "Login exitoso", gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiraEn,
+		"usuario":       usuario,
+		"roles":         roles,
 	})
 }
 
@@ -51,7 +111,7 @@ func Register(c *gin.Context) {
 		Nombre      string `json:"nombre" binding:"required"`
 		Apellido    string `json:"apellido" binding:"required"`
 		Correo      string `json:"correo" binding:"required,email"`
-		Contrasenia string `json:"contrasenia" binding:"required,min=6"`
+		Contrasenia string `json:"contrasenia" binding:"required"`
 		Telefono    int    `json:"telefono" binding:"required"`
 	}
 
@@ -61,12 +121,13 @@ func Register(c *gin.Context) {
 	}
 
 	// Registrar usuario
-	token, usuario, roles, err := authService.Register(
+	tokens, usuario, roles, err := authService.Register(
 		registerData.Nombre,
 		registerData.Apellido,
 		registerData.Correo,
 		registerData.Contrasenia,
 		registerData.Telefono,
+		clienteDe(c),
 	)
 
 	if err != nil {
@@ -79,12 +140,162 @@ func Register(c *gin.Context) {
 
 	// Respuesta exitosa
 	utils.SuccessResponse(c, http.StatusCreated, "Usuario registrado exitosamente", gin.H{
-		"token":   token,
-		"usuario": usuario,
-		"roles":   roles,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiraEn,
+		"usuario":       usuario,
+		"roles":         roles,
 	})
 }
 
+// RefreshToken renueva el token de acceso canjeando el refresh token, que se
+// reemplaza por uno nuevo
+func RefreshToken(c *gin.Context) {
+	var refreshData struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&refreshData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	tokens, usuario, roles, err := authService.Refresh(refreshData.RefreshToken, clienteDe(c))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "No se pudo renovar la sesión", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Sesión renovada", gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiraEn,
+		"usuario":       usuario,
+		"roles":         roles,
+	})
+}
+
+// Logout cierra la sesión actual y revoca sus tokens
+func Logout(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	if err := authService.Logout(c.GetInt("sesion_id"), userID.(int)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al cerrar sesión", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Sesión cerrada", nil)
+}
+
+// ForgotPassword envía por correo un enlace para restablecer la contraseña
+func ForgotPassword(c *gin.Context) {
+	var forgotData struct {
+		Correo string `json:"correo" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&forgotData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	err := credencialesService.SolicitarRestablecimiento(forgotData.Correo)
+	if err == services.ErrDemasiadasSolicitudes {
+		utils.ErrorResponse(c, http.StatusTooManyRequests, "Demasiadas solicitudes", err)
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error al solicitar restablecimiento", err)
+		return
+	}
+
+	// La respuesta es la misma exista o no la cuenta
+	utils.SuccessResponse(c, http.StatusAccepted,
+		"Si el correo está registrado, recibirás un enlace para restablecer tu contraseña", nil)
+}
+
+// ResetPassword fija una nueva contraseña con el token recibido por correo
+func ResetPassword(c *gin.Context) {
+	var resetData struct {
+		Token       string `json:"token" binding:"required"`
+		Contrasenia string `json:"contrasenia" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&resetData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	if err := credencialesService.Restablecer(resetData.Token, resetData.Contrasenia); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al restablecer contraseña", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Contraseña restablecida, inicia sesión nuevamente", nil)
+}
+
+// GetPasswordPolicy obtiene los requisitos que deben cumplir las contraseñas
+func GetPasswordPolicy(c *gin.Context) {
+	utils.SuccessResponse(c, http.StatusOK, "Política de contraseñas obtenida", politica.Actual())
+}
+
+// ChangePassword cambia la contraseña del usuario actual y cierra sus demás sesiones
+func ChangePassword(c *gin.Context) {
+	var claveData struct {
+		Actual string `json:"contrasenia_actual" binding:"required"`
+		Nueva  string `json:"contrasenia_nueva" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&claveData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	cerradas, err := credencialesService.CambiarClave(userID.(int), c.GetInt("sesion_id"), claveData.Actual, claveData.Nueva)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al cambiar contraseña", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Contraseña cambiada exitosamente", gin.H{
+		"sesiones_cerradas": cerradas,
+	})
+}
+
+// VerifyEmail confirma el correo del usuario con el token recibido
+func VerifyEmail(c *gin.Context) {
+	var verifyData struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&verifyData); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Datos inválidos", err)
+		return
+	}
+
+	if err := credencialesService.Verificar(verifyData.Token); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al verificar correo", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Correo verificado exitosamente", nil)
+}
+
+// ResendVerification reenvía el enlace de verificación al correo del usuario actual
+func ResendVerification(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	err := credencialesService.ReenviarVerificacion(userID.(int))
+	if err == services.ErrDemasiadasSolicitudes {
+		utils.ErrorResponse(c, http.StatusTooManyRequests, "Demasiadas solicitudes", err)
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Error al reenviar verificación", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusAccepted, "Enlace de verificación enviado", nil)
+}
+
 // GetProfile obtiene el perfil del usuario actual
 func GetProfile(c *gin.Context) {
 	userID, exists := c.Get("user_id")
@@ -128,6 +339,17 @@ func GetProfile(c *gin.Context) {
 	})
 }
 
+// GetMyPermissions obtiene los roles y permisos efectivos del usuario actual
+func GetMyPermissions(c *gin.Context) {
+	utils.SuccessResponse(c, http.StatusOK, "Permisos obtenidos", gin.H{
+		"roles":      c.GetStringSlice("roles"),
+		"permisos":   c.GetStringSlice("permisos"),
+		"verificado": c.GetBool("verificado"),
+
+		"dos_factores_pendiente": c.GetBool("dos_factores_pendiente"),
+	})
+}
+
 // UpdateProfile actualiza el perfil del usuario
 func UpdateProfile(c *gin.Context) {
 	userID, exists := c.Get("user_id")
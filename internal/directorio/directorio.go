@@ -0,0 +1,257 @@
+// Package directorio autentica usuarios contra un directorio LDAP o Active
+// Directory mediante bind con sus credenciales
+package directorio
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrCredenciales indica que el directorio rechazó el usuario o la contraseña
+var ErrCredenciales = errors.New("credenciales inválidas")
+
+// Config son los datos de conexión y de búsqueda de usuarios
+type Config struct {
+	URL      string
+	StartTLS bool
+	// Cuenta de servicio para buscar al usuario; vacía para búsqueda anónima
+	BindDN    string
+	BindClave string
+	BaseDN    string
+	// Filtro de búsqueda; %s se reemplaza por el correo escapado
+	Filtro string
+	// Atributos del usuario en el directorio
+	AtributoID     string
+	AtributoGrupos string
+	// Dominios de correo que se autentican contra el directorio
+	Dominios []string
+	// Grupos (DN o CN) y el rol que otorgan
+	GruposRoles       map[string]string
+	RolPredeterminado string
+}
+
+// Identidad son los datos del usuario en el directorio
+type Identidad struct {
+	Sujeto   string
+	Correo   string
+	Nombre   string
+	Apellido string
+	Grupos   []string
+}
+
+// Directorio autentica contra el servidor configurado
+type Directorio struct {
+	config Config
+}
+
+var (
+	once   sync.Once
+	actual *Directorio
+)
+
+// Actual devuelve el directorio configurado con LDAP_URL, LDAP_START_TLS,
+// LDAP_BIND_DN, LDAP_BIND_PASSWORD, LDAP_BASE_DN, LDAP_USER_FILTER,
+// LDAP_ID_ATTRIBUTE, LDAP_GROUP_ATTRIBUTE, LDAP_DOMAINS, LDAP_GROUP_ROLES y
+// LDAP_DEFAULT_ROLE, o nil si no hay directorio
+func Actual() *Directorio {
+	once.Do(func() {
+		config := Config{
+			URL:               os.Getenv("LDAP_URL"),
+			BindDN:            os.Getenv("LDAP_BIND_DN"),
+			BindClave:         os.Getenv("LDAP_BIND_PASSWORD"),
+			BaseDN:            os.Getenv("LDAP_BASE_DN"),
+			Filtro:            os.Getenv("LDAP_USER_FILTER"),
+			AtributoID:        os.Getenv("LDAP_ID_ATTRIBUTE"),
+			AtributoGrupos:    os.Getenv("LDAP_GROUP_ATTRIBUTE"),
+			GruposRoles:       ParsearGruposRoles(os.Getenv("LDAP_GROUP_ROLES")),
+			RolPredeterminado: os.Getenv("LDAP_DEFAULT_ROLE"),
+		}
+		config.StartTLS, _ = strconv.ParseBool(os.Getenv("LDAP_START_TLS"))
+		for _, dominio := range strings.Split(os.Getenv("LDAP_DOMAINS"), ",") {
+			if dominio = strings.ToLower(strings.TrimSpace(dominio)); dominio != "" {
+				config.Dominios = append(config.Dominios, dominio)
+			}
+		}
+
+		if config.URL == "" || config.BaseDN == "" || len(config.Dominios) == 0 {
+			return
+		}
+		actual = Nuevo(config)
+	})
+	return actual
+}
+
+// Nuevo crea un directorio completando los valores predeterminados
+func Nuevo(config Config) *Directorio {
+	if config.Filtro == "" {
+		config.Filtro = "(&(objectClass=person)(mail=%s))"
+	}
+	if config.AtributoID == "" {
+		config.AtributoID = "entryUUID"
+	}
+	if config.AtributoGrupos == "" {
+		config.AtributoGrupos = "memberOf"
+	}
+	if config.RolPredeterminado == "" {
+		config.RolPredeterminado = "estudiante"
+	}
+	return &Directorio{config: config}
+}
+
+// Nombre identifica al directorio en las identidades vinculadas
+func (d *Directorio) Nombre() string {
+	return "ldap"
+}
+
+// RolPredeterminado es el rol de las cuentas creadas al primer ingreso
+func (d *Directorio) RolPredeterminado() string {
+	return d.config.RolPredeterminado
+}
+
+// Aplica indica si el correo pertenece a un dominio del directorio
+func (d *Directorio) Aplica(correo string) bool {
+	i := strings.LastIndex(correo, "@")
+	if i < 0 {
+		return false
+	}
+	dominio := strings.ToLower(correo[i+1:])
+	for _, permitido := range d.config.Dominios {
+		if dominio == permitido || strings.HasSuffix(dominio, "."+permitido) {
+			return true
+		}
+	}
+	return false
+}
+
+// Roles devuelve los roles que otorgan los grupos del usuario
+func (d *Directorio) Roles(identidad *Identidad) []string {
+	var roles []string
+	for _, grupo := range identidad.Grupos {
+		if rol, ok := d.config.GruposRoles[strings.ToLower(grupo)]; ok {
+			roles = append(roles, rol)
+			continue
+		}
+		if rol, ok := d.config.GruposRoles[strings.ToLower(nombreComun(grupo))]; ok {
+			roles = append(roles, rol)
+		}
+	}
+	return roles
+}
+
+// Autenticar busca al usuario por correo y verifica su contraseña con un bind
+// a su DN
+func (d *Directorio) Autenticar(correo, clave string) (*Identidad, error) {
+	// Un bind sin contraseña es anónimo y el servidor lo aceptaría
+	if clave == "" {
+		return nil, ErrCredenciales
+	}
+
+	conn, err := ldap.DialURL(d.config.URL, ldap.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}))
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo conectar al directorio: %v", err)
+	}
+	defer conn.Close()
+	conn.SetTimeout(10 * time.Second)
+
+	if d.config.StartTLS {
+		if err := conn.StartTLS(&tls.Config{ServerName: servidor(d.config.URL)}); err != nil {
+			return nil, fmt.Errorf("no se pudo iniciar TLS con el directorio: %v", err)
+		}
+	}
+
+	if d.config.BindDN != "" {
+		if err := conn.Bind(d.config.BindDN, d.config.BindClave); err != nil {
+			return nil, fmt.Errorf("la cuenta de servicio del directorio fue rechazada: %v", err)
+		}
+	}
+
+	atributos := []string{d.config.AtributoID, "mail", "givenName", "sn", "cn", d.config.AtributoGrupos}
+	busqueda := ldap.NewSearchRequest(
+		d.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 10, false,
+		fmt.Sprintf(d.config.Filtro, ldap.EscapeFilter(correo)),
+		atributos,
+		nil,
+	)
+
+	resultado, err := conn.Search(busqueda)
+	if err != nil {
+		return nil, fmt.Errorf("error al buscar en el directorio: %v", err)
+	}
+	if len(resultado.Entries) != 1 {
+		return nil, ErrCredenciales
+	}
+	entrada := resultado.Entries[0]
+
+	if err := conn.Bind(entrada.DN, clave); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrCredenciales
+		}
+		return nil, fmt.Errorf("error al autenticar en el directorio: %v", err)
+	}
+
+	identidad := &Identidad{
+		Sujeto:   entrada.GetAttributeValue(d.config.AtributoID),
+		Correo:   entrada.GetAttributeValue("mail"),
+		Nombre:   entrada.GetAttributeValue("givenName"),
+		Apellido: entrada.GetAttributeValue("sn"),
+		Grupos:   entrada.GetAttributeValues(d.config.AtributoGrupos),
+	}
+
+	// Sin identificador estable se usa el DN
+	if identidad.Sujeto == "" {
+		identidad.Sujeto = entrada.DN
+	}
+	if identidad.Correo == "" {
+		identidad.Correo = correo
+	}
+	if identidad.Nombre == "" {
+		identidad.Nombre = entrada.GetAttributeValue("cn")
+	}
+
+	return identidad, nil
+}
+
+// ParsearGruposRoles lee pares grupo:rol separados por punto y coma; el grupo
+// puede ser el DN completo o solo su CN, por ejemplo
+// "cn=biblioteca-staff,ou=grupos,dc=uni,dc=edu:personal;docentes:profesor"
+func ParsearGruposRoles(texto string) map[string]string {
+	grupos := make(map[string]string)
+	for _, parte := range strings.Split(texto, ";") {
+		i := strings.LastIndex(parte, ":")
+		if i <= 0 || i == len(parte)-1 {
+			continue
+		}
+		grupos[strings.ToLower(strings.TrimSpace(parte[:i]))] = strings.TrimSpace(parte[i+1:])
+	}
+	return grupos
+}
+
+// nombreComun extrae el CN de un DN de grupo
+func nombreComun(dn string) string {
+	primero := strings.SplitN(dn, ",", 2)[0]
+	if i := strings.Index(primero, "="); i >= 0 && strings.EqualFold(strings.TrimSpace(primero[:i]), "cn") {
+		return strings.TrimSpace(primero[i+1:])
+	}
+	return dn
+}
+
+// servidor extrae el nombre del host de la URL del directorio
+func servidor(direccion string) string {
+	if i := strings.Index(direccion, "://"); i >= 0 {
+		direccion = direccion[i+3:]
+	}
+	if host, _, err := net.SplitHostPort(direccion); err == nil {
+		return host
+	}
+	return direccion
+}
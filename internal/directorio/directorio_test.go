@@ -0,0 +1,140 @@
+package directorio
+
+import (
+	"errors"
+	"proyecto-bd-final/internal/directorio/prueba"
+	"reflect"
+	"testing"
+)
+
+func nuevoPrueba(t *testing.T, config Config) (*Directorio, *prueba.Servidor) {
+	t.Helper()
+
+	srv, err := prueba.Iniciar("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Cerrar() })
+
+	config.URL = srv.URL()
+	config.BindDN = "cn=servicio,dc=uni,dc=edu"
+	config.BindClave = "servicio"
+	config.BaseDN = "ou=personas,dc=uni,dc=edu"
+	config.Dominios = []string{"uni.edu"}
+	return Nuevo(config), srv
+}
+
+func TestAutenticar(t *testing.T) {
+	d, _ := nuevoPrueba(t, Config{})
+
+	identidad, err := d.Autenticar("carlos.ruiz@uni.edu", "Campus2024")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	esperada := &Identidad{
+		Sujeto:   "5d1b6a52-2c1e-4b0e-9c4d-7a1f0b0a0001",
+		Correo:   "carlos.ruiz@uni.edu",
+		Nombre:   "Carlos",
+		Apellido: "Ruiz",
+		Grupos:   []string{"cn=biblioteca-staff,ou=grupos,dc=uni,dc=edu"},
+	}
+	if !reflect.DeepEqual(identidad, esperada) {
+		t.Errorf("identidad = %+v, se esperaba %+v", identidad, esperada)
+	}
+}
+
+func TestAutenticarClaveIncorrecta(t *testing.T) {
+	d, _ := nuevoPrueba(t, Config{})
+
+	if _, err := d.Autenticar("carlos.ruiz@uni.edu", "otra-clave"); !errors.Is(err, ErrCredenciales) {
+		t.Errorf("error = %v, se esperaba ErrCredenciales", err)
+	}
+	if _, err := d.Autenticar("nadie@uni.edu", "Campus2024"); !errors.Is(err, ErrCredenciales) {
+		t.Errorf("usuario inexistente: error = %v, se esperaba ErrCredenciales", err)
+	}
+}
+
+func TestAutenticarClaveVacia(t *testing.T) {
+	d, srv := nuevoPrueba(t, Config{})
+
+	// El servidor aceptaría el bind anónimo; se rechaza antes de conectarse
+	if _, err := d.Autenticar("carlos.ruiz@uni.edu", ""); !errors.Is(err, ErrCredenciales) {
+		t.Errorf("error = %v, se esperaba ErrCredenciales", err)
+	}
+	if comparaciones := srv.Comparaciones(); len(comparaciones) != 0 {
+		t.Errorf("no debería haber buscado en el directorio: %v", comparaciones)
+	}
+}
+
+func TestAutenticarEscapaFiltro(t *testing.T) {
+	d, srv := nuevoPrueba(t, Config{})
+
+	// Sin escapar, el filtro sería (&(objectClass=person)(mail=*)(uid=cruiz))
+	// y encontraría a Carlos con su contraseña
+	correo := "*)(uid=cruiz"
+	if _, err := d.Autenticar(correo, "Campus2024"); !errors.Is(err, ErrCredenciales) {
+		t.Fatalf("error = %v, se esperaba ErrCredenciales", err)
+	}
+
+	esperadas := []string{"objectClass=person", "mail=" + correo}
+	if comparaciones := srv.Comparaciones(); !reflect.DeepEqual(comparaciones, esperadas) {
+		t.Errorf("comparaciones = %q, se esperaba %q", comparaciones, esperadas)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	d, _ := nuevoPrueba(t, Config{
+		GruposRoles: ParsearGruposRoles("CN=Biblioteca-Staff,OU=Grupos,DC=uni,DC=edu:personal; docentes:profesor;sin-rol:;:nada"),
+	})
+
+	casos := []struct {
+		correo string
+		roles  []string
+	}{
+		{"carlos.ruiz@uni.edu", []string{"personal"}},
+		{"maria.lopez@uni.edu", []string{"profesor"}},
+	}
+	for _, caso := range casos {
+		identidad, err := d.Autenticar(caso.correo, "Campus2024")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if roles := d.Roles(identidad); !reflect.DeepEqual(roles, caso.roles) {
+			t.Errorf("%s: roles = %v, se esperaba %v", caso.correo, roles, caso.roles)
+		}
+	}
+
+	if roles := d.Roles(&Identidad{Grupos: []string{"cn=otros,ou=grupos,dc=uni,dc=edu"}}); len(roles) != 0 {
+		t.Errorf("un grupo sin mapeo no debería otorgar roles: %v", roles)
+	}
+}
+
+func TestParsearGruposRoles(t *testing.T) {
+	grupos := ParsearGruposRoles("CN=Biblioteca-Staff,OU=Grupos,DC=uni,DC=edu:personal; docentes:profesor;sin-rol:;:nada")
+	esperados := map[string]string{
+		"cn=biblioteca-staff,ou=grupos,dc=uni,dc=edu": "personal",
+		"docentes": "profesor",
+	}
+	if !reflect.DeepEqual(grupos, esperados) {
+		t.Errorf("grupos = %v, se esperaba %v", grupos, esperados)
+	}
+}
+
+func TestAplica(t *testing.T) {
+	d := Nuevo(Config{Dominios: []string{"uni.edu"}})
+
+	casos := map[string]bool{
+		"ana@uni.edu":         true,
+		"ana@UNI.EDU":         true,
+		"ana@alumnos.uni.edu": true,
+		"ana@otrauni.edu":     false,
+		"ana@uni.edu.ar":      false,
+		"sin-arroba":          false,
+	}
+	for correo, esperado := range casos {
+		if d.Aplica(correo) != esperado {
+			t.Errorf("Aplica(%q) = %v, se esperaba %v", correo, !esperado, esperado)
+		}
+	}
+}
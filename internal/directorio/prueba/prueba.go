@@ -0,0 +1,275 @@
+// Package prueba es un directorio LDAP de prueba para el inicio de sesión con
+// cuentas del campus. Atiende bind simple y búsquedas con filtros de igualdad,
+// presencia, and, or y not sobre un conjunto fijo de usuarios; no admite TLS.
+//
+// Usuarios: carlos.ruiz@uni.edu / Campus2024 (biblioteca-staff) y
+// maria.lopez@uni.edu / Campus2024 (docentes). La cuenta de servicio es
+// cn=servicio,dc=uni,dc=edu / servicio y la base ou=personas,dc=uni,dc=edu
+package prueba
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// Operaciones LDAP (RFC 4511)
+const (
+	opBindRequest       = 0
+	opBindResponse      = 1
+	opUnbindRequest     = 2
+	opSearchRequest     = 3
+	opSearchResultEntry = 4
+	opSearchResultDone  = 5
+	opExtendedRequest   = 23
+	opExtendedResponse  = 24
+)
+
+// Códigos de resultado
+const (
+	resultadoExito              = 0
+	resultadoErrorProtocolo     = 2
+	resultadoCredencialesMalas  = 49
+	resultadoOperacionNoSoporta = 53
+)
+
+type entrada struct {
+	dn        string
+	clave     string
+	atributos map[string][]string
+}
+
+var entradas = []entrada{
+	{
+		dn:    "cn=servicio,dc=uni,dc=edu",
+		clave: "servicio",
+	},
+	{
+		dn:    "uid=cruiz,ou=personas,dc=uni,dc=edu",
+		clave: "Campus2024",
+		atributos: map[string][]string{
+			"objectclass": {"person", "inetOrgPerson"},
+			"entryuuid":   {"5d1b6a52-2c1e-4b0e-9c4d-7a1f0b0a0001"},
+			"uid":         {"cruiz"},
+			"mail":        {"carlos.ruiz@uni.edu"},
+			"givenname":   {"Carlos"},
+			"sn":          {"Ruiz"},
+			"cn":          {"Carlos Ruiz"},
+			"memberof":    {"cn=biblioteca-staff,ou=grupos,dc=uni,dc=edu"},
+		},
+	},
+	{
+		dn:    "uid=mlopez,ou=personas,dc=uni,dc=edu",
+		clave: "Campus2024",
+		atributos: map[string][]string{
+			"objectclass": {"person", "inetOrgPerson"},
+			"entryuuid":   {"5d1b6a52-2c1e-4b0e-9c4d-7a1f0b0a0002"},
+			"uid":         {"mlopez"},
+			"mail":        {"maria.lopez@uni.edu"},
+			"givenname":   {"María"},
+			"sn":          {"López"},
+			"cn":          {"María López"},
+			"memberof":    {"cn=docentes,ou=grupos,dc=uni,dc=edu"},
+		},
+	},
+}
+
+// Servidor es un directorio de prueba escuchando en una dirección TCP
+type Servidor struct {
+	escucha net.Listener
+
+	mu            sync.Mutex
+	comparaciones []string
+}
+
+// Iniciar abre la dirección, por ejemplo "127.0.0.1:0", y atiende conexiones
+// hasta que se llame a Cerrar
+func Iniciar(direccion string) (*Servidor, error) {
+	escucha, err := net.Listen("tcp", direccion)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Servidor{escucha: escucha}
+	go func() {
+		for {
+			conn, err := escucha.Accept()
+			if err != nil {
+				return
+			}
+			go s.atender(conn)
+		}
+	}()
+	return s, nil
+}
+
+// URL es la dirección ldap:// del servidor
+func (s *Servidor) URL() string {
+	return "ldap://" + s.escucha.Addr().String()
+}
+
+// Cerrar deja de aceptar conexiones
+func (s *Servidor) Cerrar() error {
+	return s.escucha.Close()
+}
+
+// Comparaciones devuelve los filtros de igualdad recibidos como atributo=valor,
+// con el valor ya sin escapar
+func (s *Servidor) Comparaciones() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.comparaciones...)
+}
+
+func (s *Servidor) atender(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		paquete, err := ber.ReadPacket(conn)
+		if err != nil || len(paquete.Children) < 2 {
+			return
+		}
+
+		id := paquete.Children[0].Value.(int64)
+		operacion := paquete.Children[1]
+
+		switch operacion.Tag {
+		case opBindRequest:
+			responder(conn, id, resultado(opBindResponse, bind(operacion), ""))
+		case opSearchRequest:
+			for _, e := range s.buscar(operacion) {
+				responder(conn, id, e)
+			}
+			responder(conn, id, resultado(opSearchResultDone, resultadoExito, ""))
+		case opExtendedRequest:
+			responder(conn, id, resultado(opExtendedResponse, resultadoErrorProtocolo, "operación extendida no soportada"))
+		case opUnbindRequest:
+			return
+		default:
+			responder(conn, id, resultado(operacion.Tag+1, resultadoOperacionNoSoporta, "operación no soportada"))
+		}
+	}
+}
+
+// bind verifica la contraseña del DN; sin contraseña es un bind anónimo
+func bind(operacion *ber.Packet) int {
+	dn := operacion.Children[1].Data.String()
+	clave := operacion.Children[2].Data.String()
+	if dn == "" && clave == "" {
+		return resultadoExito
+	}
+
+	for _, e := range entradas {
+		if strings.EqualFold(e.dn, dn) && e.clave != "" && e.clave == clave {
+			return resultadoExito
+		}
+	}
+	return resultadoCredencialesMalas
+}
+
+func (s *Servidor) buscar(operacion *ber.Packet) []*ber.Packet {
+	base := strings.ToLower(operacion.Children[0].Data.String())
+	filtro := operacion.Children[6]
+	s.registrar(filtro)
+
+	var pedidos []string
+	for _, atributo := range operacion.Children[7].Children {
+		pedidos = append(pedidos, atributo.Data.String())
+	}
+
+	var resultados []*ber.Packet
+	for _, e := range entradas {
+		if e.atributos == nil || !strings.HasSuffix(strings.ToLower(e.dn), base) || !cumple(e, filtro) {
+			continue
+		}
+
+		respuesta := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opSearchResultEntry, nil, "SearchResultEntry")
+		respuesta.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "DN"))
+
+		atributos := ber.NewSequence("Atributos")
+		for _, nombre := range pedidos {
+			valores, ok := e.atributos[strings.ToLower(nombre)]
+			if !ok {
+				continue
+			}
+			atributo := ber.NewSequence("Atributo")
+			atributo.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, nombre, "Tipo"))
+			conjunto := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Valores")
+			for _, v := range valores {
+				conjunto.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Valor"))
+			}
+			atributo.AppendChild(conjunto)
+			atributos.AppendChild(atributo)
+		}
+		respuesta.AppendChild(atributos)
+		resultados = append(resultados, respuesta)
+	}
+	return resultados
+}
+
+// registrar guarda las comparaciones de igualdad del filtro
+func (s *Servidor) registrar(filtro *ber.Packet) {
+	switch filtro.Tag {
+	case 0, 1, 2:
+		for _, hijo := range filtro.Children {
+			s.registrar(hijo)
+		}
+	case 3:
+		s.mu.Lock()
+		s.comparaciones = append(s.comparaciones,
+			filtro.Children[0].Data.String()+"="+filtro.Children[1].Data.String())
+		s.mu.Unlock()
+	}
+}
+
+// cumple evalúa los filtros and (0), or (1), not (2), igualdad (3) y presencia (7)
+func cumple(e entrada, filtro *ber.Packet) bool {
+	switch filtro.Tag {
+	case 0:
+		for _, hijo := range filtro.Children {
+			if !cumple(e, hijo) {
+				return false
+			}
+		}
+		return true
+	case 1:
+		for _, hijo := range filtro.Children {
+			if cumple(e, hijo) {
+				return true
+			}
+		}
+		return false
+	case 2:
+		return len(filtro.Children) == 1 && !cumple(e, filtro.Children[0])
+	case 3:
+		atributo := strings.ToLower(filtro.Children[0].Data.String())
+		valor := filtro.Children[1].Data.String()
+		for _, v := range e.atributos[atributo] {
+			if strings.EqualFold(v, valor) {
+				return true
+			}
+		}
+		return false
+	case 7:
+		_, ok := e.atributos[strings.ToLower(filtro.Data.String())]
+		return ok
+	}
+	return false
+}
+
+func resultado(operacion ber.Tag, codigo int, mensaje string) *ber.Packet {
+	respuesta := ber.Encode(ber.ClassApplication, ber.TypeConstructed, operacion, nil, "Resultado")
+	respuesta.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, codigo, "Código"))
+	respuesta.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "DN"))
+	respuesta.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, mensaje, "Mensaje"))
+	return respuesta
+}
+
+func responder(conn net.Conn, id int64, operacion *ber.Packet) {
+	mensaje := ber.NewSequence("LDAPMessage")
+	mensaje.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "ID"))
+	mensaje.AppendChild(operacion)
+	conn.Write(mensaje.Bytes())
+}
@@ -0,0 +1,118 @@
+package labels
+
+import (
+	"errors"
+	"strings"
+)
+
+// patronesCode128 contiene el ancho de cada barra y espacio (alternados,
+// empezando por barra) de los 106 símbolos de Code 128 más el de parada, que
+// ya incluye la barra final de terminación
+var patronesCode128 = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+// Símbolos especiales de Code 128
+const (
+	code128CambioC = 99
+	code128CambioB = 100
+	code128InicioB = 104
+	code128InicioC = 105
+	code128Parada  = 106
+)
+
+// Code128 codifica el texto (ASCII imprimible) como código de barras Code 128
+// y devuelve los módulos de izquierda a derecha (true = barra), sin zona de
+// silencio. Las secuencias de cuatro o más dígitos usan el juego C, que
+// codifica dos dígitos por símbolo
+func Code128(texto string) ([]bool, error) {
+	if texto == "" {
+		return nil, errors.New("no se puede codificar un texto vacío")
+	}
+	for i := 0; i < len(texto); i++ {
+		if texto[i] < 32 || texto[i] > 126 {
+			return nil, errors.New("Code 128 solo admite caracteres ASCII imprimibles")
+		}
+	}
+
+	var simbolos []int
+	juegoC := false
+	for i := 0; i < len(texto); {
+		digitos := contarDigitos(texto[i:])
+		// El juego C conviene al inicio/fin con 4 dígitos o en medio con 6
+		usarC := digitos >= 4 && (i == 0 || i+digitos == len(texto) || digitos >= 6)
+
+		switch {
+		case usarC:
+			// Con cantidad impar de dígitos, el primero va en el juego B
+			if digitos%2 == 1 {
+				if len(simbolos) == 0 {
+					simbolos = append(simbolos, code128InicioB)
+				} else if juegoC {
+					simbolos = append(simbolos, code128CambioB)
+				}
+				juegoC = false
+				simbolos = append(simbolos, int(texto[i])-32)
+				i++
+				digitos--
+			}
+			if len(simbolos) == 0 {
+				simbolos = append(simbolos, code128InicioC)
+			} else if !juegoC {
+				simbolos = append(simbolos, code128CambioC)
+			}
+			juegoC = true
+			for j := 0; j < digitos; j += 2 {
+				simbolos = append(simbolos, int(texto[i]-'0')*10+int(texto[i+1]-'0'))
+				i += 2
+			}
+		default:
+			if len(simbolos) == 0 {
+				simbolos = append(simbolos, code128InicioB)
+			} else if juegoC {
+				simbolos = append(simbolos, code128CambioB)
+			}
+			juegoC = false
+			simbolos = append(simbolos, int(texto[i])-32)
+			i++
+		}
+	}
+
+	// Dígito de control: inicio + suma ponderada por posición, módulo 103
+	suma := simbolos[0]
+	for i := 1; i < len(simbolos); i++ {
+		suma += simbolos[i] * i
+	}
+	simbolos = append(simbolos, suma%103, code128Parada)
+
+	var modulos []bool
+	for _, s := range simbolos {
+		for j, ancho := range patronesCode128[s] {
+			barra := j%2 == 0
+			for k := 0; k < int(ancho-'0'); k++ {
+				modulos = append(modulos, barra)
+			}
+		}
+	}
+
+	return modulos, nil
+}
+
+// contarDigitos cuenta los dígitos consecutivos al inicio del texto
+func contarDigitos(texto string) int {
+	n := strings.IndexFunc(texto, func(r rune) bool { return r < '0' || r > '9' })
+	if n < 0 {
+		return len(texto)
+	}
+	return n
+}
@@ -0,0 +1,150 @@
+package labels
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// simbolosCode128 vuelve a leer los valores de los símbolos a partir de los
+// módulos, buscando cada patrón de anchos en la tabla
+func simbolosCode128(t *testing.T, modulos []bool) []int {
+	t.Helper()
+
+	var anchos []byte
+	for i := 0; i < len(modulos); {
+		j := i
+		for j < len(modulos) && modulos[j] == modulos[i] {
+			j++
+		}
+		anchos = append(anchos, byte('0'+j-i))
+		i = j
+	}
+
+	var simbolos []int
+	for i := 0; i < len(anchos); i += 6 {
+		// La parada es el único patrón de siete anchos
+		largo := min(6, len(anchos)-i)
+		if len(anchos)-i == 7 {
+			largo = 7
+		}
+		patron := string(anchos[i : i+largo])
+		valor := -1
+		for v, p := range patronesCode128 {
+			if p == patron {
+				valor = v
+			}
+		}
+		if valor < 0 {
+			t.Fatalf("patrón desconocido %s en la posición %d", patron, i)
+		}
+		simbolos = append(simbolos, valor)
+		if valor == code128Parada {
+			break
+		}
+	}
+	return simbolos
+}
+
+func bitsModulos(modulos []bool) string {
+	var b strings.Builder
+	for _, m := range modulos {
+		if m {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+	return b.String()
+}
+
+func TestPatronesCode128(t *testing.T) {
+	vistos := map[string]bool{}
+	for valor, patron := range patronesCode128 {
+		if vistos[patron] {
+			t.Errorf("patrón %s repetido", patron)
+		}
+		vistos[patron] = true
+
+		// Cada símbolo ocupa 11 módulos (la parada 13) y sus barras suman
+		// una cantidad par, lo que permite a los lectores detectar errores
+		total, barras := 0, 0
+		for i, ancho := range patron {
+			total += int(ancho - '0')
+			if i%2 == 0 {
+				barras += int(ancho - '0')
+			}
+		}
+		esperado := 11
+		if valor == code128Parada {
+			esperado = 13
+		}
+		if total != esperado || barras%2 != 0 {
+			t.Errorf("símbolo %d (%s): %d módulos, %d de barra", valor, patron, total, barras)
+		}
+	}
+}
+
+func TestCode128(t *testing.T) {
+	// Valores calculados a mano: inicio, datos, control (inicio + suma
+	// ponderada, módulo 103) y parada. Todos se verificaron además con un
+	// lector Code 128 independiente
+	casos := []struct {
+		nombre   string
+		texto    string
+		simbolos []int
+	}{
+		{"juego B", "Wikipedia", []int{104, 55, 73, 75, 73, 80, 69, 68, 73, 65, 88, 106}},
+		{"código de ejemplar", "00000123", []int{105, 0, 0, 1, 23, 97, 106}},
+		{"dígitos pares", "12345678", []int{105, 12, 34, 56, 78, 47, 106}},
+		{"dígitos impares", "12345", []int{104, 17, 99, 23, 45, 53, 106}},
+		{"dígitos al final", "LIB-000123", []int{104, 44, 41, 34, 13, 99, 0, 1, 23, 40, 106}},
+		{"seis dígitos en medio", "a123456b", []int{104, 65, 99, 12, 34, 56, 100, 66, 27, 106}},
+		{"cuatro dígitos en medio", "ab1234cd", []int{104, 65, 66, 17, 18, 19, 20, 67, 68, 4, 106}},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			modulos, err := Code128(caso.texto)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(modulos) != 11*(len(caso.simbolos)-1)+13 {
+				t.Errorf("%d módulos para %d símbolos", len(modulos), len(caso.simbolos))
+			}
+			if simbolos := simbolosCode128(t, modulos); !reflect.DeepEqual(simbolos, caso.simbolos) {
+				t.Errorf("símbolos = %v, se esperaba %v", simbolos, caso.simbolos)
+			}
+		})
+	}
+}
+
+func TestCode128InicioParada(t *testing.T) {
+	// Patrones de inicio B, inicio C y parada según la norma
+	casos := []struct {
+		texto  string
+		inicio string
+	}{
+		{"Wikipedia", "11010010000"},
+		{"00000123", "11010011100"},
+	}
+
+	for _, caso := range casos {
+		modulos, err := Code128(caso.texto)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bits := bitsModulos(modulos)
+		if !strings.HasPrefix(bits, caso.inicio) || !strings.HasSuffix(bits, "1100011101011") {
+			t.Errorf("%s: %s", caso.texto, bits)
+		}
+	}
+}
+
+func TestCode128Invalido(t *testing.T) {
+	for _, texto := range []string{"", "año", "línea\n"} {
+		if _, err := Code128(texto); err == nil {
+			t.Errorf("se esperaba un error al codificar %q", texto)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package labels
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// puntosPorMM convierte milímetros a puntos PDF (1/72 de pulgada)
+const puntosPorMM = 72 / 25.4
+
+// Fuentes estándar de PDF, disponibles en cualquier visor sin incrustarlas
+const (
+	fuenteNormal  = "F1"
+	fuenteNegrita = "F2"
+)
+
+// documentoPDF arma un PDF mínimo con páginas del mismo tamaño y las fuentes
+// Helvetica estándar
+type documentoPDF struct {
+	ancho, alto float64
+	paginas     []*paginaPDF
+}
+
+// paginaPDF acumula los operadores de dibujo de una página. Las coordenadas se
+// expresan en puntos con origen en la esquina superior izquierda
+type paginaPDF struct {
+	alto      float64
+	contenido bytes.Buffer
+}
+
+func nuevoDocumentoPDF(ancho, alto float64) *documentoPDF {
+	return &documentoPDF{ancho: ancho, alto: alto}
+}
+
+func (d *documentoPDF) nuevaPagina() *paginaPDF {
+	p := &paginaPDF{alto: d.alto}
+	d.paginas = append(d.paginas, p)
+	return p
+}
+
+// rectangulo rellena un rectángulo negro; se acumulan y se pintan con rellenar
+func (p *paginaPDF) rectangulo(x, y, ancho, alto float64) {
+	fmt.Fprintf(&p.contenido, "%.3f %.3f %.3f %.3f re\n", x, p.alto-y-alto, ancho, alto)
+}
+
+func (p *paginaPDF) rellenar() {
+	p.contenido.WriteString("f\n")
+}
+
+// borde dibuja el contorno gris de un rectángulo
+func (p *paginaPDF) borde(x, y, ancho, alto float64) {
+	fmt.Fprintf(&p.contenido, "q 0.75 G 0.3 w %.3f %.3f %.3f %.3f re S Q\n", x, p.alto-y-alto, ancho, alto)
+}
+
+// texto escribe una línea cuya línea base está en y
+func (p *paginaPDF) texto(x, y, tamanio float64, fuente, texto string) {
+	fmt.Fprintf(&p.contenido, "BT /%s %.2f Tf %.3f %.3f Td (%s) Tj ET\n",
+		fuente, tamanio, x, p.alto-y, escaparTextoPDF(texto))
+}
+
+// escribir genera el archivo PDF completo
+func (d *documentoPDF) escribir(w io.Writer) error {
+	var salida bytes.Buffer
+	var offsets []int
+
+	objeto := func(contenido string) {
+		offsets = append(offsets, salida.Len())
+		fmt.Fprintf(&salida, "%d 0 obj\n%s\nendobj\n", len(offsets), contenido)
+	}
+
+	salida.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1: catálogo, 2: árbol de páginas, 3 y 4: fuentes, luego página y
+	// contenido de cada página
+	kids := make([]string, len(d.paginas))
+	for i := range d.paginas {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	objeto("<< /Type /Catalog /Pages 2 0 R >>")
+	objeto(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.paginas)))
+	objeto("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	objeto("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, pagina := range d.paginas {
+		objeto(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.3f %.3f] "+
+			"/Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			d.ancho, d.alto, fuenteNormal, fuenteNegrita, 6+2*i))
+
+		var comprimido bytes.Buffer
+		zw := zlib.NewWriter(&comprimido)
+		if _, err := zw.Write(pagina.contenido.Bytes()); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		objeto(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream",
+			comprimido.Len(), comprimido.Bytes()))
+	}
+
+	inicioXref := salida.Len()
+	fmt.Fprintf(&salida, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&salida, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&salida, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, inicioXref)
+
+	_, err := w.Write(salida.Bytes())
+	return err
+}
+
+// escaparTextoPDF convierte el texto a WinAnsi y escapa los caracteres
+// especiales de las cadenas PDF
+func escaparTextoPDF(texto string) string {
+	var b strings.Builder
+	for _, r := range texto {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 0xA0 && r <= 0xFF:
+			// Latin-1 coincide con WinAnsi en este rango
+			fmt.Fprintf(&b, "\\%03o", r)
+		case r == '–' || r == '—':
+			b.WriteByte('-')
+		case r == '‘' || r == '’':
+			b.WriteByte('\'')
+		case r == '“' || r == '”':
+			b.WriteByte('"')
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// anchoTexto estima el ancho en puntos de un texto en Helvetica; alcanza para
+// recortar y centrar sin incluir la tabla de métricas completa
+func anchoTexto(texto string, tamanio float64) float64 {
+	total := 0.0
+	for _, r := range texto {
+		switch {
+		case r >= '0' && r <= '9':
+			total += 0.556
+		case r == ' ' || r == '.' || r == ',' || r == ':' || r == 'i' || r == 'l' || r == 'I':
+			total += 0.278
+		case r == 'm' || r == 'w' || r == 'M' || r == 'W':
+			total += 0.833
+		case r >= 'A' && r <= 'Z':
+			total += 0.667
+		default:
+			total += 0.556
+		}
+	}
+	return total * tamanio
+}
+
+// recortarTexto acorta el texto con puntos suspensivos hasta que entre en el ancho
+func recortarTexto(texto string, tamanio, ancho float64) string {
+	if anchoTexto(texto, tamanio) <= ancho {
+		return texto
+	}
+	runas := []rune(texto)
+	for len(runas) > 0 && anchoTexto(string(runas)+"...", tamanio) > ancho {
+		runas = runas[:len(runas)-1]
+	}
+	return strings.TrimSpace(string(runas)) + "..."
+}
+
+// partirTexto distribuye el texto en líneas que entren en el ancho; la última
+// línea se recorta si sobra texto
+func partirTexto(texto string, tamanio, ancho float64, maxLineas int) []string {
+	var lineas []string
+	actual := ""
+	palabras := strings.Fields(texto)
+	for i, palabra := range palabras {
+		candidata := strings.TrimSpace(actual + " " + palabra)
+		if actual == "" || anchoTexto(candidata, tamanio) <= ancho {
+			actual = candidata
+			continue
+		}
+		if len(lineas) == maxLineas-1 {
+			return append(lineas, recortarTexto(strings.Join(append([]string{actual}, palabras[i:]...), " "), tamanio, ancho))
+		}
+		lineas = append(lineas, recortarTexto(actual, tamanio, ancho))
+		actual = palabra
+	}
+	if actual != "" {
+		lineas = append(lineas, recortarTexto(actual, tamanio, ancho))
+	}
+	return lineas
+}
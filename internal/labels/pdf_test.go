@@ -0,0 +1,178 @@
+package labels
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	objetoPDF    = regexp.MustCompile(`(\d+) 0 obj\n<< /Length (\d+) /Filter /FlateDecode >>\nstream\n`)
+	startxrefPDF = regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`)
+)
+
+// verificarPDF comprueba la estructura del archivo: la tabla xref apunta a cada
+// objeto, startxref a la tabla y los streams tienen el largo declarado.
+// Devuelve el contenido descomprimido de las páginas
+func verificarPDF(t *testing.T, pdf []byte) []string {
+	t.Helper()
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) {
+		t.Fatal("falta el encabezado %PDF-1.4")
+	}
+
+	m := startxrefPDF.FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("falta startxref al final del archivo")
+	}
+	inicioXref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(pdf[inicioXref:], []byte("xref\n0 ")) {
+		t.Fatalf("startxref %d no apunta a la tabla xref", inicioXref)
+	}
+
+	lineas := strings.Split(string(pdf[inicioXref:]), "\n")
+	cantidad, _ := strconv.Atoi(strings.Fields(lineas[1])[1])
+	if !strings.Contains(string(pdf), "/Size "+strconv.Itoa(cantidad)+" ") {
+		t.Errorf("el trailer no declara /Size %d", cantidad)
+	}
+	for i := 1; i < cantidad; i++ {
+		entrada := lineas[2+i]
+		if len(entrada) != 19 || !strings.HasSuffix(entrada, " 00000 n ") {
+			t.Fatalf("entrada xref %d mal formada: %q", i, entrada)
+		}
+		offset, _ := strconv.Atoi(entrada[:10])
+		if !bytes.HasPrefix(pdf[offset:], []byte(strconv.Itoa(i)+" 0 obj\n")) {
+			t.Errorf("la entrada xref %d no apunta al objeto %d", i, i)
+		}
+	}
+
+	var contenidos []string
+	for _, indices := range objetoPDF.FindAllSubmatchIndex(pdf, -1) {
+		largo, _ := strconv.Atoi(string(pdf[indices[4]:indices[5]]))
+		inicio := indices[1]
+		if !bytes.HasPrefix(pdf[inicio+largo:], []byte("\nendstream")) {
+			t.Fatalf("el stream del objeto %s no mide %d bytes", pdf[indices[2]:indices[3]], largo)
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(pdf[inicio : inicio+largo]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contenido, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contenidos = append(contenidos, string(contenido))
+	}
+	return contenidos
+}
+
+func TestGenerarPDF(t *testing.T) {
+	plantilla, _ := BuscarPlantilla(PlantillaPredeterminada)
+	etiquetas := []Etiqueta{
+		{Codigo: 123, Titulo: "Cien años de soledad (edición conmemorativa)", Signatura: "863 GAR", Sucursal: "Central"},
+		{Codigo: 4567, Titulo: "Rayuela"},
+	}
+
+	casos := []struct {
+		nombre   string
+		formato  string
+		posicion int
+		paginas  int
+		detalle  string
+	}{
+		{"code128", FormatoCode128, 1, 1, "(00000123) Tj"},
+		{"qr", FormatoQR, 1, 1, "(00000123) Tj"},
+		// Desde la última posición de la hoja, la segunda etiqueta pasa a otra página
+		{"ambos en hoja empezada", FormatoAmbos, 30, 2, "(00000123  863 GAR) Tj"},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			var salida bytes.Buffer
+			err := GenerarPDF(&salida, etiquetas, Opciones{
+				Formato: caso.formato, Plantilla: plantilla, PosicionInicial: caso.posicion, Bordes: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			contenidos := verificarPDF(t, salida.Bytes())
+			if len(contenidos) != caso.paginas || !strings.Contains(salida.String(), "/Count "+strconv.Itoa(caso.paginas)+" ") {
+				t.Fatalf("%d páginas, se esperaban %d", len(contenidos), caso.paginas)
+			}
+			todo := strings.Join(contenidos, "")
+			for _, texto := range []string{caso.detalle, " re\nf\n", "0.75 G"} {
+				if !strings.Contains(todo, texto) {
+					t.Errorf("el contenido no incluye %q", texto)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerarPDFInvalido(t *testing.T) {
+	plantilla, _ := BuscarPlantilla(PlantillaPredeterminada)
+	etiquetas := []Etiqueta{{Codigo: 1}}
+
+	casos := []struct {
+		nombre string
+		op     Opciones
+	}{
+		{"formato desconocido", Opciones{Formato: "ean13", Plantilla: plantilla, PosicionInicial: 1}},
+		{"posición cero", Opciones{Formato: FormatoQR, Plantilla: plantilla}},
+		{"posición fuera de la hoja", Opciones{Formato: FormatoQR, Plantilla: plantilla, PosicionInicial: 31}},
+		{"plantilla vacía", Opciones{Formato: FormatoQR, PosicionInicial: 1}},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			var salida bytes.Buffer
+			if err := GenerarPDF(&salida, etiquetas, caso.op); err == nil {
+				t.Error("se esperaba un error")
+			}
+			if salida.Len() != 0 {
+				t.Error("no se debería escribir nada ante un error")
+			}
+		})
+	}
+}
+
+func TestEscaparTextoPDF(t *testing.T) {
+	casos := []struct {
+		texto    string
+		esperado string
+	}{
+		{"Rayuela", "Rayuela"},
+		{`(a) \ b`, `\(a\) \\ b`},
+		{"Año", `A\361o`},
+		{"Ñandú «x»", `\321and\372 \253x\273`},
+		{"“Ficciones” – Borges", `"Ficciones" - Borges`},
+		{"日本", "??"},
+	}
+
+	for _, caso := range casos {
+		if obtenido := escaparTextoPDF(caso.texto); obtenido != caso.esperado {
+			t.Errorf("escaparTextoPDF(%q) = %q, se esperaba %q", caso.texto, obtenido, caso.esperado)
+		}
+	}
+}
+
+func TestPartirTexto(t *testing.T) {
+	lineas := partirTexto("El ingenioso hidalgo don Quijote de la Mancha", 10, 80, 2)
+	if len(lineas) != 2 || !strings.HasSuffix(lineas[1], "...") {
+		t.Errorf("líneas = %q", lineas)
+	}
+	for _, linea := range lineas {
+		if anchoTexto(linea, 10) > 80 {
+			t.Errorf("la línea %q excede el ancho", linea)
+		}
+	}
+
+	if lineas := partirTexto("Rayuela", 10, 80, 2); len(lineas) != 1 || lineas[0] != "Rayuela" {
+		t.Errorf("líneas = %q", lineas)
+	}
+}
@@ -0,0 +1,426 @@
+package labels
+
+import "errors"
+
+// bloquesQR describe la corrección de errores de una versión QR con nivel M:
+// codewords de corrección por bloque y cantidad/tamaño de los bloques de datos
+type bloquesQR struct {
+	correccion          int
+	bloques1, datos1    int
+	bloques2, datos2    int
+	centrosAlineamiento []int
+}
+
+// versionesQR contiene las versiones 1 a 10 con nivel de corrección M, que
+// alcanzan para los textos cortos de una etiqueta (hasta 213 bytes)
+var versionesQR = [...]bloquesQR{
+	{10, 1, 16, 0, 0, nil},
+	{16, 1, 28, 0, 0, []int{6, 18}},
+	{26, 1, 44, 0, 0, []int{6, 22}},
+	{18, 2, 32, 0, 0, []int{6, 26}},
+	{24, 2, 43, 0, 0, []int{6, 30}},
+	{16, 4, 27, 0, 0, []int{6, 34}},
+	{18, 4, 31, 0, 0, []int{6, 22, 38}},
+	{22, 2, 38, 2, 39, []int{6, 24, 42}},
+	{22, 3, 36, 2, 37, []int{6, 26, 46}},
+	{26, 4, 43, 1, 44, []int{6, 28, 50}},
+}
+
+func (b bloquesQR) capacidad() int {
+	return b.bloques1*b.datos1 + b.bloques2*b.datos2
+}
+
+// QR representa un código QR como matriz de módulos (true = oscuro)
+type QR struct {
+	Tamanio int
+	modulos [][]bool
+	funcion [][]bool
+	version int
+}
+
+// Oscuro indica si el módulo de la fila y columna dadas es oscuro
+func (q *QR) Oscuro(fila, columna int) bool {
+	return q.modulos[fila][columna]
+}
+
+// CodificarQR genera el código QR (modo byte, corrección M) del texto,
+// eligiendo la menor versión en la que cabe y la máscara de menor penalización
+func CodificarQR(texto string) (*QR, error) {
+	datos := []byte(texto)
+
+	version := 0
+	for v := 1; v <= len(versionesQR); v++ {
+		bitsConteo := 8
+		if v >= 10 {
+			bitsConteo = 16
+		}
+		if 4+bitsConteo+len(datos)*8 <= versionesQR[v-1].capacidad()*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, errors.New("el texto es demasiado largo para un código QR de etiqueta")
+	}
+
+	q := &QR{Tamanio: version*4 + 17, version: version}
+	q.modulos = matriz(q.Tamanio)
+	q.funcion = matriz(q.Tamanio)
+
+	q.dibujarPatrones()
+	q.dibujarCodewords(q.codewords(datos))
+
+	// Elegir la máscara con menor penalización
+	mejor, mejorPenalizacion := 0, -1
+	for mascara := 0; mascara < 8; mascara++ {
+		q.aplicarMascara(mascara)
+		q.dibujarFormato(mascara)
+		if p := q.penalizacion(); mejorPenalizacion < 0 || p < mejorPenalizacion {
+			mejor, mejorPenalizacion = mascara, p
+		}
+		q.aplicarMascara(mascara) // la máscara es un XOR: se revierte
+	}
+	q.aplicarMascara(mejor)
+	q.dibujarFormato(mejor)
+
+	return q, nil
+}
+
+func matriz(tamanio int) [][]bool {
+	m := make([][]bool, tamanio)
+	for i := range m {
+		m[i] = make([]bool, tamanio)
+	}
+	return m
+}
+
+// marcar fija un módulo de función (no disponible para datos)
+func (q *QR) marcar(x, y int, oscuro bool) {
+	q.modulos[y][x] = oscuro
+	q.funcion[y][x] = true
+}
+
+func (q *QR) dibujarPatrones() {
+	n := q.Tamanio
+
+	// Patrones de sincronización
+	for i := 0; i < n; i++ {
+		q.marcar(6, i, i%2 == 0)
+		q.marcar(i, 6, i%2 == 0)
+	}
+
+	// Patrones de posición (incluyen su separador claro)
+	for _, c := range [][2]int{{3, 3}, {n - 4, 3}, {3, n - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x < 0 || x >= n || y < 0 || y >= n {
+					continue
+				}
+				d := max(abs(dx), abs(dy))
+				q.marcar(x, y, d != 2 && d != 4)
+			}
+		}
+	}
+
+	// Patrones de alineamiento, salvo donde se superponen con los de posición
+	centros := versionesQR[q.version-1].centrosAlineamiento
+	ultimo := len(centros) - 1
+	for i, cy := range centros {
+		for j, cx := range centros {
+			if (i == 0 && j == 0) || (i == 0 && j == ultimo) || (i == ultimo && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.marcar(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reservar las zonas de formato (se dibujan después de elegir la máscara)
+	q.dibujarFormato(0)
+
+	// Información de versión (versión 7 en adelante)
+	if q.version >= 7 {
+		resto := q.version
+		for i := 0; i < 12; i++ {
+			resto = (resto << 1) ^ ((resto >> 11) * 0x1F25)
+		}
+		bits := q.version<<12 | resto
+		for i := 0; i < 18; i++ {
+			oscuro := (bits>>i)&1 != 0
+			a, b := n-11+i%3, i/3
+			q.marcar(a, b, oscuro)
+			q.marcar(b, a, oscuro)
+		}
+	}
+}
+
+// dibujarFormato escribe el nivel de corrección (M) y la máscara en sus dos
+// copias, junto con el módulo oscuro fijo
+func (q *QR) dibujarFormato(mascara int) {
+	n := q.Tamanio
+	datos := 0<<3 | mascara // el nivel M se codifica como 00
+	resto := datos
+	for i := 0; i < 10; i++ {
+		resto = (resto << 1) ^ ((resto >> 9) * 0x537)
+	}
+	bits := (datos<<10 | resto) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		q.marcar(8, i, bit(i))
+	}
+	q.marcar(8, 7, bit(6))
+	q.marcar(8, 8, bit(7))
+	q.marcar(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.marcar(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		q.marcar(n-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.marcar(8, n-15+i, bit(i))
+	}
+	q.marcar(8, n-8, true)
+}
+
+// codewords arma el flujo de datos, lo divide en bloques, agrega la corrección
+// Reed-Solomon y entrelaza el resultado
+func (q *QR) codewords(datos []byte) []byte {
+	info := versionesQR[q.version-1]
+	capacidad := info.capacidad()
+
+	var bits []bool
+	agregar := func(valor, largo int) {
+		for i := largo - 1; i >= 0; i-- {
+			bits = append(bits, (valor>>i)&1 != 0)
+		}
+	}
+
+	bitsConteo := 8
+	if q.version >= 10 {
+		bitsConteo = 16
+	}
+	agregar(0x4, 4) // modo byte
+	agregar(len(datos), bitsConteo)
+	for _, b := range datos {
+		agregar(int(b), 8)
+	}
+
+	// Terminador y relleno hasta completar bytes
+	agregar(0, min(4, capacidad*8-len(bits)))
+	agregar(0, (8-len(bits)%8)%8)
+
+	flujo := make([]byte, 0, capacidad)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		flujo = append(flujo, b)
+	}
+	for relleno := byte(0xEC); len(flujo) < capacidad; relleno ^= 0xEC ^ 0x11 {
+		flujo = append(flujo, relleno)
+	}
+
+	// Dividir en bloques y calcular la corrección de cada uno
+	divisor := divisorRS(info.correccion)
+	var bloques, correcciones [][]byte
+	inicio := 0
+	for i := 0; i < info.bloques1+info.bloques2; i++ {
+		largo := info.datos1
+		if i >= info.bloques1 {
+			largo = info.datos2
+		}
+		bloque := flujo[inicio : inicio+largo]
+		inicio += largo
+		bloques = append(bloques, bloque)
+		correcciones = append(correcciones, restoRS(bloque, divisor))
+	}
+
+	// Entrelazar datos y luego corrección
+	var resultado []byte
+	for i := 0; i < max(info.datos1, info.datos2); i++ {
+		for _, bloque := range bloques {
+			if i < len(bloque) {
+				resultado = append(resultado, bloque[i])
+			}
+		}
+	}
+	for i := 0; i < info.correccion; i++ {
+		for _, c := range correcciones {
+			resultado = append(resultado, c[i])
+		}
+	}
+
+	return resultado
+}
+
+// dibujarCodewords coloca los bits en zigzag de a dos columnas, de derecha a
+// izquierda, saltando los módulos de función
+func (q *QR) dibujarCodewords(datos []byte) {
+	n := q.Tamanio
+	i := 0
+	for derecha := n - 1; derecha >= 1; derecha -= 2 {
+		if derecha == 6 {
+			derecha = 5
+		}
+		for vertical := 0; vertical < n; vertical++ {
+			for j := 0; j < 2; j++ {
+				x := derecha - j
+				y := vertical
+				if (derecha+1)&2 == 0 {
+					y = n - 1 - vertical
+				}
+				if !q.funcion[y][x] && i < len(datos)*8 {
+					q.modulos[y][x] = (datos[i>>3]>>(7-i&7))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (q *QR) aplicarMascara(mascara int) {
+	for y := 0; y < q.Tamanio; y++ {
+		for x := 0; x < q.Tamanio; x++ {
+			var invertir bool
+			switch mascara {
+			case 0:
+				invertir = (x+y)%2 == 0
+			case 1:
+				invertir = y%2 == 0
+			case 2:
+				invertir = x%3 == 0
+			case 3:
+				invertir = (x+y)%3 == 0
+			case 4:
+				invertir = (x/3+y/2)%2 == 0
+			case 5:
+				invertir = x*y%2+x*y%3 == 0
+			case 6:
+				invertir = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invertir = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invertir && !q.funcion[y][x] {
+				q.modulos[y][x] = !q.modulos[y][x]
+			}
+		}
+	}
+}
+
+// penalizacion evalúa las reglas de la norma: rachas del mismo color, bloques
+// de 2x2, patrones parecidos a los de posición y proporción de oscuros
+func (q *QR) penalizacion() int {
+	n := q.Tamanio
+	total := 0
+
+	linea := func(obtener func(i int) bool) {
+		racha := 1
+		for i := 1; i <= n; i++ {
+			if i < n && obtener(i) == obtener(i-1) {
+				racha++
+				continue
+			}
+			if racha >= 5 {
+				total += 3 + racha - 5
+			}
+			racha = 1
+		}
+		// 1:1:3:1:1 con cuatro módulos claros a un lado
+		for i := 0; i+10 < n; i++ {
+			patron := [11]bool{}
+			for k := range patron {
+				patron[k] = obtener(i + k)
+			}
+			nucleo := patron[0] && !patron[1] && patron[2] && patron[3] && patron[4] && !patron[5] && patron[6]
+			if nucleo && !patron[7] && !patron[8] && !patron[9] && !patron[10] {
+				total += 40
+			}
+			nucleo = patron[4] && !patron[5] && patron[6] && patron[7] && patron[8] && !patron[9] && patron[10]
+			if nucleo && !patron[0] && !patron[1] && !patron[2] && !patron[3] {
+				total += 40
+			}
+		}
+	}
+
+	oscuros := 0
+	for y := 0; y < n; y++ {
+		fila := y
+		linea(func(i int) bool { return q.modulos[fila][i] })
+		columna := y
+		linea(func(i int) bool { return q.modulos[i][columna] })
+
+		for x := 0; x < n; x++ {
+			if q.modulos[y][x] {
+				oscuros++
+			}
+			if x+1 < n && y+1 < n {
+				c := q.modulos[y][x]
+				if c == q.modulos[y][x+1] && c == q.modulos[y+1][x] && c == q.modulos[y+1][x+1] {
+					total += 3
+				}
+			}
+		}
+	}
+
+	// 10 puntos por cada 5% de desvío respecto del 50% de oscuros
+	desvio := abs(oscuros*20-n*n*10) / (n * n)
+	return total + desvio*10
+}
+
+// divisorRS calcula el polinomio generador Reed-Solomon del grado dado
+func divisorRS(grado int) []byte {
+	resultado := make([]byte, grado)
+	resultado[grado-1] = 1
+	raiz := byte(1)
+	for i := 0; i < grado; i++ {
+		for j := 0; j < grado; j++ {
+			resultado[j] = multiplicarGF(resultado[j], raiz)
+			if j+1 < grado {
+				resultado[j] ^= resultado[j+1]
+			}
+		}
+		raiz = multiplicarGF(raiz, 0x02)
+	}
+	return resultado
+}
+
+// restoRS calcula los codewords de corrección de un bloque de datos
+func restoRS(datos, divisor []byte) []byte {
+	resultado := make([]byte, len(divisor))
+	for _, b := range datos {
+		factor := b ^ resultado[0]
+		copy(resultado, resultado[1:])
+		resultado[len(resultado)-1] = 0
+		for i := range resultado {
+			resultado[i] ^= multiplicarGF(divisor[i], factor)
+		}
+	}
+	return resultado
+}
+
+// multiplicarGF multiplica en GF(2^8) con el polinomio 0x11D
+func multiplicarGF(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
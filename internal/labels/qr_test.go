@@ -0,0 +1,201 @@
+package labels
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// matrizQREjemplar es el QR de ContenidoCodigo(123) ("00000123"): versión 1,
+// nivel M. Se verificó decodificándolo con un lector QR independiente
+var matrizQREjemplar = []string{
+	"#######.#.###.#######",
+	"#.....#.###...#.....#",
+	"#.###.#.#.#...#.###.#",
+	"#.###.#..##...#.###.#",
+	"#.###.#.#.#.#.#.###.#",
+	"#.....#..####.#.....#",
+	"#######.#.#.#.#######",
+	"...........##........",
+	"#..######.#.##..#.###",
+	"....##.##.#.#.##..##.",
+	"##.##.#.#.#..#.#.##.#",
+	".##....#..##.....##..",
+	"...#####..#..####..##",
+	"........#..##..##.#..",
+	"#######.#...#####.##.",
+	"#.....#.#..###.##.#.#",
+	"#.###.#.#..##.##.....",
+	"#.###.#.#.###..#.##..",
+	"#.###.#..#....#######",
+	"#.....#..##..##...###",
+	"#######.##.#...###...",
+}
+
+func TestCodificarQR(t *testing.T) {
+	q, err := CodificarQR(ContenidoCodigo(123))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Tamanio != len(matrizQREjemplar) {
+		t.Fatalf("tamaño = %d, se esperaba %d", q.Tamanio, len(matrizQREjemplar))
+	}
+
+	for fila, esperada := range matrizQREjemplar {
+		var obtenida strings.Builder
+		for columna := 0; columna < q.Tamanio; columna++ {
+			if q.Oscuro(fila, columna) {
+				obtenida.WriteByte('#')
+			} else {
+				obtenida.WriteByte('.')
+			}
+		}
+		if obtenida.String() != esperada {
+			t.Errorf("fila %d = %s, se esperaba %s", fila, obtenida.String(), esperada)
+		}
+	}
+}
+
+func TestCodificarQRVersion(t *testing.T) {
+	casos := []struct {
+		largo   int
+		version int
+	}{
+		{1, 1},
+		{14, 1},
+		{15, 2},
+		{106, 6},
+		{107, 7},
+		{180, 9},
+		{213, 10},
+	}
+
+	for _, caso := range casos {
+		q, err := CodificarQR(strings.Repeat("a", caso.largo))
+		if err != nil {
+			t.Fatalf("%d bytes: %v", caso.largo, err)
+		}
+		if q.version != caso.version || q.Tamanio != caso.version*4+17 {
+			t.Errorf("%d bytes: versión %d de tamaño %d, se esperaba la versión %d", caso.largo, q.version, q.Tamanio, caso.version)
+		}
+	}
+
+	if _, err := CodificarQR(strings.Repeat("a", 214)); err == nil {
+		t.Error("se esperaba un error con un texto que no entra en la versión 10")
+	}
+}
+
+func TestFormatoQR(t *testing.T) {
+	// Bits de formato del nivel M para cada máscara, tabla de la norma ISO/IEC 18004
+	esperados := []int{
+		0b101010000010010, 0b101000100100101, 0b101111001111100, 0b101101101001011,
+		0b100010111111001, 0b100000011001110, 0b100111110010111, 0b100101010100000,
+	}
+
+	q := &QR{Tamanio: 21, version: 1, modulos: matriz(21), funcion: matriz(21)}
+	n := q.Tamanio
+	for mascara, esperado := range esperados {
+		q.dibujarFormato(mascara)
+
+		// Las dos copias, del bit menos significativo al más significativo
+		var copia1, copia2 []bool
+		for i := 0; i <= 5; i++ {
+			copia1 = append(copia1, q.Oscuro(i, 8))
+		}
+		copia1 = append(copia1, q.Oscuro(7, 8), q.Oscuro(8, 8), q.Oscuro(8, 7))
+		for i := 9; i < 15; i++ {
+			copia1 = append(copia1, q.Oscuro(8, 14-i))
+		}
+		for i := 0; i < 8; i++ {
+			copia2 = append(copia2, q.Oscuro(8, n-1-i))
+		}
+		for i := 8; i < 15; i++ {
+			copia2 = append(copia2, q.Oscuro(n-15+i, 8))
+		}
+
+		for _, copia := range [][]bool{copia1, copia2} {
+			bits := 0
+			for i, oscuro := range copia {
+				if oscuro {
+					bits |= 1 << i
+				}
+			}
+			if bits != esperado {
+				t.Errorf("máscara %d: formato %015b, se esperaba %015b", mascara, bits, esperado)
+			}
+		}
+		if !q.Oscuro(n-8, 8) {
+			t.Errorf("máscara %d: falta el módulo oscuro fijo", mascara)
+		}
+	}
+}
+
+func TestVersionQR(t *testing.T) {
+	// Bits de información de versión de la norma ISO/IEC 18004
+	esperados := map[int]int{
+		7: 0x07C94, 8: 0x085BC, 9: 0x09A99, 10: 0x0A4D3,
+	}
+
+	for version, esperado := range esperados {
+		tamanio := version*4 + 17
+		q := &QR{Tamanio: tamanio, version: version, modulos: matriz(tamanio), funcion: matriz(tamanio)}
+		q.dibujarPatrones()
+
+		superior, inferior := 0, 0
+		for i := 0; i < 18; i++ {
+			a, b := tamanio-11+i%3, i/3
+			if q.Oscuro(b, a) {
+				superior |= 1 << i
+			}
+			if q.Oscuro(a, b) {
+				inferior |= 1 << i
+			}
+		}
+		if superior != esperado || inferior != esperado {
+			t.Errorf("versión %d: %018b y %018b, se esperaba %018b", version, superior, inferior, esperado)
+		}
+	}
+}
+
+func TestRestoRS(t *testing.T) {
+	// "HELLO WORLD" en versión 1-M (modo alfanumérico): codewords de datos y
+	// de corrección del ejemplo publicado por thonky.com
+	datos := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	esperada := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if correccion := restoRS(datos, divisorRS(len(esperada))); !reflect.DeepEqual(correccion, esperada) {
+		t.Errorf("corrección = %v, se esperaba %v", correccion, esperada)
+	}
+}
+
+func TestCodewordsQR(t *testing.T) {
+	q := &QR{Tamanio: 21, version: 1}
+
+	// Modo byte (0100), largo 8 y los dígitos en ASCII, seguidos del
+	// terminador y el relleno alternado 0xEC 0x11
+	esperados := []byte{
+		0x40, 0x83, 0x03, 0x03, 0x03, 0x03, 0x03, 0x13, 0x23, 0x30,
+		0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11,
+	}
+	codewords := q.codewords([]byte("00000123"))
+	if len(codewords) != 26 {
+		t.Fatalf("%d codewords, se esperaban 26", len(codewords))
+	}
+	if !reflect.DeepEqual(codewords[:16], esperados) {
+		t.Errorf("datos = %X, se esperaba %X", codewords[:16], esperados)
+	}
+
+	// Un bloque con corrección válida tiene síndromes nulos: el polinomio
+	// completo se anula en las raíces del generador
+	raiz := byte(1)
+	for i := 0; i < 10; i++ {
+		var sindrome byte
+		for _, c := range codewords {
+			sindrome = multiplicarGF(sindrome, raiz) ^ c
+		}
+		if sindrome != 0 {
+			t.Errorf("síndrome %d = %d", i, sindrome)
+		}
+		raiz = multiplicarGF(raiz, 0x02)
+	}
+}
@@ -0,0 +1,296 @@
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Formatos de código de las etiquetas
+const (
+	FormatoCode128 = "code128"
+	FormatoQR      = "qr"
+	FormatoAmbos   = "ambos"
+)
+
+// Espacios fijos dentro de cada etiqueta, en puntos
+const (
+	relleno         = 1.5 * puntosPorMM
+	tamanioTitulo   = 6.5
+	tamanioDetalle  = 7.0
+	zonaSilencio128 = 10 // módulos claros a cada lado del Code 128
+	zonaSilencioQR  = 2  // reducida respecto de la norma para aprovechar la etiqueta
+)
+
+// Etiqueta contiene los datos impresos en la etiqueta de un ejemplar
+type Etiqueta struct {
+	Codigo    int
+	Titulo    string
+	Signatura string
+	Sucursal  string
+}
+
+// Plantilla describe la disposición de las etiquetas en la hoja, en milímetros
+type Plantilla struct {
+	Nombre          string  `json:"nombre"`
+	Descripcion     string  `json:"descripcion,omitempty"`
+	AnchoPagina     float64 `json:"ancho_pagina_mm"`
+	AltoPagina      float64 `json:"alto_pagina_mm"`
+	Columnas        int     `json:"columnas"`
+	Filas           int     `json:"filas"`
+	AnchoEtiqueta   float64 `json:"ancho_etiqueta_mm"`
+	AltoEtiqueta    float64 `json:"alto_etiqueta_mm"`
+	MargenSuperior  float64 `json:"margen_superior_mm"`
+	MargenIzquierdo float64 `json:"margen_izquierdo_mm"`
+	SeparacionH     float64 `json:"separacion_horizontal_mm"`
+	SeparacionV     float64 `json:"separacion_vertical_mm"`
+}
+
+// PlantillaPredeterminada se usa cuando no se indica otra
+const PlantillaPredeterminada = "avery-5160"
+
+// Plantillas predefinidas para las hojas de etiquetas más comunes
+var Plantillas = []Plantilla{
+	{
+		Nombre: "avery-5160", Descripcion: "Carta, 3 x 10 etiquetas de 66,7 x 25,4 mm",
+		AnchoPagina: 215.9, AltoPagina: 279.4, Columnas: 3, Filas: 10,
+		AnchoEtiqueta: 66.675, AltoEtiqueta: 25.4, MargenSuperior: 12.7, MargenIzquierdo: 4.7625,
+		SeparacionH: 3.175,
+	},
+	{
+		Nombre: "avery-l7160", Descripcion: "A4, 3 x 7 etiquetas de 63,5 x 38,1 mm",
+		AnchoPagina: 210, AltoPagina: 297, Columnas: 3, Filas: 7,
+		AnchoEtiqueta: 63.5, AltoEtiqueta: 38.1, MargenSuperior: 15.15, MargenIzquierdo: 7.25,
+		SeparacionH: 2.5,
+	},
+	{
+		Nombre: "a4-3x8", Descripcion: "A4, 3 x 8 etiquetas de 70 x 37 mm sin márgenes",
+		AnchoPagina: 210, AltoPagina: 297, Columnas: 3, Filas: 8,
+		AnchoEtiqueta: 70, AltoEtiqueta: 37, MargenSuperior: 0.5,
+	},
+	{
+		Nombre: "a4-lomo", Descripcion: "A4, 4 x 13 etiquetas de lomo de 48,5 x 21,2 mm",
+		AnchoPagina: 210, AltoPagina: 297, Columnas: 4, Filas: 13,
+		AnchoEtiqueta: 48.5, AltoEtiqueta: 21.2, MargenSuperior: 10.7, MargenIzquierdo: 8,
+	},
+}
+
+// BuscarPlantilla obtiene una plantilla predefinida por su nombre
+func BuscarPlantilla(nombre string) (Plantilla, bool) {
+	for _, p := range Plantillas {
+		if p.Nombre == nombre {
+			return p, true
+		}
+	}
+	return Plantilla{}, false
+}
+
+// Validar comprueba que las medidas sean positivas y que la grilla entre en la hoja
+func (p Plantilla) Validar() error {
+	if p.AnchoPagina <= 0 || p.AltoPagina <= 0 || p.AnchoEtiqueta <= 0 || p.AltoEtiqueta <= 0 {
+		return errors.New("las medidas de la página y de la etiqueta deben ser positivas")
+	}
+	if p.Columnas <= 0 || p.Filas <= 0 {
+		return errors.New("la plantilla debe tener al menos una fila y una columna")
+	}
+	if p.MargenSuperior < 0 || p.MargenIzquierdo < 0 || p.SeparacionH < 0 || p.SeparacionV < 0 {
+		return errors.New("los márgenes y separaciones no pueden ser negativos")
+	}
+
+	ancho := p.MargenIzquierdo + float64(p.Columnas)*p.AnchoEtiqueta + float64(p.Columnas-1)*p.SeparacionH
+	alto := p.MargenSuperior + float64(p.Filas)*p.AltoEtiqueta + float64(p.Filas-1)*p.SeparacionV
+	// Tolerancia por redondeo de las medidas de los fabricantes
+	if ancho > p.AnchoPagina+0.5 || alto > p.AltoPagina+0.5 {
+		return errors.New("las etiquetas no entran en la página")
+	}
+	if p.AltoEtiqueta < 10 || p.AnchoEtiqueta < 25 {
+		return errors.New("la etiqueta es demasiado pequeña (mínimo 25 x 10 mm)")
+	}
+
+	return nil
+}
+
+// Opciones configura la generación de una hoja de etiquetas
+type Opciones struct {
+	Formato   string
+	Plantilla Plantilla
+	// PosicionInicial permite reutilizar hojas empezadas (1 = primera etiqueta)
+	PosicionInicial int
+	Bordes          bool
+}
+
+// ContenidoCodigo es el texto codificado en el código de barras y el QR de un
+// ejemplar: el código con ceros a la izquierda, que Code 128 comprime en pares
+func ContenidoCodigo(codigo int) string {
+	return fmt.Sprintf("%08d", codigo)
+}
+
+// GenerarPDF dibuja las etiquetas en hojas según la plantilla y escribe el PDF
+func GenerarPDF(w io.Writer, etiquetas []Etiqueta, op Opciones) error {
+	if err := op.Plantilla.Validar(); err != nil {
+		return err
+	}
+	switch op.Formato {
+	case FormatoCode128, FormatoQR, FormatoAmbos:
+	default:
+		return errors.New("formato de etiqueta no soportado: " + op.Formato)
+	}
+
+	p := op.Plantilla
+	porHoja := p.Columnas * p.Filas
+	posicion := op.PosicionInicial - 1
+	if posicion < 0 || posicion >= porHoja {
+		return errors.New("la posición inicial debe estar entre 1 y " + strconv.Itoa(porHoja))
+	}
+
+	doc := nuevoDocumentoPDF(p.AnchoPagina*puntosPorMM, p.AltoPagina*puntosPorMM)
+	var pagina *paginaPDF
+	for _, etiqueta := range etiquetas {
+		if pagina == nil || posicion == porHoja {
+			pagina = doc.nuevaPagina()
+			if posicion == porHoja {
+				posicion = 0
+			}
+		}
+
+		fila, columna := posicion/p.Columnas, posicion%p.Columnas
+		x := (p.MargenIzquierdo + float64(columna)*(p.AnchoEtiqueta+p.SeparacionH)) * puntosPorMM
+		y := (p.MargenSuperior + float64(fila)*(p.AltoEtiqueta+p.SeparacionV)) * puntosPorMM
+		ancho, alto := p.AnchoEtiqueta*puntosPorMM, p.AltoEtiqueta*puntosPorMM
+
+		if op.Bordes {
+			pagina.borde(x, y, ancho, alto)
+		}
+		if err := dibujarEtiqueta(pagina, etiqueta, op.Formato, x, y, ancho, alto); err != nil {
+			return err
+		}
+		posicion++
+	}
+
+	if len(doc.paginas) == 0 {
+		doc.nuevaPagina()
+	}
+
+	return doc.escribir(w)
+}
+
+// dibujarEtiqueta compone una etiqueta dentro del rectángulo dado
+func dibujarEtiqueta(pagina *paginaPDF, e Etiqueta, formato string, x, y, ancho, alto float64) error {
+	contenido := ContenidoCodigo(e.Codigo)
+	x, y = x+relleno, y+relleno
+	ancho, alto = ancho-2*relleno, alto-2*relleno
+
+	switch formato {
+	case FormatoCode128:
+		// Título arriba, código de barras al centro y código + signatura abajo
+		pagina.texto(x, y+tamanioTitulo, tamanioTitulo, fuenteNormal, recortarTexto(e.Titulo, tamanioTitulo, ancho))
+		altoBarras := alto - tamanioTitulo - tamanioDetalle - 4
+		if err := dibujarCode128(pagina, contenido, x, y+tamanioTitulo+2, ancho, altoBarras); err != nil {
+			return err
+		}
+		base := y + alto
+		pagina.texto(x, base, tamanioDetalle, fuenteNormal, contenido)
+		if e.Signatura != "" {
+			signatura := recortarTexto(e.Signatura, tamanioDetalle, ancho/2)
+			pagina.texto(x+ancho-anchoTexto(signatura, tamanioDetalle), base, tamanioDetalle, fuenteNegrita, signatura)
+		}
+
+	case FormatoQR:
+		// QR a la izquierda; título, signatura, código y sucursal a la derecha
+		if err := dibujarQR(pagina, contenido, x, y, alto); err != nil {
+			return err
+		}
+		xt, anchoLibre := x+alto+2, ancho-alto-2
+		linea := y
+		for _, l := range partirTexto(e.Titulo, tamanioTitulo, anchoLibre, 3) {
+			linea += tamanioTitulo + 1
+			pagina.texto(xt, linea, tamanioTitulo, fuenteNormal, l)
+		}
+		for _, detalle := range []struct{ texto, fuente string }{
+			{e.Signatura, fuenteNegrita}, {contenido, fuenteNormal}, {e.Sucursal, fuenteNormal},
+		} {
+			if detalle.texto == "" || linea+tamanioDetalle+1 > y+alto {
+				continue
+			}
+			linea += tamanioDetalle + 1
+			pagina.texto(xt, linea, tamanioDetalle, detalle.fuente, recortarTexto(detalle.texto, tamanioDetalle, anchoLibre))
+		}
+
+	case FormatoAmbos:
+		// QR a la izquierda; título, código de barras y código a la derecha
+		if err := dibujarQR(pagina, contenido, x, y, alto); err != nil {
+			return err
+		}
+		xt, anchoLibre := x+alto+2, ancho-alto-2
+		pagina.texto(xt, y+tamanioTitulo, tamanioTitulo, fuenteNormal, recortarTexto(e.Titulo, tamanioTitulo, anchoLibre))
+		altoBarras := alto - tamanioTitulo - tamanioDetalle - 4
+		if err := dibujarCode128(pagina, contenido, xt, y+tamanioTitulo+2, anchoLibre, altoBarras); err != nil {
+			return err
+		}
+		detalle := contenido
+		if e.Signatura != "" {
+			detalle += "  " + e.Signatura
+		}
+		pagina.texto(xt, y+alto, tamanioDetalle, fuenteNormal, recortarTexto(detalle, tamanioDetalle, anchoLibre))
+	}
+
+	return nil
+}
+
+// dibujarCode128 dibuja el código de barras ocupando el ancho disponible,
+// incluida la zona de silencio
+func dibujarCode128(pagina *paginaPDF, contenido string, x, y, ancho, alto float64) error {
+	modulos, err := Code128(contenido)
+	if err != nil {
+		return err
+	}
+
+	modulo := ancho / float64(len(modulos)+2*zonaSilencio128)
+	inicio := x + zonaSilencio128*modulo
+	for i := 0; i < len(modulos); {
+		if !modulos[i] {
+			i++
+			continue
+		}
+		j := i
+		for j < len(modulos) && modulos[j] {
+			j++
+		}
+		pagina.rectangulo(inicio+float64(i)*modulo, y, float64(j-i)*modulo, alto)
+		i = j
+	}
+	pagina.rellenar()
+
+	return nil
+}
+
+// dibujarQR dibuja el código QR en un cuadrado de lado dado, incluida la zona
+// de silencio
+func dibujarQR(pagina *paginaPDF, contenido string, x, y, lado float64) error {
+	qr, err := CodificarQR(contenido)
+	if err != nil {
+		return err
+	}
+
+	modulo := lado / float64(qr.Tamanio+2*zonaSilencioQR)
+	x0, y0 := x+zonaSilencioQR*modulo, y+zonaSilencioQR*modulo
+	for fila := 0; fila < qr.Tamanio; fila++ {
+		// Los módulos oscuros contiguos de una fila se dibujan juntos
+		for columna := 0; columna < qr.Tamanio; {
+			if !qr.Oscuro(fila, columna) {
+				columna++
+				continue
+			}
+			fin := columna
+			for fin < qr.Tamanio && qr.Oscuro(fila, fin) {
+				fin++
+			}
+			pagina.rectangulo(x0+float64(columna)*modulo, y0+float64(fila)*modulo, float64(fin-columna)*modulo, modulo)
+			columna = fin
+		}
+	}
+	pagina.rellenar()
+
+	return nil
+}
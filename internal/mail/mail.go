@@ -0,0 +1,133 @@
+// Package mail envía los correos del sistema a través de un remitente
+// intercambiable: SMTP en producción o el log del servidor en desarrollo
+package mail
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mensaje es un correo de texto plano
+type Mensaje struct {
+	Para   string
+	Asunto string
+	Cuerpo string
+}
+
+// Sender entrega mensajes; las implementaciones deben poder usarse desde
+// varias goroutines
+type Sender interface {
+	Enviar(m Mensaje) error
+}
+
+var (
+	mu        sync.RWMutex
+	remitente Sender = LogSender{}
+)
+
+// Configurar elige el remitente según las variables de entorno: SMTP si está
+// definido SMTP_HOST, el log del servidor en caso contrario. El log solo se
+// admite en desarrollo, porque los correos llevan enlaces con tokens vigentes:
+// con GIN_MODE=release, la falta de SMTP_HOST es un error
+func Configurar() (Sender, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		if os.Getenv("GIN_MODE") == "release" {
+			return nil, fmt.Errorf("SMTP_HOST es obligatorio con GIN_MODE=release")
+		}
+		SetSender(LogSender{})
+		return LogSender{}, nil
+	}
+
+	puerto := os.Getenv("SMTP_PORT")
+	if puerto == "" {
+		puerto = "587"
+	}
+
+	s := &SMTPSender{
+		Host:    host,
+		Puerto:  puerto,
+		Usuario: os.Getenv("SMTP_USER"),
+		Clave:   os.Getenv("SMTP_PASSWORD"),
+		Desde:   os.Getenv("SMTP_FROM"),
+		Timeout: 10 * time.Second,
+	}
+	if s.Desde == "" {
+		s.Desde = s.Usuario
+	}
+
+	SetSender(s)
+	return s, nil
+}
+
+// SetSender reemplaza el remitente en uso (por ejemplo, uno de prueba)
+func SetSender(s Sender) {
+	mu.Lock()
+	remitente = s
+	mu.Unlock()
+}
+
+// Enviar entrega el mensaje con el remitente configurado
+func Enviar(m Mensaje) error {
+	mu.RLock()
+	s := remitente
+	mu.RUnlock()
+	return s.Enviar(m)
+}
+
+// LogSender escribe los mensajes en el log en lugar de enviarlos
+type LogSender struct{}
+
+func (LogSender) Enviar(m Mensaje) error {
+	log.Printf("✉️ Correo para %s: %s\n%s", m.Para, m.Asunto, m.Cuerpo)
+	return nil
+}
+
+// SMTPSender envía los mensajes por SMTP con autenticación PLAIN
+type SMTPSender struct {
+	Host    string
+	Puerto  string
+	Usuario string
+	Clave   string
+	Desde   string
+	Timeout time.Duration
+}
+
+func (s *SMTPSender) Enviar(m Mensaje) error {
+	if strings.ContainsAny(m.Para, "\r\n") {
+		return fmt.Errorf("destinatario inválido")
+	}
+
+	var auth smtp.Auth
+	if s.Usuario != "" {
+		auth = smtp.PlainAuth("", s.Usuario, s.Clave, s.Host)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.Desde)
+	fmt.Fprintf(&b, "To: %s\r\n", m.Para)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Asunto))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Cuerpo, "\n", "\r\n"))
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- smtp.SendMail(s.Host+":"+s.Puerto, auth, s.Desde, []string{m.Para}, []byte(b.String()))
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(s.Timeout):
+		return fmt.Errorf("tiempo de espera agotado al enviar correo a %s", m.Para)
+	}
+}
@@ -4,12 +4,18 @@ import (
 	"net/http"
 	"strings"
 
+	"proyecto-bd-final/internal/services"
 	"proyecto-bd-final/pkg/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware verifica el token JWT
+var (
+	sesionService       = services.NewSesionService()
+	autorizacionService = services.NewAutorizacionService()
+)
+
+// AuthMiddleware verifica el token JWT y que su sesión no haya sido cerrada
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -35,10 +41,31 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Los tokens sin sesión o de sesiones cerradas no se aceptan
+		if claims.SesionID == 0 || sesionService.Revocada(claims.SesionID) {
+			utils.ErrorResponse(c, http.StatusUnauthorized, "La sesión fue cerrada, inicie sesión nuevamente", nil)
+			c.Abort()
+			return
+		}
+
+		// Los roles del token pueden estar desactualizados: se usan los vigentes
+		acceso, err := autorizacionService.AccesoUsuario(claims.UserID)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener roles", err)
+			c.Abort()
+			return
+		}
+
+		sesionService.RegistrarUso(claims.SesionID)
+
 		// Guardar los claims en el contexto para uso posterior
 		c.Set("user_id", claims.UserID)
 		c.Set("email", claims.Email)
-		c.Set("roles", claims.Roles)
+		c.Set("roles", acceso.Roles)
+		c.Set("permisos", acceso.Permisos)
+		c.Set("verificado", acceso.Verificado)
+		c.Set("dos_factores_pendiente", acceso.DosFactoresPendiente)
+		c.Set("sesion_id", claims.SesionID)
 
 		c.Next()
 	}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"proyecto-bd-final/internal/services"
+	"proyecto-bd-final/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var sucursalService = services.NewSucursalService()
+
+// BranchScope middleware que fija la sucursal sobre la que opera la petición.
+// El personal solo puede operar en la sucursal que tiene asignada; el
+// administrador puede elegir cualquiera con ?sucursal= (0 = todas)
+func BranchScope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		solicitada := 0
+		if valor := c.Query("sucursal"); valor != "" {
+			id, err := strconv.Atoi(valor)
+			if err != nil {
+				utils.ErrorResponse(c, http.StatusBadRequest, "Parámetro inválido: sucursal", err)
+				c.Abort()
+				return
+			}
+			solicitada = id
+		}
+
+		roles, _ := c.Get("roles")
+		userRoles, _ := roles.([]string)
+		for _, r := range userRoles {
+			if r == "admin" {
+				c.Set("sucursal_id", solicitada)
+				c.Next()
+				return
+			}
+		}
+
+		userID, _ := c.Get("user_id")
+		asignada, err := sucursalService.GetSucursalPersonal(userID.(int))
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Error al obtener la sucursal del personal", err)
+			c.Abort()
+			return
+		}
+
+		if asignada == 0 {
+			utils.ErrorResponse(c, http.StatusForbidden, "No tienes una sucursal asignada", nil)
+			c.Abort()
+			return
+		}
+
+		if solicitada != 0 && solicitada != asignada {
+			utils.ErrorResponse(c, http.StatusForbidden, "No tienes permiso para operar en esta sucursal", nil)
+			c.Abort()
+			return
+		}
+
+		c.Set("sucursal_id", asignada)
+		c.Next()
+	}
+}
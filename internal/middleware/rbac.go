@@ -8,33 +8,38 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// RequirePermission middleware que verifica si el usuario tiene el permiso requerido
+// RequirePermission middleware que verifica si alguno de los roles del usuario
+// otorga el permiso requerido (tabla RolPermiso)
 func RequirePermission(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		roles, exists := c.Get("roles")
+		permisos, exists := c.Get("permisos")
 		if !exists {
-			utils.ErrorResponse(c, http.StatusForbidden, "No se encontraron roles de usuario", nil)
+			utils.ErrorResponse(c, http.StatusForbidden, "No se encontraron permisos de usuario", nil)
 			c.Abort()
 			return
 		}
 
-		userRoles, ok := roles.([]string)
+		userPermisos, ok := permisos.([]string)
 		if !ok {
-			utils.ErrorResponse(c, http.StatusInternalServerError, "Error al procesar roles", nil)
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Error al procesar permisos", nil)
 			c.Abort()
 			return
 		}
 
-		// Verificar si el usuario tiene el permiso (esto se puede mejorar con una consulta a BD)
-		// Por ahora, verificamos roles básicos
 		hasPermission := false
-		for _, role := range userRoles {
-			if role == "admin" || role == permission {
+		for _, p := range userPermisos {
+			if p == permission {
 				hasPermission = true
 				break
 			}
 		}
 
+		if !hasPermission && c.GetBool("dos_factores_pendiente") {
+			utils.ErrorResponse(c, http.StatusForbidden, "Debes activar el segundo factor para usar los permisos de tu rol", nil)
+			c.Abort()
+			return
+		}
+
 		if !hasPermission {
 			utils.ErrorResponse(c, http.StatusForbidden, "No tienes permiso para acceder a este recurso", nil)
 			c.Abort()
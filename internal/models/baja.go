@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// Baja es una solicitud de retiro de la colección de un ejemplar o, si no
+// indica ejemplar, de todos los ejemplares de un libro
+type Baja struct {
+	IDBaja               int             `json:"id_baja" db:"IDBAJA"`
+	Estado               string          `json:"estado" db:"ESTADO"`
+	Motivo               string          `json:"motivo" db:"MOTIVO"`
+	Observaciones        string          `json:"observaciones,omitempty" db:"OBSERVACIONES"`
+	LibroISBN            string          `json:"libro_isbn" db:"LIBRO_ISBN"`
+	LibroTitulo          string          `json:"libro_titulo,omitempty"`
+	EjemplarCodigo       *int            `json:"ejemplar_codigo,omitempty" db:"EJEMPLAR_CODIGO"`
+	FechaSolicitud       time.Time       `json:"fecha_solicitud" db:"FECHASOLICITUD"`
+	UsuarioSolicitaID    int             `json:"usuario_solicita_id" db:"USUARIO_IDSOLICITA"`
+	FechaResolucion      *time.Time      `json:"fecha_resolucion,omitempty" db:"FECHARESOLUCION"`
+	UsuarioResuelveID    *int            `json:"usuario_resuelve_id,omitempty" db:"USUARIO_IDRESUELVE"`
+	ComentarioResolucion string          `json:"comentario_resolucion,omitempty" db:"COMENTARIORESOLUCION"`
+	Ejemplares           []*BajaEjemplar `json:"ejemplares,omitempty"`
+}
+
+// BajaEjemplar registra de forma permanente un ejemplar retirado y el estado
+// en que se encontraba al aprobarse la baja
+type BajaEjemplar struct {
+	EjemplarCodigo       int    `json:"ejemplar_codigo" db:"EJEMPLAR_CODIGO"`
+	EstadoAnterior       string `json:"estado_anterior" db:"ESTADOANTERIOR"`
+	SucursalID           int    `json:"sucursal_id" db:"SUCURSAL_IDSUCURSAL"`
+	LocalizacionAnterior string `json:"localizacion_anterior,omitempty" db:"LOCALIZACIONANTERIOR"`
+}
+
+// CandidatoBaja es un ejemplar sin préstamos en el período analizado
+type CandidatoBaja struct {
+	EjemplarCodigo int        `json:"ejemplar_codigo"`
+	LibroISBN      string     `json:"libro_isbn"`
+	LibroTitulo    string     `json:"libro_titulo"`
+	SucursalID     int        `json:"sucursal_id"`
+	Sucursal       string     `json:"sucursal"`
+	Estado         string     `json:"estado"`
+	Localizacion   string     `json:"localizacion,omitempty"`
+	FechaAlta      time.Time  `json:"fecha_alta"`
+	UltimoPrestamo *time.Time `json:"ultimo_prestamo,omitempty"`
+}
+
+// TituloExcedente es un libro con varios ejemplares sin préstamos en el período
+type TituloExcedente struct {
+	LibroISBN         string     `json:"libro_isbn"`
+	LibroTitulo       string     `json:"libro_titulo"`
+	TotalEjemplares   int        `json:"total_ejemplares"`
+	EjemplaresOciosos int        `json:"ejemplares_ociosos"`
+	PrestamosPeriodo  int        `json:"prestamos_periodo"`
+	UltimoPrestamo    *time.Time `json:"ultimo_prestamo,omitempty"`
+}
+
+// ReporteCandidatosBaja reúne los candidatos a expurgo de la colección
+type ReporteCandidatosBaja struct {
+	Anios               int                `json:"anios"`
+	Desde               time.Time          `json:"desde"`
+	EjemplaresInactivos []*CandidatoBaja   `json:"ejemplares_inactivos"`
+	TitulosExcedentes   []*TituloExcedente `json:"titulos_excedentes"`
+}
@@ -8,5 +8,5 @@ type Bitacora struct {
 	FechaHora  time.Time `json:"fecha_hora" db:"FECHAHORA"`
 	Detalle    string    `json:"detalle" db:"DETALLE"`
 	Entidad    string    `json:"entidad" db:"ENTIDAD"`
-	UsuarioID  int       `json:"usuario_id" db:"USUARIO_IDUSUARIO"`
+	UsuarioID  *int      `json:"usuario_id" db:"USUARIO_IDUSUARIO"` // nil si no se identificó al usuario
 }
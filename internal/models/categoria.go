@@ -0,0 +1,16 @@
+package models
+
+type Categoria struct {
+	IDCategoria   int          `json:"id_categoria" db:"IDCATEGORIA"`
+	Nombre        string       `json:"nombre" db:"NOMBRE"`
+	Descripcion   string       `json:"descripcion,omitempty" db:"DESCRIPCION"`
+	PadreID       *int         `json:"padre_id,omitempty" db:"CATEGORIA_IDPADRE"`
+	TotalLibros   int          `json:"total_libros"`
+	Subcategorias []*Categoria `json:"subcategorias,omitempty"`
+}
+
+type LibroCategoria struct {
+	IDLibroCategoria int    `json:"id_libro_categoria" db:"IDLIBROCATEGORIA"`
+	LibroISBN        string `json:"libro_isbn" db:"LIBRO_ISBN"`
+	CategoriaID      int    `json:"categoria_id" db:"CATEGORIA_IDCATEGORIA"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// EstadoDosFactores resume la configuración del segundo factor de un usuario
+type EstadoDosFactores struct {
+	Activo           bool `json:"activo"`
+	Obligatorio      bool `json:"obligatorio"`
+	CodigosRestantes int  `json:"codigos_restantes"`
+}
+
+// InscripcionDosFactores son los datos para registrar la cuenta en la
+// aplicación autenticadora; la URI se muestra como código QR
+type InscripcionDosFactores struct {
+	Secreto string `json:"secreto"`
+	URI     string `json:"uri"`
+}
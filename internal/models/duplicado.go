@@ -0,0 +1,22 @@
+package models
+
+// DuplicadoLibros agrupa libros que podrían ser el mismo registro cargado
+// más de una vez
+type DuplicadoLibros struct {
+	Motivo string   `json:"motivo"`
+	Clave  string   `json:"clave"`
+	Libros []*Libro `json:"libros"`
+}
+
+// AutorResumen es un autor con la cantidad de libros que tiene asociados
+type AutorResumen struct {
+	Autor
+	Libros int `json:"libros"`
+}
+
+// DuplicadoAutores agrupa autores que podrían ser la misma persona
+type DuplicadoAutores struct {
+	Motivo  string          `json:"motivo"`
+	Clave   string          `json:"clave"`
+	Autores []*AutorResumen `json:"autores"`
+}
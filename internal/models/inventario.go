@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Inventario es una sesión de recuento de estantería en una sucursal
+type Inventario struct {
+	IDInventario     int        `json:"id_inventario" db:"IDINVENTARIO"`
+	Estado           string     `json:"estado" db:"ESTADO"`
+	FechaInicio      time.Time  `json:"fecha_inicio" db:"FECHAINICIO"`
+	FechaCierre      *time.Time `json:"fecha_cierre,omitempty" db:"FECHACIERRE"`
+	Localizacion     string     `json:"localizacion,omitempty" db:"LOCALIZACION"`
+	SucursalID       int        `json:"sucursal_id" db:"SUCURSAL_IDSUCURSAL"`
+	UsuarioID        int        `json:"usuario_id" db:"USUARIO_IDRESPONSABLE"`
+	TotalEsperados   *int       `json:"total_esperados,omitempty" db:"TOTALESPERADOS"`
+	TotalEncontrados *int       `json:"total_encontrados,omitempty" db:"TOTALENCONTRADOS"`
+	Lecturas         int        `json:"lecturas"`
+}
+
+// DiscrepanciaInventario es un ejemplar cuya lectura no coincide con lo
+// registrado en la base de datos
+type DiscrepanciaInventario struct {
+	Tipo                   string `json:"tipo"`
+	Codigo                 int    `json:"codigo"`
+	LibroISBN              string `json:"libro_isbn,omitempty"`
+	LibroTitulo            string `json:"libro_titulo,omitempty"`
+	EstadoEjemplar         string `json:"estado_ejemplar,omitempty"`
+	LocalizacionRegistrada string `json:"localizacion_registrada,omitempty"`
+	LocalizacionLeida      string `json:"localizacion_leida,omitempty"`
+	Motivo                 string `json:"motivo"`
+}
+
+// ReporteInventario compara las lecturas de un inventario con los ejemplares
+// que deberían estar en la estantería
+type ReporteInventario struct {
+	Inventario  *Inventario              `json:"inventario"`
+	Esperados   int                      `json:"esperados"`
+	Leidos      int                      `json:"leidos"`
+	Encontrados int                      `json:"encontrados"`
+	Faltantes   []DiscrepanciaInventario `json:"faltantes"`
+	MalUbicados []DiscrepanciaInventario `json:"mal_ubicados"`
+	Inesperados []DiscrepanciaInventario `json:"inesperados"`
+}
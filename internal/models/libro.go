@@ -1,14 +1,18 @@
 package models
 
 type Libro struct {
-	ISBN            string   `json:"isbn" db:"ISBN"`
-	Titulo          string   `json:"titulo" db:"TITULO"`
-	AnioPublicacion int      `json:"anioPublicacion" db:"ANIOEDICION"`
-	EditorialID     int      `json:"editorialId" db:"EDITORIAL_IDEDITORIAL"`
-	EditorialNombre string   `json:"editorialNombre,omitempty"`
-	Autores         []string `json:"autores,omitempty"`
-	Cantidad        int      `json:"cantidad,omitempty"`
-	Disponible      bool     `json:"disponible,omitempty"`
+	ISBN                 string      `json:"isbn" db:"ISBN"`
+	Titulo               string      `json:"titulo" db:"TITULO"`
+	AnioPublicacion      int         `json:"anioPublicacion" db:"ANIOEDICION"`
+	EditorialID          int         `json:"editorialId" db:"EDITORIAL_IDEDITORIAL"`
+	EditorialNombre      string      `json:"editorialNombre,omitempty"`
+	Autores              []string    `json:"autores,omitempty"`
+	Categorias           []string    `json:"categorias,omitempty"`
+	Cantidad             int         `json:"cantidad,omitempty"`
+	Disponible           bool        `json:"disponible,omitempty"`
+	Signatura            string      `json:"signatura,omitempty" db:"SIGNATURA"`
+	SistemaClasificacion string      `json:"sistemaClasificacion,omitempty" db:"SISTEMACLASIFICACION"`
+	Ejemplares           []*Ejemplar `json:"ejemplares,omitempty"`
 }
 
 type Editorial struct {
@@ -31,8 +35,11 @@ type LibroAutor struct {
 	LibroISBN    int    `json:"libroIsbn" db:"LIBRO_ISBN"`
 }
 type Ejemplar struct {
-	IDEjemplar   int    `json:"id_ejemplar" db:"IDEJEMPLAR"`
-	Localizacion string `json:"localizacion" db:"LOCALIZACION"`
-	Estado       string `json:"estado" db:"ESTADO"`
-	LibroISBN    string `json:"libro_isbn" db:"Libro_ISBN"`
+	IDEjemplar            int    `json:"id_ejemplar" db:"CODIGO"`
+	Localizacion          string `json:"localizacion" db:"LOCALIZACION"`
+	Estado                string `json:"estado" db:"ESTADO"`
+	LibroISBN             string `json:"libro_isbn" db:"Libro_ISBN"`
+	SucursalPropietariaID int    `json:"sucursal_propietaria_id" db:"SUCURSAL_IDPROPIETARIA"`
+	SucursalID            int    `json:"sucursal_id" db:"SUCURSAL_IDUBICACION"`
+	SucursalNombre        string `json:"sucursal_nombre,omitempty"`
 }
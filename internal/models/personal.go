@@ -4,4 +4,5 @@ type Personal struct {
 	CodigoEmpleado int    `json:"codigo_empleado" db:"CODIGOEMPLEADO"`
 	Puesto         string `json:"puesto" db:"PUESTO"`
 	UsuarioID      int    `json:"usuario_id" db:"USUARIO_IDUSUARIO"`
+	SucursalID     *int   `json:"sucursal_id,omitempty" db:"SUCURSAL_IDSUCURSAL"`
 }
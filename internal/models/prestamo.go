@@ -10,4 +10,6 @@ type Prestamo struct {
 	Estado                  string     `json:"estado" db:"ESTADO"`
 	UsuarioID               int        `json:"usuario_id" db:"USUARIO_IDUSUARIO"`
 	DevolucionID            int        `json:"devolucion_id" db:"DEVOLUCION_IDDEVOLUCION"`
+	SucursalPrestamoID      *int       `json:"sucursal_prestamo_id,omitempty" db:"SUCURSAL_IDPRESTAMO"`
+	SucursalDevolucionID    *int       `json:"sucursal_devolucion_id,omitempty" db:"SUCURSAL_IDDEVOLUCION"`
 }
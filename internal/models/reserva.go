@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type Reserva struct {
+	IDReserva        int       `json:"id_reserva" db:"IDRESERVA"`
+	FechaReserva     time.Time `json:"fecha_reserva" db:"FECHARESERVA"`
+	Estado           string    `json:"estado" db:"ESTADO"`
+	UsuarioID        int       `json:"usuario_id" db:"USUARIO_IDUSUARIO"`
+	LibroISBN        string    `json:"libro_isbn" db:"LIBRO_ISBN"`
+	SucursalRetiroID int       `json:"sucursal_retiro_id" db:"SUCURSAL_IDRETIRO"`
+	EjemplarCodigo   *int      `json:"ejemplar_codigo,omitempty" db:"EJEMPLAR_CODIGO"`
+}
@@ -1,8 +1,10 @@
 package models
 
 type Rol struct {
-	IDRol     int    `json:"id_rol" db:"IDROL"`
-	NombreRol string `json:"nombre_rol" db:"NOMBREROL"`
+	IDRol     int        `json:"id_rol" db:"IDROL"`
+	NombreRol string     `json:"nombre_rol" db:"NOMBREROL"`
+	Usuarios  int        `json:"usuarios"`
+	Permisos  []*Permiso `json:"permisos,omitempty"`
 }
 
 type Permiso struct {
@@ -15,3 +17,13 @@ type RolPermiso struct {
 	RolID        int `json:"rol_id" db:"ROLES_IDROL"`
 	PermisoID    int `json:"permiso_id" db:"PERMISO_IDPERMISO"`
 }
+
+// AccesoUsuario son los roles y permisos efectivos de un usuario
+type AccesoUsuario struct {
+	Roles      []string `json:"roles"`
+	Permisos   []string `json:"permisos"`
+	Verificado bool     `json:"verificado"`
+
+	// Sus roles exigen segundo factor y aún no lo activó: no recibe permisos
+	DosFactoresPendiente bool `json:"dos_factores_pendiente"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+type Sesion struct {
+	IDSesion        int        `json:"id_sesion" db:"IDSESION"`
+	UsuarioID       int        `json:"usuario_id" db:"USUARIO_IDUSUARIO"`
+	FechaCreacion   time.Time  `json:"fecha_creacion" db:"FECHACREACION"`
+	FechaExpiracion time.Time  `json:"fecha_expiracion" db:"FECHAEXPIRACION"`
+	FechaRevocacion *time.Time `json:"fecha_revocacion,omitempty" db:"FECHAREVOCACION"`
+
+	// Desde dónde se usa la sesión, actualizado al renovar los tokens.
+	// UltimoUso además se actualiza con las peticiones, cada minuto como mucho
+	Dispositivo   string     `json:"dispositivo" db:"DISPOSITIVO"`
+	IP            string     `json:"ip" db:"IP"`
+	AgenteUsuario string     `json:"agente_usuario" db:"AGENTEUSUARIO"`
+	UltimoUso     *time.Time `json:"ultimo_uso,omitempty" db:"ULTIMOUSO"`
+	Actual        bool       `json:"actual"`
+}
+
+// Cliente identifica el equipo desde el que se inicia o usa una sesión
+type Cliente struct {
+	IP            string
+	AgenteUsuario string
+}
+
+// Tokens son las credenciales emitidas al iniciar o renovar una sesión
+type Tokens struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiraEn     int    `json:"expires_in"`
+}
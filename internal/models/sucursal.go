@@ -0,0 +1,16 @@
+package models
+
+type Sucursal struct {
+	IDSucursal int    `json:"id_sucursal" db:"IDSUCURSAL"`
+	Codigo     string `json:"codigo" db:"CODIGO"`
+	Nombre     string `json:"nombre" db:"NOMBRE"`
+	Direccion  string `json:"direccion,omitempty" db:"DIRECCION"`
+}
+
+// DisponibilidadSucursal resume los ejemplares de un libro en una sucursal
+type DisponibilidadSucursal struct {
+	SucursalID  int    `json:"sucursal_id"`
+	Sucursal    string `json:"sucursal"`
+	Total       int    `json:"total"`
+	Disponibles int    `json:"disponibles"`
+}
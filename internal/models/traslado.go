@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type Traslado struct {
+	IDTraslado        int        `json:"id_traslado" db:"IDTRASLADO"`
+	Estado            string     `json:"estado" db:"ESTADO"`
+	FechaSolicitud    time.Time  `json:"fecha_solicitud" db:"FECHASOLICITUD"`
+	FechaEnvio        *time.Time `json:"fecha_envio,omitempty" db:"FECHAENVIO"`
+	FechaRecepcion    *time.Time `json:"fecha_recepcion,omitempty" db:"FECHARECEPCION"`
+	EjemplarCodigo    int        `json:"ejemplar_codigo" db:"EJEMPLAR_CODIGO"`
+	LibroISBN         string     `json:"libro_isbn,omitempty"`
+	LibroTitulo       string     `json:"libro_titulo,omitempty"`
+	SucursalOrigenID  int        `json:"sucursal_origen_id" db:"SUCURSAL_IDORIGEN"`
+	SucursalDestinoID int        `json:"sucursal_destino_id" db:"SUCURSAL_IDDESTINO"`
+	UsuarioID         int        `json:"usuario_id" db:"USUARIO_IDSOLICITA"`
+	ReservaID         *int       `json:"reserva_id,omitempty" db:"RESERVA_IDRESERVA"`
+}
@@ -10,6 +10,13 @@ type Usuario struct {
 	Correo        string    `json:"correo" db:"CORREO"`
 	Telefono      int       `json:"telefono" db:"TELEFONO"`
 	FechaRegistro time.Time `json:"fecha_registro" db:"FECHAREGISTRO"`
+
+	// Correo verificado: hasta entonces no puede solicitar préstamos
+	FechaVerificacion *time.Time `json:"fecha_verificacion,omitempty" db:"FECHAVERIFICACION"`
+	Verificado        bool       `json:"verificado"`
+
+	// Segundo factor (TOTP) activado
+	DosFactores bool `json:"dos_factores"`
 }
 
 type UsuarioRol struct {
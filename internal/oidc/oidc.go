@@ -0,0 +1,386 @@
+// Package oidc implementa el inicio de sesión único con un proveedor OpenID
+// Connect mediante el flujo de código de autorización con PKCE
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Config son los datos del cliente registrado en el proveedor
+type Config struct {
+	Emisor         string
+	ClienteID      string
+	ClienteSecreto string
+	URLRetorno     string
+	Alcances       []string
+	Reglas         []Regla
+}
+
+// Identidad son los datos del usuario autenticado según el ID token
+type Identidad struct {
+	Sujeto           string
+	Correo           string
+	CorreoVerificado bool
+	Nombre           string
+	Apellido         string
+	Claims           map[string]interface{}
+}
+
+// Proveedor es un proveedor OpenID Connect con su configuración descubierta
+type Proveedor struct {
+	config  Config
+	cliente *http.Client
+
+	mu        sync.Mutex
+	metadatos *metadatos
+	claves    map[string]interface{}
+	cargadas  time.Time
+}
+
+type metadatos struct {
+	Emisor       string `json:"issuer"`
+	Autorizacion string `json:"authorization_endpoint"`
+	Token        string `json:"token_endpoint"`
+	JWKS         string `json:"jwks_uri"`
+}
+
+var (
+	once   sync.Once
+	actual *Proveedor
+)
+
+// Actual devuelve el proveedor configurado con OIDC_ISSUER, OIDC_CLIENT_ID,
+// OIDC_CLIENT_SECRET, OIDC_REDIRECT_URL, OIDC_SCOPES y OIDC_ROLE_RULES, o nil
+// si el inicio de sesión único no está configurado
+func Actual() *Proveedor {
+	once.Do(func() {
+		config := Config{
+			Emisor:         strings.TrimRight(os.Getenv("OIDC_ISSUER"), "/"),
+			ClienteID:      os.Getenv("OIDC_CLIENT_ID"),
+			ClienteSecreto: os.Getenv("OIDC_CLIENT_SECRET"),
+			URLRetorno:     os.Getenv("OIDC_REDIRECT_URL"),
+			Alcances:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+			Reglas:         ParsearReglas(os.Getenv("OIDC_ROLE_RULES")),
+		}
+		if config.Emisor == "" || config.ClienteID == "" || config.URLRetorno == "" {
+			return
+		}
+		actual = Nuevo(config)
+	})
+	return actual
+}
+
+// Nuevo crea un proveedor; la configuración se descubre en el primer uso
+func Nuevo(config Config) *Proveedor {
+	if len(config.Alcances) == 0 {
+		config.Alcances = []string{"openid", "email", "profile"}
+	}
+	return &Proveedor{
+		config:  config,
+		cliente: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Emisor identifica al proveedor en las identidades vinculadas
+func (p *Proveedor) Emisor() string {
+	return p.config.Emisor
+}
+
+// Roles aplica las reglas de mapeo a los claims de la identidad
+func (p *Proveedor) Roles(identidad *Identidad) []string {
+	var roles []string
+	for _, regla := range p.config.Reglas {
+		if regla.Coincide(identidad.Claims) {
+			roles = append(roles, regla.Rol)
+		}
+	}
+	return roles
+}
+
+// URLAutorizacion arma la dirección a la que se envía al usuario para
+// autenticarse. El verificador PKCE y el nonce se guardan hasta el retorno
+func (p *Proveedor) URLAutorizacion(ctx context.Context, estado, nonce, verificador string) (string, error) {
+	m, err := p.descubrir(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	suma := sha256.Sum256([]byte(verificador))
+	parametros := url.Values{}
+	parametros.Set("response_type", "code")
+	parametros.Set("client_id", p.config.ClienteID)
+	parametros.Set("redirect_uri", p.config.URLRetorno)
+	parametros.Set("scope", strings.Join(p.config.Alcances, " "))
+	parametros.Set("state", estado)
+	parametros.Set("nonce", nonce)
+	parametros.Set("code_challenge", base64.RawURLEncoding.EncodeToString(suma[:]))
+	parametros.Set("code_challenge_method", "S256")
+
+	separador := "?"
+	if strings.Contains(m.Autorizacion, "?") {
+		separador = "&"
+	}
+	return m.Autorizacion + separador + parametros.Encode(), nil
+}
+
+// Canjear cambia el código de autorización por los tokens y valida el ID token
+func (p *Proveedor) Canjear(ctx context.Context, codigo, verificador, nonce string) (*Identidad, error) {
+	m, err := p.descubrir(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	formulario := url.Values{}
+	formulario.Set("grant_type", "authorization_code")
+	formulario.Set("code", codigo)
+	formulario.Set("redirect_uri", p.config.URLRetorno)
+	formulario.Set("client_id", p.config.ClienteID)
+	formulario.Set("code_verifier", verificador)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.Token, strings.NewReader(formulario.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClienteSecreto != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClienteID), url.QueryEscape(p.config.ClienteSecreto))
+	}
+
+	resp, err := p.cliente.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo contactar al proveedor: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var respuesta struct {
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		Descripcion string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&respuesta); err != nil {
+		return nil, fmt.Errorf("respuesta inválida del proveedor: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || respuesta.Error != "" {
+		return nil, fmt.Errorf("el proveedor rechazó el código: %s %s", respuesta.Error, respuesta.Descripcion)
+	}
+	if respuesta.IDToken == "" {
+		return nil, errors.New("el proveedor no entregó un ID token")
+	}
+
+	return p.validarIDToken(ctx, m, respuesta.IDToken, nonce)
+}
+
+// validarIDToken verifica firma, emisor, audiencia, vencimiento y nonce
+func (p *Proveedor) validarIDToken(ctx context.Context, m *metadatos, idToken, nonce string) (*Identidad, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.clave(ctx, m, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384"}),
+		jwt.WithIssuer(m.Emisor),
+		jwt.WithAudience(p.config.ClienteID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ID token inválido: %v", err)
+	}
+
+	if recibido, _ := claims["nonce"].(string); recibido != nonce {
+		return nil, errors.New("ID token inválido: el nonce no coincide")
+	}
+
+	identidad := &Identidad{Claims: claims}
+	identidad.Sujeto, _ = claims["sub"].(string)
+	identidad.Correo, _ = claims["email"].(string)
+	identidad.Nombre, _ = claims["given_name"].(string)
+	identidad.Apellido, _ = claims["family_name"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		identidad.CorreoVerificado = v
+	case string:
+		identidad.CorreoVerificado = v == "true"
+	}
+
+	if identidad.Nombre == "" {
+		nombre, _ := claims["name"].(string)
+		partes := strings.Fields(nombre)
+		if len(partes) > 0 {
+			identidad.Nombre = partes[0]
+			identidad.Apellido = strings.Join(partes[1:], " ")
+		}
+	}
+
+	if identidad.Sujeto == "" {
+		return nil, errors.New("ID token inválido: falta el sujeto")
+	}
+
+	return identidad, nil
+}
+
+// descubrir obtiene y guarda la configuración publicada por el proveedor
+func (p *Proveedor) descubrir(ctx context.Context) (*metadatos, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadatos != nil {
+		return p.metadatos, nil
+	}
+
+	var m metadatos
+	if err := p.obtenerJSON(ctx, p.config.Emisor+"/.well-known/openid-configuration", &m); err != nil {
+		return nil, fmt.Errorf("no se pudo obtener la configuración del proveedor: %v", err)
+	}
+	if strings.TrimRight(m.Emisor, "/") != p.config.Emisor {
+		return nil, errors.New("el emisor publicado no coincide con OIDC_ISSUER")
+	}
+	if m.Autorizacion == "" || m.Token == "" || m.JWKS == "" {
+		return nil, errors.New("la configuración del proveedor está incompleta")
+	}
+
+	p.metadatos = &m
+	return p.metadatos, nil
+}
+
+// clave devuelve la clave pública del ID token; si no se conoce el kid se
+// vuelven a leer las claves, porque el proveedor pudo haberlas rotado
+func (p *Proveedor) clave(ctx context.Context, m *metadatos, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if clave := p.buscarClave(kid); clave != nil {
+		return clave, nil
+	}
+	if time.Since(p.cargadas) < 30*time.Second {
+		return nil, errors.New("clave de firma desconocida")
+	}
+
+	var conjunto struct {
+		Claves []jwk `json:"keys"`
+	}
+	if err := p.obtenerJSON(ctx, m.JWKS, &conjunto); err != nil {
+		return nil, fmt.Errorf("no se pudieron obtener las claves del proveedor: %v", err)
+	}
+
+	p.claves = make(map[string]interface{})
+	for _, k := range conjunto.Claves {
+		if k.Uso != "" && k.Uso != "sig" {
+			continue
+		}
+		if clave, err := k.clavePublica(); err == nil {
+			p.claves[k.Kid] = clave
+		}
+	}
+	p.cargadas = time.Now()
+
+	if clave := p.buscarClave(kid); clave != nil {
+		return clave, nil
+	}
+	return nil, errors.New("clave de firma desconocida")
+}
+
+// buscarClave busca por kid; sin kid solo sirve si el proveedor publica una única clave
+func (p *Proveedor) buscarClave(kid string) interface{} {
+	if kid == "" && len(p.claves) == 1 {
+		for _, clave := range p.claves {
+			return clave
+		}
+	}
+	return p.claves[kid]
+}
+
+func (p *Proveedor) obtenerJSON(ctx context.Context, direccion string, destino interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, direccion, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.cliente.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("respuesta %d de %s", resp.StatusCode, direccion)
+	}
+	return json.NewDecoder(resp.Body).Decode(destino)
+}
+
+// jwk es una clave pública publicada en el JWKS del proveedor
+type jwk struct {
+	Tipo  string `json:"kty"`
+	Kid   string `json:"kid"`
+	Uso   string `json:"use"`
+	N     string `json:"n"`
+	E     string `json:"e"`
+	Curva string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+func (k jwk) clavePublica() (interface{}, error) {
+	switch k.Tipo {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curva elliptic.Curve
+		switch k.Curva {
+		case "P-256":
+			curva = elliptic.P256()
+		case "P-384":
+			curva = elliptic.P384()
+		default:
+			return nil, errors.New("curva no soportada")
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curva, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, errors.New("tipo de clave no soportado")
+}
+
+// Aleatorio genera un valor aleatorio apto para state, nonce y verificador PKCE
+func Aleatorio() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,322 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	clientePrueba = "biblioteca"
+	retornoPrueba = "http://localhost:8080/api/auth/oidc/callback"
+	kidPrueba     = "clave-1"
+)
+
+// idpPrueba es un proveedor mínimo: publica su configuración y su JWKS, y en
+// el endpoint de token exige el verificador PKCE del código emitido
+type idpPrueba struct {
+	t     *testing.T
+	srv   *httptest.Server
+	clave *rsa.PrivateKey
+
+	mu      sync.Mutex
+	codigos map[string]string // código -> code_challenge
+	kid     string
+	claims  jwt.MapClaims
+}
+
+func nuevoIDP(t *testing.T) *idpPrueba {
+	t.Helper()
+
+	clave, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &idpPrueba{t: t, clave: clave, codigos: map[string]string{}, kid: kidPrueba}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.configuracion)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/token", idp.token)
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+
+	return idp
+}
+
+func (idp *idpPrueba) configuracion(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 idp.srv.URL,
+		"authorization_endpoint": idp.srv.URL + "/authorize",
+		"token_endpoint":         idp.srv.URL + "/token",
+		"jwks_uri":               idp.srv.URL + "/jwks",
+	})
+}
+
+func (idp *idpPrueba) jwks(w http.ResponseWriter, r *http.Request) {
+	publica := idp.clave.PublicKey
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kidPrueba,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(publica.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publica.E)).Bytes()),
+		}},
+	})
+}
+
+func (idp *idpPrueba) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	desafio, ok := idp.codigos[r.PostForm.Get("code")]
+	suma := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code",
+		r.PostForm.Get("client_id") != clientePrueba,
+		r.PostForm.Get("redirect_uri") != retornoPrueba,
+		!ok:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	case base64.RawURLEncoding.EncodeToString(suma[:]) != desafio:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "PKCE"})
+		return
+	}
+	delete(idp.codigos, r.PostForm.Get("code"))
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims)
+	token.Header["kid"] = idp.kid
+	firmado, err := token.SignedString(idp.clave)
+	if err != nil {
+		idp.t.Error(err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": firmado})
+}
+
+// emitir registra un código para el desafío de la URL de autorización y
+// prepara los claims del ID token que devolverá el endpoint de token
+func (idp *idpPrueba) emitir(direccion string, claims jwt.MapClaims) string {
+	idp.t.Helper()
+
+	u, err := url.Parse(direccion)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.codigos["codigo"] = u.Query().Get("code_challenge")
+	idp.claims = claims
+	return "codigo"
+}
+
+func (idp *idpPrueba) claimsValidos(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            idp.srv.URL,
+		"aud":            clientePrueba,
+		"sub":            "usuario-123",
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "ana@example.edu",
+		"email_verified": true,
+		"name":           "Ana María Pérez",
+		"groups":         []string{"biblioteca-staff"},
+	}
+}
+
+func (idp *idpPrueba) proveedor(reglas string) *Proveedor {
+	return Nuevo(Config{
+		Emisor:     idp.srv.URL,
+		ClienteID:  clientePrueba,
+		URLRetorno: retornoPrueba,
+		Reglas:     ParsearReglas(reglas),
+	})
+}
+
+func TestURLAutorizacion(t *testing.T) {
+	idp := nuevoIDP(t)
+	p := idp.proveedor("")
+
+	direccion, err := p.URLAutorizacion(context.Background(), "estado", "nonce", "verificador")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(direccion, idp.srv.URL+"/authorize?") {
+		t.Fatalf("la dirección no usa el endpoint descubierto: %s", direccion)
+	}
+
+	u, _ := url.Parse(direccion)
+	suma := sha256.Sum256([]byte("verificador"))
+	esperados := map[string]string{
+		"response_type":         "code",
+		"client_id":             clientePrueba,
+		"redirect_uri":          retornoPrueba,
+		"scope":                 "openid email profile",
+		"state":                 "estado",
+		"nonce":                 "nonce",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(suma[:]),
+		"code_challenge_method": "S256",
+	}
+	for parametro, valor := range esperados {
+		if obtenido := u.Query().Get(parametro); obtenido != valor {
+			t.Errorf("%s = %q, se esperaba %q", parametro, obtenido, valor)
+		}
+	}
+}
+
+func TestDescubrimientoEmisorDistinto(t *testing.T) {
+	idp := nuevoIDP(t)
+	p := Nuevo(Config{Emisor: idp.srv.URL + "/otro", ClienteID: clientePrueba, URLRetorno: retornoPrueba})
+
+	// El emisor configurado no publica configuración en esa ruta
+	if _, err := p.URLAutorizacion(context.Background(), "e", "n", "v"); err == nil {
+		t.Fatal("se esperaba un error de descubrimiento")
+	}
+}
+
+func TestCanjear(t *testing.T) {
+	idp := nuevoIDP(t)
+	p := idp.proveedor("")
+	ctx := context.Background()
+
+	direccion, err := p.URLAutorizacion(ctx, "estado", "nonce", "verificador")
+	if err != nil {
+		t.Fatal(err)
+	}
+	codigo := idp.emitir(direccion, idp.claimsValidos("nonce"))
+
+	identidad, err := p.Canjear(ctx, codigo, "verificador", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identidad.Sujeto != "usuario-123" || identidad.Correo != "ana@example.edu" || !identidad.CorreoVerificado {
+		t.Errorf("identidad inesperada: %+v", identidad)
+	}
+	if identidad.Nombre != "Ana" || identidad.Apellido != "María Pérez" {
+		t.Errorf("nombre = %q %q", identidad.Nombre, identidad.Apellido)
+	}
+}
+
+func TestCanjearVerificadorIncorrecto(t *testing.T) {
+	idp := nuevoIDP(t)
+	p := idp.proveedor("")
+	ctx := context.Background()
+
+	direccion, err := p.URLAutorizacion(ctx, "estado", "nonce", "verificador")
+	if err != nil {
+		t.Fatal(err)
+	}
+	codigo := idp.emitir(direccion, idp.claimsValidos("nonce"))
+
+	if _, err := p.Canjear(ctx, codigo, "otro-verificador", "nonce"); err == nil {
+		t.Fatal("el proveedor debía rechazar un verificador PKCE incorrecto")
+	}
+}
+
+func TestCanjearIDTokenInvalido(t *testing.T) {
+	casos := []struct {
+		nombre  string
+		kid     string
+		cambiar func(jwt.MapClaims)
+		nonce   string
+		error   string
+	}{
+		{"audiencia", kidPrueba, func(c jwt.MapClaims) { c["aud"] = "otro-cliente" }, "nonce", "audience"},
+		{"emisor", kidPrueba, func(c jwt.MapClaims) { c["iss"] = "https://otro.example" }, "nonce", "issuer"},
+		{"vencido", kidPrueba, func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, "nonce", "expired"},
+		{"sin vencimiento", kidPrueba, func(c jwt.MapClaims) { delete(c, "exp") }, "nonce", "exp"},
+		{"nonce", kidPrueba, func(c jwt.MapClaims) {}, "otro-nonce", "el nonce no coincide"},
+		{"kid desconocido", "clave-rotada", func(c jwt.MapClaims) {}, "nonce", "clave de firma desconocida"},
+		{"sin sujeto", kidPrueba, func(c jwt.MapClaims) { delete(c, "sub") }, "nonce", "falta el sujeto"},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			idp := nuevoIDP(t)
+			p := idp.proveedor("")
+			ctx := context.Background()
+
+			direccion, err := p.URLAutorizacion(ctx, "estado", "nonce", "verificador")
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims := idp.claimsValidos("nonce")
+			caso.cambiar(claims)
+			idp.kid = caso.kid
+			codigo := idp.emitir(direccion, claims)
+
+			_, err = p.Canjear(ctx, codigo, "verificador", caso.nonce)
+			if err == nil {
+				t.Fatal("se esperaba un ID token inválido")
+			}
+			if !strings.HasPrefix(err.Error(), "ID token inválido") || !strings.Contains(err.Error(), caso.error) {
+				t.Errorf("error = %q, se esperaba uno que mencione %q", err, caso.error)
+			}
+		})
+	}
+}
+
+func TestParsearReglas(t *testing.T) {
+	reglas := ParsearReglas(" groups=biblioteca-staff:personal ; affiliation=faculty:profesor;inválida;email_domain=example.edu:estudiante;x=:y;z=1:")
+	esperadas := []Regla{
+		{Claim: "groups", Valor: "biblioteca-staff", Rol: "personal"},
+		{Claim: "affiliation", Valor: "faculty", Rol: "profesor"},
+		{Claim: "email_domain", Valor: "example.edu", Rol: "estudiante"},
+	}
+	if !reflect.DeepEqual(reglas, esperadas) {
+		t.Errorf("reglas = %+v", reglas)
+	}
+
+	// El valor puede contener dos puntos; el rol es lo que sigue al último
+	reglas = ParsearReglas("role=urn:biblioteca:admin:administrador")
+	if len(reglas) != 1 || reglas[0].Valor != "urn:biblioteca:admin" || reglas[0].Rol != "administrador" {
+		t.Errorf("reglas = %+v", reglas)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	idp := nuevoIDP(t)
+	p := idp.proveedor("groups=biblioteca-staff:personal;groups=otros:ninguno;email_domain=EXAMPLE.edu:estudiante;affiliation=faculty:profesor;email_verified=true:verificado")
+
+	identidad := &Identidad{Claims: map[string]interface{}{
+		"groups":         []interface{}{"biblioteca-staff", "todos"},
+		"email":          "ana@example.edu",
+		"affiliation":    "student",
+		"email_verified": true,
+	}}
+
+	roles := p.Roles(identidad)
+	esperados := []string{"personal", "estudiante", "verificado"}
+	if !reflect.DeepEqual(roles, esperados) {
+		t.Errorf("roles = %v, se esperaba %v", roles, esperados)
+	}
+
+	if roles := p.Roles(&Identidad{Claims: map[string]interface{}{}}); len(roles) != 0 {
+		t.Errorf("sin claims no debería asignar roles: %v", roles)
+	}
+}
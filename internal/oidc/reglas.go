@@ -0,0 +1,57 @@
+package oidc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Regla asigna un rol cuando un claim del ID token tiene el valor indicado.
+// Para claims con listas (por ejemplo groups) basta con que contenga el valor
+type Regla struct {
+	Claim string
+	Valor string
+	Rol   string
+}
+
+// ParsearReglas lee reglas con el formato claim=valor:rol separadas por punto
+// y coma, por ejemplo "groups=biblioteca-staff:personal;affiliation=faculty:profesor".
+// El claim especial email_domain compara el dominio del correo
+func ParsearReglas(texto string) []Regla {
+	var reglas []Regla
+	for _, parte := range strings.Split(texto, ";") {
+		igual := strings.Index(parte, "=")
+		dosPuntos := strings.LastIndex(parte, ":")
+		if igual <= 0 || dosPuntos <= igual+1 || dosPuntos == len(parte)-1 {
+			continue
+		}
+		reglas = append(reglas, Regla{
+			Claim: strings.TrimSpace(parte[:igual]),
+			Valor: strings.TrimSpace(parte[igual+1 : dosPuntos]),
+			Rol:   strings.TrimSpace(parte[dosPuntos+1:]),
+		})
+	}
+	return reglas
+}
+
+// Coincide indica si los claims cumplen la regla
+func (r Regla) Coincide(claims map[string]interface{}) bool {
+	if r.Claim == "email_domain" {
+		correo, _ := claims["email"].(string)
+		i := strings.LastIndex(correo, "@")
+		return i >= 0 && strings.EqualFold(correo[i+1:], r.Valor)
+	}
+
+	switch v := claims[r.Claim].(type) {
+	case []interface{}:
+		for _, elemento := range v {
+			if fmt.Sprint(elemento) == r.Valor {
+				return true
+			}
+		}
+	case nil:
+		return false
+	default:
+		return fmt.Sprint(v) == r.Valor
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+// Package politica define los requisitos que deben cumplir las contraseñas
+package politica
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// comunes es la lista incluida de contraseñas frecuentes o filtradas,
+// comprimida con gzip: las ~7000 de la lista de zxcvbn (basada en las 10.000
+// más usadas recopiladas por Mark Burnett, licencia MIT) más algunas locales.
+// PASSWORD_DENYLIST permite sumar una lista más grande
+//
+//go:embed comunes.txt.gz
+var comunes []byte
+
+// LongitudMaxima es el límite en bytes que admite bcrypt; se aplica también
+// con argon2id para que cambiar de algoritmo no deje contraseñas sin rehashear
+const LongitudMaxima = 72
+
+// Politica son los requisitos de una contraseña
+type Politica struct {
+	LongitudMinima    int  `json:"longitud_minima"`
+	LongitudMaxima    int  `json:"longitud_maxima"` // en bytes
+	RequiereMayuscula bool `json:"requiere_mayuscula"`
+	RequiereMinuscula bool `json:"requiere_minuscula"`
+	RequiereDigito    bool `json:"requiere_digito"`
+	RequiereSimbolo   bool `json:"requiere_simbolo"`
+	RechazaComunes    bool `json:"rechaza_comunes"`
+
+	prohibidas map[string]bool
+}
+
+var (
+	once   sync.Once
+	actual *Politica
+)
+
+// Actual devuelve la política configurada con las variables de entorno
+// PASSWORD_MIN_LENGTH, PASSWORD_REQUIRE_UPPER, PASSWORD_REQUIRE_LOWER,
+// PASSWORD_REQUIRE_DIGIT, PASSWORD_REQUIRE_SYMBOL y PASSWORD_DENYLIST (archivo
+// con contraseñas prohibidas adicionales, una por línea, opcionalmente gzip)
+func Actual() *Politica {
+	once.Do(func() {
+		actual = &Politica{
+			LongitudMinima:    entero("PASSWORD_MIN_LENGTH", 8),
+			LongitudMaxima:    LongitudMaxima,
+			RequiereMayuscula: booleano("PASSWORD_REQUIRE_UPPER", true),
+			RequiereMinuscula: booleano("PASSWORD_REQUIRE_LOWER", true),
+			RequiereDigito:    booleano("PASSWORD_REQUIRE_DIGIT", true),
+			RequiereSimbolo:   booleano("PASSWORD_REQUIRE_SYMBOL", false),
+			RechazaComunes:    true,
+			prohibidas:        make(map[string]bool),
+		}
+
+		if err := cargarLista(actual.prohibidas, comunes); err != nil {
+			log.Printf("⚠️ No se pudo leer la lista incluida de contraseñas comunes: %v", err)
+		}
+		if ruta := os.Getenv("PASSWORD_DENYLIST"); ruta != "" {
+			contenido, err := os.ReadFile(ruta)
+			if err == nil {
+				err = cargarLista(actual.prohibidas, contenido)
+			}
+			if err != nil {
+				log.Printf("⚠️ No se pudo leer la lista de contraseñas prohibidas %s: %v", ruta, err)
+			}
+		}
+	})
+	return actual
+}
+
+// Validar verifica que la contraseña cumpla la política; correo y nombre se
+// usan para rechazar contraseñas que los contengan
+func (p *Politica) Validar(clave string, personales ...string) error {
+	if len([]rune(clave)) < p.LongitudMinima {
+		return errors.New("la contraseña debe tener al menos " + strconv.Itoa(p.LongitudMinima) + " caracteres")
+	}
+	if len(clave) > p.LongitudMaxima {
+		return errors.New("la contraseña no puede superar los " + strconv.Itoa(p.LongitudMaxima) +
+			" bytes; las letras acentuadas y otros símbolos ocupan más de uno")
+	}
+
+	// Antes que los tipos de caracteres: a "Password1" le sirve más saber que
+	// es común que saber qué le falta
+	normalizada := strings.ToLower(clave)
+	if p.RechazaComunes && p.esComun(normalizada) {
+		return errors.New("la contraseña es demasiado común, elija otra")
+	}
+
+	var mayuscula, minuscula, digito, simbolo bool
+	for _, r := range clave {
+		switch {
+		case unicode.IsUpper(r):
+			mayuscula = true
+		case unicode.IsLower(r):
+			minuscula = true
+		case unicode.IsDigit(r):
+			digito = true
+		default:
+			simbolo = true
+		}
+	}
+
+	var faltan []string
+	if p.RequiereMayuscula && !mayuscula {
+		faltan = append(faltan, "una mayúscula")
+	}
+	if p.RequiereMinuscula && !minuscula {
+		faltan = append(faltan, "una minúscula")
+	}
+	if p.RequiereDigito && !digito {
+		faltan = append(faltan, "un número")
+	}
+	if p.RequiereSimbolo && !simbolo {
+		faltan = append(faltan, "un símbolo")
+	}
+	if len(faltan) > 0 {
+		return errors.New("la contraseña debe incluir " + strings.Join(faltan, ", "))
+	}
+
+	for _, dato := range personales {
+		dato = strings.ToLower(strings.TrimSpace(dato))
+		if i := strings.Index(dato, "@"); i >= 0 {
+			dato = dato[:i]
+		}
+		if len(dato) >= 4 && strings.Contains(normalizada, dato) {
+			return errors.New("la contraseña no puede contener su nombre ni su correo")
+		}
+	}
+
+	return nil
+}
+
+// esComun indica si la contraseña (en minúsculas) figura en la lista, tal cual
+// o sin los dígitos y símbolos finales con que se suelen cumplir los requisitos
+// ("Dragon2024!" se compara también como "dragon")
+func (p *Politica) esComun(normalizada string) bool {
+	if p.prohibidas[normalizada] {
+		return true
+	}
+
+	base := strings.TrimRightFunc(normalizada, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	return len([]rune(base)) >= 4 && base != normalizada && p.prohibidas[base]
+}
+
+// cargarLista agrega las contraseñas del contenido, una por línea; acepta
+// contenido comprimido con gzip
+func cargarLista(destino map[string]bool, contenido []byte) error {
+	var lector io.Reader = bytes.NewReader(contenido)
+	if bytes.HasPrefix(contenido, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(lector)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		lector = gz
+	}
+
+	scanner := bufio.NewScanner(lector)
+	for scanner.Scan() {
+		if linea := strings.ToLower(strings.TrimSpace(scanner.Text())); linea != "" {
+			destino[linea] = true
+		}
+	}
+	return scanner.Err()
+}
+
+func entero(variable string, predeterminado int) int {
+	if n, err := strconv.Atoi(os.Getenv(variable)); err == nil && n > 0 {
+		return n
+	}
+	return predeterminado
+}
+
+func booleano(variable string, predeterminado bool) bool {
+	if b, err := strconv.ParseBool(os.Getenv(variable)); err == nil {
+		return b
+	}
+	return predeterminado
+}
@@ -16,7 +16,8 @@ func NewUserRepository() *UserRepository {
 // GetByEmail busca un usuario por correo electrónico
 func (r *UserRepository) GetByEmail(email string) (*models.Usuario, error) {
 	var user models.Usuario
-	query := `SELECT IDUSUARIO, NOMBRE, APELLIDO, CONTRASENIA, CORREO, TELEFONO, FECHAREGISTRO 
+	var verificacion, activacion sql.NullTime
+	query := `SELECT IDUSUARIO, NOMBRE, APELLIDO, CONTRASENIA, CORREO, TELEFONO, FECHAREGISTRO, FECHAVERIFICACION, TOTPACTIVACION 
 			  FROM Usuario WHERE CORREO = :1`
 
 	err := config.DB.QueryRow(query, email).Scan(
@@ -27,6 +28,8 @@ func (r *UserRepository) GetByEmail(email string) (*models.Usuario, error) {
 		&user.Correo,
 		&user.Telefono,
 		&user.FechaRegistro,
+		&verificacion,
+		&activacion,
 	)
 
 	if err == sql.ErrNoRows {
@@ -36,13 +39,16 @@ func (r *UserRepository) GetByEmail(email string) (*models.Usuario, error) {
 		return nil, err
 	}
 
+	setVerificacion(&user, verificacion)
+	user.DosFactores = activacion.Valid
 	return &user, nil
 }
 
 // GetByID busca un usuario por ID
 func (r *UserRepository) GetByID(id int) (*models.Usuario, error) {
 	var user models.Usuario
-	query := `SELECT IDUSUARIO, NOMBRE, APELLIDO, CONTRASENIA, CORREO, TELEFONO, FECHAREGISTRO 
+	var verificacion, activacion sql.NullTime
+	query := `SELECT IDUSUARIO, NOMBRE, APELLIDO, CONTRASENIA, CORREO, TELEFONO, FECHAREGISTRO, FECHAVERIFICACION, TOTPACTIVACION 
 			  FROM Usuario WHERE IDUSUARIO = :1`
 
 	err := config.DB.QueryRow(query, id).Scan(
@@ -53,6 +59,8 @@ func (r *UserRepository) GetByID(id int) (*models.Usuario, error) {
 		&user.Correo,
 		&user.Telefono,
 		&user.FechaRegistro,
+		&verificacion,
+		&activacion,
 	)
 
 	if err == sql.ErrNoRows {
@@ -62,6 +70,8 @@ func (r *UserRepository) GetByID(id int) (*models.Usuario, error) {
 		return nil, err
 	}
 
+	setVerificacion(&user, verificacion)
+	user.DosFactores = activacion.Valid
 	return &user, nil
 }
 
@@ -100,6 +110,14 @@ func (r *UserRepository) Update(user *models.Usuario) error {
 	return err
 }
 
+// UpdatePassword reemplaza el hash de la contraseña de un usuario
+func (r *UserRepository) UpdatePassword(userID int, hash string) error {
+	query := `UPDATE Usuario SET CONTRASENIA = :1 WHERE IDUSUARIO = :2`
+
+	_, err := config.DB.Exec(query, hash, userID)
+	return err
+}
+
 // GetRoles obtiene los roles de un usuario
 func (r *UserRepository) GetRoles(userID int) ([]string, error) {
 	query := `SELECT R.NOMBREROL 
@@ -130,6 +148,33 @@ func (r *UserRepository) GetRoles(userID int) ([]string, error) {
 	return roles, nil
 }
 
+// GetPermisos obtiene los permisos que otorgan los roles de un usuario
+func (r *UserRepository) GetPermisos(userID int) ([]string, error) {
+	query := `SELECT DISTINCT P.DESCRIPCION 
+			  FROM Permiso P 
+			  INNER JOIN RolPermiso RP ON P.IDPERMISO = RP.PERMISO_IDPERMISO 
+			  INNER JOIN UsuarioRol UR ON RP.ROLES_IDROL = UR.ROLES_IDROL 
+			  WHERE UR.USUARIO_IDUSUARIO = :1 
+			  ORDER BY P.DESCRIPCION`
+
+	rows, err := config.DB.Query(query, userID)
+	if err != nil {
+		return []string{}, err
+	}
+	defer rows.Close()
+
+	permisos := []string{}
+	for rows.Next() {
+		var permiso string
+		if err := rows.Scan(&permiso); err != nil {
+			return []string{}, err
+		}
+		permisos = append(permisos, permiso)
+	}
+
+	return permisos, rows.Err()
+}
+
 // AssignRole asigna un rol a un usuario
 func (r *UserRepository) AssignRole(userID, roleID int) error {
 	query := `INSERT INTO UsuarioRol (IDUSUARIOROL, USUARIO_IDUSUARIO, ROLES_IDROL) 
@@ -141,7 +186,7 @@ func (r *UserRepository) AssignRole(userID, roleID int) error {
 
 // GetAll obtiene todos los usuarios (para admin)
 func (r *UserRepository) GetAll() ([]*models.Usuario, error) {
-	query := `SELECT IDUSUARIO, NOMBRE, APELLIDO, CORREO, TELEFONO, FECHAREGISTRO 
+	query := `SELECT IDUSUARIO, NOMBRE, APELLIDO, CORREO, TELEFONO, FECHAREGISTRO, FECHAVERIFICACION, TOTPACTIVACION 
 			  FROM Usuario ORDER BY FECHAREGISTRO DESC`
 
 	rows, err := config.DB.Query(query)
@@ -153,6 +198,7 @@ func (r *UserRepository) GetAll() ([]*models.Usuario, error) {
 	var users []*models.Usuario
 	for rows.Next() {
 		var user models.Usuario
+		var verificacion, activacion sql.NullTime
 		if err := rows.Scan(
 			&user.IDUsuario,
 			&user.Nombre,
@@ -160,11 +206,23 @@ func (r *UserRepository) GetAll() ([]*models.Usuario, error) {
 			&user.Correo,
 			&user.Telefono,
 			&user.FechaRegistro,
+			&verificacion,
+			&activacion,
 		); err != nil {
 			return nil, err
 		}
+		setVerificacion(&user, verificacion)
+		user.DosFactores = activacion.Valid
 		users = append(users, &user)
 	}
 
 	return users, nil
 }
+
+// setVerificacion completa los datos de verificación del correo
+func setVerificacion(user *models.Usuario, verificacion sql.NullTime) {
+	if verificacion.Valid {
+		user.FechaVerificacion = &verificacion.Time
+		user.Verificado = true
+	}
+}
@@ -3,17 +3,29 @@ package routes
 import (
 	"proyecto-bd-final/internal/controllers"
 	"proyecto-bd-final/internal/middleware"
+	"proyecto-bd-final/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 // SetupRoutes configura todas las rutas de la aplicación
 func SetupRoutes(router *gin.Engine) {
+	// Claves públicas para que otros servicios verifiquen los tokens
+	router.GET("/.well-known/jwks.json", controllers.GetJWKS)
+
 	// Rutas públicas
 	public := router.Group("/api")
 	{
 		public.POST("/auth/login", controllers.Login)
+		public.POST("/auth/login/2fa", controllers.LoginSecondFactor)
+		public.GET("/auth/oidc/login", controllers.SSOLogin)
+		public.GET("/auth/oidc/callback", controllers.SSOCallback)
 		public.POST("/auth/register", controllers.Register)
+		public.POST("/auth/refresh", controllers.RefreshToken)
+		public.POST("/auth/password/forgot", controllers.ForgotPassword)
+		public.POST("/auth/password/reset", controllers.ResetPassword)
+		public.GET("/auth/password/policy", controllers.GetPasswordPolicy)
+		public.POST("/auth/verify-email", controllers.VerifyEmail)
 	}
 
 	// Rutas protegidas (requieren autenticación)
@@ -21,41 +33,167 @@ func SetupRoutes(router *gin.Engine) {
 	protected.Use(middleware.AuthMiddleware())
 	{
 		// Rutas de usuario
+		protected.POST("/auth/logout", controllers.Logout)
 		protected.GET("/profile", controllers.GetProfile)
 		protected.PUT("/profile", controllers.UpdateProfile)
+		protected.GET("/profile/permissions", controllers.GetMyPermissions)
+		protected.PUT("/profile/password", controllers.ChangePassword)
+		protected.POST("/profile/verify-email/resend", controllers.ResendVerification)
+
+		// Sesiones abiertas del usuario
+		protected.GET("/profile/sessions", controllers.GetMySessions)
+		protected.DELETE("/profile/sessions", controllers.RevokeOtherSessions)
+		protected.DELETE("/profile/sessions/:id", controllers.RevokeMySession)
+
+		// Segundo factor (TOTP)
+		protected.GET("/profile/2fa", controllers.GetTwoFactorStatus)
+		protected.POST("/profile/2fa/setup", controllers.SetupTwoFactor)
+		protected.POST("/profile/2fa/enable", controllers.EnableTwoFactor)
+		protected.POST("/profile/2fa/disable", controllers.DisableTwoFactor)
+		protected.POST("/profile/2fa/recovery-codes", controllers.RegenerateRecoveryCodes)
 
 		// Rutas de libros
 		protected.GET("/books", controllers.GetBooks)
 		protected.GET("/books/:isbn", controllers.GetBookByISBN)
+		protected.GET("/books/:isbn/availability", controllers.GetBookAvailability)
+
+		// Rutas de sucursales
+		protected.GET("/branches", controllers.GetBranches)
+
+		// Rutas de categorías
+		protected.GET("/categories", controllers.GetCategories)
+		protected.GET("/categories/:id/books", controllers.GetCategoryBooks)
 
 		// Rutas de préstamos
 		protected.GET("/loans/my-loans", controllers.GetMyLoans)
-		protected.POST("/loans", controllers.CreateLoan)
+		protected.POST("/loans", middleware.RequirePermission(services.PermisoSolicitarPrestamos), controllers.CreateLoan)
 		protected.PUT("/loans/:id/return", controllers.ReturnLoan)
 
-		// Rutas de admin
+		// Rutas de reservas
+		protected.GET("/holds/my-holds", controllers.GetMyHolds)
+		protected.POST("/holds", middleware.RequirePermission(services.PermisoSolicitarPrestamos), controllers.CreateHold)
+		protected.PUT("/holds/:id/cancel", controllers.CancelHold)
+
+		// Rutas del personal, limitadas a su sucursal
+		staff := protected.Group("/staff")
+		staff.Use(middleware.BranchScope())
+		{
+			prestamos := middleware.RequirePermission(services.PermisoGestionarPrestamos)
+			ejemplares := middleware.RequirePermission(services.PermisoGestionarEjemplares)
+			reportes := middleware.RequirePermission(services.PermisoVerReportes)
+
+			staff.GET("/loans", prestamos, controllers.GetBranchLoans)
+			staff.PUT("/loans/:id/return", prestamos, controllers.ReceiveLoanReturn)
+			staff.GET("/holds", prestamos, controllers.GetBranchHolds)
+			staff.PUT("/copies/:codigo/location", ejemplares, controllers.UpdateCopyLocation)
+			staff.POST("/copies/labels", ejemplares, controllers.PrintCopyLabels)
+			staff.GET("/labels/layouts", ejemplares, controllers.GetLabelLayouts)
+			staff.GET("/transfers", ejemplares, controllers.GetTransfers)
+			staff.POST("/transfers", ejemplares, controllers.RequestTransfer)
+			staff.PUT("/transfers/:id/send", ejemplares, controllers.SendTransfer)
+			staff.PUT("/transfers/:id/receive", ejemplares, controllers.ReceiveTransfer)
+			staff.PUT("/transfers/:id/cancel", ejemplares, controllers.CancelTransfer)
+			staff.GET("/stocktakes", ejemplares, controllers.GetStocktakes)
+			staff.POST("/stocktakes", ejemplares, controllers.StartStocktake)
+			staff.POST("/stocktakes/:id/scans", ejemplares, controllers.ScanStocktake)
+			staff.GET("/stocktakes/:id/report", ejemplares, controllers.GetStocktakeReport)
+			staff.PUT("/stocktakes/:id/close", ejemplares, controllers.CloseStocktake)
+			staff.PUT("/stocktakes/:id/cancel", ejemplares, controllers.CancelStocktake)
+			staff.GET("/deaccessions", ejemplares, controllers.GetDeaccessions)
+			staff.POST("/deaccessions", ejemplares, controllers.RequestDeaccession)
+			staff.GET("/deaccessions/candidates", ejemplares, controllers.GetDeaccessionCandidates)
+			staff.GET("/reports/prestamos-activos", reportes, controllers.GetReportePrestamosActivos)
+			staff.GET("/reports/estanteria", reportes, controllers.GetReporteEstanteria)
+		}
+
+		// Rutas de administración: cada una exige el permiso correspondiente
 		admin := protected.Group("/admin")
-		admin.Use(middleware.RequireRole("admin"))
 		{
-			admin.GET("/users", controllers.GetAllUsers)
-			admin.GET("/statistics", controllers.GetStatistics)
-			admin.GET("/bitacora", controllers.GetBitacora)
-			admin.GET("/loans", controllers.GetAllLoans) // Nuevo endpoint para admin
+			usuarios := middleware.RequirePermission(services.PermisoGestionarUsuarios)
+			libros := middleware.RequirePermission(services.PermisoGestionarLibros)
+			prestamos := middleware.RequirePermission(services.PermisoGestionarPrestamos)
+			ejemplares := middleware.RequirePermission(services.PermisoGestionarEjemplares)
+			sucursales := middleware.RequirePermission(services.PermisoGestionarSucursales)
+			roles := middleware.RequirePermission(services.PermisoGestionarRoles)
+			reportes := middleware.RequirePermission(services.PermisoVerReportes)
+
+			admin.GET("/users", usuarios, controllers.GetAllUsers)
+			admin.PUT("/users/:id/unlock", usuarios, controllers.UnlockUser)
+			admin.DELETE("/users/:id/2fa", usuarios, controllers.ResetUserTwoFactor)
+			admin.GET("/users/:id/sessions", usuarios, controllers.GetUserSessions)
+			admin.DELETE("/users/:id/sessions", usuarios, controllers.RevokeUserSessions)
+			admin.DELETE("/users/:id/sessions/:sesionId", usuarios, controllers.RevokeUserSession)
+			admin.GET("/statistics", reportes, controllers.GetStatistics)
+			admin.GET("/bitacora", middleware.RequirePermission(services.PermisoVerBitacora), controllers.GetBitacora)
 
 			// Gestión de libros (admin)
-			admin.POST("/books", controllers.CreateBook)
-			admin.PUT("/books/:isbn", controllers.UpdateBook)
-			admin.DELETE("/books/:isbn", controllers.DeleteBook)
+			admin.POST("/books", libros, controllers.CreateBook)
+			admin.GET("/books/export", libros, controllers.ExportBooks)
+			admin.POST("/books/reindex", libros, controllers.ReindexBooks)
+			admin.PUT("/books/:isbn", libros, controllers.UpdateBook)
+			admin.DELETE("/books/:isbn", libros, controllers.DeleteBook)
+			admin.PUT("/books/:isbn/categories", libros, controllers.SetBookCategories)
+			admin.GET("/labels/layouts", ejemplares, controllers.GetLabelLayouts)
+
+			// Gestión de categorías
+			admin.POST("/categories", libros, controllers.CreateCategory)
+			admin.PUT("/categories/:id", libros, controllers.UpdateCategory)
+			admin.DELETE("/categories/:id", libros, controllers.DeleteCategory)
+
+			// Gestión de sucursales
+			admin.POST("/branches", sucursales, controllers.CreateBranch)
+			admin.PUT("/branches/:id", sucursales, controllers.UpdateBranch)
+			admin.PUT("/staff/:id/branch", sucursales, controllers.AssignStaffBranch)
+
+			// Duplicados del catálogo
+			admin.GET("/duplicates/books", libros, controllers.GetDuplicateBooks)
+			admin.GET("/duplicates/authors", libros, controllers.GetDuplicateAuthors)
+			admin.POST("/books/merge", libros, controllers.MergeBooks)
+			admin.POST("/authors/merge", libros, controllers.MergeAuthors)
 
 			// Gestión de roles
-			admin.GET("/roles", controllers.GetRoles)
-			admin.POST("/users/:id/roles", controllers.AssignRole)
-
-			// Reportes (admin)
-			admin.GET("/reports/prestamos-activos", controllers.GetReportePrestamosActivos)
-			admin.GET("/reports/usuarios-activos", controllers.GetReporteUsuariosActivos)
-			admin.GET("/reports/libros-populares", controllers.GetReporteLibrosPopulares)
-			admin.GET("/reports/estadisticas", controllers.GetEstadisticasGenerales)
+			admin.GET("/roles", roles, controllers.GetRoles)
+			admin.POST("/roles", roles, controllers.CreateRole)
+			admin.GET("/roles/:id", roles, controllers.GetRole)
+			admin.PUT("/roles/:id", roles, controllers.UpdateRole)
+			admin.DELETE("/roles/:id", roles, controllers.DeleteRole)
+			admin.PUT("/roles/:id/permissions", roles, controllers.SetRolePermissions)
+			admin.GET("/permissions", roles, controllers.GetPermissions)
+			admin.POST("/users/:id/roles", roles, controllers.AssignRole)
+			admin.DELETE("/users/:id/roles/:rolId", roles, controllers.RevokeRole)
+
+			// Rutas que operan sobre ejemplares o movimientos de una sucursal:
+			// sobre todas solo con el rol admin, si no en la sucursal asignada
+			porSucursal := admin.Group("")
+			porSucursal.Use(middleware.BranchScope())
+			{
+				porSucursal.GET("/loans", prestamos, controllers.GetAllLoans) // Nuevo endpoint para admin
+				porSucursal.PUT("/copies/:codigo/location", ejemplares, controllers.UpdateCopyLocation)
+				porSucursal.POST("/copies/labels", ejemplares, controllers.PrintCopyLabels)
+
+				// Bajas de ejemplares y libros
+				porSucursal.GET("/deaccessions", libros, controllers.GetDeaccessions)
+				porSucursal.POST("/deaccessions", libros, controllers.RequestDeaccession)
+				porSucursal.GET("/deaccessions/candidates", libros, controllers.GetDeaccessionCandidates)
+				porSucursal.GET("/deaccessions/:id", libros, controllers.GetDeaccession)
+				porSucursal.PUT("/deaccessions/:id/approve", libros, controllers.ApproveDeaccession)
+				porSucursal.PUT("/deaccessions/:id/reject", libros, controllers.RejectDeaccession)
+
+				// Inventario de estanterías
+				porSucursal.GET("/stocktakes", ejemplares, controllers.GetStocktakes)
+				porSucursal.POST("/stocktakes", ejemplares, controllers.StartStocktake)
+				porSucursal.POST("/stocktakes/:id/scans", ejemplares, controllers.ScanStocktake)
+				porSucursal.GET("/stocktakes/:id/report", ejemplares, controllers.GetStocktakeReport)
+				porSucursal.PUT("/stocktakes/:id/close", ejemplares, controllers.CloseStocktake)
+				porSucursal.PUT("/stocktakes/:id/cancel", ejemplares, controllers.CancelStocktake)
+
+				// Reportes (admin)
+				porSucursal.GET("/reports/prestamos-activos", reportes, controllers.GetReportePrestamosActivos)
+				porSucursal.GET("/reports/usuarios-activos", reportes, controllers.GetReporteUsuariosActivos)
+				porSucursal.GET("/reports/libros-populares", reportes, controllers.GetReporteLibrosPopulares)
+				porSucursal.GET("/reports/estadisticas", reportes, controllers.GetEstadisticasGenerales)
+				porSucursal.GET("/reports/estanteria", reportes, controllers.GetReporteEstanteria)
+			}
 		}
 	}
 }
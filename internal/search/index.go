@@ -0,0 +1,237 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Pesos por campo: una coincidencia en el título vale más que en la editorial
+const (
+	pesoTitulo    = 3.0
+	pesoAutor     = 2.0
+	pesoCategoria = 1.5
+	pesoEditorial = 1.0
+)
+
+// Factores aplicados a coincidencias no exactas
+const (
+	factorPrefijo   = 0.7
+	factorDifuso1   = 0.5
+	factorDifuso2   = 0.3
+	minLargoPrefijo = 2
+	minLargoDifuso  = 4
+	minLargoDifuso2 = 8
+)
+
+// Documento es la representación indexable de un libro
+type Documento struct {
+	ISBN       string
+	Titulo     string
+	Autores    []string
+	Categorias []string
+	Editorial  string
+}
+
+// Resultado es un libro encontrado junto con su puntaje de relevancia
+type Resultado struct {
+	ISBN   string  `json:"isbn"`
+	Puntos float64 `json:"puntos"`
+}
+
+// Index es un índice invertido en memoria del catálogo
+type Index struct {
+	mu sync.RWMutex
+	// postings relaciona cada término con el peso que tiene en cada libro
+	postings map[string]map[string]float64
+	// terminos guarda los términos de cada libro para poder reindexarlo
+	terminos map[string]map[string]float64
+	// titulos se usa para desempatar resultados con el mismo puntaje
+	titulos map[string]string
+}
+
+// Catalogo es el índice compartido del catálogo de libros
+var Catalogo = NewIndex()
+
+// NewIndex crea un índice vacío
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string]map[string]float64),
+		terminos: make(map[string]map[string]float64),
+		titulos:  make(map[string]string),
+	}
+}
+
+// Replace reemplaza todo el contenido del índice
+func (idx *Index) Replace(docs []Documento) {
+	nuevo := NewIndex()
+	for _, doc := range docs {
+		nuevo.add(doc)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.postings = nuevo.postings
+	idx.terminos = nuevo.terminos
+	idx.titulos = nuevo.titulos
+}
+
+// Upsert agrega o actualiza un libro en el índice
+func (idx *Index) Upsert(doc Documento) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(doc.ISBN)
+	idx.add(doc)
+}
+
+// Remove elimina un libro del índice
+func (idx *Index) Remove(isbn string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(isbn)
+}
+
+// Len devuelve la cantidad de libros indexados
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.terminos)
+}
+
+func (idx *Index) add(doc Documento) {
+	pesos := make(map[string]float64)
+	for _, t := range Tokenize(doc.Titulo) {
+		pesos[t] += pesoTitulo
+	}
+	for _, autor := range doc.Autores {
+		for _, t := range Tokenize(autor) {
+			pesos[t] += pesoAutor
+		}
+	}
+	for _, categoria := range doc.Categorias {
+		for _, t := range Tokenize(categoria) {
+			pesos[t] += pesoCategoria
+		}
+	}
+	for _, t := range Tokenize(doc.Editorial) {
+		pesos[t] += pesoEditorial
+	}
+	// El ISBN se indexa tal cual para permitir búsquedas directas
+	if isbn := Fold(strings.TrimSpace(doc.ISBN)); isbn != "" {
+		pesos[isbn] += pesoTitulo
+	}
+
+	for t, peso := range pesos {
+		if idx.postings[t] == nil {
+			idx.postings[t] = make(map[string]float64)
+		}
+		idx.postings[t][doc.ISBN] = peso
+	}
+	idx.terminos[doc.ISBN] = pesos
+	idx.titulos[doc.ISBN] = Fold(doc.Titulo)
+}
+
+func (idx *Index) remove(isbn string) {
+	for t := range idx.terminos[isbn] {
+		delete(idx.postings[t], isbn)
+		if len(idx.postings[t]) == 0 {
+			delete(idx.postings, t)
+		}
+	}
+	delete(idx.terminos, isbn)
+	delete(idx.titulos, isbn)
+}
+
+// expansion es un término del vocabulario que coincide con un término buscado
+type expansion struct {
+	termino string
+	factor  float64
+}
+
+// expandir busca en el vocabulario las coincidencias exactas, por prefijo y
+// difusas de un término de la consulta
+func (idx *Index) expandir(q string) []expansion {
+	var exps []expansion
+	if _, ok := idx.postings[q]; ok {
+		exps = append(exps, expansion{q, 1})
+	}
+
+	largo := len([]rune(q))
+	maxDist := 0
+	if largo >= minLargoDifuso2 {
+		maxDist = 2
+	} else if largo >= minLargoDifuso {
+		maxDist = 1
+	}
+
+	for t := range idx.postings {
+		if t == q {
+			continue
+		}
+		if largo >= minLargoPrefijo && strings.HasPrefix(t, q) {
+			exps = append(exps, expansion{t, factorPrefijo})
+			continue
+		}
+		if maxDist == 0 {
+			continue
+		}
+		switch d := levenshtein(q, t, maxDist); {
+		case d > maxDist:
+		case d == 1:
+			exps = append(exps, expansion{t, factorDifuso1})
+		case d == 2:
+			exps = append(exps, expansion{t, factorDifuso2})
+		}
+	}
+	return exps
+}
+
+// Search devuelve los libros que coinciden con la consulta ordenados por
+// relevancia. Cada término de la consulta aporta el mejor puntaje TF-IDF entre
+// sus expansiones, y el total se pondera por la fracción de términos cubiertos
+func (idx *Index) Search(consulta string) []Resultado {
+	terminos := Tokenize(consulta)
+	if len(terminos) == 0 {
+		return []Resultado{}
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	total := float64(len(idx.terminos))
+	puntos := make(map[string]float64)
+	cubiertos := make(map[string]int)
+
+	for _, q := range terminos {
+		mejor := make(map[string]float64)
+		for _, exp := range idx.expandir(q) {
+			docs := idx.postings[exp.termino]
+			idf := math.Log(1 + total/float64(len(docs)))
+			for isbn, peso := range docs {
+				if p := exp.factor * idf * peso; p > mejor[isbn] {
+					mejor[isbn] = p
+				}
+			}
+		}
+		for isbn, p := range mejor {
+			puntos[isbn] += p
+			cubiertos[isbn]++
+		}
+	}
+
+	resultados := make([]Resultado, 0, len(puntos))
+	for isbn, p := range puntos {
+		cobertura := float64(cubiertos[isbn]) / float64(len(terminos))
+		resultados = append(resultados, Resultado{ISBN: isbn, Puntos: p * cobertura * cobertura})
+	}
+
+	sort.Slice(resultados, func(i, j int) bool {
+		if resultados[i].Puntos != resultados[j].Puntos {
+			return resultados[i].Puntos > resultados[j].Puntos
+		}
+		return idx.titulos[resultados[i].ISBN] < idx.titulos[resultados[j].ISBN]
+	})
+
+	return resultados
+}
@@ -0,0 +1,100 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// plegado reemplaza letras acentuadas por su forma base
+var plegado = map[rune]rune{
+	'á': 'a', 'à': 'a', 'ä': 'a', 'â': 'a', 'ã': 'a', 'å': 'a',
+	'é': 'e', 'è': 'e', 'ë': 'e', 'ê': 'e',
+	'í': 'i', 'ì': 'i', 'ï': 'i', 'î': 'i',
+	'ó': 'o', 'ò': 'o', 'ö': 'o', 'ô': 'o', 'õ': 'o', 'ø': 'o',
+	'ú': 'u', 'ù': 'u', 'ü': 'u', 'û': 'u',
+	'ñ': 'n', 'ç': 'c', 'ý': 'y', 'ÿ': 'y',
+}
+
+// palabrasVacias son términos demasiado frecuentes para aportar relevancia
+var palabrasVacias = map[string]bool{
+	"a": true, "al": true, "de": true, "del": true, "el": true, "en": true,
+	"la": true, "las": true, "lo": true, "los": true, "un": true, "una": true,
+	"y": true, "o": true, "para": true, "por": true, "con": true,
+	"the": true, "of": true, "and": true, "an": true, "to": true, "in": true,
+}
+
+// Fold convierte el texto a minúsculas y elimina los acentos
+func Fold(texto string) string {
+	var b strings.Builder
+	b.Grow(len(texto))
+	for _, r := range strings.ToLower(texto) {
+		if base, ok := plegado[r]; ok {
+			r = base
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Tokenize separa el texto en términos normalizados, descartando palabras vacías
+func Tokenize(texto string) []string {
+	campos := strings.FieldsFunc(Fold(texto), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := make([]string, 0, len(campos))
+	for _, campo := range campos {
+		if palabrasVacias[campo] {
+			continue
+		}
+		tokens = append(tokens, campo)
+	}
+	return tokens
+}
+
+// levenshtein calcula la distancia de edición entre dos términos, abandonando
+// el cálculo en cuanto supera max
+func levenshtein(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > max {
+		return max + 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		minFila := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			costo := 1
+			if ra[i-1] == rb[j-1] {
+				costo = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+costo)
+			minFila = min(minFila, curr[j])
+		}
+		if minFila > max {
+			return max + 1
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Distancia calcula la distancia de edición entre dos textos; si supera max
+// devuelve max+1 sin terminar el cálculo
+func Distancia(a, b string, max int) int {
+	return levenshtein(a, b, max)
+}
@@ -2,66 +2,234 @@ package services
 
 import (
 	"errors"
+	"log"
+	"proyecto-bd-final/internal/config"
+	"proyecto-bd-final/internal/directorio"
 	"proyecto-bd-final/internal/models"
+	"proyecto-bd-final/internal/politica"
 	"proyecto-bd-final/internal/repository"
 	"proyecto-bd-final/pkg/utils"
 )
 
 type AuthService struct {
-	userRepo *repository.UserRepository
+	userRepo            *repository.UserRepository
+	sesionService       *SesionService
+	autorizacionService *AutorizacionService
+	credencialesService *CredencialesService
+	bloqueoService      *BloqueoService
+	dosFactoresService  *DosFactoresService
+	ssoService          *SSOService
 }
 
 func NewAuthService() *AuthService {
 	return &AuthService{
-		userRepo: repository.NewUserRepository(),
+		userRepo:            repository.NewUserRepository(),
+		sesionService:       NewSesionService(),
+		autorizacionService: NewAutorizacionService(),
+		credencialesService: NewCredencialesService(),
+		bloqueoService:      NewBloqueoService(),
+		dosFactoresService:  NewDosFactoresService(),
+		ssoService:          NewSSOService(),
 	}
 }
 
-// Login autentica un usuario y genera un token JWT
-func (s *AuthService) Login(email, password string) (string, *models.Usuario, []string, error) {
+// Login autentica un usuario e inicia una sesión. Los intentos fallidos se
+// cuentan por cuenta y por IP y bloquean temporalmente a ambas
+func (s *AuthService) Login(email, password string, cliente models.Cliente) (*models.Tokens, *models.Usuario, []string, error) {
+	if err := s.bloqueoService.VerificarIP(cliente.IP); err != nil {
+		s.bloqueoService.RegistrarBloqueado(0, email, cliente.IP)
+		return nil, nil, nil, err
+	}
+
+	// Los dominios del directorio institucional se autentican contra LDAP
+	if dir := directorio.Actual(); dir != nil && dir.Aplica(email) {
+		return s.loginDirectorio(dir, email, password, cliente)
+	}
+
 	// Buscar usuario por email
 	user, err := s.userRepo.GetByEmail(email)
 	if err != nil {
-		return "", nil, nil, errors.New("credenciales inválidas")
+		s.bloqueoService.RegistrarFallo(0, email, cliente.IP)
+		return nil, nil, nil, errors.New("credenciales inválidas")
+	}
+
+	if err := s.bloqueoService.VerificarCuenta(user.IDUsuario); err != nil {
+		s.bloqueoService.RegistrarBloqueado(user.IDUsuario, email, cliente.IP)
+		return nil, nil, nil, err
 	}
 
 	// Verificar contraseña
 	if !utils.CheckPasswordHash(password, user.Contrasenia) {
-		return "", nil, nil, errors.New("credenciales inválidas")
+		s.bloqueoService.RegistrarFallo(user.IDUsuario, email, cliente.IP)
+		return nil, nil, nil, errors.New("credenciales inválidas")
 	}
 
-	// Obtener roles del usuario
-	roles, err := s.userRepo.GetRoles(user.IDUsuario)
+	// Actualizar el hash si se generó con otro algoritmo o parámetros; es el
+	// único momento en que se conoce la contraseña en claro
+	if utils.NeedsRehash(user.Contrasenia) {
+		s.actualizarHash(user.IDUsuario, password)
+	}
+
+	// Con segundo factor, el contador de fallos se reinicia recién al validar
+	// el código, para que la contraseña no sirva para seguir probando códigos
+	if user.DosFactores {
+		token, err := s.credencialesService.emitirToken(user.IDUsuario, TokenDosFactores, DuracionDesafioDosFactores)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return nil, nil, nil, &SegundoFactorError{Token: token}
+	}
+
+	return s.completarLogin(user, cliente)
+}
+
+// actualizarHash reemplaza el hash de la contraseña por uno con la
+// configuración vigente; si falla, el login sigue y se reintenta la próxima vez
+func (s *AuthService) actualizarHash(userID int, password string) {
+	hash, err := utils.HashPassword(password)
+	if err == nil {
+		err = s.userRepo.UpdatePassword(userID, hash)
+	}
 	if err != nil {
-		return "", nil, nil, err
+		log.Printf("⚠️ No se pudo actualizar el hash de la contraseña del usuario %d: %v", userID, err)
 	}
+}
 
-	// Si no tiene roles, asignar rol por defecto
-	if len(roles) == 0 {
-		roles = []string{"usuario"}
+// loginDirectorio verifica la contraseña con un bind al directorio y obtiene
+// la cuenta vinculada, creándola en el primer ingreso con los roles de sus grupos
+func (s *AuthService) loginDirectorio(dir *directorio.Directorio, email, password string, cliente models.Cliente) (*models.Tokens, *models.Usuario, []string, error) {
+	userID := 0
+	if existente, _ := s.userRepo.GetByEmail(email); existente != nil {
+		userID = existente.IDUsuario
+		if err := s.bloqueoService.VerificarCuenta(userID); err != nil {
+			s.bloqueoService.RegistrarBloqueado(userID, email, cliente.IP)
+			return nil, nil, nil, err
+		}
 	}
 
-	// Generar token JWT
-	token, err := utils.GenerateToken(user.IDUsuario, user.Correo, roles)
+	identidad, err := dir.Autenticar(email, password)
+	if err == directorio.ErrCredenciales {
+		s.bloqueoService.RegistrarFallo(userID, email, cliente.IP)
+		return nil, nil, nil, errors.New("credenciales inválidas")
+	}
 	if err != nil {
-		return "", nil, nil, err
+		return nil, nil, nil, err
+	}
+
+	user, err := s.ssoService.resolver(identidadExterna{
+		proveedor:        dir.Nombre(),
+		sujeto:           identidad.Sujeto,
+		correo:           identidad.Correo,
+		correoVerificado: true,
+		nombre:           identidad.Nombre,
+		apellido:         identidad.Apellido,
+		roles:            dir.Roles(identidad),
+	}, dir.RolPredeterminado(), true)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return s.LoginExterno(user, cliente)
+}
+
+// LoginSegundoFactor completa el inicio de sesión con el token del primer paso
+// y un código de la aplicación autenticadora o de recuperación
+func (s *AuthService) LoginSegundoFactor(token, codigo string, cliente models.Cliente) (*models.Tokens, *models.Usuario, []string, error) {
+	if err := s.bloqueoService.VerificarIP(cliente.IP); err != nil {
+		s.bloqueoService.RegistrarBloqueado(0, "segundo factor", cliente.IP)
+		return nil, nil, nil, err
+	}
+
+	userID, err := s.credencialesService.buscarToken(token, TokenDosFactores)
+	if err != nil {
+		return nil, nil, nil, errors.New("el inicio de sesión expiró, ingrese nuevamente")
+	}
+
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := s.bloqueoService.VerificarCuenta(userID); err != nil {
+		s.bloqueoService.RegistrarBloqueado(userID, user.Correo, cliente.IP)
+		return nil, nil, nil, err
+	}
+
+	if err := s.dosFactoresService.Verificar(userID, codigo); err != nil {
+		s.bloqueoService.RegistrarFallo(userID, user.Correo, cliente.IP)
+		return nil, nil, nil, err
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := s.credencialesService.consumirToken(tx, token, TokenDosFactores); err != nil {
+		return nil, nil, nil, errors.New("el inicio de sesión expiró, ingrese nuevamente")
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return s.completarLogin(user, cliente)
+}
+
+// LoginExterno inicia la sesión de un usuario autenticado por un proveedor de
+// identidad; si tiene segundo factor se pide igual que con contraseña
+func (s *AuthService) LoginExterno(user *models.Usuario, cliente models.Cliente) (*models.Tokens, *models.Usuario, []string, error) {
+	if user.DosFactores {
+		token, err := s.credencialesService.emitirToken(user.IDUsuario, TokenDosFactores, DuracionDesafioDosFactores)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return nil, nil, nil, &SegundoFactorError{Token: token}
 	}
 
-	return token, user, roles, nil
+	return s.completarLogin(user, cliente)
+}
+
+// completarLogin reinicia los intentos fallidos y emite los tokens de la sesión
+func (s *AuthService) completarLogin(user *models.Usuario, cliente models.Cliente) (*models.Tokens, *models.Usuario, []string, error) {
+	if err := s.bloqueoService.RegistrarExito(user.IDUsuario); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Obtener roles del usuario
+	roles, err := s.autorizacionService.RolesUsuario(user.IDUsuario)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	tokens, err := s.emitirTokens(user, roles, cliente)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return tokens, user, roles, nil
 }
 
 // Register registra un nuevo usuario
-func (s *AuthService) Register(nombre, apellido, email, password string, telefono int) (string, *models.Usuario, []string, error) {
+func (s *AuthService) Register(nombre, apellido, email, password string, telefono int, cliente models.Cliente) (*models.Tokens, *models.Usuario, []string, error) {
 	// Verificar si el email ya existe
 	existingUser, _ := s.userRepo.GetByEmail(email)
 	if existingUser != nil {
-		return "", nil, nil, errors.New("el correo ya está registrado")
+		return nil, nil, nil, errors.New("el correo ya está registrado")
+	}
+
+	if err := DominioPermitido(email); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := politica.Actual().Validar(password, email, nombre, apellido); err != nil {
+		return nil, nil, nil, err
 	}
 
 	// Hash de la contraseña
 	hashedPassword, err := utils.HashPassword(password)
 	if err != nil {
-		return "", nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	// Crear usuario
@@ -75,18 +243,79 @@ func (s *AuthService) Register(nombre, apellido, email, password string, telefon
 
 	err = s.userRepo.Create(user)
 	if err != nil {
-		return "", nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	// Asignar rol por defecto (estudiante)
 	// Asumiendo que el rol de estudiante tiene ID 2
+	if err := s.userRepo.AssignRole(user.IDUsuario, 2); err != nil {
+		return nil, nil, nil, err
+	}
 	roles := []string{"estudiante"}
 
-	// Generar token
-	token, err := utils.GenerateToken(user.IDUsuario, user.Correo, roles)
+	// La cuenta queda sin verificar hasta que confirme el correo
+	if err := s.credencialesService.EnviarVerificacion(user); err != nil {
+		log.Printf("⚠️ No se pudo enviar el correo de verificación a %s: %v", user.Correo, err)
+	}
+
+	tokens, err := s.emitirTokens(user, roles, cliente)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return tokens, user, roles, nil
+}
+
+// Refresh canjea el refresh token por un nuevo par de tokens, con los roles
+// vigentes del usuario
+func (s *AuthService) Refresh(refresh string, cliente models.Cliente) (*models.Tokens, *models.Usuario, []string, error) {
+	sesionID, userID, nuevo, err := s.sesionService.Rotar(refresh, cliente)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	roles, err := s.autorizacionService.RolesUsuario(userID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	token, err := utils.GenerateToken(user.IDUsuario, user.Correo, roles, sesionID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return &models.Tokens{
+		AccessToken:  token,
+		RefreshToken: nuevo,
+		ExpiraEn:     int(utils.DuracionAccessToken.Seconds()),
+	}, user, roles, nil
+}
+
+// Logout cierra la sesión a la que pertenece el token de acceso
+func (s *AuthService) Logout(sesionID, userID int) error {
+	return s.sesionService.Revocar(sesionID, userID)
+}
+
+// emitirTokens inicia una sesión y genera el token de acceso y el refresh token
+func (s *AuthService) emitirTokens(user *models.Usuario, roles []string, cliente models.Cliente) (*models.Tokens, error) {
+	sesionID, refresh, err := s.sesionService.Crear(user.IDUsuario, cliente)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := utils.GenerateToken(user.IDUsuario, user.Correo, roles, sesionID)
 	if err != nil {
-		return "", nil, nil, err
+		return nil, err
 	}
 
-	return token, user, roles, nil
+	return &models.Tokens{
+		AccessToken:  token,
+		RefreshToken: refresh,
+		ExpiraEn:     int(utils.DuracionAccessToken.Seconds()),
+	}, nil
 }
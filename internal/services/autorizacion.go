@@ -0,0 +1,133 @@
+package services
+
+import (
+	"proyecto-bd-final/internal/models"
+	"proyecto-bd-final/internal/repository"
+	"sync"
+	"time"
+)
+
+// Permisos del sistema (descripción en la tabla Permiso)
+const (
+	PermisoGestionarUsuarios   = "Gestionar usuarios"
+	PermisoGestionarLibros     = "Gestionar libros"
+	PermisoGestionarPrestamos  = "Gestionar préstamos"
+	PermisoVerBitacora         = "Ver bitácora"
+	PermisoGestionarRoles      = "Gestionar roles"
+	PermisoSolicitarPrestamos  = "Solicitar préstamos"
+	PermisoVerCatalogo         = "Ver catálogo"
+	PermisoGestionarEjemplares = "Gestionar ejemplares"
+	PermisoVerReportes         = "Ver reportes"
+	PermisoGestionarSucursales = "Gestionar sucursales"
+)
+
+// DuracionCacheRoles limita cuánto tarda en aplicarse un cambio de roles hecho
+// desde otra instancia del servidor; los cambios locales invalidan la caché
+const DuracionCacheRoles = 30 * time.Second
+
+type accesoCacheado struct {
+	acceso *models.AccesoUsuario
+	expira time.Time
+}
+
+// cacheAcceso guarda los roles y permisos vigentes de cada usuario para no
+// consultar Oracle en cada petición
+var cacheAcceso = struct {
+	sync.RWMutex
+	usuarios map[int]accesoCacheado
+}{usuarios: make(map[int]accesoCacheado)}
+
+type AutorizacionService struct {
+	userRepo *repository.UserRepository
+}
+
+func NewAutorizacionService() *AutorizacionService {
+	return &AutorizacionService{
+		userRepo: repository.NewUserRepository(),
+	}
+}
+
+// AccesoUsuario obtiene los roles y permisos actuales del usuario
+func (s *AutorizacionService) AccesoUsuario(userID int) (*models.AccesoUsuario, error) {
+	cacheAcceso.RLock()
+	entrada, ok := cacheAcceso.usuarios[userID]
+	cacheAcceso.RUnlock()
+
+	if ok && time.Now().Before(entrada.expira) {
+		return entrada.acceso, nil
+	}
+
+	roles, err := s.userRepo.GetRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Si no tiene roles, asignar rol por defecto
+	if len(roles) == 0 {
+		roles = []string{"usuario"}
+	}
+
+	permisos, err := s.userRepo.GetPermisos(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sin correo verificado no puede solicitar préstamos ni reservas
+	if !user.Verificado {
+		habilitados := permisos[:0]
+		for _, permiso := range permisos {
+			if permiso != PermisoSolicitarPrestamos {
+				habilitados = append(habilitados, permiso)
+			}
+		}
+		permisos = habilitados
+	}
+
+	// Si sus roles exigen segundo factor, no recibe permisos hasta activarlo
+	pendiente := !user.DosFactores && DosFactoresObligatorio(roles)
+	if pendiente {
+		permisos = []string{}
+	}
+
+	acceso := &models.AccesoUsuario{
+		Roles:                roles,
+		Permisos:             permisos,
+		Verificado:           user.Verificado,
+		DosFactoresPendiente: pendiente,
+	}
+
+	cacheAcceso.Lock()
+	cacheAcceso.usuarios[userID] = accesoCacheado{acceso: acceso, expira: time.Now().Add(DuracionCacheRoles)}
+	cacheAcceso.Unlock()
+
+	return acceso, nil
+}
+
+// RolesUsuario obtiene los roles actuales del usuario
+func (s *AutorizacionService) RolesUsuario(userID int) ([]string, error) {
+	acceso, err := s.AccesoUsuario(userID)
+	if err != nil {
+		return nil, err
+	}
+	return acceso.Roles, nil
+}
+
+// InvalidarRoles descarta los roles cacheados del usuario tras un cambio
+func (s *AutorizacionService) InvalidarRoles(userID int) {
+	cacheAcceso.Lock()
+	delete(cacheAcceso.usuarios, userID)
+	cacheAcceso.Unlock()
+}
+
+// InvalidarTodos descarta la caché completa, por ejemplo al cambiar los
+// permisos de un rol
+func (s *AutorizacionService) InvalidarTodos() {
+	cacheAcceso.Lock()
+	cacheAcceso.usuarios = make(map[int]accesoCacheado)
+	cacheAcceso.Unlock()
+}
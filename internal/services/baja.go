@@ -0,0 +1,504 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"proyecto-bd-final/internal/config"
+	"proyecto-bd-final/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Estados de una solicitud de baja
+const (
+	BajaPendiente = "PENDIENTE"
+	BajaAprobada  = "APROBADA"
+	BajaRechazada = "RECHAZADA"
+)
+
+// Motivos de baja de un ejemplar o título
+const (
+	MotivoDeteriorado    = "DETERIORADO"
+	MotivoDesactualizado = "DESACTUALIZADO"
+	MotivoPerdido        = "PERDIDO"
+	MotivoDonado         = "DONADO"
+)
+
+// AniosInactividadBaja es el período sin préstamos que se usa por defecto para
+// buscar candidatos a baja
+const AniosInactividadBaja = 3
+
+type BajaService struct {
+	bitacoraService *BitacoraService
+	reservaService  *ReservaService
+}
+
+func NewBajaService() *BajaService {
+	return &BajaService{
+		bitacoraService: NewBitacoraService(),
+		reservaService:  NewReservaService(),
+	}
+}
+
+const selectBaja = `SELECT B.idBaja, B.estado, B.motivo, B.observaciones, B.Libro_ISBN, L.titulo,
+              B.Ejemplar_codigo, B.fechaSolicitud, B.Usuario_idSolicita, B.fechaResolucion,
+              B.Usuario_idResuelve, B.comentarioResolucion
+              FROM Baja B
+              INNER JOIN Libro L ON L.ISBN = B.Libro_ISBN`
+
+// GetByID obtiene una solicitud de baja con los ejemplares retirados
+func (s *BajaService) GetByID(id int) (*models.Baja, error) {
+	baja, err := scanBaja(config.DB.QueryRow(selectBaja+` WHERE B.idBaja = :1`, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("solicitud de baja no encontrada")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT Ejemplar_codigo, estadoAnterior, Sucursal_idSucursal, localizacionAnterior
+              FROM BajaEjemplar
+              WHERE Baja_idBaja = :1
+              ORDER BY Ejemplar_codigo`
+
+	rows, err := config.DB.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ejemplar models.BajaEjemplar
+		var estado, localizacion sql.NullString
+
+		if err := rows.Scan(&ejemplar.EjemplarCodigo, &estado, &ejemplar.SucursalID, &localizacion); err != nil {
+			return nil, err
+		}
+		ejemplar.EstadoAnterior = estado.String
+		ejemplar.LocalizacionAnterior = localizacion.String
+		baja.Ejemplares = append(baja.Ejemplares, &ejemplar)
+	}
+
+	return baja, rows.Err()
+}
+
+// GetBajas obtiene las solicitudes de baja, opcionalmente filtradas por
+// estado. Con sucursal, solo las de ejemplares ubicados en ella
+func (s *BajaService) GetBajas(estado string, sucursalID int) ([]*models.Baja, error) {
+	query := selectBaja + `
+              WHERE (:1 IS NULL OR B.estado = :2)
+              AND (:3 IS NULL OR EXISTS (SELECT 1 FROM Ejemplar EJ
+                                         WHERE EJ.codigo = B.Ejemplar_codigo AND EJ.Sucursal_idUbicacion = :4))
+              ORDER BY B.fechaSolicitud DESC, B.idBaja DESC`
+
+	filtroEstado := nullString(estado)
+	filtroSucursal := nullSucursal(sucursalID)
+	rows, err := config.DB.Query(query, filtroEstado, filtroEstado, filtroSucursal, filtroSucursal)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bajas := []*models.Baja{}
+	for rows.Next() {
+		baja, err := scanBaja(rows)
+		if err != nil {
+			return nil, err
+		}
+		bajas = append(bajas, baja)
+	}
+
+	return bajas, rows.Err()
+}
+
+// Solicitar registra una solicitud de baja pendiente de aprobación. Si se
+// indica codigo se retira ese ejemplar; si no, el libro completo. sucursalID
+// es la sucursal de quien opera (0 para el administrador): el personal solo
+// puede pedir la baja de ejemplares ubicados en su sucursal
+func (s *BajaService) Solicitar(isbn string, codigo *int, motivo, observaciones string, sucursalID, userID int) (*models.Baja, error) {
+	motivo = strings.ToUpper(strings.TrimSpace(motivo))
+	switch motivo {
+	case MotivoDeteriorado, MotivoDesactualizado, MotivoPerdido, MotivoDonado:
+	default:
+		return nil, errors.New("motivo de baja inválido (DETERIORADO, DESACTUALIZADO, PERDIDO o DONADO)")
+	}
+
+	if codigo != nil {
+		var estado string
+		var ubicacionID int
+		err := config.DB.QueryRow(`SELECT Libro_ISBN, estado, Sucursal_idUbicacion FROM Ejemplar WHERE codigo = :1`, *codigo).
+			Scan(&isbn, &estado, &ubicacionID)
+		if err == sql.ErrNoRows {
+			return nil, errors.New("ejemplar no encontrado")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if sucursalID > 0 && ubicacionID != sucursalID {
+			return nil, errors.New("el ejemplar no está en tu sucursal")
+		}
+		if estado == EjemplarDadoDeBaja {
+			return nil, errors.New("el ejemplar ya fue dado de baja")
+		}
+	} else {
+		if sucursalID > 0 {
+			return nil, errors.New("solo el administrador puede dar de baja un libro completo")
+		}
+		var existe int
+		if err := config.DB.QueryRow(`SELECT COUNT(*) FROM Libro WHERE ISBN = :1`, isbn).Scan(&existe); err != nil {
+			return nil, err
+		}
+		if existe == 0 {
+			return nil, errors.New("libro no encontrado")
+		}
+	}
+
+	// No puede haber otra solicitud pendiente sobre el ejemplar o su libro
+	query := `SELECT COUNT(*) FROM Baja
+              WHERE estado = :1 AND Libro_ISBN = :2
+              AND (Ejemplar_codigo IS NULL OR :3 IS NULL OR Ejemplar_codigo = :4)`
+	var pendientes int
+	err := config.DB.QueryRow(query, BajaPendiente, isbn, nullInt(codigo), nullInt(codigo)).Scan(&pendientes)
+	if err != nil {
+		return nil, err
+	}
+	if pendientes > 0 {
+		return nil, errors.New("ya hay una solicitud de baja pendiente para este ejemplar o libro")
+	}
+
+	var id int
+	if err := config.DB.QueryRow("SELECT BAJA_SEQ.NEXTVAL FROM DUAL").Scan(&id); err != nil {
+		return nil, err
+	}
+
+	query = `INSERT INTO Baja (idBaja, estado, motivo, observaciones, Libro_ISBN, Ejemplar_codigo,
+             fechaSolicitud, Usuario_idSolicita)
+             VALUES (:1, :2, :3, :4, :5, :6, :7, :8)`
+	_, err = config.DB.Exec(query, id, BajaPendiente, motivo, nullString(strings.TrimSpace(observaciones)),
+		isbn, nullInt(codigo), time.Now(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Registrar en bitácora
+	objeto := "libro ISBN: " + isbn
+	if codigo != nil {
+		objeto = "ejemplar " + strconv.Itoa(*codigo) + " del " + objeto
+	}
+	s.bitacoraService.RegistrarAccion(userID, "SOLICITAR", "Baja",
+		"Solicitud de baja "+strconv.Itoa(id)+" ("+motivo+") del "+objeto)
+
+	return s.GetByID(id)
+}
+
+// Aprobar retira de la colección los ejemplares de la solicitud y deja
+// constancia de cada uno en BajaEjemplar. Los ejemplares prestados, en
+// tránsito o con un traslado pendiente impiden la aprobación
+func (s *BajaService) Aprobar(id int, comentario string, userID int) (*models.Baja, error) {
+	baja, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if baja.Estado != BajaPendiente {
+		return nil, errors.New("la solicitud de baja no está pendiente")
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT EJ.codigo, EJ.estado, EJ.Sucursal_idUbicacion, EJ.localizacion,
+              (SELECT COUNT(*) FROM Traslado T
+                WHERE T.Ejemplar_codigo = EJ.codigo AND T.estado IN (:1, :2)) AS TRASLADOS
+              FROM Ejemplar EJ
+              WHERE EJ.Libro_ISBN = :3 AND (:4 IS NULL OR EJ.codigo = :5) AND EJ.estado <> :6
+              ORDER BY EJ.codigo`
+
+	filtro := nullInt(baja.EjemplarCodigo)
+	rows, err := tx.Query(query, TrasladoSolicitado, TrasladoEnTransito, baja.LibroISBN, filtro, filtro, EjemplarDadoDeBaja)
+	if err != nil {
+		return nil, err
+	}
+
+	var ejemplares []*models.BajaEjemplar
+	var bloqueados []string
+	for rows.Next() {
+		var ejemplar models.BajaEjemplar
+		var localizacion sql.NullString
+		var traslados int
+
+		if err := rows.Scan(&ejemplar.EjemplarCodigo, &ejemplar.EstadoAnterior, &ejemplar.SucursalID,
+			&localizacion, &traslados); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ejemplar.LocalizacionAnterior = localizacion.String
+
+		if ejemplar.EstadoAnterior == EjemplarPrestado || ejemplar.EstadoAnterior == EjemplarEnTransito || traslados > 0 {
+			bloqueados = append(bloqueados, strconv.Itoa(ejemplar.EjemplarCodigo))
+		}
+		ejemplares = append(ejemplares, &ejemplar)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(bloqueados) > 0 {
+		return nil, errors.New("ejemplares prestados o en traslado: " + strings.Join(bloqueados, ", "))
+	}
+	if baja.EjemplarCodigo != nil && len(ejemplares) == 0 {
+		return nil, errors.New("el ejemplar ya fue dado de baja")
+	}
+
+	liberoReservas := false
+	for _, ejemplar := range ejemplares {
+		_, err := tx.Exec(`INSERT INTO BajaEjemplar (idBajaEjemplar, Baja_idBaja, Ejemplar_codigo,
+                           estadoAnterior, Sucursal_idSucursal, localizacionAnterior)
+                           VALUES (BAJAEJEMPLAR_SEQ.NEXTVAL, :1, :2, :3, :4, :5)`,
+			id, ejemplar.EjemplarCodigo, ejemplar.EstadoAnterior, ejemplar.SucursalID,
+			nullString(ejemplar.LocalizacionAnterior))
+		if err != nil {
+			return nil, err
+		}
+
+		// Si el ejemplar cambió de estado mientras tanto, no se retira
+		result, err := tx.Exec(`UPDATE Ejemplar SET estado = :1, localizacion = NULL
+                                WHERE codigo = :2 AND estado = :3`,
+			EjemplarDadoDeBaja, ejemplar.EjemplarCodigo, ejemplar.EstadoAnterior)
+		if err != nil {
+			return nil, err
+		}
+		if filas, _ := result.RowsAffected(); filas == 0 {
+			return nil, errors.New("el ejemplar " + strconv.Itoa(ejemplar.EjemplarCodigo) + " cambió de estado, intente nuevamente")
+		}
+
+		// La reserva que tenía apartado el ejemplar busca otro
+		if ejemplar.EstadoAnterior == EjemplarReservado {
+			_, err = tx.Exec(`UPDATE Reserva SET estado = :1, Ejemplar_codigo = NULL
+                              WHERE Ejemplar_codigo = :2 AND estado = :3`,
+				ReservaPendiente, ejemplar.EjemplarCodigo, ReservaLista)
+			if err != nil {
+				return nil, err
+			}
+			liberoReservas = true
+		}
+	}
+
+	// Sin ejemplares, las reservas del libro ya no se pueden atender
+	if baja.EjemplarCodigo == nil {
+		_, err = tx.Exec(`UPDATE Reserva SET estado = :1, Ejemplar_codigo = NULL
+                          WHERE Libro_ISBN = :2 AND estado IN (:3, :4)`,
+			ReservaCancelada, baja.LibroISBN, ReservaPendiente, ReservaLista)
+		if err != nil {
+			return nil, err
+		}
+		liberoReservas = false
+	}
+
+	_, err = tx.Exec(`UPDATE Baja SET estado = :1, fechaResolucion = :2, Usuario_idResuelve = :3,
+                      comentarioResolucion = :4
+                      WHERE idBaja = :5 AND estado = :6`,
+		BajaAprobada, time.Now(), userID, nullString(strings.TrimSpace(comentario)), id, BajaPendiente)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "APROBAR", "Baja",
+		"Baja "+strconv.Itoa(id)+" aprobada: "+strconv.Itoa(len(ejemplares))+" ejemplares retirados del libro ISBN: "+baja.LibroISBN)
+
+	if liberoReservas {
+		s.reservaService.AtenderPendientes(baja.LibroISBN, userID)
+	}
+
+	return s.GetByID(id)
+}
+
+// Rechazar descarta una solicitud de baja pendiente; el comentario es obligatorio
+func (s *BajaService) Rechazar(id int, comentario string, userID int) (*models.Baja, error) {
+	comentario = strings.TrimSpace(comentario)
+	if comentario == "" {
+		return nil, errors.New("debe indicar el motivo del rechazo")
+	}
+
+	result, err := config.DB.Exec(`UPDATE Baja SET estado = :1, fechaResolucion = :2, Usuario_idResuelve = :3,
+                                   comentarioResolucion = :4
+                                   WHERE idBaja = :5 AND estado = :6`,
+		BajaRechazada, time.Now(), userID, comentario, id, BajaPendiente)
+	if err != nil {
+		return nil, err
+	}
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		if _, err := s.GetByID(id); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("la solicitud de baja no está pendiente")
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "RECHAZAR", "Baja", "Baja "+strconv.Itoa(id)+" rechazada: "+comentario)
+
+	return s.GetByID(id)
+}
+
+// GetCandidatos busca candidatos a baja: ejemplares sin préstamos en los
+// últimos años (ingresados antes del período) y libros con varios ejemplares
+// ociosos. Se omiten los que ya tienen una solicitud pendiente
+func (s *BajaService) GetCandidatos(anios, sucursalID int) (*models.ReporteCandidatosBaja, error) {
+	if anios <= 0 {
+		return nil, errors.New("la cantidad de años debe ser positiva")
+	}
+
+	desde := time.Now().AddDate(-anios, 0, 0)
+	reporte := &models.ReporteCandidatosBaja{
+		Anios:               anios,
+		Desde:               desde,
+		EjemplaresInactivos: []*models.CandidatoBaja{},
+		TitulosExcedentes:   []*models.TituloExcedente{},
+	}
+	filtro := nullSucursal(sucursalID)
+
+	query := `SELECT EJ.codigo, L.ISBN, L.titulo, S.idSucursal, S.nombre, EJ.estado, EJ.localizacion,
+              EJ.fechaAlta,
+              (SELECT MAX(P.fechaPrestamo) FROM Prestamo P WHERE P.Ejemplar_codigo = EJ.codigo) AS ULTIMO
+              FROM Ejemplar EJ
+              INNER JOIN Libro L ON L.ISBN = EJ.Libro_ISBN
+              INNER JOIN Sucursal S ON S.idSucursal = EJ.Sucursal_idUbicacion
+              WHERE EJ.estado IN (:1, :2) AND EJ.fechaAlta <= :3
+              AND (:4 IS NULL OR EJ.Sucursal_idUbicacion = :5)
+              AND NOT EXISTS (SELECT 1 FROM Prestamo P
+                              WHERE P.Ejemplar_codigo = EJ.codigo AND P.fechaPrestamo >= :6)
+              AND NOT EXISTS (SELECT 1 FROM Baja B
+                              WHERE B.estado = :7 AND B.Libro_ISBN = EJ.Libro_ISBN
+                              AND (B.Ejemplar_codigo IS NULL OR B.Ejemplar_codigo = EJ.codigo))
+              ORDER BY ULTIMO NULLS FIRST, EJ.codigo`
+
+	rows, err := config.DB.Query(query, EjemplarDisponible, EjemplarPerdido, desde, filtro, filtro, desde, BajaPendiente)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var candidato models.CandidatoBaja
+		var localizacion sql.NullString
+		var ultimo sql.NullTime
+
+		if err := rows.Scan(
+			&candidato.EjemplarCodigo,
+			&candidato.LibroISBN,
+			&candidato.LibroTitulo,
+			&candidato.SucursalID,
+			&candidato.Sucursal,
+			&candidato.Estado,
+			&localizacion,
+			&candidato.FechaAlta,
+			&ultimo,
+		); err != nil {
+			return nil, err
+		}
+
+		candidato.Localizacion = localizacion.String
+		if ultimo.Valid {
+			candidato.UltimoPrestamo = &ultimo.Time
+		}
+		reporte.EjemplaresInactivos = append(reporte.EjemplaresInactivos, &candidato)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Libros con dos o más ejemplares sin préstamos en el período
+	query = `SELECT X.ISBN, X.titulo, COUNT(*) AS TOTAL,
+             SUM(CASE WHEN X.prestamos = 0 THEN 1 ELSE 0 END) AS OCIOSOS,
+             SUM(X.prestamos) AS PRESTAMOS, MAX(X.ultimo) AS ULTIMO
+             FROM (SELECT L.ISBN, L.titulo,
+                          (SELECT COUNT(*) FROM Prestamo P
+                            WHERE P.Ejemplar_codigo = EJ.codigo AND P.fechaPrestamo >= :1) AS prestamos,
+                          (SELECT MAX(P.fechaPrestamo) FROM Prestamo P
+                            WHERE P.Ejemplar_codigo = EJ.codigo) AS ultimo
+                   FROM Ejemplar EJ
+                   INNER JOIN Libro L ON L.ISBN = EJ.Libro_ISBN
+                   WHERE EJ.estado <> :2 AND EJ.fechaAlta <= :3
+                   AND (:4 IS NULL OR EJ.Sucursal_idUbicacion = :5)) X
+             GROUP BY X.ISBN, X.titulo
+             HAVING SUM(CASE WHEN X.prestamos = 0 THEN 1 ELSE 0 END) >= 2
+             ORDER BY OCIOSOS DESC, X.titulo`
+
+	excedentes, err := config.DB.Query(query, desde, EjemplarDadoDeBaja, desde, filtro, filtro)
+	if err != nil {
+		return nil, err
+	}
+	defer excedentes.Close()
+
+	for excedentes.Next() {
+		var titulo models.TituloExcedente
+		var ultimo sql.NullTime
+
+		if err := excedentes.Scan(
+			&titulo.LibroISBN,
+			&titulo.LibroTitulo,
+			&titulo.TotalEjemplares,
+			&titulo.EjemplaresOciosos,
+			&titulo.PrestamosPeriodo,
+			&ultimo,
+		); err != nil {
+			return nil, err
+		}
+
+		if ultimo.Valid {
+			titulo.UltimoPrestamo = &ultimo.Time
+		}
+		reporte.TitulosExcedentes = append(reporte.TitulosExcedentes, &titulo)
+	}
+
+	return reporte, excedentes.Err()
+}
+
+func scanBaja(row scanner) (*models.Baja, error) {
+	var baja models.Baja
+	var observaciones, comentario sql.NullString
+	var codigo, resuelveID sql.NullInt64
+	var fechaResolucion sql.NullTime
+
+	if err := row.Scan(
+		&baja.IDBaja,
+		&baja.Estado,
+		&baja.Motivo,
+		&observaciones,
+		&baja.LibroISBN,
+		&baja.LibroTitulo,
+		&codigo,
+		&baja.FechaSolicitud,
+		&baja.UsuarioSolicitaID,
+		&fechaResolucion,
+		&resuelveID,
+		&comentario,
+	); err != nil {
+		return nil, err
+	}
+
+	baja.Observaciones = observaciones.String
+	baja.ComentarioResolucion = comentario.String
+	if codigo.Valid {
+		c := int(codigo.Int64)
+		baja.EjemplarCodigo = &c
+	}
+	if fechaResolucion.Valid {
+		baja.FechaResolucion = &fechaResolucion.Time
+	}
+	if resuelveID.Valid {
+		r := int(resuelveID.Int64)
+		baja.UsuarioResuelveID = &r
+	}
+
+	return &baja, nil
+}
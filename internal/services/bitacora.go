@@ -13,12 +13,14 @@ func NewBitacoraService() *BitacoraService {
 	return &BitacoraService{}
 }
 
-// RegistrarAccion registra una acción en la bitácora
+// RegistrarAccion registra una acción en la bitácora; usuarioID 0 indica que no
+// hay un usuario identificado (por ejemplo, un login con un correo inexistente)
 func (s *BitacoraService) RegistrarAccion(usuarioID int, accion, entidad, detalle string) error {
 	query := `INSERT INTO Bitacora (IDBITACORA, ACCION, FECHAHORA, DETALLE, ENTIDAD, USUARIO_IDUSUARIO) 
 			  VALUES (BITACORA_SEQ.NEXTVAL, :1, :2, :3, :4, :5)`
 
-	_, err := config.DB.Exec(query, accion, time.Now(), detalle, entidad, usuarioID)
+	usuario := sql.NullInt64{Int64: int64(usuarioID), Valid: usuarioID > 0}
+	_, err := config.DB.Exec(query, accion, time.Now(), detalle, entidad, usuario)
 	return err
 }
 
@@ -51,16 +53,21 @@ func (s *BitacoraService) ObtenerBitacora(limite int, entidad string) ([]*models
 	var registros []*models.Bitacora
 	for rows.Next() {
 		var registro models.Bitacora
+		var usuario sql.NullInt64
 		if err := rows.Scan(
 			&registro.IDBitacora,
 			&registro.Accion,
 			&registro.FechaHora,
 			&registro.Detalle,
 			&registro.Entidad,
-			&registro.UsuarioID,
+			&usuario,
 		); err != nil {
 			return nil, err
 		}
+		if usuario.Valid {
+			id := int(usuario.Int64)
+			registro.UsuarioID = &id
+		}
 		registros = append(registros, &registro)
 	}
 
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"proyecto-bd-final/internal/config"
+	"strconv"
+	"time"
+)
+
+// Límites de intentos fallidos de inicio de sesión
+const (
+	// MaxIntentosCuenta son los fallos seguidos que bloquean la cuenta
+	MaxIntentosCuenta = 5
+	// BloqueoInicial es el primer bloqueo de la cuenta; se duplica con cada
+	// fallo posterior hasta BloqueoMaximo
+	BloqueoInicial = time.Minute
+	BloqueoMaximo  = time.Hour
+	// MaxIntentosIP son los fallos que bloquean una IP dentro de VentanaIntentosIP
+	MaxIntentosIP     = 20
+	VentanaIntentosIP = 15 * time.Minute
+	// RetrasoPorFallo demora cada respuesta fallida según los fallos acumulados
+	RetrasoPorFallo = 250 * time.Millisecond
+	RetrasoMaximo   = 3 * time.Second
+)
+
+// fallosIP cuenta los inicios de sesión fallidos de cada IP, existan o no las
+// cuentas usadas
+var fallosIP = newLimitador(MaxIntentosIP, VentanaIntentosIP)
+
+// BloqueoError indica que la cuenta o la IP están bloqueadas temporalmente
+type BloqueoError struct {
+	Hasta time.Time
+}
+
+func (e *BloqueoError) Error() string {
+	minutos := int(math.Ceil(time.Until(e.Hasta).Minutes()))
+	if minutos < 1 {
+		minutos = 1
+	}
+	return "demasiados intentos fallidos, intente nuevamente en " + strconv.Itoa(minutos) + " minuto(s)"
+}
+
+type BloqueoService struct {
+	bitacoraService *BitacoraService
+}
+
+func NewBloqueoService() *BloqueoService {
+	return &BloqueoService{
+		bitacoraService: NewBitacoraService(),
+	}
+}
+
+// VerificarIP rechaza la IP si acumuló demasiados fallos recientes
+func (s *BloqueoService) VerificarIP(ip string) error {
+	if fallosIP.Excedido(ip) {
+		return &BloqueoError{Hasta: time.Now().Add(VentanaIntentosIP)}
+	}
+	return nil
+}
+
+// VerificarCuenta rechaza la cuenta mientras esté bloqueada
+func (s *BloqueoService) VerificarCuenta(userID int) error {
+	var bloqueo sql.NullTime
+	err := config.DB.QueryRow(`SELECT bloqueadoHasta FROM Usuario WHERE idUsuario = :1`, userID).Scan(&bloqueo)
+	if err != nil {
+		return err
+	}
+
+	if bloqueo.Valid && time.Now().Before(bloqueo.Time) {
+		return &BloqueoError{Hasta: bloqueo.Time}
+	}
+	return nil
+}
+
+// RegistrarFallo suma un intento fallido a la IP y, si se conoce, a la cuenta
+// (userID 0 para correos no registrados). Bloquea la cuenta al llegar a
+// MaxIntentosCuenta, registra el intento en la bitácora y demora la respuesta
+func (s *BloqueoService) RegistrarFallo(userID int, correo, ip string) {
+	fallos := fallosIP.Registrar(ip)
+
+	if userID == 0 {
+		s.bitacoraService.RegistrarAccion(0, "LOGIN_FAILED", "Usuario",
+			"Intento con correo no registrado "+correo+" desde "+ip)
+		esperar(fallos)
+		return
+	}
+
+	var intentos int
+	_, err := config.DB.Exec(`UPDATE Usuario SET intentosFallidos = intentosFallidos + 1
+	                          WHERE idUsuario = :1
+	                          RETURNING intentosFallidos INTO :2`,
+		userID, sql.Out{Dest: &intentos})
+	if err != nil {
+		esperar(fallos)
+		return
+	}
+
+	s.bitacoraService.RegistrarAccion(userID, "LOGIN_FAILED", "Usuario",
+		"Contraseña incorrecta desde "+ip+" (intento "+strconv.Itoa(intentos)+")")
+
+	if intentos >= MaxIntentosCuenta {
+		hasta := time.Now().Add(duracionBloqueo(intentos))
+		_, err := config.DB.Exec(`UPDATE Usuario SET bloqueadoHasta = :1 WHERE idUsuario = :2`, hasta, userID)
+		if err == nil {
+			s.bitacoraService.RegistrarAccion(userID, "LOCK", "Usuario",
+				"Cuenta bloqueada hasta "+hasta.Format("2006-01-02 15:04")+" tras "+strconv.Itoa(intentos)+" intentos fallidos")
+		}
+	}
+
+	if intentos > fallos {
+		fallos = intentos
+	}
+	esperar(fallos)
+}
+
+// RegistrarBloqueado audita un intento rechazado por bloqueo
+func (s *BloqueoService) RegistrarBloqueado(userID int, correo, ip string) {
+	s.bitacoraService.RegistrarAccion(userID, "LOGIN_BLOCKED", "Usuario",
+		"Intento bloqueado para "+correo+" desde "+ip)
+}
+
+// RegistrarExito reinicia el contador de la cuenta tras un inicio de sesión
+// correcto
+func (s *BloqueoService) RegistrarExito(userID int) error {
+	_, err := config.DB.Exec(`UPDATE Usuario SET intentosFallidos = 0, bloqueadoHasta = NULL
+	                          WHERE idUsuario = :1 AND (intentosFallidos > 0 OR bloqueadoHasta IS NOT NULL)`,
+		userID)
+	return err
+}
+
+// Desbloquear levanta el bloqueo de una cuenta y reinicia sus intentos
+func (s *BloqueoService) Desbloquear(userID, adminID int) error {
+	result, err := config.DB.Exec(`UPDATE Usuario SET intentosFallidos = 0, bloqueadoHasta = NULL
+	                               WHERE idUsuario = :1`, userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.New("usuario no encontrado")
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(adminID, "UNLOCK", "Usuario",
+		"Cuenta del usuario "+strconv.Itoa(userID)+" desbloqueada")
+
+	return nil
+}
+
+// duracionBloqueo duplica el bloqueo con cada fallo por encima del máximo
+func duracionBloqueo(intentos int) time.Duration {
+	duracion := BloqueoInicial
+	for i := MaxIntentosCuenta; i < intentos && duracion < BloqueoMaximo; i++ {
+		duracion *= 2
+	}
+	if duracion > BloqueoMaximo {
+		duracion = BloqueoMaximo
+	}
+	return duracion
+}
+
+// esperar demora la respuesta de forma proporcional a los fallos acumulados
+func esperar(fallos int) {
+	retraso := time.Duration(fallos) * RetrasoPorFallo
+	if retraso > RetrasoMaximo {
+		retraso = RetrasoMaximo
+	}
+	time.Sleep(retraso)
+}
@@ -2,8 +2,12 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"proyecto-bd-final/internal/config"
 	"proyecto-bd-final/internal/models"
+	"proyecto-bd-final/internal/search"
+	"strconv"
+	"strings"
 )
 
 type BookService struct {
@@ -16,69 +20,17 @@ func NewBookService() *BookService {
 	}
 }
 
-// GetAll obtiene todos los libros con sus autores y editorial
-func (s *BookService) GetAll() ([]*models.Libro, error) {
-	query := `SELECT DISTINCT L.ISBN, L.titulo, EXTRACT(YEAR FROM L.anioEdicion) as anio,
-              L.Editorial_idEditorial, E.nombre AS EDITORIAL_NOMBRE
-              FROM Libro L
-              LEFT JOIN Editorial E ON L.Editorial_idEditorial = E.idEditorial
-              ORDER BY L.titulo`
-
-	rows, err := config.DB.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var libros []*models.Libro
-	for rows.Next() {
-		var libro models.Libro
-		var editorialNombre sql.NullString
-
-		if err := rows.Scan(
-			&libro.ISBN,
-			&libro.Titulo,
-			&libro.AnioPublicacion,
-			&libro.EditorialID,
-			&editorialNombre,
-		); err != nil {
-			return nil, err
-		}
-
-		if editorialNombre.Valid {
-			libro.EditorialNombre = editorialNombre.String
-		}
-
-		// Obtener cantidad de ejemplares
-		cantidad, _ := s.GetCantidadEjemplares(libro.ISBN)
-		libro.Cantidad = cantidad
-
-		// Obtener autores del libro
-		autores, err := s.GetAutoresByISBN(libro.ISBN)
-		if err == nil {
-			libro.Autores = autores
-		}
-
-		// Verificar disponibilidad
-		disponible, _ := s.VerificarDisponibilidad(libro.ISBN)
-		libro.Disponible = disponible
-
-		libros = append(libros, &libro)
-	}
-
-	return libros, nil
-}
-
 // GetByISBN obtiene un libro por ISBN
 func (s *BookService) GetByISBN(isbn string) (*models.Libro, error) {
 	query := `SELECT L.ISBN, L.titulo, EXTRACT(YEAR FROM L.anioEdicion) as anio,
-              L.Editorial_idEditorial, E.nombre AS EDITORIAL_NOMBRE
+              L.Editorial_idEditorial, E.nombre AS EDITORIAL_NOMBRE,
+              L.signatura, L.sistemaClasificacion
               FROM Libro L
               LEFT JOIN Editorial E ON L.Editorial_idEditorial = E.idEditorial
               WHERE L.ISBN = :1`
 
 	var libro models.Libro
-	var editorialNombre sql.NullString
+	var editorialNombre, signatura, sistema sql.NullString
 
 	err := config.DB.QueryRow(query, isbn).Scan(
 		&libro.ISBN,
@@ -86,6 +38,8 @@ func (s *BookService) GetByISBN(isbn string) (*models.Libro, error) {
 		&libro.AnioPublicacion,
 		&libro.EditorialID,
 		&editorialNombre,
+		&signatura,
+		&sistema,
 	)
 
 	if err != nil {
@@ -95,6 +49,8 @@ func (s *BookService) GetByISBN(isbn string) (*models.Libro, error) {
 	if editorialNombre.Valid {
 		libro.EditorialNombre = editorialNombre.String
 	}
+	libro.Signatura = signatura.String
+	libro.SistemaClasificacion = sistema.String
 
 	// Obtener cantidad de ejemplares
 	cantidad, _ := s.GetCantidadEjemplares(isbn)
@@ -106,13 +62,90 @@ func (s *BookService) GetByISBN(isbn string) (*models.Libro, error) {
 		libro.Autores = autores
 	}
 
+	// Obtener categorías
+	categorias, err := s.GetCategoriasByISBN(isbn)
+	if err == nil {
+		libro.Categorias = categorias
+	}
+
 	// Verificar disponibilidad
 	disponible, _ := s.VerificarDisponibilidad(isbn)
 	libro.Disponible = disponible
 
+	// Obtener ejemplares con su ubicación
+	ejemplares, err := s.GetEjemplaresByISBN(isbn)
+	if err == nil {
+		libro.Ejemplares = ejemplares
+	}
+
 	return &libro, nil
 }
 
+// GetEjemplaresByISBN obtiene los ejemplares de un libro con su estado y ubicación
+func (s *BookService) GetEjemplaresByISBN(isbn string) ([]*models.Ejemplar, error) {
+	query := `SELECT EJ.codigo, EJ.localizacion, EJ.estado, EJ.Libro_ISBN,
+              EJ.Sucursal_idPropietaria, EJ.Sucursal_idUbicacion, S.nombre
+              FROM Ejemplar EJ
+              INNER JOIN Sucursal S ON EJ.Sucursal_idUbicacion = S.idSucursal
+              WHERE EJ.Libro_ISBN = :1 AND EJ.estado <> 'BAJA'
+              ORDER BY EJ.codigo`
+
+	rows, err := config.DB.Query(query, isbn)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ejemplares []*models.Ejemplar
+	for rows.Next() {
+		var ejemplar models.Ejemplar
+		var localizacion sql.NullString
+
+		if err := rows.Scan(
+			&ejemplar.IDEjemplar,
+			&localizacion,
+			&ejemplar.Estado,
+			&ejemplar.LibroISBN,
+			&ejemplar.SucursalPropietariaID,
+			&ejemplar.SucursalID,
+			&ejemplar.SucursalNombre,
+		); err != nil {
+			return nil, err
+		}
+
+		ejemplar.Localizacion = localizacion.String
+		ejemplares = append(ejemplares, &ejemplar)
+	}
+
+	return ejemplares, nil
+}
+
+// UpdateLocalizacionEjemplar cambia la ubicación física de un ejemplar; si se
+// indica sucursal, el ejemplar debe estar ubicado en ella
+func (s *BookService) UpdateLocalizacionEjemplar(codigo int, localizacion string, sucursalID int, userID int) error {
+	query := `UPDATE Ejemplar SET localizacion = :1
+              WHERE codigo = :2 AND (:3 IS NULL OR Sucursal_idUbicacion = :4)`
+
+	filtro := nullSucursal(sucursalID)
+	result, err := config.DB.Exec(query, nullString(localizacion), codigo, filtro, filtro)
+	if err != nil {
+		return err
+	}
+
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		if sucursalID > 0 {
+			return errors.New("ejemplar no encontrado en la sucursal")
+		}
+		return errors.New("ejemplar no encontrado")
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "UPDATE", "Ejemplar",
+		"Ejemplar "+strconv.Itoa(codigo)+" reubicado en: "+localizacion)
+
+	return nil
+}
+
 // GetAutoresByISBN obtiene los autores de un libro
 func (s *BookService) GetAutoresByISBN(isbn string) ([]string, error) {
 	query := `SELECT A.nombre || ' ' || A.apellido AS NombreCompleto
@@ -138,6 +171,32 @@ func (s *BookService) GetAutoresByISBN(isbn string) ([]string, error) {
 	return autores, nil
 }
 
+// GetCategoriasByISBN obtiene los nombres de las categorías de un libro
+func (s *BookService) GetCategoriasByISBN(isbn string) ([]string, error) {
+	query := `SELECT C.nombre
+              FROM Categoria C
+              INNER JOIN LibroCategoria LC ON C.idCategoria = LC.Categoria_idCategoria
+              WHERE LC.Libro_ISBN = :1
+              ORDER BY C.nombre`
+
+	rows, err := config.DB.Query(query, isbn)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categorias []string
+	for rows.Next() {
+		var nombre string
+		if err := rows.Scan(&nombre); err != nil {
+			return nil, err
+		}
+		categorias = append(categorias, nombre)
+	}
+
+	return categorias, nil
+}
+
 // VerificarDisponibilidad verifica si hay ejemplares disponibles
 func (s *BookService) VerificarDisponibilidad(isbn string) (bool, error) {
 	query := `SELECT COUNT(*) 
@@ -157,7 +216,7 @@ func (s *BookService) VerificarDisponibilidad(isbn string) (bool, error) {
 func (s *BookService) GetCantidadEjemplares(isbn string) (int, error) {
 	query := `SELECT COUNT(*) 
               FROM Ejemplar 
-              WHERE Libro_ISBN = :1`
+              WHERE Libro_ISBN = :1 AND estado <> 'BAJA'`
 
 	var count int
 	err := config.DB.QueryRow(query, isbn).Scan(&count)
@@ -168,64 +227,107 @@ func (s *BookService) GetCantidadEjemplares(isbn string) (int, error) {
 	return count, nil
 }
 
-// SearchBooks busca libros por título o autor
-func (s *BookService) SearchBooks(searchTerm string) ([]*models.Libro, error) {
-	query := `SELECT DISTINCT L.ISBN, L.titulo, EXTRACT(YEAR FROM L.anioEdicion) as anio,
-              L.Editorial_idEditorial, E.nombre AS EDITORIAL_NOMBRE
+// RebuildSearchIndex reconstruye el índice de búsqueda a partir de la base de datos
+func (s *BookService) RebuildSearchIndex() (int, error) {
+	query := `SELECT L.ISBN, L.titulo, E.nombre AS EDITORIAL_NOMBRE,
+              (SELECT LISTAGG(A.nombre || ' ' || A.apellido, '|')
+                      WITHIN GROUP (ORDER BY LA.idLibroAutor)
+                 FROM LibroAutor LA
+                 INNER JOIN Autor A ON A.idAutor = LA.Autor_idAutor
+                WHERE LA.Libro_ISBN = L.ISBN) AS AUTORES,
+              (SELECT LISTAGG(C.nombre, '|') WITHIN GROUP (ORDER BY C.nombre)
+                 FROM LibroCategoria LC
+                 INNER JOIN Categoria C ON C.idCategoria = LC.Categoria_idCategoria
+                WHERE LC.Libro_ISBN = L.ISBN) AS CATEGORIAS
               FROM Libro L
-              LEFT JOIN Editorial E ON L.Editorial_idEditorial = E.idEditorial
-              LEFT JOIN LibroAutor LA ON L.ISBN = LA.Libro_ISBN
-              LEFT JOIN Autor A ON LA.Autor_idAutor = A.idAutor
-              WHERE LOWER(L.titulo) LIKE '%' || LOWER(:1) || '%'
-              OR LOWER(A.nombre) LIKE '%' || LOWER(:2) || '%'
-              OR LOWER(A.apellido) LIKE '%' || LOWER(:3) || '%'
-              ORDER BY L.titulo`
+              LEFT JOIN Editorial E ON L.Editorial_idEditorial = E.idEditorial`
 
-	rows, err := config.DB.Query(query, searchTerm, searchTerm, searchTerm)
+	rows, err := config.DB.Query(query)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	defer rows.Close()
 
-	var libros []*models.Libro
+	var docs []search.Documento
 	for rows.Next() {
-		var libro models.Libro
-		var editorialNombre sql.NullString
+		var doc search.Documento
+		var editorial, autores, categorias sql.NullString
 
-		if err := rows.Scan(
-			&libro.ISBN,
-			&libro.Titulo,
-			&libro.AnioPublicacion,
-			&libro.EditorialID,
-			&editorialNombre,
-		); err != nil {
-			return nil, err
+		if err := rows.Scan(&doc.ISBN, &doc.Titulo, &editorial, &autores, &categorias); err != nil {
+			return 0, err
 		}
 
-		if editorialNombre.Valid {
-			libro.EditorialNombre = editorialNombre.String
-		}
+		doc.Editorial = editorial.String
+		doc.Autores = splitLista(autores)
+		doc.Categorias = splitLista(categorias)
+		docs = append(docs, doc)
+	}
 
-		// Obtener cantidad de ejemplares
-		cantidad, _ := s.GetCantidadEjemplares(libro.ISBN)
-		libro.Cantidad = cantidad
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
 
-		autores, err := s.GetAutoresByISBN(libro.ISBN)
-		if err == nil {
-			libro.Autores = autores
-		}
+	search.Catalogo.Replace(docs)
+	return len(docs), nil
+}
 
-		disponible, _ := s.VerificarDisponibilidad(libro.ISBN)
-		libro.Disponible = disponible
+// indexarLibro actualiza la entrada de un libro en el índice de búsqueda
+func (s *BookService) indexarLibro(isbn string) {
+	libro, err := s.GetByISBN(isbn)
+	if err != nil {
+		return
+	}
 
-		libros = append(libros, &libro)
+	search.Catalogo.Upsert(search.Documento{
+		ISBN:       libro.ISBN,
+		Titulo:     libro.Titulo,
+		Autores:    libro.Autores,
+		Categorias: libro.Categorias,
+		Editorial:  libro.EditorialNombre,
+	})
+}
+
+// buscarISBNsSQL busca libros por título o autor con LIKE y devuelve sus ISBN
+// ordenados por título; se usa mientras el índice de búsqueda no está construido
+func (s *BookService) buscarISBNsSQL(searchTerm string) ([]string, error) {
+	query := `SELECT L.ISBN
+              FROM Libro L
+              WHERE LOWER(L.titulo) LIKE '%' || LOWER(:1) || '%'
+              OR EXISTS (SELECT 1 FROM LibroAutor LA
+                         INNER JOIN Autor A ON LA.Autor_idAutor = A.idAutor
+                         WHERE LA.Libro_ISBN = L.ISBN
+                         AND (LOWER(A.nombre) LIKE '%' || LOWER(:2) || '%'
+                              OR LOWER(A.apellido) LIKE '%' || LOWER(:3) || '%'))
+              ORDER BY L.titulo`
+	rows, err := config.DB.Query(query, searchTerm, searchTerm, searchTerm)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var isbns []string
+	for rows.Next() {
+		var isbn string
+		if err := rows.Scan(&isbn); err != nil {
+			return nil, err
+		}
+		isbns = append(isbns, isbn)
 	}
 
-	return libros, nil
+	return isbns, rows.Err()
 }
 
-// Create crea un nuevo libro
-func (s *BookService) Create(libro *models.Libro, userID int) error {
+// Create crea un nuevo libro; los ejemplares pertenecen a la sucursal indicada
+// (la central si es 0) y se ubican en localizacion
+func (s *BookService) Create(libro *models.Libro, localizacion string, sucursalID int, userID int) error {
+	if sucursalID == 0 {
+		sucursalID = SucursalCentral
+	}
+
+	if err := normalizarSignatura(libro); err != nil {
+		return err
+	}
+
 	tx, err := config.DB.Begin()
 	if err != nil {
 		return err
@@ -233,19 +335,21 @@ func (s *BookService) Create(libro *models.Libro, userID int) error {
 	defer tx.Rollback()
 
 	// Insertar libro usando TO_DATE para convertir el año
-	query := `INSERT INTO Libro (ISBN, titulo, anioEdicion, Editorial_idEditorial) 
-              VALUES (:1, :2, TO_DATE(:3, 'YYYY'), :4)`
+	query := `INSERT INTO Libro (ISBN, titulo, anioEdicion, Editorial_idEditorial, signatura, sistemaClasificacion) 
+              VALUES (:1, :2, TO_DATE(:3, 'YYYY'), :4, :5, :6)`
 
-	_, err = tx.Exec(query, libro.ISBN, libro.Titulo, libro.AnioPublicacion, libro.EditorialID)
+	_, err = tx.Exec(query, libro.ISBN, libro.Titulo, libro.AnioPublicacion, libro.EditorialID,
+		nullString(libro.Signatura), nullString(libro.SistemaClasificacion))
 	if err != nil {
 		return err
 	}
 
 	// Crear ejemplares automáticamente según la cantidad especificada
 	for i := 0; i < libro.Cantidad; i++ {
-		ejemplarQuery := `INSERT INTO Ejemplar (codigo, estado, Libro_ISBN, Prestamo_idPrestamo) 
-                          VALUES (EJEMPLAR_SEQ.NEXTVAL, 'DISPONIBLE', :1, NULL)`
-		_, err = tx.Exec(ejemplarQuery, libro.ISBN)
+		ejemplarQuery := `INSERT INTO Ejemplar (codigo, estado, Libro_ISBN, Prestamo_idPrestamo, localizacion,
+                          Sucursal_idPropietaria, Sucursal_idUbicacion) 
+                          VALUES (EJEMPLAR_SEQ.NEXTVAL, 'DISPONIBLE', :1, NULL, :2, :3, :4)`
+		_, err = tx.Exec(ejemplarQuery, libro.ISBN, nullString(localizacion), sucursalID, sucursalID)
 		if err != nil {
 			return err
 		}
@@ -255,6 +359,9 @@ func (s *BookService) Create(libro *models.Libro, userID int) error {
 		return err
 	}
 
+	// Mantener sincronizado el índice de búsqueda
+	s.indexarLibro(libro.ISBN)
+
 	// Registrar en bitácora
 	s.bitacoraService.RegistrarAccion(userID, "CREATE", "LIBRO", "Libro creado: "+libro.Titulo)
 
@@ -263,46 +370,48 @@ func (s *BookService) Create(libro *models.Libro, userID int) error {
 
 // Update actualiza un libro existente
 func (s *BookService) Update(libro *models.Libro, userID int) error {
+	if err := normalizarSignatura(libro); err != nil {
+		return err
+	}
+
 	query := `UPDATE Libro 
-              SET titulo = :1, anioEdicion = TO_DATE(:2, 'YYYY'), Editorial_idEditorial = :3
-              WHERE ISBN = :4`
+              SET titulo = :1, anioEdicion = TO_DATE(:2, 'YYYY'), Editorial_idEditorial = :3,
+                  signatura = :4, sistemaClasificacion = :5
+              WHERE ISBN = :6`
 
-	_, err := config.DB.Exec(query, libro.Titulo, libro.AnioPublicacion, libro.EditorialID, libro.ISBN)
+	_, err := config.DB.Exec(query, libro.Titulo, libro.AnioPublicacion, libro.EditorialID,
+		nullString(libro.Signatura), nullString(libro.SistemaClasificacion), libro.ISBN)
 	if err != nil {
 		return err
 	}
 
+	// Mantener sincronizado el índice de búsqueda
+	s.indexarLibro(libro.ISBN)
+
 	// Registrar en bitácora
 	s.bitacoraService.RegistrarAccion(userID, "UPDATE", "LIBRO", "Libro actualizado: "+libro.Titulo)
 
 	return nil
 }
 
-// Delete elimina un libro (soft delete marcando ejemplares como no disponibles)
-func (s *BookService) Delete(isbn string, userID int) error {
-	// Verificar que no haya préstamos activos
-	checkQuery := `SELECT COUNT(*) FROM Prestamo P 
-                   INNER JOIN Ejemplar E ON P.idPrestamo = E.Prestamo_idPrestamo
-                   WHERE E.Libro_ISBN = :1 AND P.estado = 'ACTIVO'`
-	var count int
-	err := config.DB.QueryRow(checkQuery, isbn).Scan(&count)
-	if err != nil {
-		return err
-	}
+// normalizarSignatura valida el sistema de clasificación y lo deduce de la
+// signatura cuando no se indica
+func normalizarSignatura(libro *models.Libro) error {
+	libro.Signatura = strings.TrimSpace(libro.Signatura)
+	libro.SistemaClasificacion = strings.ToUpper(strings.TrimSpace(libro.SistemaClasificacion))
 
-	if count > 0 {
-		return sql.ErrNoRows // Retornar error si hay préstamos activos
+	if libro.Signatura == "" {
+		libro.SistemaClasificacion = ""
+		return nil
 	}
 
-	// Marcar ejemplares como no disponibles
-	query := `UPDATE Ejemplar SET estado = 'NO_DISPONIBLE' WHERE Libro_ISBN = :1`
-	_, err = config.DB.Exec(query, isbn)
-	if err != nil {
-		return err
+	switch libro.SistemaClasificacion {
+	case "":
+		libro.SistemaClasificacion = DetectarSistema(libro.Signatura)
+	case SistemaDewey, SistemaLC:
+	default:
+		return errors.New("sistema de clasificación inválido: use DEWEY o LC")
 	}
 
-	// Registrar en bitácora
-	s.bitacoraService.RegistrarAccion(userID, "DELETE", "LIBRO", "Libro marcado como no disponible: "+isbn)
-
 	return nil
 }
@@ -0,0 +1,418 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"proyecto-bd-final/internal/config"
+	"proyecto-bd-final/internal/models"
+	"strconv"
+)
+
+type CategoriaService struct {
+	bitacoraService *BitacoraService
+	bookService     *BookService
+}
+
+func NewCategoriaService() *CategoriaService {
+	return &CategoriaService{
+		bitacoraService: NewBitacoraService(),
+		bookService:     NewBookService(),
+	}
+}
+
+// GetAll obtiene todas las categorías sin jerarquía
+func (s *CategoriaService) GetAll() ([]*models.Categoria, error) {
+	query := `SELECT idCategoria, nombre, descripcion, Categoria_idPadre
+              FROM Categoria
+              ORDER BY nombre`
+
+	rows, err := config.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categorias []*models.Categoria
+	for rows.Next() {
+		categoria, err := scanCategoria(rows)
+		if err != nil {
+			return nil, err
+		}
+		categorias = append(categorias, categoria)
+	}
+
+	return categorias, rows.Err()
+}
+
+// GetArbol obtiene la taxonomía completa como árbol; TotalLibros cuenta los
+// libros distintos de cada categoría incluyendo sus subcategorías
+func (s *CategoriaService) GetArbol() ([]*models.Categoria, error) {
+	categorias, err := s.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// Libros asignados directamente a cada categoría
+	rows, err := config.DB.Query(`SELECT Categoria_idCategoria, Libro_ISBN FROM LibroCategoria`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	librosPorCategoria := make(map[int][]string)
+	for rows.Next() {
+		var categoriaID int
+		var isbn string
+		if err := rows.Scan(&categoriaID, &isbn); err != nil {
+			return nil, err
+		}
+		librosPorCategoria[categoriaID] = append(librosPorCategoria[categoriaID], isbn)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	porID := make(map[int]*models.Categoria, len(categorias))
+	for _, c := range categorias {
+		porID[c.IDCategoria] = c
+	}
+
+	var raices []*models.Categoria
+	for _, c := range categorias {
+		if c.PadreID != nil {
+			if padre, ok := porID[*c.PadreID]; ok {
+				padre.Subcategorias = append(padre.Subcategorias, c)
+				continue
+			}
+		}
+		raices = append(raices, c)
+	}
+
+	// Acumular los libros de cada subárbol sin contar dos veces el mismo libro
+	var acumular func(c *models.Categoria) map[string]bool
+	acumular = func(c *models.Categoria) map[string]bool {
+		libros := make(map[string]bool)
+		for _, isbn := range librosPorCategoria[c.IDCategoria] {
+			libros[isbn] = true
+		}
+		for _, sub := range c.Subcategorias {
+			for isbn := range acumular(sub) {
+				libros[isbn] = true
+			}
+		}
+		c.TotalLibros = len(libros)
+		return libros
+	}
+	for _, raiz := range raices {
+		acumular(raiz)
+	}
+
+	if raices == nil {
+		raices = []*models.Categoria{}
+	}
+
+	return raices, nil
+}
+
+// GetByID obtiene una categoría por su ID
+func (s *CategoriaService) GetByID(id int) (*models.Categoria, error) {
+	query := `SELECT idCategoria, nombre, descripcion, Categoria_idPadre
+              FROM Categoria
+              WHERE idCategoria = :1`
+
+	categoria, err := scanCategoria(config.DB.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("categoría no encontrada")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return categoria, nil
+}
+
+// GetByISBN obtiene las categorías asignadas a un libro
+func (s *CategoriaService) GetByISBN(isbn string) ([]*models.Categoria, error) {
+	query := `SELECT C.idCategoria, C.nombre, C.descripcion, C.Categoria_idPadre
+              FROM Categoria C
+              INNER JOIN LibroCategoria LC ON C.idCategoria = LC.Categoria_idCategoria
+              WHERE LC.Libro_ISBN = :1
+              ORDER BY C.nombre`
+
+	rows, err := config.DB.Query(query, isbn)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categorias := []*models.Categoria{}
+	for rows.Next() {
+		categoria, err := scanCategoria(rows)
+		if err != nil {
+			return nil, err
+		}
+		categorias = append(categorias, categoria)
+	}
+
+	return categorias, rows.Err()
+}
+
+// Create crea una nueva categoría
+func (s *CategoriaService) Create(categoria *models.Categoria, userID int) error {
+	if categoria.PadreID != nil {
+		if _, err := s.GetByID(*categoria.PadreID); err != nil {
+			return errors.New("la categoría padre no existe")
+		}
+	}
+
+	query := `INSERT INTO Categoria (idCategoria, nombre, descripcion, Categoria_idPadre)
+              VALUES (CATEGORIA_SEQ.NEXTVAL, :1, :2, :3)
+              RETURNING idCategoria INTO :4`
+
+	_, err := config.DB.Exec(query,
+		categoria.Nombre,
+		nullString(categoria.Descripcion),
+		nullInt(categoria.PadreID),
+		sql.Out{Dest: &categoria.IDCategoria},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "CREATE", "Categoria", "Categoría creada: "+categoria.Nombre)
+
+	return nil
+}
+
+// Update actualiza una categoría, impidiendo ciclos en la jerarquía
+func (s *CategoriaService) Update(categoria *models.Categoria, userID int) error {
+	if _, err := s.GetByID(categoria.IDCategoria); err != nil {
+		return err
+	}
+
+	if categoria.PadreID != nil {
+		descendientes, err := s.GetDescendientes(categoria.IDCategoria)
+		if err != nil {
+			return err
+		}
+		for _, id := range descendientes {
+			if id == *categoria.PadreID {
+				return errors.New("una categoría no puede ser subcategoría de sí misma ni de sus descendientes")
+			}
+		}
+		if _, err := s.GetByID(*categoria.PadreID); err != nil {
+			return errors.New("la categoría padre no existe")
+		}
+	}
+
+	query := `UPDATE Categoria
+              SET nombre = :1, descripcion = :2, Categoria_idPadre = :3
+              WHERE idCategoria = :4`
+
+	_, err := config.DB.Exec(query,
+		categoria.Nombre,
+		nullString(categoria.Descripcion),
+		nullInt(categoria.PadreID),
+		categoria.IDCategoria,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Las categorías forman parte del índice de búsqueda
+	s.reindexarLibros(categoria.IDCategoria)
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "UPDATE", "Categoria", "Categoría actualizada: "+categoria.Nombre)
+
+	return nil
+}
+
+// Delete elimina una categoría sin subcategorías junto con sus asignaciones
+func (s *CategoriaService) Delete(id int, userID int) error {
+	categoria, err := s.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	var hijos int
+	err = config.DB.QueryRow(`SELECT COUNT(*) FROM Categoria WHERE Categoria_idPadre = :1`, id).Scan(&hijos)
+	if err != nil {
+		return err
+	}
+	if hijos > 0 {
+		return errors.New("la categoría tiene subcategorías")
+	}
+
+	isbns, err := s.isbnsDeCategoria(id)
+	if err != nil {
+		return err
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`DELETE FROM LibroCategoria WHERE Categoria_idCategoria = :1`, id); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM Categoria WHERE idCategoria = :1`, id); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, isbn := range isbns {
+		s.bookService.indexarLibro(isbn)
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "DELETE", "Categoria", "Categoría eliminada: "+categoria.Nombre)
+
+	return nil
+}
+
+// AsignarALibro reemplaza las categorías asignadas a un libro
+func (s *CategoriaService) AsignarALibro(isbn string, categoriaIDs []int, userID int) error {
+	if _, err := s.bookService.GetByISBN(isbn); err != nil {
+		return errors.New("libro no encontrado")
+	}
+
+	for _, id := range categoriaIDs {
+		if _, err := s.GetByID(id); err != nil {
+			return errors.New("la categoría " + strconv.Itoa(id) + " no existe")
+		}
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`DELETE FROM LibroCategoria WHERE Libro_ISBN = :1`, isbn); err != nil {
+		return err
+	}
+
+	asignadas := make(map[int]bool)
+	for _, id := range categoriaIDs {
+		if asignadas[id] {
+			continue
+		}
+		asignadas[id] = true
+
+		query := `INSERT INTO LibroCategoria (idLibroCategoria, Libro_ISBN, Categoria_idCategoria)
+                  VALUES (LIBROCATEGORIA_SEQ.NEXTVAL, :1, :2)`
+		if _, err = tx.Exec(query, isbn, id); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.bookService.indexarLibro(isbn)
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "UPDATE", "LibroCategoria",
+		"Categorías actualizadas para libro ISBN: "+isbn)
+
+	return nil
+}
+
+// GetDescendientes obtiene el ID de la categoría y los de todas sus subcategorías
+func (s *CategoriaService) GetDescendientes(id int) ([]int, error) {
+	query := `SELECT idCategoria FROM Categoria
+              START WITH idCategoria = :1
+              CONNECT BY PRIOR idCategoria = Categoria_idPadre`
+
+	rows, err := config.DB.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var categoriaID int
+		if err := rows.Scan(&categoriaID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, categoriaID)
+	}
+
+	return ids, rows.Err()
+}
+
+// isbnsDeCategoria obtiene los libros asignados directamente a una categoría
+func (s *CategoriaService) isbnsDeCategoria(id int) ([]string, error) {
+	rows, err := config.DB.Query(`SELECT Libro_ISBN FROM LibroCategoria WHERE Categoria_idCategoria = :1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var isbns []string
+	for rows.Next() {
+		var isbn string
+		if err := rows.Scan(&isbn); err != nil {
+			return nil, err
+		}
+		isbns = append(isbns, isbn)
+	}
+
+	return isbns, rows.Err()
+}
+
+// reindexarLibros actualiza en el índice de búsqueda los libros de una categoría
+func (s *CategoriaService) reindexarLibros(id int) {
+	isbns, err := s.isbnsDeCategoria(id)
+	if err != nil {
+		return
+	}
+	for _, isbn := range isbns {
+		s.bookService.indexarLibro(isbn)
+	}
+}
+
+// scanner abstrae sql.Row y sql.Rows para reutilizar el escaneo de filas
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCategoria(row scanner) (*models.Categoria, error) {
+	var categoria models.Categoria
+	var descripcion sql.NullString
+	var padreID sql.NullInt64
+
+	if err := row.Scan(&categoria.IDCategoria, &categoria.Nombre, &descripcion, &padreID); err != nil {
+		return nil, err
+	}
+
+	categoria.Descripcion = descripcion.String
+	if padreID.Valid {
+		id := int(padreID.Int64)
+		categoria.PadreID = &id
+	}
+
+	return &categoria, nil
+}
+
+// nullString convierte una cadena vacía en NULL
+func nullString(valor string) sql.NullString {
+	return sql.NullString{String: valor, Valid: valor != ""}
+}
+
+// nullInt convierte un puntero nulo en NULL
+func nullInt(valor *int) sql.NullInt64 {
+	if valor == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*valor), Valid: true}
+}
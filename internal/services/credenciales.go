@@ -0,0 +1,366 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"proyecto-bd-final/internal/config"
+	"proyecto-bd-final/internal/mail"
+	"proyecto-bd-final/internal/models"
+	"proyecto-bd-final/internal/politica"
+	"proyecto-bd-final/internal/repository"
+	"proyecto-bd-final/pkg/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tipos de token de un solo uso enviados por correo
+const (
+	TokenRestablecer = "RESTABLECER"
+	TokenVerificar   = "VERIFICAR"
+)
+
+// Vigencia de los enlaces enviados por correo
+const (
+	DuracionTokenRestablecer = time.Hour
+	DuracionTokenVerificar   = 48 * time.Hour
+)
+
+// MaxSolicitudesRestablecer limita los correos de restablecimiento por
+// dirección y por hora
+const MaxSolicitudesRestablecer = 3
+
+var (
+	limiteRestablecer  = newLimitador(MaxSolicitudesRestablecer, time.Hour)
+	limiteVerificacion = newLimitador(MaxSolicitudesRestablecer, time.Hour)
+)
+
+// ErrDemasiadasSolicitudes indica que se superó el límite de solicitudes
+var ErrDemasiadasSolicitudes = errors.New("demasiadas solicitudes, intente más tarde")
+
+type CredencialesService struct {
+	userRepo            *repository.UserRepository
+	sesionService       *SesionService
+	autorizacionService *AutorizacionService
+	bitacoraService     *BitacoraService
+}
+
+func NewCredencialesService() *CredencialesService {
+	return &CredencialesService{
+		userRepo:            repository.NewUserRepository(),
+		sesionService:       NewSesionService(),
+		autorizacionService: NewAutorizacionService(),
+		bitacoraService:     NewBitacoraService(),
+	}
+}
+
+// SolicitarRestablecimiento envía un enlace para restablecer la contraseña.
+// No informa si el correo está registrado, para no revelar qué cuentas existen
+func (s *CredencialesService) SolicitarRestablecimiento(correo string) error {
+	correo = strings.TrimSpace(correo)
+	if !limiteRestablecer.Permitir(strings.ToLower(correo)) {
+		return ErrDemasiadasSolicitudes
+	}
+
+	user, err := s.userRepo.GetByEmail(correo)
+	if err != nil {
+		return nil
+	}
+
+	// El token y el correo se generan en segundo plano: si la respuesta
+	// esperara al servidor SMTP, su demora revelaría qué correos están registrados
+	go s.enviarRestablecimiento(user)
+
+	return nil
+}
+
+// enviarRestablecimiento emite el token de restablecimiento y lo envía por correo
+func (s *CredencialesService) enviarRestablecimiento(user *models.Usuario) {
+	token, err := s.emitirToken(user.IDUsuario, TokenRestablecer, DuracionTokenRestablecer)
+	if err != nil {
+		log.Printf("⚠️ No se pudo generar el token de restablecimiento de %s: %v", user.Correo, err)
+		return
+	}
+
+	enlace := urlAplicacion() + "/reset-password?token=" + token
+	err = mail.Enviar(mail.Mensaje{
+		Para:   user.Correo,
+		Asunto: "Restablecer contraseña - Biblioteca",
+		Cuerpo: "Hola " + user.Nombre + ",\n\n" +
+			"Recibimos una solicitud para restablecer tu contraseña. Para elegir una nueva, ingresa a:\n\n" +
+			enlace + "\n\n" +
+			"El enlace vence en una hora y solo puede usarse una vez. Si no fuiste tú, ignora este mensaje.\n",
+	})
+	if err != nil {
+		log.Printf("⚠️ No se pudo enviar el correo de restablecimiento a %s: %v", user.Correo, err)
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(user.IDUsuario, "PASSWORD_RESET_REQUEST", "Usuario",
+		"Solicitud de restablecimiento de contraseña")
+}
+
+// Restablecer fija la nueva contraseña usando el token recibido por correo y
+// cierra todas las sesiones del usuario
+func (s *CredencialesService) Restablecer(token, nueva string) error {
+	var correo, nombre, apellido string
+	err := config.DB.QueryRow(`SELECT U.correo, U.nombre, U.apellido
+                               FROM TokenUsuario T
+                               INNER JOIN Usuario U ON U.idUsuario = T.Usuario_idUsuario
+                               WHERE T.tokenHash = :1 AND T.tipo = :2`,
+		utils.HashToken(token), TokenRestablecer).Scan(&correo, &nombre, &apellido)
+	if err == sql.ErrNoRows {
+		return errors.New("el enlace es inválido o expiró")
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := politica.Actual().Validar(nueva, correo, nombre, apellido); err != nil {
+		return err
+	}
+
+	hash, err := utils.HashPassword(nueva)
+	if err != nil {
+		return err
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID, err := s.consumirToken(tx, token, TokenRestablecer)
+	if err != nil {
+		return err
+	}
+
+	// Demostrar acceso al correo también levanta el bloqueo por intentos fallidos
+	if _, err = tx.Exec(`UPDATE Usuario SET contrasenia = :1, intentosFallidos = 0, bloqueadoHasta = NULL
+	                     WHERE idUsuario = :2`, hash, userID); err != nil {
+		return err
+	}
+
+	// Los demás enlaces pendientes dejan de servir
+	_, err = tx.Exec(`UPDATE TokenUsuario SET fechaUso = :1
+                      WHERE Usuario_idUsuario = :2 AND tipo = :3 AND fechaUso IS NULL`,
+		time.Now(), userID, TokenRestablecer)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if _, err := s.sesionService.RevocarTodas(userID, 0); err != nil {
+		log.Printf("⚠️ No se pudieron cerrar las sesiones del usuario %d: %v", userID, err)
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "PASSWORD_RESET", "Usuario", "Contraseña restablecida por correo")
+
+	return nil
+}
+
+// CambiarClave reemplaza la contraseña del usuario verificando la actual y
+// cierra sus demás sesiones. Devuelve la cantidad de sesiones cerradas
+func (s *CredencialesService) CambiarClave(userID, sesionID int, actual, nueva string) (int, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if !utils.CheckPasswordHash(actual, user.Contrasenia) {
+		return 0, errors.New("la contraseña actual es incorrecta")
+	}
+	if actual == nueva {
+		return 0, errors.New("la nueva contraseña debe ser distinta de la actual")
+	}
+	if err := politica.Actual().Validar(nueva, user.Correo, user.Nombre, user.Apellido); err != nil {
+		return 0, err
+	}
+
+	hash, err := utils.HashPassword(nueva)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.userRepo.UpdatePassword(userID, hash); err != nil {
+		return 0, err
+	}
+
+	cerradas, err := s.sesionService.RevocarTodas(userID, sesionID)
+	if err != nil {
+		log.Printf("⚠️ No se pudieron cerrar las sesiones del usuario %d: %v", userID, err)
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "PASSWORD_CHANGE", "Usuario",
+		"Contraseña cambiada, "+strconv.Itoa(cerradas)+" sesiones cerradas")
+
+	return cerradas, nil
+}
+
+// EnviarVerificacion envía el enlace para confirmar el correo del usuario
+func (s *CredencialesService) EnviarVerificacion(user *models.Usuario) error {
+	token, err := s.emitirToken(user.IDUsuario, TokenVerificar, DuracionTokenVerificar)
+	if err != nil {
+		return err
+	}
+
+	enlace := urlAplicacion() + "/verify-email?token=" + token
+	return mail.Enviar(mail.Mensaje{
+		Para:   user.Correo,
+		Asunto: "Confirma tu correo - Biblioteca",
+		Cuerpo: "Hola " + user.Nombre + ",\n\n" +
+			"Para activar tu cuenta y poder solicitar préstamos, confirma tu correo ingresando a:\n\n" +
+			enlace + "\n\n" +
+			"El enlace vence en 48 horas. Si no creaste esta cuenta, ignora este mensaje.\n",
+	})
+}
+
+// ReenviarVerificacion vuelve a enviar el enlace de verificación
+func (s *CredencialesService) ReenviarVerificacion(userID int) error {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.Verificado {
+		return errors.New("el correo ya fue verificado")
+	}
+	if !limiteVerificacion.Permitir(strconv.Itoa(userID)) {
+		return ErrDemasiadasSolicitudes
+	}
+
+	if err := s.EnviarVerificacion(user); err != nil {
+		return err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "EMAIL_VERIFY_REQUEST", "Usuario", "Reenvío de verificación de correo")
+
+	return nil
+}
+
+// Verificar confirma el correo del usuario con el token recibido
+func (s *CredencialesService) Verificar(token string) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID, err := s.consumirToken(tx, token, TokenVerificar)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE Usuario SET fechaVerificacion = :1 WHERE idUsuario = :2 AND fechaVerificacion IS NULL`,
+		time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Habilitar de inmediato los préstamos
+	s.autorizacionService.InvalidarRoles(userID)
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "EMAIL_VERIFY", "Usuario", "Correo verificado")
+
+	return nil
+}
+
+// DominioPermitido verifica que el correo pertenezca a alguno de los dominios
+// institucionales de ALLOWED_EMAIL_DOMAINS (separados por comas); sin la
+// variable se acepta cualquier dominio
+func DominioPermitido(correo string) error {
+	lista := strings.TrimSpace(os.Getenv("ALLOWED_EMAIL_DOMAINS"))
+	if lista == "" {
+		return nil
+	}
+
+	i := strings.LastIndex(correo, "@")
+	if i < 0 {
+		return errors.New("correo inválido")
+	}
+	dominio := strings.ToLower(correo[i+1:])
+
+	for _, permitido := range strings.Split(lista, ",") {
+		permitido = strings.ToLower(strings.TrimSpace(permitido))
+		if permitido != "" && (dominio == permitido || strings.HasSuffix(dominio, "."+permitido)) {
+			return nil
+		}
+	}
+
+	return errors.New("solo se aceptan correos institucionales (" + lista + ")")
+}
+
+// emitirToken genera un token de un solo uso y guarda su hash
+func (s *CredencialesService) emitirToken(userID int, tipo string, duracion time.Duration) (string, error) {
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	ahora := time.Now()
+	query := `INSERT INTO TokenUsuario (idToken, Usuario_idUsuario, tipo, tokenHash, fechaCreacion, fechaExpiracion)
+              VALUES (TOKENUSUARIO_SEQ.NEXTVAL, :1, :2, :3, :4, :5)`
+
+	if _, err := config.DB.Exec(query, userID, tipo, utils.HashToken(token), ahora, ahora.Add(duracion)); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// buscarToken devuelve el usuario de un token vigente sin consumirlo
+func (s *CredencialesService) buscarToken(token, tipo string) (int, error) {
+	var userID int
+	err := config.DB.QueryRow(`SELECT Usuario_idUsuario FROM TokenUsuario
+                               WHERE tokenHash = :1 AND tipo = :2 AND fechaUso IS NULL AND fechaExpiracion > :3`,
+		utils.HashToken(token), tipo, time.Now()).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, errors.New("el enlace es inválido o expiró")
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// consumirToken marca el token como usado y devuelve su usuario; falla si no
+// existe, ya se usó o expiró
+func (s *CredencialesService) consumirToken(tx *sql.Tx, token, tipo string) (int, error) {
+	var userID int
+	ahora := time.Now()
+
+	result, err := tx.Exec(`UPDATE TokenUsuario SET fechaUso = :1
+                            WHERE tokenHash = :2 AND tipo = :3 AND fechaUso IS NULL AND fechaExpiracion > :4
+                            RETURNING Usuario_idUsuario INTO :5`,
+		ahora, utils.HashToken(token), tipo, ahora, sql.Out{Dest: &userID})
+	if err != nil {
+		return 0, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return 0, errors.New("el enlace es inválido o expiró")
+	}
+
+	return userID, nil
+}
+
+// urlAplicacion es la dirección del frontend usada en los enlaces de los correos
+func urlAplicacion() string {
+	if url := os.Getenv("APP_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return "http://localhost:5173"
+}
@@ -0,0 +1,404 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"os"
+	"proyecto-bd-final/internal/config"
+	"proyecto-bd-final/internal/models"
+	"proyecto-bd-final/internal/repository"
+	"proyecto-bd-final/internal/totp"
+	"proyecto-bd-final/pkg/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TokenDosFactores es el tipo del token que entrega el primer paso del login
+// cuando la cuenta tiene segundo factor
+const TokenDosFactores = "DOS_FACTORES"
+
+// DuracionDesafioDosFactores es el plazo para ingresar el código tras la contraseña
+const DuracionDesafioDosFactores = 5 * time.Minute
+
+// CantidadCodigosRecuperacion son los códigos que se entregan al activar el
+// segundo factor o al regenerarlos
+const CantidadCodigosRecuperacion = 10
+
+// SegundoFactorError indica que la contraseña es correcta pero falta el código
+// del segundo factor; Token identifica el intento en el segundo paso
+type SegundoFactorError struct {
+	Token string
+}
+
+func (e *SegundoFactorError) Error() string {
+	return "se requiere el código del segundo factor"
+}
+
+// RolesDosFactores devuelve los roles que deben usar segundo factor, según
+// TWO_FACTOR_REQUIRED_ROLES (separados por comas; por defecto solo admin)
+func RolesDosFactores() []string {
+	lista, ok := os.LookupEnv("TWO_FACTOR_REQUIRED_ROLES")
+	if !ok {
+		return []string{RolAdmin}
+	}
+
+	var roles []string
+	for _, rol := range strings.Split(lista, ",") {
+		if rol = strings.TrimSpace(rol); rol != "" {
+			roles = append(roles, rol)
+		}
+	}
+	return roles
+}
+
+// DosFactoresObligatorio indica si alguno de los roles exige segundo factor
+func DosFactoresObligatorio(roles []string) bool {
+	for _, requerido := range RolesDosFactores() {
+		for _, rol := range roles {
+			if strings.EqualFold(rol, requerido) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type DosFactoresService struct {
+	userRepo            *repository.UserRepository
+	autorizacionService *AutorizacionService
+	bitacoraService     *BitacoraService
+}
+
+func NewDosFactoresService() *DosFactoresService {
+	return &DosFactoresService{
+		userRepo:            repository.NewUserRepository(),
+		autorizacionService: NewAutorizacionService(),
+		bitacoraService:     NewBitacoraService(),
+	}
+}
+
+// Estado obtiene si el usuario tiene el segundo factor activo, si sus roles lo
+// exigen y cuántos códigos de recuperación le quedan
+func (s *DosFactoresService) Estado(userID int) (*models.EstadoDosFactores, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.userRepo.GetRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	estado := &models.EstadoDosFactores{
+		Activo:      user.DosFactores,
+		Obligatorio: DosFactoresObligatorio(roles),
+	}
+
+	err = config.DB.QueryRow(`SELECT COUNT(*) FROM CodigoRecuperacion
+	                          WHERE Usuario_idUsuario = :1 AND fechaUso IS NULL`, userID).Scan(&estado.CodigosRestantes)
+	if err != nil {
+		return nil, err
+	}
+
+	return estado, nil
+}
+
+// Iniciar genera un secreto nuevo para registrar en la aplicación
+// autenticadora; queda pendiente hasta confirmarlo con Activar
+func (s *DosFactoresService) Iniciar(userID int) (*models.InscripcionDosFactores, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DosFactores {
+		return nil, errors.New("el segundo factor ya está activado; desactívelo antes de registrar otro dispositivo")
+	}
+
+	secreto, err := totp.GenerarSecreto()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := config.DB.Exec(`UPDATE Usuario SET totpSecreto = :1, totpUltimoPaso = NULL
+	                               WHERE idUsuario = :2 AND totpActivacion IS NULL`, secreto, userID)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, errors.New("el segundo factor ya está activado")
+	}
+
+	return &models.InscripcionDosFactores{
+		Secreto: secreto,
+		URI:     totp.URI(emisorTOTP(), user.Correo, secreto),
+	}, nil
+}
+
+// Activar confirma el secreto pendiente con un código de la aplicación y
+// devuelve los códigos de recuperación, que solo se muestran esta vez
+func (s *DosFactoresService) Activar(userID int, codigo string) ([]string, error) {
+	var secreto sql.NullString
+	var activacion sql.NullTime
+	err := config.DB.QueryRow(`SELECT totpSecreto, totpActivacion FROM Usuario WHERE idUsuario = :1`, userID).
+		Scan(&secreto, &activacion)
+	if err != nil {
+		return nil, err
+	}
+	if activacion.Valid {
+		return nil, errors.New("el segundo factor ya está activado")
+	}
+	if !secreto.Valid {
+		return nil, errors.New("primero inicie la configuración del segundo factor")
+	}
+
+	paso, ok := totp.Validar(secreto.String, codigo, time.Now())
+	if !ok {
+		return nil, errors.New("código incorrecto")
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE Usuario SET totpActivacion = :1, totpUltimoPaso = :2
+	                        WHERE idUsuario = :3 AND totpSecreto = :4 AND totpActivacion IS NULL`,
+		time.Now(), paso, userID, secreto.String)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, errors.New("la configuración cambió, iníciela nuevamente")
+	}
+
+	codigos, err := generarCodigos(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Recuperar de inmediato los permisos que exigían segundo factor
+	s.autorizacionService.InvalidarRoles(userID)
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "2FA_ENABLE", "Usuario", "Segundo factor activado")
+
+	return codigos, nil
+}
+
+// Desactivar quita el segundo factor tras confirmar la contraseña y un código;
+// no se permite si los roles del usuario lo exigen
+func (s *DosFactoresService) Desactivar(userID int, clave, codigo string) error {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.DosFactores {
+		return errors.New("el segundo factor no está activado")
+	}
+	if !utils.CheckPasswordHash(clave, user.Contrasenia) {
+		return errors.New("la contraseña es incorrecta")
+	}
+
+	roles, err := s.userRepo.GetRoles(userID)
+	if err != nil {
+		return err
+	}
+	if DosFactoresObligatorio(roles) {
+		return errors.New("sus roles exigen segundo factor, no puede desactivarlo")
+	}
+
+	if err := s.Verificar(userID, codigo); err != nil {
+		return err
+	}
+
+	if err := s.quitar(userID); err != nil {
+		return err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "2FA_DISABLE", "Usuario", "Segundo factor desactivado")
+
+	return nil
+}
+
+// RegenerarCodigos reemplaza los códigos de recuperación pendientes
+func (s *DosFactoresService) RegenerarCodigos(userID int, codigo string) ([]string, error) {
+	if err := s.Verificar(userID, codigo); err != nil {
+		return nil, err
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	codigos, err := generarCodigos(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "2FA_RECOVERY_CODES", "Usuario", "Códigos de recuperación regenerados")
+
+	return codigos, nil
+}
+
+// Restablecer quita el segundo factor de otro usuario que perdió su
+// dispositivo; deberá configurarlo de nuevo (admin)
+func (s *DosFactoresService) Restablecer(userID, adminID int) error {
+	if _, err := s.userRepo.GetByID(userID); err != nil {
+		return err
+	}
+
+	if err := s.quitar(userID); err != nil {
+		return err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(adminID, "2FA_RESET", "Usuario",
+		"Segundo factor del usuario "+strconv.Itoa(userID)+" restablecido")
+
+	return nil
+}
+
+// Verificar comprueba un código de la aplicación o, si no tiene ese formato,
+// un código de recuperación. Cada código sirve una sola vez
+func (s *DosFactoresService) Verificar(userID int, codigo string) error {
+	var secreto sql.NullString
+	var activacion sql.NullTime
+	err := config.DB.QueryRow(`SELECT totpSecreto, totpActivacion FROM Usuario WHERE idUsuario = :1`, userID).
+		Scan(&secreto, &activacion)
+	if err != nil {
+		return err
+	}
+	if !activacion.Valid || !secreto.Valid {
+		return errors.New("el segundo factor no está activado")
+	}
+
+	codigo = strings.TrimSpace(codigo)
+	if len(codigo) != totp.Digitos {
+		return s.usarCodigoRecuperacion(userID, codigo)
+	}
+
+	paso, ok := totp.Validar(secreto.String, codigo, time.Now())
+	if !ok {
+		return errors.New("código incorrecto")
+	}
+
+	// Un código ya aceptado no vuelve a servir aunque siga vigente
+	result, err := config.DB.Exec(`UPDATE Usuario SET totpUltimoPaso = :1
+	                               WHERE idUsuario = :2 AND (totpUltimoPaso IS NULL OR totpUltimoPaso < :3)`,
+		paso, userID, paso)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.New("el código ya fue utilizado, espere el siguiente")
+	}
+
+	return nil
+}
+
+func (s *DosFactoresService) usarCodigoRecuperacion(userID int, codigo string) error {
+	result, err := config.DB.Exec(`UPDATE CodigoRecuperacion SET fechaUso = :1
+	                               WHERE Usuario_idUsuario = :2 AND codigoHash = :3 AND fechaUso IS NULL`,
+		time.Now(), userID, utils.HashToken(normalizarCodigo(codigo)))
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.New("código incorrecto")
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "2FA_RECOVERY", "Usuario", "Acceso con código de recuperación")
+
+	return nil
+}
+
+// quitar borra el secreto y los códigos de recuperación del usuario
+func (s *DosFactoresService) quitar(userID int) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE Usuario SET totpSecreto = NULL, totpActivacion = NULL, totpUltimoPaso = NULL
+	                  WHERE idUsuario = :1`, userID)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM CodigoRecuperacion WHERE Usuario_idUsuario = :1`, userID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.autorizacionService.InvalidarRoles(userID)
+	return nil
+}
+
+// generarCodigos reemplaza los códigos de recuperación del usuario y devuelve
+// los nuevos en claro; solo se guarda su hash
+func generarCodigos(tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec(`DELETE FROM CodigoRecuperacion WHERE Usuario_idUsuario = :1`, userID); err != nil {
+		return nil, err
+	}
+
+	codificacion := base32.StdEncoding.WithPadding(base32.NoPadding)
+	ahora := time.Now()
+
+	codigos := make([]string, 0, CantidadCodigosRecuperacion)
+	for i := 0; i < CantidadCodigosRecuperacion; i++ {
+		aleatorio := make([]byte, 8)
+		if _, err := rand.Read(aleatorio); err != nil {
+			return nil, err
+		}
+		texto := strings.ToLower(codificacion.EncodeToString(aleatorio))[:10]
+		codigo := texto[:5] + "-" + texto[5:]
+
+		_, err := tx.Exec(`INSERT INTO CodigoRecuperacion (idCodigo, Usuario_idUsuario, codigoHash, fechaCreacion)
+		                   VALUES (CODIGORECUPERACION_SEQ.NEXTVAL, :1, :2, :3)`,
+			userID, utils.HashToken(normalizarCodigo(codigo)), ahora)
+		if err != nil {
+			return nil, err
+		}
+		codigos = append(codigos, codigo)
+	}
+
+	return codigos, nil
+}
+
+// normalizarCodigo ignora mayúsculas, guiones y espacios del código de recuperación
+func normalizarCodigo(codigo string) string {
+	codigo = strings.ToLower(codigo)
+	codigo = strings.ReplaceAll(codigo, "-", "")
+	return strings.ReplaceAll(codigo, " ", "")
+}
+
+// emisorTOTP es el nombre con el que aparece la cuenta en la aplicación
+// autenticadora (TOTP_ISSUER)
+func emisorTOTP() string {
+	if emisor := strings.TrimSpace(os.Getenv("TOTP_ISSUER")); emisor != "" {
+		return emisor
+	}
+	return "Biblioteca"
+}
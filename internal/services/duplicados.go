@@ -0,0 +1,627 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"proyecto-bd-final/internal/config"
+	"proyecto-bd-final/internal/models"
+	"proyecto-bd-final/internal/search"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Motivos por los que se consideran duplicados dos registros
+const (
+	DuplicadoMismoISBN13     = "MISMO_ISBN13"
+	DuplicadoTituloSimilar   = "TITULO_SIMILAR"
+	DuplicadoMismoNombre     = "MISMO_NOMBRE"
+	DuplicadoNombreSimilar   = "NOMBRE_SIMILAR"
+	DuplicadoMismasIniciales = "INICIALES"
+)
+
+// UmbralTituloSimilar es la proporción mínima de palabras compartidas
+// (coeficiente de Jaccard) para considerar similares dos títulos
+const UmbralTituloSimilar = 0.75
+
+type DuplicadosService struct {
+	bitacoraService *BitacoraService
+	bookService     *BookService
+}
+
+func NewDuplicadosService() *DuplicadosService {
+	return &DuplicadosService{
+		bitacoraService: NewBitacoraService(),
+		bookService:     NewBookService(),
+	}
+}
+
+// BuscarLibros agrupa los libros con el mismo ISBN-13 (un ISBN-10 y su
+// equivalente ISBN-13 son el mismo libro) y los de título similar que
+// comparten algún autor
+func (s *DuplicadosService) BuscarLibros(umbral float64) ([]*models.DuplicadoLibros, error) {
+	if umbral <= 0 || umbral > 1 {
+		return nil, errors.New("el umbral debe estar entre 0 y 1")
+	}
+
+	query := `SELECT L.ISBN, L.titulo, EXTRACT(YEAR FROM L.anioEdicion) AS anio,
+              L.Editorial_idEditorial, E.nombre AS EDITORIAL_NOMBRE,
+              (SELECT LISTAGG(A.nombre || ' ' || A.apellido, '|')
+                      WITHIN GROUP (ORDER BY LA.idLibroAutor)
+                 FROM LibroAutor LA
+                 INNER JOIN Autor A ON A.idAutor = LA.Autor_idAutor
+                WHERE LA.Libro_ISBN = L.ISBN) AS AUTORES,
+              (SELECT COUNT(*) FROM Ejemplar EJ
+                WHERE EJ.Libro_ISBN = L.ISBN AND EJ.estado <> :1) AS TOTAL
+              FROM Libro L
+              LEFT JOIN Editorial E ON L.Editorial_idEditorial = E.idEditorial
+              ORDER BY L.ISBN`
+
+	rows, err := config.DB.Query(query, EjemplarDadoDeBaja)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var libros []*models.Libro
+	for rows.Next() {
+		var libro models.Libro
+		var anio sql.NullInt64
+		var editorial, autores sql.NullString
+
+		if err := rows.Scan(&libro.ISBN, &libro.Titulo, &anio, &libro.EditorialID, &editorial, &autores, &libro.Cantidad); err != nil {
+			return nil, err
+		}
+
+		libro.AnioPublicacion = int(anio.Int64)
+		libro.EditorialNombre = editorial.String
+		libro.Autores = splitLista(autores)
+		libros = append(libros, &libro)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	grupos := []*models.DuplicadoLibros{}
+	agrupados := newConjuntos(len(libros))
+
+	// Mismo ISBN-13
+	porISBN := make(map[string][]int)
+	var clavesISBN []string
+	for i, libro := range libros {
+		isbn13 := ISBN13(libro.ISBN)
+		if isbn13 == "" {
+			continue
+		}
+		if len(porISBN[isbn13]) == 0 {
+			clavesISBN = append(clavesISBN, isbn13)
+		}
+		porISBN[isbn13] = append(porISBN[isbn13], i)
+	}
+	for _, clave := range clavesISBN {
+		indices := porISBN[clave]
+		if len(indices) < 2 {
+			continue
+		}
+		grupo := &models.DuplicadoLibros{Motivo: DuplicadoMismoISBN13, Clave: clave}
+		for _, i := range indices {
+			agrupados.unir(indices[0], i)
+			grupo.Libros = append(grupo.Libros, libros[i])
+		}
+		grupos = append(grupos, grupo)
+	}
+
+	// Títulos similares: solo se comparan los libros que comparten alguna palabra
+	terminos := make([]map[string]bool, len(libros))
+	autores := make([]map[string]bool, len(libros))
+	porTermino := make(map[string][]int)
+	for i, libro := range libros {
+		terminos[i] = make(map[string]bool)
+		for _, t := range search.Tokenize(libro.Titulo) {
+			if !terminos[i][t] {
+				terminos[i][t] = true
+				porTermino[t] = append(porTermino[t], i)
+			}
+		}
+		autores[i] = make(map[string]bool)
+		for _, autor := range libro.Autores {
+			autores[i][ClaveNombre(autor)] = true
+		}
+	}
+
+	similares := newConjuntos(len(libros))
+	for i := range libros {
+		comparados := make(map[int]bool)
+		for t := range terminos[i] {
+			for _, j := range porTermino[t] {
+				if j <= i || comparados[j] {
+					continue
+				}
+				comparados[j] = true
+				if agrupados.mismo(i, j) || !autoresCompatibles(autores[i], autores[j]) {
+					continue
+				}
+				if jaccard(terminos[i], terminos[j]) >= umbral {
+					similares.unir(i, j)
+				}
+			}
+		}
+	}
+
+	for _, indices := range similares.grupos() {
+		grupo := &models.DuplicadoLibros{
+			Motivo: DuplicadoTituloSimilar,
+			Clave:  strings.Join(search.Tokenize(libros[indices[0]].Titulo), " "),
+		}
+		for _, i := range indices {
+			grupo.Libros = append(grupo.Libros, libros[i])
+		}
+		grupos = append(grupos, grupo)
+	}
+
+	return grupos, nil
+}
+
+// BuscarAutores agrupa los autores con el mismo nombre normalizado (sin
+// acentos, mayúsculas ni orden de las palabras), los que difieren en una o dos
+// letras y los que solo se distinguen por usar iniciales en el nombre
+func (s *DuplicadosService) BuscarAutores() ([]*models.DuplicadoAutores, error) {
+	query := `SELECT A.idAutor, A.nombre, A.apellido, A.nacionalidad,
+              (SELECT COUNT(*) FROM LibroAutor LA WHERE LA.Autor_idAutor = A.idAutor) AS LIBROS
+              FROM Autor A
+              ORDER BY A.idAutor`
+
+	rows, err := config.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var autores []*models.AutorResumen
+	for rows.Next() {
+		var autor models.AutorResumen
+		var nombre, apellido, nacionalidad sql.NullString
+
+		if err := rows.Scan(&autor.IDAutor, &nombre, &apellido, &nacionalidad, &autor.Libros); err != nil {
+			return nil, err
+		}
+
+		autor.Nombre = nombre.String
+		autor.Apellido = apellido.String
+		autor.Nacionalidad = nacionalidad.String
+		autores = append(autores, &autor)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	claves := make([]string, len(autores))
+	for i, autor := range autores {
+		claves[i] = ClaveNombre(autor.Nombre + " " + autor.Apellido)
+	}
+
+	grupos := []*models.DuplicadoAutores{}
+	agrupar := func(motivo string, conjuntos *conjuntos) {
+		for _, indices := range conjuntos.grupos() {
+			grupo := &models.DuplicadoAutores{Motivo: motivo, Clave: claves[indices[0]]}
+			for _, i := range indices {
+				grupo.Autores = append(grupo.Autores, autores[i])
+			}
+			grupos = append(grupos, grupo)
+		}
+	}
+
+	mismos := newConjuntos(len(autores))
+	similares := newConjuntos(len(autores))
+	iniciales := newConjuntos(len(autores))
+	for i := range autores {
+		for j := i + 1; j < len(autores); j++ {
+			switch {
+			case claves[i] == "" || claves[j] == "":
+			case claves[i] == claves[j]:
+				mismos.unir(i, j)
+			case nombresSimilares(claves[i], claves[j]):
+				similares.unir(i, j)
+			case ClaveNombre(autores[i].Apellido) == ClaveNombre(autores[j].Apellido) &&
+				inicialesCompatibles(search.Tokenize(autores[i].Nombre), search.Tokenize(autores[j].Nombre)):
+				iniciales.unir(i, j)
+			}
+		}
+	}
+
+	agrupar(DuplicadoMismoNombre, mismos)
+	agrupar(DuplicadoNombreSimilar, similares)
+	agrupar(DuplicadoMismasIniciales, iniciales)
+
+	return grupos, nil
+}
+
+// FusionarLibros une el libro duplicado con el que se conserva: sus autores,
+// categorías, ejemplares (y con ellos el historial de préstamos), reservas y
+// bajas pasan al libro conservado, y el duplicado se elimina
+func (s *DuplicadosService) FusionarLibros(conservarISBN, duplicadoISBN string, userID int) (*models.Libro, error) {
+	if conservarISBN == duplicadoISBN {
+		return nil, errors.New("los libros a fusionar deben ser distintos")
+	}
+
+	var titulos [2]string
+	for i, isbn := range []string{conservarISBN, duplicadoISBN} {
+		err := config.DB.QueryRow(`SELECT titulo FROM Libro WHERE ISBN = :1`, isbn).Scan(&titulos[i])
+		if err == sql.ErrNoRows {
+			return nil, errors.New("libro no encontrado: " + isbn)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var pendientes int
+	err := config.DB.QueryRow(`SELECT COUNT(*) FROM Baja
+                               WHERE Libro_ISBN = :1 AND Ejemplar_codigo IS NULL AND estado = :2`,
+		duplicadoISBN, BajaPendiente).Scan(&pendientes)
+	if err != nil {
+		return nil, err
+	}
+	if pendientes > 0 {
+		return nil, errors.New("el libro duplicado tiene una solicitud de baja del título pendiente; resuélvala antes de fusionar")
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Autores y categorías que el libro conservado ya tiene se descartan
+	_, err = tx.Exec(`UPDATE LibroAutor SET Libro_ISBN = :1
+                      WHERE Libro_ISBN = :2
+                      AND Autor_idAutor NOT IN (SELECT Autor_idAutor FROM LibroAutor WHERE Libro_ISBN = :3)`,
+		conservarISBN, duplicadoISBN, conservarISBN)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec(`DELETE FROM LibroAutor WHERE Libro_ISBN = :1`, duplicadoISBN); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE LibroCategoria SET Libro_ISBN = :1
+                      WHERE Libro_ISBN = :2
+                      AND Categoria_idCategoria NOT IN (SELECT Categoria_idCategoria FROM LibroCategoria
+                                                        WHERE Libro_ISBN = :3)`,
+		conservarISBN, duplicadoISBN, conservarISBN)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec(`DELETE FROM LibroCategoria WHERE Libro_ISBN = :1`, duplicadoISBN); err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`UPDATE Ejemplar SET Libro_ISBN = :1 WHERE Libro_ISBN = :2`, conservarISBN, duplicadoISBN)
+	if err != nil {
+		return nil, err
+	}
+	ejemplares, _ := result.RowsAffected()
+
+	_, err = tx.Exec(`UPDATE Reserva SET Libro_ISBN = :1 WHERE Libro_ISBN = :2`, conservarISBN, duplicadoISBN)
+	if err != nil {
+		return nil, err
+	}
+
+	// Una baja pendiente del título completo, trasladada al libro conservado,
+	// retiraría al aprobarse también sus ejemplares. Si se solicita mientras
+	// tanto, la fila queda en el duplicado y su clave foránea impide eliminarlo
+	_, err = tx.Exec(`UPDATE Baja SET Libro_ISBN = :1
+                      WHERE Libro_ISBN = :2 AND NOT (Ejemplar_codigo IS NULL AND estado = :3)`,
+		conservarISBN, duplicadoISBN, BajaPendiente)
+	if err != nil {
+		return nil, err
+	}
+
+	// Si el libro conservado no tiene signatura, toma la del duplicado
+	_, err = tx.Exec(`UPDATE Libro SET (signatura, sistemaClasificacion) =
+                          (SELECT signatura, sistemaClasificacion FROM Libro WHERE ISBN = :1)
+                      WHERE ISBN = :2 AND signatura IS NULL`,
+		duplicadoISBN, conservarISBN)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM Libro WHERE ISBN = :1`, duplicadoISBN); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Mantener sincronizado el índice de búsqueda
+	search.Catalogo.Remove(duplicadoISBN)
+	s.bookService.indexarLibro(conservarISBN)
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "MERGE", "LIBRO",
+		"Libro "+duplicadoISBN+" ("+titulos[1]+") fusionado en "+conservarISBN+" ("+titulos[0]+"): "+
+			strconv.FormatInt(ejemplares, 10)+" ejemplares trasladados")
+
+	return s.bookService.GetByISBN(conservarISBN)
+}
+
+// FusionarAutores une el autor duplicado con el que se conserva: sus libros
+// pasan al autor conservado y el duplicado se elimina
+func (s *DuplicadosService) FusionarAutores(conservarID, duplicadoID int, userID int) (*models.Autor, error) {
+	if conservarID == duplicadoID {
+		return nil, errors.New("los autores a fusionar deben ser distintos")
+	}
+
+	var nombres [2]string
+	for i, id := range []int{conservarID, duplicadoID} {
+		err := config.DB.QueryRow(`SELECT nombre || ' ' || apellido FROM Autor WHERE idAutor = :1`, id).Scan(&nombres[i])
+		if err == sql.ErrNoRows {
+			return nil, errors.New("autor no encontrado: " + strconv.Itoa(id))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := config.DB.Query(`SELECT Libro_ISBN FROM LibroAutor WHERE Autor_idAutor = :1`, duplicadoID)
+	if err != nil {
+		return nil, err
+	}
+	var libros []string
+	for rows.Next() {
+		var isbn string
+		if err := rows.Scan(&isbn); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		libros = append(libros, isbn)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Si ambos figuraban en el mismo libro, queda una sola vez
+	_, err = tx.Exec(`UPDATE LibroAutor SET Autor_idAutor = :1
+                      WHERE Autor_idAutor = :2
+                      AND Libro_ISBN NOT IN (SELECT Libro_ISBN FROM LibroAutor WHERE Autor_idAutor = :3)`,
+		conservarID, duplicadoID, conservarID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec(`DELETE FROM LibroAutor WHERE Autor_idAutor = :1`, duplicadoID); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE Autor SET nacionalidad = NVL(nacionalidad,
+                          (SELECT nacionalidad FROM Autor WHERE idAutor = :1))
+                      WHERE idAutor = :2`,
+		duplicadoID, conservarID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM Autor WHERE idAutor = :1`, duplicadoID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Mantener sincronizado el índice de búsqueda
+	for _, isbn := range libros {
+		s.bookService.indexarLibro(isbn)
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "MERGE", "Autor",
+		"Autor "+strconv.Itoa(duplicadoID)+" ("+nombres[1]+") fusionado en "+strconv.Itoa(conservarID)+
+			" ("+nombres[0]+"): "+strconv.Itoa(len(libros))+" libros reasignados")
+
+	var autor models.Autor
+	var nombre, apellido, nacionalidad sql.NullString
+	err = config.DB.QueryRow(`SELECT idAutor, nombre, apellido, nacionalidad FROM Autor WHERE idAutor = :1`, conservarID).
+		Scan(&autor.IDAutor, &nombre, &apellido, &nacionalidad)
+	if err != nil {
+		return nil, err
+	}
+	autor.Nombre = nombre.String
+	autor.Apellido = apellido.String
+	autor.Nacionalidad = nacionalidad.String
+
+	return &autor, nil
+}
+
+// ISBN13 normaliza un ISBN a su forma de 13 dígitos, ignorando guiones y
+// espacios. Los ISBN-10 (que pierden los ceros a la izquierda al guardarse
+// como número) se convierten con el prefijo 978. Devuelve "" si el ISBN no es
+// válido
+func ISBN13(isbn string) string {
+	var digitos []byte
+	for _, r := range strings.ToUpper(isbn) {
+		switch {
+		case r >= '0' && r <= '9', r == 'X':
+			digitos = append(digitos, byte(r))
+		case r == '-' || unicode.IsSpace(r):
+		default:
+			return ""
+		}
+	}
+
+	switch {
+	case len(digitos) == 13:
+		if digitoControlISBN13(digitos[:12]) != digitos[12] {
+			return ""
+		}
+		return string(digitos)
+	case len(digitos) >= 9 && len(digitos) <= 10:
+		for len(digitos) < 10 {
+			digitos = append([]byte{'0'}, digitos...)
+		}
+		suma := 0
+		for i, d := range digitos {
+			valor := int(d - '0')
+			if d == 'X' {
+				if i != 9 {
+					return ""
+				}
+				valor = 10
+			}
+			suma += valor * (10 - i)
+		}
+		if suma%11 != 0 {
+			return ""
+		}
+		convertido := append([]byte("978"), digitos[:9]...)
+		return string(append(convertido, digitoControlISBN13(convertido)))
+	}
+
+	return ""
+}
+
+// digitoControlISBN13 calcula el dígito de control de los 12 primeros dígitos
+func digitoControlISBN13(digitos []byte) byte {
+	suma := 0
+	for i, d := range digitos {
+		if d < '0' || d > '9' {
+			return 0
+		}
+		peso := 1
+		if i%2 == 1 {
+			peso = 3
+		}
+		suma += int(d-'0') * peso
+	}
+	return byte('0' + (10-suma%10)%10)
+}
+
+// ClaveNombre normaliza un nombre para compararlo: sin acentos, en minúsculas
+// y con las palabras ordenadas, de modo que "García Márquez, Gabriel" y
+// "Gabriel Garcia Marquez" tienen la misma clave
+func ClaveNombre(nombre string) string {
+	palabras := search.Tokenize(nombre)
+	sort.Strings(palabras)
+	return strings.Join(palabras, " ")
+}
+
+// nombresSimilares tolera errores de tipeo: una letra en nombres cortos y dos
+// en los largos
+func nombresSimilares(a, b string) bool {
+	tolerancia := 1
+	if len(a) >= 12 && len(b) >= 12 {
+		tolerancia = 2
+	}
+	if len(a) < 6 || len(b) < 6 {
+		return false
+	}
+	return search.Distancia(a, b, tolerancia) <= tolerancia
+}
+
+// inicialesCompatibles indica si dos nombres coinciden palabra por palabra
+// cuando al menos uno usa iniciales ("G." y "Gabriel")
+func inicialesCompatibles(a, b []string) bool {
+	if len(a) == 0 || len(a) != len(b) {
+		return false
+	}
+
+	usaIniciales := false
+	for i := range a {
+		if len(a[i]) == 1 || len(b[i]) == 1 {
+			usaIniciales = true
+			if a[i][0] != b[i][0] {
+				return false
+			}
+		} else if a[i] != b[i] {
+			return false
+		}
+	}
+	return usaIniciales
+}
+
+// autoresCompatibles indica si dos libros comparten algún autor; los libros
+// sin autores cargados se consideran compatibles con cualquiera
+func autoresCompatibles(a, b map[string]bool) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for autor := range a {
+		if b[autor] {
+			return true
+		}
+	}
+	return false
+}
+
+// jaccard calcula la proporción de términos compartidos entre dos conjuntos
+func jaccard(a, b map[string]bool) float64 {
+	comunes := 0
+	for t := range a {
+		if b[t] {
+			comunes++
+		}
+	}
+	total := len(a) + len(b) - comunes
+	if total == 0 {
+		return 0
+	}
+	return float64(comunes) / float64(total)
+}
+
+// conjuntos agrupa índices relacionados de a pares (union-find)
+type conjuntos struct {
+	padre []int
+}
+
+func newConjuntos(n int) *conjuntos {
+	padre := make([]int, n)
+	for i := range padre {
+		padre[i] = i
+	}
+	return &conjuntos{padre: padre}
+}
+
+func (c *conjuntos) raiz(i int) int {
+	for c.padre[i] != i {
+		c.padre[i] = c.padre[c.padre[i]]
+		i = c.padre[i]
+	}
+	return i
+}
+
+func (c *conjuntos) unir(i, j int) {
+	c.padre[c.raiz(j)] = c.raiz(i)
+}
+
+func (c *conjuntos) mismo(i, j int) bool {
+	return c.raiz(i) == c.raiz(j)
+}
+
+// grupos devuelve los conjuntos de dos o más elementos, en orden de aparición
+func (c *conjuntos) grupos() [][]int {
+	porRaiz := make(map[int][]int)
+	var raices []int
+	for i := range c.padre {
+		r := c.raiz(i)
+		if len(porRaiz[r]) == 0 {
+			raices = append(raices, r)
+		}
+		porRaiz[r] = append(porRaiz[r], i)
+	}
+
+	var grupos [][]int
+	for _, r := range raices {
+		if len(porRaiz[r]) > 1 {
+			grupos = append(grupos, porRaiz[r])
+		}
+	}
+	return grupos
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"proyecto-bd-final/internal/config"
+	"proyecto-bd-final/internal/labels"
+	"strconv"
+	"strings"
+)
+
+// MaxEtiquetas limita los ejemplares por hoja de etiquetas (Oracle admite
+// hasta 1000 elementos en una lista IN)
+const MaxEtiquetas = 1000
+
+// GetEtiquetasEjemplares obtiene los datos a imprimir de los ejemplares
+// indicados por código y/o de todos los ejemplares de un libro. Si se indica
+// sucursal, solo se incluyen los ejemplares ubicados en ella
+func (s *BookService) GetEtiquetasEjemplares(codigos []int, isbn string, sucursalID int) ([]labels.Etiqueta, error) {
+	if len(codigos) == 0 && isbn == "" {
+		return nil, errors.New("debe indicar los códigos de ejemplar o un ISBN")
+	}
+	if len(codigos) > MaxEtiquetas {
+		return nil, errors.New("se pueden imprimir como máximo " + strconv.Itoa(MaxEtiquetas) + " etiquetas por vez")
+	}
+
+	filtro := nullSucursal(sucursalID)
+	args := []interface{}{filtro, filtro}
+	condiciones := []string{"(:1 IS NULL OR EJ.Sucursal_idUbicacion = :2)"}
+
+	if len(codigos) > 0 {
+		binds := make([]string, len(codigos))
+		for i, codigo := range codigos {
+			args = append(args, codigo)
+			binds[i] = ":" + strconv.Itoa(len(args))
+		}
+		condiciones = append(condiciones, "EJ.codigo IN ("+strings.Join(binds, ", ")+")")
+	}
+	if isbn != "" {
+		args = append(args, isbn)
+		condiciones = append(condiciones, "EJ.Libro_ISBN = :"+strconv.Itoa(len(args)))
+	}
+
+	query := `SELECT EJ.codigo, L.titulo, L.Signatura, S.nombre
+              FROM Ejemplar EJ
+              INNER JOIN Libro L ON EJ.Libro_ISBN = L.ISBN
+              INNER JOIN Sucursal S ON EJ.Sucursal_idUbicacion = S.idSucursal
+              WHERE ` + strings.Join(condiciones, " AND ") + `
+              ORDER BY L.Signatura, EJ.codigo`
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	etiquetas := []labels.Etiqueta{}
+	encontrados := make(map[int]bool)
+	for rows.Next() {
+		var etiqueta labels.Etiqueta
+		var signatura sql.NullString
+
+		if err := rows.Scan(&etiqueta.Codigo, &etiqueta.Titulo, &signatura, &etiqueta.Sucursal); err != nil {
+			return nil, err
+		}
+
+		etiqueta.Signatura = signatura.String
+		encontrados[etiqueta.Codigo] = true
+		etiquetas = append(etiquetas, etiqueta)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Informar los códigos pedidos que no existen (o están en otra sucursal)
+	var faltantes []string
+	for _, codigo := range codigos {
+		if !encontrados[codigo] {
+			faltantes = append(faltantes, strconv.Itoa(codigo))
+		}
+	}
+	if len(faltantes) > 0 {
+		return nil, errors.New("ejemplares no encontrados: " + strings.Join(faltantes, ", "))
+	}
+	if len(etiquetas) == 0 {
+		return nil, errors.New("no hay ejemplares para imprimir")
+	}
+	if len(etiquetas) > MaxEtiquetas {
+		return nil, errors.New("se pueden imprimir como máximo " + strconv.Itoa(MaxEtiquetas) + " etiquetas por vez")
+	}
+
+	return etiquetas, nil
+}
+
+// ImprimirEtiquetas genera la hoja de etiquetas en PDF y registra la impresión
+func (s *BookService) ImprimirEtiquetas(w io.Writer, etiquetas []labels.Etiqueta, op labels.Opciones, userID int) error {
+	if err := labels.GenerarPDF(w, etiquetas, op); err != nil {
+		return err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "PRINT", "Ejemplar",
+		"Etiquetas impresas: "+strconv.Itoa(len(etiquetas))+" ("+op.Formato+", "+op.Plantilla.Nombre+")")
+
+	return nil
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"proyecto-bd-final/internal/config"
+	"strconv"
+	"strings"
+)
+
+// Formatos de exportación soportados
+const (
+	FormatoCSV     = "csv"
+	FormatoJSONL   = "jsonl"
+	FormatoMARCXML = "marcxml"
+)
+
+// separadorLista separa los valores agregados con LISTAGG
+const separadorLista = "|"
+
+// RegistroCatalogo representa un libro del catálogo listo para exportar
+type RegistroCatalogo struct {
+	ISBN                 string   `json:"isbn"`
+	Titulo               string   `json:"titulo"`
+	AnioPublicacion      int      `json:"anioPublicacion"`
+	Signatura            string   `json:"signatura,omitempty"`
+	SistemaClasificacion string   `json:"sistemaClasificacion,omitempty"`
+	Editorial            string   `json:"editorial"`
+	PaisEditorial        string   `json:"paisEditorial,omitempty"`
+	Autores              []string `json:"autores"`
+	TotalEjemplares      int      `json:"totalEjemplares"`
+	EjemplaresDisponible int      `json:"ejemplaresDisponibles"`
+
+	// autoresInvertidos guarda los autores como "Apellido, Nombre" para MARC
+	autoresInvertidos []string
+}
+
+// CatalogExporter escribe registros del catálogo en un formato concreto
+type CatalogExporter interface {
+	Begin() error
+	Write(registro *RegistroCatalogo) error
+	End() error
+}
+
+// ExportContentType devuelve el tipo MIME y la extensión de archivo de un formato
+func ExportContentType(formato string) (string, string, error) {
+	switch formato {
+	case FormatoCSV:
+		return "text/csv; charset=utf-8", "csv", nil
+	case FormatoJSONL:
+		return "application/x-ndjson; charset=utf-8", "jsonl", nil
+	case FormatoMARCXML:
+		return "application/marcxml+xml; charset=utf-8", "xml", nil
+	}
+	return "", "", errors.New("formato de exportación no soportado: " + formato)
+}
+
+// NewCatalogExporter crea el exportador correspondiente al formato indicado
+func NewCatalogExporter(formato string, w io.Writer) (CatalogExporter, error) {
+	switch formato {
+	case FormatoCSV:
+		return &csvExporter{w: csv.NewWriter(w)}, nil
+	case FormatoJSONL:
+		return &jsonlExporter{enc: json.NewEncoder(w)}, nil
+	case FormatoMARCXML:
+		return &marcxmlExporter{w: bufio.NewWriter(w)}, nil
+	}
+	return nil, errors.New("formato de exportación no soportado: " + formato)
+}
+
+// ExportCatalog recorre el catálogo completo fila por fila y lo escribe con el
+// exportador indicado, sin cargar todos los libros en memoria
+func (s *BookService) ExportCatalog(exporter CatalogExporter, userID int) (int, error) {
+	query := `SELECT L.ISBN, L.titulo, EXTRACT(YEAR FROM L.anioEdicion) AS anio,
+              L.signatura, L.sistemaClasificacion,
+              E.nombre AS EDITORIAL_NOMBRE, E.pais AS EDITORIAL_PAIS,
+              (SELECT LISTAGG(A.nombre || ' ' || A.apellido, '|')
+                      WITHIN GROUP (ORDER BY LA.idLibroAutor)
+                 FROM LibroAutor LA
+                 INNER JOIN Autor A ON A.idAutor = LA.Autor_idAutor
+                WHERE LA.Libro_ISBN = L.ISBN) AS AUTORES,
+              (SELECT LISTAGG(A.apellido || ', ' || A.nombre, '|')
+                      WITHIN GROUP (ORDER BY LA.idLibroAutor)
+                 FROM LibroAutor LA
+                 INNER JOIN Autor A ON A.idAutor = LA.Autor_idAutor
+                WHERE LA.Libro_ISBN = L.ISBN) AS AUTORES_INVERTIDOS,
+              (SELECT COUNT(*) FROM Ejemplar EJ
+                WHERE EJ.Libro_ISBN = L.ISBN AND EJ.estado <> 'BAJA') AS TOTAL,
+              (SELECT COUNT(*) FROM Ejemplar EJ
+                WHERE EJ.Libro_ISBN = L.ISBN AND EJ.estado = 'DISPONIBLE') AS DISPONIBLES
+              FROM Libro L
+              LEFT JOIN Editorial E ON L.Editorial_idEditorial = E.idEditorial
+              ORDER BY L.ISBN`
+
+	rows, err := config.DB.Query(query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	if err := exporter.Begin(); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for rows.Next() {
+		var registro RegistroCatalogo
+		var anio sql.NullInt64
+		var signatura, sistema, editorial, pais, autores, autoresInvertidos sql.NullString
+
+		if err := rows.Scan(
+			&registro.ISBN,
+			&registro.Titulo,
+			&anio,
+			&signatura,
+			&sistema,
+			&editorial,
+			&pais,
+			&autores,
+			&autoresInvertidos,
+			&registro.TotalEjemplares,
+			&registro.EjemplaresDisponible,
+		); err != nil {
+			return total, err
+		}
+
+		registro.AnioPublicacion = int(anio.Int64)
+		registro.Signatura = signatura.String
+		registro.SistemaClasificacion = sistema.String
+		registro.Editorial = editorial.String
+		registro.PaisEditorial = pais.String
+		registro.Autores = splitLista(autores)
+		registro.autoresInvertidos = splitLista(autoresInvertidos)
+
+		if err := exporter.Write(&registro); err != nil {
+			return total, err
+		}
+		total++
+	}
+
+	if err := rows.Err(); err != nil {
+		return total, err
+	}
+
+	if err := exporter.End(); err != nil {
+		return total, err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "EXPORT", "LIBRO", "Exportación del catálogo: "+strconv.Itoa(total)+" libros")
+
+	return total, nil
+}
+
+// splitLista separa una lista agregada con LISTAGG
+func splitLista(valor sql.NullString) []string {
+	if !valor.Valid || valor.String == "" {
+		return []string{}
+	}
+	return strings.Split(valor.String, separadorLista)
+}
+
+// csvExporter exporta el catálogo como CSV con encabezado
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvExporter) Begin() error {
+	return e.w.Write([]string{
+		"isbn", "titulo", "anio_publicacion", "signatura", "editorial", "pais_editorial",
+		"autores", "total_ejemplares", "ejemplares_disponibles",
+	})
+}
+
+func (e *csvExporter) Write(r *RegistroCatalogo) error {
+	return e.w.Write([]string{
+		r.ISBN,
+		r.Titulo,
+		strconv.Itoa(r.AnioPublicacion),
+		r.Signatura,
+		r.Editorial,
+		r.PaisEditorial,
+		strings.Join(r.Autores, "; "),
+		strconv.Itoa(r.TotalEjemplares),
+		strconv.Itoa(r.EjemplaresDisponible),
+	})
+}
+
+func (e *csvExporter) End() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// jsonlExporter exporta el catálogo como JSON Lines (un objeto por línea)
+type jsonlExporter struct {
+	enc *json.Encoder
+}
+
+func (e *jsonlExporter) Begin() error { return nil }
+
+func (e *jsonlExporter) Write(r *RegistroCatalogo) error {
+	return e.enc.Encode(r)
+}
+
+func (e *jsonlExporter) End() error { return nil }
+
+// marcxmlExporter exporta el catálogo como una colección MARC21 en XML
+type marcxmlExporter struct {
+	w *bufio.Writer
+}
+
+func (e *marcxmlExporter) Begin() error {
+	_, err := e.w.WriteString(xml.Header +
+		`<collection xmlns="http://www.loc.gov/MARC21/slim">` + "\n")
+	return err
+}
+
+func (e *marcxmlExporter) Write(r *RegistroCatalogo) error {
+	e.w.WriteString("  <record>\n")
+	e.w.WriteString("    <leader>00000nam a2200000 a 4500</leader>\n")
+	e.controlField("001", r.ISBN)
+	e.dataField("020", " ", " ", "a", r.ISBN)
+
+	// Signatura: 050 para LC y 082 para Dewey
+	switch r.SistemaClasificacion {
+	case SistemaLC:
+		e.dataField("050", " ", "4", "a", r.Signatura)
+	case SistemaDewey:
+		e.dataField("082", "0", "4", "a", r.Signatura)
+	}
+
+	if len(r.autoresInvertidos) > 0 {
+		e.dataField("100", "1", " ", "a", r.autoresInvertidos[0])
+	}
+
+	primerIndicador := "0"
+	if len(r.autoresInvertidos) > 0 {
+		primerIndicador = "1"
+	}
+	e.dataField("245", primerIndicador, "0", "a", r.Titulo)
+
+	anio := ""
+	if r.AnioPublicacion > 0 {
+		anio = strconv.Itoa(r.AnioPublicacion)
+	}
+	e.dataField("264", " ", "1", "a", r.PaisEditorial, "b", r.Editorial, "c", anio)
+
+	for _, autor := range r.autoresInvertidos[min(1, len(r.autoresInvertidos)):] {
+		e.dataField("700", "1", " ", "a", autor)
+	}
+
+	// Campo local con el conteo de ejemplares
+	e.dataField("999", " ", " ",
+		"a", strconv.Itoa(r.TotalEjemplares),
+		"b", strconv.Itoa(r.EjemplaresDisponible))
+
+	_, err := e.w.WriteString("  </record>\n")
+	if err != nil {
+		return err
+	}
+
+	// Vaciar el buffer por registro para mantener la memoria acotada
+	return e.w.Flush()
+}
+
+func (e *marcxmlExporter) End() error {
+	if _, err := e.w.WriteString("</collection>\n"); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+// controlField escribe un campo de control MARC
+func (e *marcxmlExporter) controlField(tag, valor string) {
+	fmt.Fprintf(e.w, "    <controlfield tag=\"%s\">", tag)
+	xml.EscapeText(e.w, []byte(valor))
+	e.w.WriteString("</controlfield>\n")
+}
+
+// dataField escribe un campo de datos MARC; subcampos recibe pares código/valor
+// y omite los valores vacíos
+func (e *marcxmlExporter) dataField(tag, ind1, ind2 string, subcampos ...string) {
+	fmt.Fprintf(e.w, "    <datafield tag=\"%s\" ind1=\"%s\" ind2=\"%s\">\n", tag, ind1, ind2)
+	for i := 0; i+1 < len(subcampos); i += 2 {
+		if subcampos[i+1] == "" {
+			continue
+		}
+		fmt.Fprintf(e.w, "      <subfield code=\"%s\">", subcampos[i])
+		xml.EscapeText(e.w, []byte(subcampos[i+1]))
+		e.w.WriteString("</subfield>\n")
+	}
+	e.w.WriteString("    </datafield>\n")
+}
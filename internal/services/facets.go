@@ -0,0 +1,503 @@
+package services
+
+import (
+	"database/sql"
+	"proyecto-bd-final/internal/config"
+	"proyecto-bd-final/internal/models"
+	"proyecto-bd-final/internal/search"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LimiteCatalogo y LimiteCatalogoMaximo son el tamaño de página por defecto y
+// el máximo de la búsqueda facetada
+const (
+	LimiteCatalogo       = 20
+	LimiteCatalogoMaximo = 100
+)
+
+// loteISBN es la cantidad de ISBN por lista IN; Oracle admite hasta 1000
+const loteISBN = 500
+
+// FiltroCatalogo agrupa los filtros estructurados del catálogo y la página
+// pedida (Limite 0 = todos los libros). Facetas indica si se calculan los
+// conteos de cada faceta
+type FiltroCatalogo struct {
+	Q              string
+	EditorialID    int
+	AutorID        int
+	CategoriaID    int
+	SucursalID     int
+	AnioDesde      int
+	AnioHasta      int
+	Disponible     *bool
+	Limite         int
+	Desplazamiento int
+	Facetas        bool
+}
+
+// Faceta es un valor posible de un filtro con la cantidad de libros que lo cumplen
+type Faceta struct {
+	Valor    string `json:"valor"`
+	Etiqueta string `json:"etiqueta"`
+	Cantidad int    `json:"cantidad"`
+}
+
+// FacetasCatalogo contiene los conteos por filtro. Cada faceta se cuenta con
+// todos los filtros salvo el suyo, para que elegir un valor no oculte los demás
+type FacetasCatalogo struct {
+	Editoriales    []Faceta `json:"editoriales"`
+	Autores        []Faceta `json:"autores"`
+	Categorias     []Faceta `json:"categorias"`
+	Anios          []Faceta `json:"anios"`
+	Disponibilidad []Faceta `json:"disponibilidad"`
+}
+
+// ResultadoCatalogo es la respuesta de una búsqueda filtrada del catálogo:
+// una página de libros, el total que cumple los filtros y las facetas
+type ResultadoCatalogo struct {
+	Total          int             `json:"total"`
+	Limite         int             `json:"limit"`
+	Desplazamiento int             `json:"offset"`
+	Libros         []*models.Libro `json:"libros"`
+	Facetas        FacetasCatalogo `json:"facetas"`
+}
+
+// Dimensiones de filtro que tienen faceta propia
+const (
+	dimensionNinguna = iota
+	dimensionEditorial
+	dimensionAutor
+	dimensionCategoria
+	dimensionAnio
+	dimensionDisponible
+)
+
+// consultaCatalogo acumula los binds posicionales de una consulta
+type consultaCatalogo struct {
+	args []interface{}
+}
+
+func (q *consultaCatalogo) bind(v interface{}) string {
+	q.args = append(q.args, v)
+	return ":" + strconv.Itoa(len(q.args))
+}
+
+// enLista arma columna IN (...) partida en listas de loteISBN elementos
+func (q *consultaCatalogo) enLista(columna string, valores []string) string {
+	var listas []string
+	for inicio := 0; inicio < len(valores); inicio += loteISBN {
+		fin := inicio + loteISBN
+		if fin > len(valores) {
+			fin = len(valores)
+		}
+		binds := make([]string, 0, fin-inicio)
+		for _, v := range valores[inicio:fin] {
+			binds = append(binds, q.bind(v))
+		}
+		listas = append(listas, columna+" IN ("+strings.Join(binds, ", ")+")")
+	}
+	return "(" + strings.Join(listas, " OR ") + ")"
+}
+
+// ejemplarEnSucursal limita los ejemplares a la sucursal del filtro, si la hay
+func (q *consultaCatalogo) ejemplarEnSucursal(filtro FiltroCatalogo) string {
+	if filtro.SucursalID > 0 {
+		return ` AND EJ.Sucursal_idUbicacion = ` + q.bind(filtro.SucursalID)
+	}
+	return ""
+}
+
+// condiciones devuelve las condiciones sobre L de todos los filtros salvo el
+// de la dimensión excluida. coincidencias son los ISBN de la búsqueda por
+// texto (nil = sin búsqueda)
+func (q *consultaCatalogo) condiciones(filtro FiltroCatalogo, coincidencias []string, excluida int) string {
+	var w strings.Builder
+
+	// Con sucursal, solo cuentan los libros con ejemplares ubicados en ella
+	if filtro.SucursalID > 0 {
+		w.WriteString(` AND EXISTS (SELECT 1 FROM Ejemplar EJ
+                    WHERE EJ.Libro_ISBN = L.ISBN AND EJ.estado <> ` + q.bind(EjemplarDadoDeBaja) +
+			q.ejemplarEnSucursal(filtro) + `)`)
+	}
+	if coincidencias != nil {
+		w.WriteString(` AND ` + q.enLista("L.ISBN", coincidencias))
+	}
+
+	if excluida != dimensionEditorial && filtro.EditorialID > 0 {
+		w.WriteString(` AND L.Editorial_idEditorial = ` + q.bind(filtro.EditorialID))
+	}
+	if excluida != dimensionAutor && filtro.AutorID > 0 {
+		w.WriteString(` AND EXISTS (SELECT 1 FROM LibroAutor FA
+                    WHERE FA.Libro_ISBN = L.ISBN AND FA.Autor_idAutor = ` + q.bind(filtro.AutorID) + `)`)
+	}
+	if excluida != dimensionCategoria && filtro.CategoriaID > 0 {
+		// Incluye los libros de todas las subcategorías
+		w.WriteString(` AND EXISTS (SELECT 1 FROM LibroCategoria FC
+                    WHERE FC.Libro_ISBN = L.ISBN
+                    AND FC.Categoria_idCategoria IN (SELECT idCategoria FROM Categoria
+                                                     START WITH idCategoria = ` + q.bind(filtro.CategoriaID) + `
+                                                     CONNECT BY PRIOR idCategoria = Categoria_idPadre))`)
+	}
+	if excluida != dimensionAnio {
+		if filtro.AnioDesde > 0 {
+			w.WriteString(` AND EXTRACT(YEAR FROM L.anioEdicion) >= ` + q.bind(filtro.AnioDesde))
+		}
+		if filtro.AnioHasta > 0 {
+			w.WriteString(` AND EXTRACT(YEAR FROM L.anioEdicion) <= ` + q.bind(filtro.AnioHasta))
+		}
+	}
+	if excluida != dimensionDisponible && filtro.Disponible != nil {
+		w.WriteString(` AND `)
+		if !*filtro.Disponible {
+			w.WriteString(`NOT `)
+		}
+		w.WriteString(`EXISTS (SELECT 1 FROM Ejemplar EJ
+                    WHERE EJ.Libro_ISBN = L.ISBN AND EJ.estado = ` + q.bind(EjemplarDisponible) +
+			q.ejemplarEnSucursal(filtro) + `)`)
+	}
+
+	return w.String()
+}
+
+// SearchCatalog aplica los filtros estructurados (y la búsqueda por texto, si la
+// hay) y devuelve una página de libros y, si se piden, los conteos de cada
+// faceta. Los filtros y la página se resuelven en la base de datos; con
+// búsqueda por texto el orden es la relevancia y se pagina sobre los ISBN
+func (s *BookService) SearchCatalog(filtro FiltroCatalogo) (*ResultadoCatalogo, error) {
+	resultado := &ResultadoCatalogo{
+		Limite:         filtro.Limite,
+		Desplazamiento: filtro.Desplazamiento,
+		Libros:         []*models.Libro{},
+		Facetas: FacetasCatalogo{
+			Editoriales:    []Faceta{},
+			Autores:        []Faceta{},
+			Categorias:     []Faceta{},
+			Anios:          []Faceta{},
+			Disponibilidad: []Faceta{},
+		},
+	}
+
+	var coincidencias []string
+	if strings.TrimSpace(filtro.Q) != "" {
+		var err error
+		if coincidencias, err = s.buscarTexto(filtro.Q); err != nil {
+			return nil, err
+		}
+		if len(coincidencias) == 0 {
+			return resultado, nil
+		}
+	}
+
+	var pagina []string
+	var err error
+	if coincidencias != nil {
+		pagina, resultado.Total, err = s.paginaPorRelevancia(filtro, coincidencias)
+	} else {
+		pagina, resultado.Total, err = s.paginaPorTitulo(filtro)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resultado.Libros, err = s.cargarCatalogo(pagina, filtro.SucursalID); err != nil {
+		return nil, err
+	}
+
+	if filtro.Facetas {
+		if err := s.calcularFacetas(filtro, coincidencias, &resultado.Facetas); err != nil {
+			return nil, err
+		}
+	}
+
+	return resultado, nil
+}
+
+// paginaPorTitulo cuenta los libros que cumplen los filtros y devuelve los
+// ISBN de la página pedida en orden alfabético
+func (s *BookService) paginaPorTitulo(filtro FiltroCatalogo) ([]string, int, error) {
+	var total int
+	conteo := &consultaCatalogo{}
+	err := config.DB.QueryRow(`SELECT COUNT(*) FROM Libro L WHERE 1 = 1`+
+		conteo.condiciones(filtro, nil, dimensionNinguna), conteo.args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	if total == 0 || filtro.Desplazamiento >= total {
+		return nil, total, nil
+	}
+
+	q := &consultaCatalogo{}
+	query := `SELECT L.ISBN FROM Libro L WHERE 1 = 1` + q.condiciones(filtro, nil, dimensionNinguna) + `
+              ORDER BY L.titulo, L.ISBN
+              OFFSET ` + q.bind(filtro.Desplazamiento) + ` ROWS`
+	if filtro.Limite > 0 {
+		query += ` FETCH NEXT ` + q.bind(filtro.Limite) + ` ROWS ONLY`
+	}
+
+	isbns, err := consultarISBNs(query, q.args)
+	return isbns, total, err
+}
+
+// paginaPorRelevancia filtra en la base de datos los libros que coinciden con
+// el texto y devuelve los ISBN de la página pedida en orden de relevancia
+func (s *BookService) paginaPorRelevancia(filtro FiltroCatalogo, coincidencias []string) ([]string, int, error) {
+	q := &consultaCatalogo{}
+	cumplen, err := consultarISBNs(`SELECT L.ISBN FROM Libro L WHERE 1 = 1`+
+		q.condiciones(filtro, coincidencias, dimensionNinguna), q.args)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	posicion := make(map[string]int, len(coincidencias))
+	for i, isbn := range coincidencias {
+		posicion[isbn] = i
+	}
+	sort.Slice(cumplen, func(i, j int) bool {
+		return posicion[cumplen[i]] < posicion[cumplen[j]]
+	})
+
+	total := len(cumplen)
+	if filtro.Desplazamiento >= total {
+		return nil, total, nil
+	}
+	cumplen = cumplen[filtro.Desplazamiento:]
+	if filtro.Limite > 0 && filtro.Limite < len(cumplen) {
+		cumplen = cumplen[:filtro.Limite]
+	}
+	return cumplen, total, nil
+}
+
+func consultarISBNs(query string, args []interface{}) ([]string, error) {
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var isbns []string
+	for rows.Next() {
+		var isbn string
+		if err := rows.Scan(&isbn); err != nil {
+			return nil, err
+		}
+		isbns = append(isbns, isbn)
+	}
+
+	return isbns, rows.Err()
+}
+
+// cargarCatalogo obtiene los libros indicados con sus autores, categorías y
+// disponibilidad, de a loteISBN por consulta, en el mismo orden. Con sucursal,
+// los ejemplares considerados son solo los ubicados en ella
+func (s *BookService) cargarCatalogo(isbns []string, sucursalID int) ([]*models.Libro, error) {
+	cargados := make(map[string]*models.Libro, len(isbns))
+	filtro := FiltroCatalogo{SucursalID: sucursalID}
+
+	for inicio := 0; inicio < len(isbns); inicio += loteISBN {
+		fin := inicio + loteISBN
+		if fin > len(isbns) {
+			fin = len(isbns)
+		}
+
+		q := &consultaCatalogo{}
+		query := `SELECT L.ISBN, L.titulo, EXTRACT(YEAR FROM L.anioEdicion) AS anio,
+              L.Editorial_idEditorial, E.nombre AS EDITORIAL_NOMBRE,
+              L.signatura, L.sistemaClasificacion,
+              (SELECT LISTAGG(A.nombre || ' ' || A.apellido, '` + separadorLista + `')
+                      WITHIN GROUP (ORDER BY LA.idLibroAutor)
+                 FROM LibroAutor LA
+                 INNER JOIN Autor A ON A.idAutor = LA.Autor_idAutor
+                WHERE LA.Libro_ISBN = L.ISBN) AS AUTORES,
+              (SELECT LISTAGG(C.nombre, '` + separadorLista + `')
+                      WITHIN GROUP (ORDER BY C.nombre)
+                 FROM LibroCategoria LC
+                 INNER JOIN Categoria C ON C.idCategoria = LC.Categoria_idCategoria
+                WHERE LC.Libro_ISBN = L.ISBN) AS CATEGORIAS,
+              (SELECT COUNT(*) FROM Ejemplar EJ
+                WHERE EJ.Libro_ISBN = L.ISBN AND EJ.estado <> ` + q.bind(EjemplarDadoDeBaja) +
+			q.ejemplarEnSucursal(filtro) + `) AS TOTAL,
+              (SELECT COUNT(*) FROM Ejemplar EJ
+                WHERE EJ.Libro_ISBN = L.ISBN AND EJ.estado = ` + q.bind(EjemplarDisponible) +
+			q.ejemplarEnSucursal(filtro) + `) AS DISPONIBLES
+              FROM Libro L
+              LEFT JOIN Editorial E ON L.Editorial_idEditorial = E.idEditorial
+              WHERE ` + q.enLista("L.ISBN", isbns[inicio:fin])
+
+		if err := cargarLibrosCatalogo(cargados, query, q.args); err != nil {
+			return nil, err
+		}
+	}
+
+	libros := make([]*models.Libro, 0, len(isbns))
+	for _, isbn := range isbns {
+		if libro, ok := cargados[isbn]; ok {
+			libros = append(libros, libro)
+		}
+	}
+	return libros, nil
+}
+
+// cargarLibrosCatalogo agrega a libros las filas de la consulta de cargarCatalogo
+func cargarLibrosCatalogo(libros map[string]*models.Libro, query string, args []interface{}) error {
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var libro models.Libro
+		var anio sql.NullInt64
+		var editorialNombre, signatura, sistema, autores, categorias sql.NullString
+		var disponibles int
+
+		if err := rows.Scan(
+			&libro.ISBN,
+			&libro.Titulo,
+			&anio,
+			&libro.EditorialID,
+			&editorialNombre,
+			&signatura,
+			&sistema,
+			&autores,
+			&categorias,
+			&libro.Cantidad,
+			&disponibles,
+		); err != nil {
+			return err
+		}
+
+		libro.AnioPublicacion = int(anio.Int64)
+		libro.EditorialNombre = editorialNombre.String
+		libro.Signatura = signatura.String
+		libro.SistemaClasificacion = sistema.String
+		libro.Autores = splitLista(autores)
+		libro.Categorias = splitLista(categorias)
+		libro.Disponible = disponibles > 0
+
+		libros[libro.ISBN] = &libro
+	}
+
+	return rows.Err()
+}
+
+// buscarTexto devuelve los ISBN que coinciden con el texto, por relevancia
+func (s *BookService) buscarTexto(q string) ([]string, error) {
+	if search.Catalogo.Len() > 0 {
+		resultados := search.Catalogo.Search(q)
+		isbns := make([]string, 0, len(resultados))
+		for _, r := range resultados {
+			isbns = append(isbns, r.ISBN)
+		}
+		return isbns, nil
+	}
+
+	isbns, err := s.buscarISBNsSQL(q)
+	if isbns == nil && err == nil {
+		isbns = []string{}
+	}
+	return isbns, err
+}
+
+// calcularFacetas cuenta editoriales, autores, categorías, años y
+// disponibilidad; cada faceta considera los libros que cumplen los demás filtros
+func (s *BookService) calcularFacetas(filtro FiltroCatalogo, coincidencias []string, facetas *FacetasCatalogo) error {
+	var err error
+
+	q := &consultaCatalogo{}
+	facetas.Editoriales, err = contarFaceta(`SELECT TO_CHAR(E.idEditorial), E.nombre, COUNT(*)
+              FROM Libro L
+              INNER JOIN Editorial E ON E.idEditorial = L.Editorial_idEditorial
+              WHERE 1 = 1`+q.condiciones(filtro, coincidencias, dimensionEditorial)+`
+              GROUP BY E.idEditorial, E.nombre`, q.args)
+	if err != nil {
+		return err
+	}
+
+	q = &consultaCatalogo{}
+	facetas.Autores, err = contarFaceta(`SELECT TO_CHAR(A.idAutor), A.nombre || ' ' || A.apellido, COUNT(DISTINCT L.ISBN)
+              FROM Libro L
+              INNER JOIN LibroAutor LA ON LA.Libro_ISBN = L.ISBN
+              INNER JOIN Autor A ON A.idAutor = LA.Autor_idAutor
+              WHERE 1 = 1`+q.condiciones(filtro, coincidencias, dimensionAutor)+`
+              GROUP BY A.idAutor, A.nombre, A.apellido`, q.args)
+	if err != nil {
+		return err
+	}
+
+	q = &consultaCatalogo{}
+	facetas.Categorias, err = contarFaceta(`SELECT TO_CHAR(C.idCategoria), C.nombre, COUNT(DISTINCT L.ISBN)
+              FROM Libro L
+              INNER JOIN LibroCategoria LC ON LC.Libro_ISBN = L.ISBN
+              INNER JOIN Categoria C ON C.idCategoria = LC.Categoria_idCategoria
+              WHERE 1 = 1`+q.condiciones(filtro, coincidencias, dimensionCategoria)+`
+              GROUP BY C.idCategoria, C.nombre`, q.args)
+	if err != nil {
+		return err
+	}
+
+	q = &consultaCatalogo{}
+	facetas.Anios, err = contarFaceta(`SELECT TO_CHAR(EXTRACT(YEAR FROM L.anioEdicion)),
+                     TO_CHAR(EXTRACT(YEAR FROM L.anioEdicion)), COUNT(*)
+              FROM Libro L
+              WHERE L.anioEdicion IS NOT NULL`+q.condiciones(filtro, coincidencias, dimensionAnio)+`
+              GROUP BY EXTRACT(YEAR FROM L.anioEdicion)`, q.args)
+	if err != nil {
+		return err
+	}
+
+	// Los años se muestran en orden cronológico descendente
+	sort.Slice(facetas.Anios, func(i, j int) bool {
+		a, _ := strconv.Atoi(facetas.Anios[i].Valor)
+		b, _ := strconv.Atoi(facetas.Anios[j].Valor)
+		return a > b
+	})
+
+	q = &consultaCatalogo{}
+	disponible := q.bind(EjemplarDisponible)
+	sucursal := q.ejemplarEnSucursal(filtro)
+	facetas.Disponibilidad, err = contarFaceta(`SELECT disponible,
+                     CASE disponible WHEN 'true' THEN 'Disponible' ELSE 'No disponible' END,
+                     COUNT(*)
+              FROM (SELECT CASE WHEN EXISTS (SELECT 1 FROM Ejemplar EJ
+                                             WHERE EJ.Libro_ISBN = L.ISBN AND EJ.estado = `+disponible+sucursal+`)
+                                THEN 'true' ELSE 'false' END AS disponible
+                      FROM Libro L
+                     WHERE 1 = 1`+q.condiciones(filtro, coincidencias, dimensionDisponible)+`)
+              GROUP BY disponible`, q.args)
+	return err
+}
+
+// contarFaceta lee filas valor, etiqueta, cantidad y las ordena por cantidad
+// descendente y etiqueta
+func contarFaceta(query string, args []interface{}) ([]Faceta, error) {
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facetas := []Faceta{}
+	for rows.Next() {
+		var faceta Faceta
+		var etiqueta sql.NullString
+		if err := rows.Scan(&faceta.Valor, &etiqueta, &faceta.Cantidad); err != nil {
+			return nil, err
+		}
+		faceta.Etiqueta = etiqueta.String
+		facetas = append(facetas, faceta)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(facetas, func(i, j int) bool {
+		if facetas[i].Cantidad != facetas[j].Cantidad {
+			return facetas[i].Cantidad > facetas[j].Cantidad
+		}
+		return facetas[i].Etiqueta < facetas[j].Etiqueta
+	})
+	return facetas, nil
+}
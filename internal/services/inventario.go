@@ -0,0 +1,546 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"proyecto-bd-final/internal/config"
+	"proyecto-bd-final/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Estados de una sesión de inventario
+const (
+	InventarioAbierto   = "ABIERTO"
+	InventarioCerrado   = "CERRADO"
+	InventarioCancelado = "CANCELADO"
+)
+
+// Tipos de discrepancia del reporte de inventario
+const (
+	DiscrepanciaFaltante   = "FALTANTE"
+	DiscrepanciaMalUbicado = "MAL_UBICADO"
+	DiscrepanciaInesperado = "INESPERADO"
+)
+
+type InventarioService struct {
+	bitacoraService *BitacoraService
+	reservaService  *ReservaService
+}
+
+func NewInventarioService() *InventarioService {
+	return &InventarioService{
+		bitacoraService: NewBitacoraService(),
+		reservaService:  NewReservaService(),
+	}
+}
+
+const selectInventario = `SELECT I.idInventario, I.estado, I.fechaInicio, I.fechaCierre, I.localizacion,
+              I.Sucursal_idSucursal, I.Usuario_idResponsable, I.totalEsperados, I.totalEncontrados,
+              (SELECT COUNT(*) FROM InventarioLectura IL WHERE IL.Inventario_idInventario = I.idInventario)
+              FROM Inventario I`
+
+// GetByID obtiene una sesión de inventario por su ID
+func (s *InventarioService) GetByID(id int) (*models.Inventario, error) {
+	inventario, err := scanInventario(config.DB.QueryRow(selectInventario+` WHERE I.idInventario = :1`, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("inventario no encontrado")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return inventario, nil
+}
+
+// GetInventarios obtiene las sesiones de inventario de una sucursal (0 =
+// todas), opcionalmente filtradas por estado
+func (s *InventarioService) GetInventarios(sucursalID int, estado string) ([]*models.Inventario, error) {
+	query := selectInventario + `
+              WHERE (:1 IS NULL OR I.Sucursal_idSucursal = :2)
+              AND (:3 IS NULL OR I.estado = :4)
+              ORDER BY I.fechaInicio DESC, I.idInventario DESC`
+
+	filtroSucursal := nullSucursal(sucursalID)
+	filtroEstado := nullString(estado)
+	rows, err := config.DB.Query(query, filtroSucursal, filtroSucursal, filtroEstado, filtroEstado)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inventarios := []*models.Inventario{}
+	for rows.Next() {
+		inventario, err := scanInventario(rows)
+		if err != nil {
+			return nil, err
+		}
+		inventarios = append(inventarios, inventario)
+	}
+
+	return inventarios, rows.Err()
+}
+
+// Iniciar abre una sesión de inventario en la sucursal. Si se indica
+// localizacion, solo se revisan las ubicaciones que empiezan con ella (por
+// ejemplo "SALA-A" abarca todos los estantes de la sala A)
+func (s *InventarioService) Iniciar(sucursalID int, localizacion string, userID int) (*models.Inventario, error) {
+	localizacion = strings.ToUpper(strings.TrimSpace(localizacion))
+
+	var existe int
+	if err := config.DB.QueryRow(`SELECT COUNT(*) FROM Sucursal WHERE idSucursal = :1`, sucursalID).Scan(&existe); err != nil {
+		return nil, err
+	}
+	if existe == 0 {
+		return nil, errors.New("sucursal no encontrada")
+	}
+
+	// Dos sesiones abiertas no pueden revisar los mismos estantes
+	query := `SELECT COUNT(*) FROM Inventario
+              WHERE Sucursal_idSucursal = :1 AND estado = :2
+              AND (:3 IS NULL OR localizacion IS NULL
+                   OR SUBSTR(:4, 1, LENGTH(localizacion)) = localizacion
+                   OR SUBSTR(localizacion, 1, LENGTH(:5)) = :6)`
+
+	alcance := nullString(localizacion)
+	var abiertos int
+	err := config.DB.QueryRow(query, sucursalID, InventarioAbierto, alcance, alcance, alcance, alcance).Scan(&abiertos)
+	if err != nil {
+		return nil, err
+	}
+	if abiertos > 0 {
+		return nil, errors.New("ya hay un inventario abierto que abarca esas ubicaciones")
+	}
+
+	var id int
+	if err := config.DB.QueryRow("SELECT INVENTARIO_SEQ.NEXTVAL FROM DUAL").Scan(&id); err != nil {
+		return nil, err
+	}
+
+	query = `INSERT INTO Inventario (idInventario, estado, fechaInicio, localizacion,
+             Sucursal_idSucursal, Usuario_idResponsable)
+             VALUES (:1, :2, :3, :4, :5, :6)`
+	if _, err := config.DB.Exec(query, id, InventarioAbierto, time.Now(), alcance, sucursalID, userID); err != nil {
+		return nil, err
+	}
+
+	// Registrar en bitácora
+	detalle := "Inventario " + strconv.Itoa(id) + " iniciado en sucursal " + strconv.Itoa(sucursalID)
+	if localizacion != "" {
+		detalle += ", ubicaciones " + localizacion
+	}
+	s.bitacoraService.RegistrarAccion(userID, "CREATE", "Inventario", detalle)
+
+	return s.GetByID(id)
+}
+
+// RegistrarLecturas guarda los códigos escaneados en una ubicación. Si un
+// ejemplar ya se había leído, se conserva la última ubicación en que se leyó.
+// sucursalID es la sucursal de quien opera (0 para el administrador)
+func (s *InventarioService) RegistrarLecturas(id int, localizacion string, codigos []int, sucursalID, userID int) (int, error) {
+	inventario, err := s.inventarioAbierto(id, sucursalID)
+	if err != nil {
+		return 0, err
+	}
+
+	localizacion = strings.ToUpper(strings.TrimSpace(localizacion))
+	if localizacion == "" {
+		return 0, errors.New("debe indicar la ubicación escaneada")
+	}
+	if !strings.HasPrefix(localizacion, inventario.Localizacion) {
+		return 0, errors.New("la ubicación está fuera del alcance del inventario")
+	}
+	if len(codigos) == 0 {
+		return 0, errors.New("debe indicar al menos un código")
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	ahora := time.Now()
+	for _, codigo := range codigos {
+		result, err := tx.Exec(`UPDATE InventarioLectura SET localizacion = :1, fechaLectura = :2, Usuario_idUsuario = :3
+                                WHERE Inventario_idInventario = :4 AND codigoLeido = :5`,
+			localizacion, ahora, userID, id, codigo)
+		if err != nil {
+			return 0, err
+		}
+		if filas, _ := result.RowsAffected(); filas > 0 {
+			continue
+		}
+
+		_, err = tx.Exec(`INSERT INTO InventarioLectura (idLectura, Inventario_idInventario, codigoLeido,
+                          localizacion, fechaLectura, Usuario_idUsuario)
+                          VALUES (INVENTARIOLECTURA_SEQ.NEXTVAL, :1, :2, :3, :4, :5)`,
+			id, codigo, localizacion, ahora, userID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "ESCANEAR", "Inventario",
+		"Inventario "+strconv.Itoa(id)+": "+strconv.Itoa(len(codigos))+" lecturas en "+localizacion)
+
+	return len(codigos), nil
+}
+
+// GetReporte obtiene el reporte de discrepancias de un inventario. Mientras
+// está abierto se calcula con el estado actual de los ejemplares; al cerrarlo
+// queda guardado tal como estaba en ese momento
+func (s *InventarioService) GetReporte(id, sucursalID int) (*models.ReporteInventario, error) {
+	inventario, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if sucursalID > 0 && inventario.SucursalID != sucursalID {
+		return nil, errors.New("el inventario pertenece a otra sucursal")
+	}
+
+	if inventario.Estado == InventarioCerrado {
+		return s.reporteGuardado(inventario)
+	}
+	return s.calcularReporte(inventario)
+}
+
+// Cerrar finaliza el inventario y guarda su reporte. Con marcarPerdidos, los
+// ejemplares faltantes pasan a estado PERDIDO, sus traslados no enviados se
+// cancelan y las reservas que los tenían apartados vuelven a quedar pendientes
+func (s *InventarioService) Cerrar(id int, marcarPerdidos bool, sucursalID, userID int) (*models.ReporteInventario, error) {
+	inventario, err := s.inventarioAbierto(id, sucursalID)
+	if err != nil {
+		return nil, err
+	}
+
+	reporte, err := s.calcularReporte(inventario)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Solo un cierre concurrente puede ganar; el otro no repite el reporte
+	result, err := tx.Exec(`UPDATE Inventario SET estado = :1, fechaCierre = :2, totalEsperados = :3, totalEncontrados = :4
+                            WHERE idInventario = :5 AND estado = :6`,
+		InventarioCerrado, time.Now(), reporte.Esperados, reporte.Encontrados, id, InventarioAbierto)
+	if err != nil {
+		return nil, err
+	}
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		return nil, errors.New("el inventario no está abierto")
+	}
+
+	for _, grupo := range [][]models.DiscrepanciaInventario{reporte.Faltantes, reporte.MalUbicados, reporte.Inesperados} {
+		for _, d := range grupo {
+			_, err := tx.Exec(`INSERT INTO InventarioDiscrepancia (idDiscrepancia, Inventario_idInventario, tipo,
+                               codigo, estadoEjemplar, localizacionRegistrada, localizacionLeida, motivo)
+                               VALUES (INVENTARIODISCREPANCIA_SEQ.NEXTVAL, :1, :2, :3, :4, :5, :6, :7)`,
+				id, d.Tipo, d.Codigo, nullString(d.EstadoEjemplar), nullString(d.LocalizacionRegistrada),
+				nullString(d.LocalizacionLeida), d.Motivo)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var perdidos []int
+	librosLiberados := make(map[string]bool)
+	if marcarPerdidos {
+		for _, d := range reporte.Faltantes {
+			// Solo si el ejemplar sigue figurando en la estantería de la sucursal
+			result, err := tx.Exec(`UPDATE Ejemplar SET estado = :1
+                                    WHERE codigo = :2 AND estado IN (:3, :4) AND Sucursal_idUbicacion = :5`,
+				EjemplarPerdido, d.Codigo, EjemplarDisponible, EjemplarReservado, inventario.SucursalID)
+			if err != nil {
+				return nil, err
+			}
+			if filas, _ := result.RowsAffected(); filas == 0 {
+				continue
+			}
+			perdidos = append(perdidos, d.Codigo)
+
+			// Un traslado todavía no enviado ya no se podrá despachar
+			_, err = tx.Exec(`UPDATE Traslado SET estado = :1 WHERE Ejemplar_codigo = :2 AND estado = :3`,
+				TrasladoCancelado, d.Codigo, TrasladoSolicitado)
+			if err != nil {
+				return nil, err
+			}
+
+			result, err = tx.Exec(`UPDATE Reserva SET estado = :1, Ejemplar_codigo = NULL
+                                   WHERE Ejemplar_codigo = :2 AND estado IN (:3, :4)`,
+				ReservaPendiente, d.Codigo, ReservaLista, ReservaEnTransito)
+			if err != nil {
+				return nil, err
+			}
+			if filas, _ := result.RowsAffected(); filas > 0 {
+				librosLiberados[d.LibroISBN] = true
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "CERRAR", "Inventario",
+		"Inventario "+strconv.Itoa(id)+" cerrado: "+strconv.Itoa(len(reporte.Faltantes))+" faltantes, "+
+			strconv.Itoa(len(reporte.MalUbicados))+" mal ubicados, "+strconv.Itoa(len(reporte.Inesperados))+" inesperados")
+	for _, codigo := range perdidos {
+		s.bitacoraService.RegistrarAccion(userID, "UPDATE", "Ejemplar",
+			"Ejemplar "+strconv.Itoa(codigo)+" marcado como perdido en inventario "+strconv.Itoa(id))
+	}
+
+	// Las reservas que perdieron su ejemplar buscan otro
+	for isbn := range librosLiberados {
+		s.reservaService.AtenderPendientes(isbn, userID)
+	}
+
+	return s.GetReporte(id, sucursalID)
+}
+
+// Cancelar descarta un inventario abierto sin generar reporte
+func (s *InventarioService) Cancelar(id, sucursalID, userID int) error {
+	if _, err := s.inventarioAbierto(id, sucursalID); err != nil {
+		return err
+	}
+
+	result, err := config.DB.Exec(`UPDATE Inventario SET estado = :1, fechaCierre = :2
+                                   WHERE idInventario = :3 AND estado = :4`,
+		InventarioCancelado, time.Now(), id, InventarioAbierto)
+	if err != nil {
+		return err
+	}
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		return errors.New("el inventario no está abierto")
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "CANCELAR", "Inventario", "Inventario "+strconv.Itoa(id)+" cancelado")
+
+	return nil
+}
+
+// inventarioAbierto obtiene el inventario y verifica que siga abierto y que
+// pertenezca a la sucursal de quien opera
+func (s *InventarioService) inventarioAbierto(id, sucursalID int) (*models.Inventario, error) {
+	inventario, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if sucursalID > 0 && inventario.SucursalID != sucursalID {
+		return nil, errors.New("el inventario pertenece a otra sucursal")
+	}
+	if inventario.Estado != InventarioAbierto {
+		return nil, errors.New("el inventario no está abierto")
+	}
+
+	return inventario, nil
+}
+
+// calcularReporte compara las lecturas con los ejemplares que deberían estar
+// en la estantería: los disponibles o reservados ubicados en la sucursal y
+// dentro del alcance del inventario
+func (s *InventarioService) calcularReporte(inventario *models.Inventario) (*models.ReporteInventario, error) {
+	reporte := &models.ReporteInventario{
+		Inventario:  inventario,
+		Leidos:      inventario.Lecturas,
+		Faltantes:   []models.DiscrepanciaInventario{},
+		MalUbicados: []models.DiscrepanciaInventario{},
+		Inesperados: []models.DiscrepanciaInventario{},
+	}
+
+	query := `SELECT IL.codigoLeido, IL.localizacion, EJ.localizacion, EJ.estado,
+              EJ.Sucursal_idUbicacion, L.ISBN, L.titulo
+              FROM InventarioLectura IL
+              LEFT JOIN Ejemplar EJ ON EJ.codigo = IL.codigoLeido
+              LEFT JOIN Libro L ON L.ISBN = EJ.Libro_ISBN
+              WHERE IL.Inventario_idInventario = :1
+              ORDER BY IL.localizacion, IL.codigoLeido`
+
+	rows, err := config.DB.Query(query, inventario.IDInventario)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	leidos := make(map[int]bool)
+	for rows.Next() {
+		var d models.DiscrepanciaInventario
+		var registrada, estado, isbn, titulo sql.NullString
+		var ubicacionID sql.NullInt64
+
+		if err := rows.Scan(&d.Codigo, &d.LocalizacionLeida, &registrada, &estado, &ubicacionID, &isbn, &titulo); err != nil {
+			return nil, err
+		}
+		leidos[d.Codigo] = true
+		d.LocalizacionRegistrada = registrada.String
+		d.EstadoEjemplar = estado.String
+		d.LibroISBN = isbn.String
+		d.LibroTitulo = titulo.String
+
+		switch {
+		case !ubicacionID.Valid:
+			d.Tipo, d.Motivo = DiscrepanciaInesperado, "el código no corresponde a ningún ejemplar"
+		case int(ubicacionID.Int64) != inventario.SucursalID:
+			d.Tipo, d.Motivo = DiscrepanciaInesperado, "el ejemplar figura en la sucursal "+strconv.FormatInt(ubicacionID.Int64, 10)
+		case d.EstadoEjemplar != EjemplarDisponible && d.EstadoEjemplar != EjemplarReservado:
+			d.Tipo, d.Motivo = DiscrepanciaInesperado, "el ejemplar figura como "+d.EstadoEjemplar
+		case !strings.EqualFold(d.LocalizacionRegistrada, d.LocalizacionLeida):
+			d.Tipo, d.Motivo = DiscrepanciaMalUbicado, "el ejemplar se encontró fuera de su ubicación registrada"
+		default:
+			reporte.Encontrados++
+			continue
+		}
+
+		if d.Tipo == DiscrepanciaInesperado {
+			reporte.Inesperados = append(reporte.Inesperados, d)
+		} else {
+			reporte.MalUbicados = append(reporte.MalUbicados, d)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT EJ.codigo, EJ.localizacion, EJ.estado, L.ISBN, L.titulo
+             FROM Ejemplar EJ
+             INNER JOIN Libro L ON L.ISBN = EJ.Libro_ISBN
+             WHERE EJ.Sucursal_idUbicacion = :1 AND EJ.estado IN (:2, :3)
+             AND (:4 IS NULL OR SUBSTR(UPPER(EJ.localizacion), 1, LENGTH(:5)) = :6)
+             ORDER BY EJ.localizacion, EJ.codigo`
+
+	alcance := nullString(inventario.Localizacion)
+	esperados, err := config.DB.Query(query, inventario.SucursalID, EjemplarDisponible, EjemplarReservado,
+		alcance, alcance, alcance)
+	if err != nil {
+		return nil, err
+	}
+	defer esperados.Close()
+
+	for esperados.Next() {
+		var d models.DiscrepanciaInventario
+		var registrada sql.NullString
+
+		if err := esperados.Scan(&d.Codigo, &registrada, &d.EstadoEjemplar, &d.LibroISBN, &d.LibroTitulo); err != nil {
+			return nil, err
+		}
+		reporte.Esperados++
+		if leidos[d.Codigo] {
+			continue
+		}
+
+		d.Tipo = DiscrepanciaFaltante
+		d.LocalizacionRegistrada = registrada.String
+		d.Motivo = "el ejemplar no se encontró en la estantería"
+		reporte.Faltantes = append(reporte.Faltantes, d)
+	}
+
+	return reporte, esperados.Err()
+}
+
+// reporteGuardado arma el reporte de un inventario cerrado a partir de las
+// discrepancias registradas al cerrarlo
+func (s *InventarioService) reporteGuardado(inventario *models.Inventario) (*models.ReporteInventario, error) {
+	reporte := &models.ReporteInventario{
+		Inventario:  inventario,
+		Leidos:      inventario.Lecturas,
+		Faltantes:   []models.DiscrepanciaInventario{},
+		MalUbicados: []models.DiscrepanciaInventario{},
+		Inesperados: []models.DiscrepanciaInventario{},
+	}
+	if inventario.TotalEsperados != nil {
+		reporte.Esperados = *inventario.TotalEsperados
+	}
+	if inventario.TotalEncontrados != nil {
+		reporte.Encontrados = *inventario.TotalEncontrados
+	}
+
+	query := `SELECT D.tipo, D.codigo, L.ISBN, L.titulo, D.estadoEjemplar,
+              D.localizacionRegistrada, D.localizacionLeida, D.motivo
+              FROM InventarioDiscrepancia D
+              LEFT JOIN Ejemplar EJ ON EJ.codigo = D.codigo
+              LEFT JOIN Libro L ON L.ISBN = EJ.Libro_ISBN
+              WHERE D.Inventario_idInventario = :1
+              ORDER BY D.idDiscrepancia`
+
+	rows, err := config.DB.Query(query, inventario.IDInventario)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.DiscrepanciaInventario
+		var isbn, titulo, estado, registrada, leida sql.NullString
+
+		if err := rows.Scan(&d.Tipo, &d.Codigo, &isbn, &titulo, &estado, &registrada, &leida, &d.Motivo); err != nil {
+			return nil, err
+		}
+		d.LibroISBN = isbn.String
+		d.LibroTitulo = titulo.String
+		d.EstadoEjemplar = estado.String
+		d.LocalizacionRegistrada = registrada.String
+		d.LocalizacionLeida = leida.String
+
+		switch d.Tipo {
+		case DiscrepanciaFaltante:
+			reporte.Faltantes = append(reporte.Faltantes, d)
+		case DiscrepanciaMalUbicado:
+			reporte.MalUbicados = append(reporte.MalUbicados, d)
+		default:
+			reporte.Inesperados = append(reporte.Inesperados, d)
+		}
+	}
+
+	return reporte, rows.Err()
+}
+
+func scanInventario(row scanner) (*models.Inventario, error) {
+	var inventario models.Inventario
+	var fechaCierre sql.NullTime
+	var localizacion sql.NullString
+	var esperados, encontrados sql.NullInt64
+
+	if err := row.Scan(
+		&inventario.IDInventario,
+		&inventario.Estado,
+		&inventario.FechaInicio,
+		&fechaCierre,
+		&localizacion,
+		&inventario.SucursalID,
+		&inventario.UsuarioID,
+		&esperados,
+		&encontrados,
+		&inventario.Lecturas,
+	); err != nil {
+		return nil, err
+	}
+
+	if fechaCierre.Valid {
+		inventario.FechaCierre = &fechaCierre.Time
+	}
+	inventario.Localizacion = localizacion.String
+	if esperados.Valid {
+		total := int(esperados.Int64)
+		inventario.TotalEsperados = &total
+	}
+	if encontrados.Valid {
+		total := int(encontrados.Int64)
+		inventario.TotalEncontrados = &total
+	}
+
+	return &inventario, nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// limitador cuenta eventos por clave en una ventana deslizante
+type limitador struct {
+	mu      sync.Mutex
+	maximo  int
+	ventana time.Duration
+	eventos map[string][]time.Time
+}
+
+func newLimitador(maximo int, ventana time.Duration) *limitador {
+	return &limitador{
+		maximo:  maximo,
+		ventana: ventana,
+		eventos: make(map[string][]time.Time),
+	}
+}
+
+// Permitir registra un evento para la clave si no superó el máximo de la ventana
+func (l *limitador) Permitir(clave string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ahora := time.Now()
+	vigentes := l.vigentes(clave, ahora)
+	if len(vigentes) >= l.maximo {
+		l.eventos[clave] = vigentes
+		return false
+	}
+
+	l.eventos[clave] = append(vigentes, ahora)
+	l.depurar(ahora)
+
+	return true
+}
+
+// depurar descarta las claves sin actividad reciente cuando hay demasiadas
+func (l *limitador) depurar(ahora time.Time) {
+	if len(l.eventos) > 10000 {
+		for k := range l.eventos {
+			if len(l.vigentes(k, ahora)) == 0 {
+				delete(l.eventos, k)
+			}
+		}
+	}
+}
+
+// vigentes devuelve los eventos de la clave dentro de la ventana
+func (l *limitador) vigentes(clave string, ahora time.Time) []time.Time {
+	eventos := l.eventos[clave]
+	i := 0
+	for i < len(eventos) && ahora.Sub(eventos[i]) >= l.ventana {
+		i++
+	}
+	return eventos[i:]
+}
+
+// Registrar agrega un evento para la clave sin aplicar el máximo y devuelve
+// cuántos hay en la ventana
+func (l *limitador) Registrar(clave string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ahora := time.Now()
+	vigentes := append(l.vigentes(clave, ahora), ahora)
+	l.eventos[clave] = vigentes
+	l.depurar(ahora)
+	return len(vigentes)
+}
+
+// Contar devuelve los eventos de la clave dentro de la ventana
+func (l *limitador) Contar(clave string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.vigentes(clave, time.Now()))
+}
+
+// Excedido indica si la clave alcanzó el máximo de la ventana
+func (l *limitador) Excedido(clave string) bool {
+	return l.Contar(clave) >= l.maximo
+}
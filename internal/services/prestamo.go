@@ -5,28 +5,36 @@ import (
 	"errors"
 	"proyecto-bd-final/internal/config"
 	"proyecto-bd-final/internal/models"
+	"strconv"
 	"time"
 )
 
 type PrestamoService struct {
 	bitacoraService *BitacoraService
+	reservaService  *ReservaService
 }
 
 func NewPrestamoService() *PrestamoService {
 	return &PrestamoService{
 		bitacoraService: NewBitacoraService(),
+		reservaService:  NewReservaService(),
 	}
 }
 
-// VerificarDisponibilidad verifica si hay ejemplares disponibles de un libro
-func (s *PrestamoService) VerificarDisponibilidad(isbn string) (bool, int, error) {
+// VerificarDisponibilidad verifica si hay ejemplares disponibles de un libro;
+// si se indica sucursal, solo considera los ejemplares ubicados en ella
+func (s *PrestamoService) VerificarDisponibilidad(isbn string, sucursalID int) (bool, int, error) {
 	query := `SELECT codigo 
 			  FROM Ejemplar 
 			  WHERE Libro_ISBN = :1 AND estado = 'DISPONIBLE'
+			  AND (:2 IS NULL OR Sucursal_idUbicacion = :3)
+			  ORDER BY codigo
 			  FETCH FIRST 1 ROW ONLY`
 
+	filtro := nullSucursal(sucursalID)
+
 	var codigoEjemplar int
-	err := config.DB.QueryRow(query, isbn).Scan(&codigoEjemplar)
+	err := config.DB.QueryRow(query, isbn, filtro, filtro).Scan(&codigoEjemplar)
 
 	if err == sql.ErrNoRows {
 		return false, 0, nil
@@ -39,24 +47,39 @@ func (s *PrestamoService) VerificarDisponibilidad(isbn string) (bool, int, error
 	return true, codigoEjemplar, nil
 }
 
-// CrearPrestamo crea un nuevo préstamo y actualiza el estado del ejemplar
-func (s *PrestamoService) CrearPrestamo(usuarioID int, libroISBN string) (*models.Prestamo, error) {
-	// Verificar disponibilidad
-	disponible, codigoEjemplar, err := s.VerificarDisponibilidad(libroISBN)
+// CrearPrestamo crea un nuevo préstamo y actualiza el estado del ejemplar. Si el
+// usuario tiene una reserva lista para el libro se le entrega el ejemplar
+// apartado. El préstamo queda registrado en la sucursal donde está el ejemplar
+func (s *PrestamoService) CrearPrestamo(usuarioID int, libroISBN string, sucursalID int) (*models.Prestamo, error) {
+	// Iniciar transacción
+	tx, err := config.DB.Begin()
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	if !disponible {
-		return nil, errors.New("no hay ejemplares disponibles para este libro")
+	codigoEjemplar, err := tomarReservaLista(tx, usuarioID, libroISBN, sucursalID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Iniciar transacción
-	tx, err := config.DB.Begin()
-	if err != nil {
+	// El ejemplar se toma con un UPDATE condicionado a su estado: si otro
+	// préstamo o una reserva lo tomó antes, no se pisa
+	if codigoEjemplar == 0 {
+		codigoEjemplar, err = tomarEjemplarDisponible(tx, libroISBN, sucursalID)
+		if err != nil {
+			return nil, err
+		}
+
+		if codigoEjemplar == 0 {
+			if sucursalID > 0 {
+				return nil, errors.New("no hay ejemplares disponibles para este libro en la sucursal")
+			}
+			return nil, errors.New("no hay ejemplares disponibles para este libro")
+		}
+	} else if err := tomarEjemplar(tx, codigoEjemplar, EjemplarReservado); err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
 
 	// Crear préstamo
 	fechaPrestamo := time.Now()
@@ -69,25 +92,37 @@ func (s *PrestamoService) CrearPrestamo(usuarioID int, libroISBN string) (*model
 		return nil, err
 	}
 
+	// Sucursal donde se entrega el ejemplar
+	var sucursalPrestamo int
+	err = tx.QueryRow(`SELECT Sucursal_idUbicacion FROM Ejemplar WHERE codigo = :1`, codigoEjemplar).Scan(&sucursalPrestamo)
+	if err != nil {
+		return nil, err
+	}
+
 	// Insertar el préstamo
 	queryPrestamo := `INSERT INTO Prestamo 
-					  (IDPRESTAMO, FECHAPRESTAMO, FECHADEVOLUCIONPREVISTA, ESTADO, USUARIO_IDUSUARIO, DEVOLUCION_IDDEVOLUCION) 
-					  VALUES (:1, :2, :3, :4, :5, NULL)`
+					  (IDPRESTAMO, FECHAPRESTAMO, FECHADEVOLUCIONPREVISTA, ESTADO, USUARIO_IDUSUARIO, DEVOLUCION_IDDEVOLUCION,
+					   SUCURSAL_IDPRESTAMO, EJEMPLAR_CODIGO) 
+					  VALUES (:1, :2, :3, :4, :5, NULL, :6, :7)`
 
-	_, err = tx.Exec(queryPrestamo, idPrestamo, fechaPrestamo, fechaDevolucion, "ACTIVO", usuarioID)
+	_, err = tx.Exec(queryPrestamo, idPrestamo, fechaPrestamo, fechaDevolucion, "ACTIVO", usuarioID, sucursalPrestamo,
+		codigoEjemplar)
 	if err != nil {
 		return nil, err
 	}
 
-	// Actualizar estado del ejemplar
+	// Vincular el ejemplar, ya marcado como prestado, al préstamo
 	queryEjemplar := `UPDATE Ejemplar 
-					  SET estado = 'PRESTADO', Prestamo_idPrestamo = :1 
-					  WHERE codigo = :2`
+					  SET Prestamo_idPrestamo = :1 
+					  WHERE codigo = :2 AND estado = :3`
 
-	_, err = tx.Exec(queryEjemplar, idPrestamo, codigoEjemplar)
+	result, err := tx.Exec(queryEjemplar, idPrestamo, codigoEjemplar, EjemplarPrestado)
 	if err != nil {
 		return nil, err
 	}
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		return nil, errEjemplarTomado
+	}
 
 	// Commit transacción
 	if err = tx.Commit(); err != nil {
@@ -100,12 +135,68 @@ func (s *PrestamoService) CrearPrestamo(usuarioID int, libroISBN string) (*model
 		FechaDevolucionPrevista: fechaDevolucion,
 		Estado:                  "ACTIVO",
 		UsuarioID:               usuarioID,
+		SucursalPrestamoID:      &sucursalPrestamo,
 	}
 
 	return prestamo, nil
 }
 
-// DevolverPrestamo registra la devolución de un libro
+// intentosTomarEjemplar es cuántas veces se busca otro ejemplar disponible si
+// uno concurrente se lleva el elegido
+const intentosTomarEjemplar = 5
+
+// tomarEjemplarDisponible marca como prestado un ejemplar disponible del libro
+// (en la sucursal, si se indica) dentro de la transacción. Devuelve 0 si no hay
+func tomarEjemplarDisponible(tx *sql.Tx, isbn string, sucursalID int) (int, error) {
+	query := `SELECT codigo 
+			  FROM Ejemplar 
+			  WHERE Libro_ISBN = :1 AND estado = 'DISPONIBLE'
+			  AND (:2 IS NULL OR Sucursal_idUbicacion = :3)
+			  ORDER BY codigo
+			  FETCH FIRST 1 ROW ONLY`
+
+	filtro := nullSucursal(sucursalID)
+	for i := 0; i < intentosTomarEjemplar; i++ {
+		var codigo int
+		err := tx.QueryRow(query, isbn, filtro, filtro).Scan(&codigo)
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		err = tomarEjemplar(tx, codigo, EjemplarDisponible)
+		if err == nil {
+			return codigo, nil
+		}
+		if err != errEjemplarTomado {
+			return 0, err
+		}
+	}
+
+	return 0, errors.New("no se pudo tomar un ejemplar, intente nuevamente")
+}
+
+var errEjemplarTomado = errors.New("el ejemplar ya no está disponible")
+
+// tomarEjemplar pasa el ejemplar a PRESTADO solo si sigue en el estado
+// esperado; la fila queda bloqueada hasta el fin de la transacción
+func tomarEjemplar(tx *sql.Tx, codigo int, estado string) error {
+	result, err := tx.Exec(`UPDATE Ejemplar SET estado = :1 WHERE codigo = :2 AND estado = :3`,
+		EjemplarPrestado, codigo, estado)
+	if err != nil {
+		return err
+	}
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		return errEjemplarTomado
+	}
+	return nil
+}
+
+// DevolverPrestamo registra la devolución de un libro por parte del lector. Se
+// asume la sucursal del préstamo y el ejemplar no cambia de ubicación: solo el
+// personal puede recibirlo en otra sucursal con RecibirDevolucion
 func (s *PrestamoService) DevolverPrestamo(prestamoID, usuarioID int) error {
 	// Verificar que el préstamo pertenece al usuario
 	var usuarioIDPrestamo int
@@ -119,6 +210,45 @@ func (s *PrestamoService) DevolverPrestamo(prestamoID, usuarioID int) error {
 		return errors.New("no tienes permiso para devolver este préstamo")
 	}
 
+	return s.registrarDevolucion(prestamoID, 0, usuarioID)
+}
+
+// RecibirDevolucion registra en el mostrador de una sucursal la devolución de
+// cualquier préstamo activo (personal)
+func (s *PrestamoService) RecibirDevolucion(prestamoID, sucursalID, personalID int) error {
+	var estado string
+	err := config.DB.QueryRow(`SELECT ESTADO FROM Prestamo WHERE IDPRESTAMO = :1`, prestamoID).Scan(&estado)
+	if err != nil {
+		return errors.New("préstamo no encontrado")
+	}
+
+	if estado != "ACTIVO" {
+		return errors.New("el préstamo no está activo")
+	}
+
+	if err := s.registrarDevolucion(prestamoID, sucursalID, personalID); err != nil {
+		return err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(personalID, "UPDATE", "Prestamo",
+		"Devolución recibida en sucursal ID "+strconv.Itoa(sucursalID)+" - Préstamo ID: "+strconv.Itoa(prestamoID))
+
+	return nil
+}
+
+// registrarDevolucion cierra el préstamo activo, deja el ejemplar disponible en
+// la sucursal donde se devolvió (0 = donde estaba) y atiende las reservas
+// pendientes del libro
+func (s *PrestamoService) registrarDevolucion(prestamoID, sucursalID, userID int) error {
+	filtro := nullSucursal(sucursalID)
+
+	var isbn string
+	err := config.DB.QueryRow(`SELECT Libro_ISBN FROM Ejemplar WHERE Prestamo_idPrestamo = :1`, prestamoID).Scan(&isbn)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
 	// Iniciar transacción
 	tx, err := config.DB.Begin()
 	if err != nil {
@@ -128,32 +258,48 @@ func (s *PrestamoService) DevolverPrestamo(prestamoID, usuarioID int) error {
 
 	// Actualizar préstamo
 	queryPrestamo := `UPDATE Prestamo 
-					  SET FECHADEVOLUCIONREAL = :1, ESTADO = :2 
-					  WHERE IDPRESTAMO = :3`
+					  SET FECHADEVOLUCIONREAL = :1, ESTADO = :2,
+					      SUCURSAL_IDDEVOLUCION = NVL(:3, SUCURSAL_IDPRESTAMO)
+					  WHERE IDPRESTAMO = :4 AND ESTADO = 'ACTIVO'`
 
-	_, err = tx.Exec(queryPrestamo, time.Now(), "DEVUELTO", prestamoID)
+	result, err := tx.Exec(queryPrestamo, time.Now(), "DEVUELTO", filtro, prestamoID)
 	if err != nil {
 		return err
 	}
 
-	// Actualizar estado del ejemplar
+	// Una devolución repetida no debe pisar la fecha ni la sucursal registradas
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		return errors.New("el préstamo no está activo")
+	}
+
+	// Actualizar estado y ubicación del ejemplar
 	queryEjemplar := `UPDATE Ejemplar 
-					  SET estado = 'DISPONIBLE', Prestamo_idPrestamo = NULL
-					  WHERE Prestamo_idPrestamo = :1`
+					  SET estado = 'DISPONIBLE', Prestamo_idPrestamo = NULL,
+					      Sucursal_idUbicacion = NVL(:1, Sucursal_idUbicacion)
+					  WHERE Prestamo_idPrestamo = :2`
 
-	_, err = tx.Exec(queryEjemplar, prestamoID)
+	_, err = tx.Exec(queryEjemplar, filtro, prestamoID)
 	if err != nil {
 		return err
 	}
 
 	// Commit transacción
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if isbn != "" {
+		s.reservaService.AtenderPendientes(isbn, userID)
+	}
+
+	return nil
 }
 
 // GetPrestamosByUsuario obtiene todos los préstamos de un usuario
 func (s *PrestamoService) GetPrestamosByUsuario(usuarioID int) ([]*models.Prestamo, error) {
 	query := `SELECT P.IDPRESTAMO, P.FECHAPRESTAMO, P.FECHADEVOLUCIONPREVISTA, 
-			  P.FECHADEVOLUCIONREAL, P.ESTADO, P.USUARIO_IDUSUARIO
+			  P.FECHADEVOLUCIONREAL, P.ESTADO, P.USUARIO_IDUSUARIO,
+			  P.SUCURSAL_IDPRESTAMO, P.SUCURSAL_IDDEVOLUCION
 			  FROM Prestamo P
 			  WHERE P.USUARIO_IDUSUARIO = :1
 			  ORDER BY P.FECHAPRESTAMO DESC`
@@ -166,26 +312,11 @@ func (s *PrestamoService) GetPrestamosByUsuario(usuarioID int) ([]*models.Presta
 
 	var prestamos []*models.Prestamo
 	for rows.Next() {
-		var prestamo models.Prestamo
-		var fechaDevolucionReal sql.NullTime
-
-		if err := rows.Scan(
-			&prestamo.IDPrestamo,
-			&prestamo.FechaPrestamo,
-			&prestamo.FechaDevolucionPrevista,
-			&fechaDevolucionReal,
-			&prestamo.Estado,
-			&prestamo.UsuarioID,
-		); err != nil {
+		prestamo, err := scanPrestamo(rows)
+		if err != nil {
 			return nil, err
 		}
-
-		if fechaDevolucionReal.Valid {
-			t := fechaDevolucionReal.Time
-			prestamo.FechaDevolucionReal = &t
-		}
-
-		prestamos = append(prestamos, &prestamo)
+		prestamos = append(prestamos, prestamo)
 	}
 
 	return prestamos, nil
@@ -194,7 +325,8 @@ func (s *PrestamoService) GetPrestamosByUsuario(usuarioID int) ([]*models.Presta
 // GetTodosPrestamos obtiene todos los préstamos (admin)
 func (s *PrestamoService) GetTodosPrestamos() ([]*models.Prestamo, error) {
 	query := `SELECT P.IDPRESTAMO, P.FECHAPRESTAMO, P.FECHADEVOLUCIONPREVISTA, 
-			  P.FECHADEVOLUCIONREAL, P.ESTADO, P.USUARIO_IDUSUARIO
+			  P.FECHADEVOLUCIONREAL, P.ESTADO, P.USUARIO_IDUSUARIO,
+			  P.SUCURSAL_IDPRESTAMO, P.SUCURSAL_IDDEVOLUCION
 			  FROM Prestamo P
 			  ORDER BY P.FECHAPRESTAMO DESC`
 
@@ -206,27 +338,79 @@ func (s *PrestamoService) GetTodosPrestamos() ([]*models.Prestamo, error) {
 
 	var prestamos []*models.Prestamo
 	for rows.Next() {
-		var prestamo models.Prestamo
-		var fechaDevolucionReal sql.NullTime
-
-		if err := rows.Scan(
-			&prestamo.IDPrestamo,
-			&prestamo.FechaPrestamo,
-			&prestamo.FechaDevolucionPrevista,
-			&fechaDevolucionReal,
-			&prestamo.Estado,
-			&prestamo.UsuarioID,
-		); err != nil {
+		prestamo, err := scanPrestamo(rows)
+		if err != nil {
 			return nil, err
 		}
+		prestamos = append(prestamos, prestamo)
+	}
 
-		if fechaDevolucionReal.Valid {
-			t := fechaDevolucionReal.Time
-			prestamo.FechaDevolucionReal = &t
-		}
+	return prestamos, nil
+}
 
-		prestamos = append(prestamos, &prestamo)
+// GetPrestamosSucursal obtiene los préstamos entregados o devueltos en una
+// sucursal (personal)
+func (s *PrestamoService) GetPrestamosSucursal(sucursalID int) ([]*models.Prestamo, error) {
+	query := `SELECT P.IDPRESTAMO, P.FECHAPRESTAMO, P.FECHADEVOLUCIONPREVISTA, 
+			  P.FECHADEVOLUCIONREAL, P.ESTADO, P.USUARIO_IDUSUARIO,
+			  P.SUCURSAL_IDPRESTAMO, P.SUCURSAL_IDDEVOLUCION
+			  FROM Prestamo P
+			  WHERE P.SUCURSAL_IDPRESTAMO = :1 OR P.SUCURSAL_IDDEVOLUCION = :2
+			  ORDER BY P.FECHAPRESTAMO DESC`
+
+	rows, err := config.DB.Query(query, sucursalID, sucursalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prestamos []*models.Prestamo
+	for rows.Next() {
+		prestamo, err := scanPrestamo(rows)
+		if err != nil {
+			return nil, err
+		}
+		prestamos = append(prestamos, prestamo)
 	}
 
 	return prestamos, nil
 }
+
+func scanPrestamo(row scanner) (*models.Prestamo, error) {
+	var prestamo models.Prestamo
+	var fechaDevolucionReal sql.NullTime
+	var sucursalPrestamo, sucursalDevolucion sql.NullInt64
+
+	if err := row.Scan(
+		&prestamo.IDPrestamo,
+		&prestamo.FechaPrestamo,
+		&prestamo.FechaDevolucionPrevista,
+		&fechaDevolucionReal,
+		&prestamo.Estado,
+		&prestamo.UsuarioID,
+		&sucursalPrestamo,
+		&sucursalDevolucion,
+	); err != nil {
+		return nil, err
+	}
+
+	if fechaDevolucionReal.Valid {
+		t := fechaDevolucionReal.Time
+		prestamo.FechaDevolucionReal = &t
+	}
+	if sucursalPrestamo.Valid {
+		id := int(sucursalPrestamo.Int64)
+		prestamo.SucursalPrestamoID = &id
+	}
+	if sucursalDevolucion.Valid {
+		id := int(sucursalDevolucion.Int64)
+		prestamo.SucursalDevolucionID = &id
+	}
+
+	return &prestamo, nil
+}
+
+// nullSucursal convierte la sucursal 0 (sin filtro) en NULL
+func nullSucursal(sucursalID int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(sucursalID), Valid: sucursalID > 0}
+}
@@ -1,7 +1,9 @@
 package services
 
 import (
+	"database/sql"
 	"proyecto-bd-final/internal/config"
+	"sort"
 )
 
 type ReportsService struct {
@@ -77,8 +79,9 @@ type EstadisticasGeneralesResponse struct {
 	FechaReporte       string `json:"fecha_reporte"`
 }
 
-// GetReportePrestamosActivos genera un reporte de todos los préstamos activos
-func (s *ReportsService) GetReportePrestamosActivos(userID int) (*ReportePrestamosActivosResponse, error) {
+// GetReportePrestamosActivos genera un reporte de todos los préstamos activos;
+// si se indica sucursal, solo los entregados en ella
+func (s *ReportsService) GetReportePrestamosActivos(userID int, sucursalID int) (*ReportePrestamosActivosResponse, error) {
 	query := `SELECT 
 				P.IDPRESTAMO, 
 				TO_CHAR(P.FECHAPRESTAMO, 'YYYY-MM-DD') as FECHA_PRESTAMO,
@@ -94,9 +97,11 @@ func (s *ReportsService) GetReportePrestamosActivos(userID int) (*ReportePrestam
 			  INNER JOIN Ejemplar E ON P.IDPRESTAMO = E.Prestamo_idPrestamo
 			  INNER JOIN Libro L ON E.Libro_ISBN = L.ISBN
 			  WHERE P.ESTADO = 'ACTIVO'
+			  AND (:1 IS NULL OR P.SUCURSAL_IDPRESTAMO = :2)
 			  ORDER BY P.FECHADEVOLUCIONPREVISTA ASC`
 
-	rows, err := config.DB.Query(query)
+	filtro := nullSucursal(sucursalID)
+	rows, err := config.DB.Query(query, filtro, filtro)
 	if err != nil {
 		return nil, err
 	}
@@ -190,8 +195,9 @@ func (s *ReportsService) GetReporteUsuariosActivos(userID int, limite int) (*Rep
 	}, nil
 }
 
-// GetReporteLibrosPopulares genera un reporte de los libros más solicitados
-func (s *ReportsService) GetReporteLibrosPopulares(userID int, limite int) (*ReporteLibrosPopularesResponse, error) {
+// GetReporteLibrosPopulares genera un reporte de los libros más solicitados;
+// si se indica sucursal, solo cuenta los préstamos entregados en ella
+func (s *ReportsService) GetReporteLibrosPopulares(userID int, limite int, sucursalID int) (*ReporteLibrosPopularesResponse, error) {
 	query := `SELECT 
 				L.ISBN,
 				L.TITULO,
@@ -202,11 +208,13 @@ func (s *ReportsService) GetReporteLibrosPopulares(userID int, limite int) (*Rep
 			  INNER JOIN Ejemplar EJ ON L.ISBN = EJ.Libro_ISBN
 			  INNER JOIN Prestamo P ON EJ.Prestamo_idPrestamo = P.IDPRESTAMO
 			  INNER JOIN Editorial E ON L.Editorial_idEditorial = E.IDEDITORIAL
+			  WHERE (:1 IS NULL OR P.SUCURSAL_IDPRESTAMO = :2)
 			  GROUP BY L.ISBN, L.TITULO, E.NOMBRE
 			  ORDER BY TOTAL_PRESTAMOS DESC
-			  FETCH FIRST :1 ROWS ONLY`
+			  FETCH FIRST :3 ROWS ONLY`
 
-	rows, err := config.DB.Query(query, limite)
+	filtro := nullSucursal(sucursalID)
+	rows, err := config.DB.Query(query, filtro, filtro, limite)
 	if err != nil {
 		return nil, err
 	}
@@ -252,8 +260,8 @@ func (s *ReportsService) GetEstadisticasGenerales(userID int) (*EstadisticasGene
 		return nil, err
 	}
 
-	// Total de ejemplares
-	err = config.DB.QueryRow("SELECT COUNT(*) FROM Ejemplar").Scan(&stats.TotalEjemplares)
+	// Total de ejemplares (sin los dados de baja)
+	err = config.DB.QueryRow("SELECT COUNT(*) FROM Ejemplar WHERE estado <> 'BAJA'").Scan(&stats.TotalEjemplares)
 	if err != nil {
 		return nil, err
 	}
@@ -285,3 +293,105 @@ func (s *ReportsService) GetEstadisticasGenerales(userID int) (*EstadisticasGene
 
 	return &stats, nil
 }
+
+// ReporteEstanteriaResponse estructura para el listado topográfico (shelf list)
+type ReporteEstanteriaResponse struct {
+	Localizacion string                `json:"localizacion,omitempty"`
+	SucursalID   int                   `json:"sucursal_id,omitempty"`
+	Total        int                   `json:"total"`
+	Ejemplares   []EjemplarEstanteInfo `json:"ejemplares"`
+	FechaReporte string                `json:"fecha_reporte"`
+}
+
+// EjemplarEstanteInfo información de un ejemplar en el orden de estantería
+type EjemplarEstanteInfo struct {
+	Codigo               int    `json:"codigo"`
+	Localizacion         string `json:"localizacion"`
+	Signatura            string `json:"signatura"`
+	SistemaClasificacion string `json:"sistema_clasificacion"`
+	Titulo               string `json:"titulo"`
+	ISBN                 string `json:"isbn"`
+	Estado               string `json:"estado"`
+
+	clave string
+}
+
+// GetReporteEstanteria genera el listado topográfico de los ejemplares,
+// ordenados por ubicación y signatura como están en los estantes. Si se indica
+// localizacion, solo incluye las ubicaciones que empiezan con ese prefijo, y si
+// se indica sucursal, solo los ejemplares ubicados en ella
+func (s *ReportsService) GetReporteEstanteria(userID int, localizacion string, sucursalID int) (*ReporteEstanteriaResponse, error) {
+	query := `SELECT EJ.codigo, EJ.localizacion, L.signatura, L.sistemaClasificacion,
+				L.titulo, L.ISBN, EJ.estado
+			  FROM Ejemplar EJ
+			  INNER JOIN Libro L ON EJ.Libro_ISBN = L.ISBN
+			  WHERE EJ.estado <> 'BAJA'
+			  AND (:1 IS NULL OR EJ.localizacion LIKE :2 || '%')
+			  AND (:3 IS NULL OR EJ.Sucursal_idUbicacion = :4)`
+
+	var filtro sql.NullString
+	if localizacion != "" {
+		filtro = sql.NullString{String: localizacion, Valid: true}
+	}
+
+	filtroSucursal := nullSucursal(sucursalID)
+	rows, err := config.DB.Query(query, filtro, filtro, filtroSucursal, filtroSucursal)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ejemplares := []EjemplarEstanteInfo{}
+	for rows.Next() {
+		var ejemplar EjemplarEstanteInfo
+		var ubicacion, signatura, sistema sql.NullString
+		if err := rows.Scan(
+			&ejemplar.Codigo,
+			&ubicacion,
+			&signatura,
+			&sistema,
+			&ejemplar.Titulo,
+			&ejemplar.ISBN,
+			&ejemplar.Estado,
+		); err != nil {
+			return nil, err
+		}
+
+		ejemplar.Localizacion = ubicacion.String
+		ejemplar.Signatura = signatura.String
+		ejemplar.SistemaClasificacion = sistema.String
+		ejemplar.clave = ClaveOrdenSignatura(ejemplar.Signatura, ejemplar.SistemaClasificacion)
+		ejemplares = append(ejemplares, ejemplar)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// El orden de signaturas no es alfabético, por eso se ordena en Go
+	sort.Slice(ejemplares, func(i, j int) bool {
+		a, b := ejemplares[i], ejemplares[j]
+		if a.Localizacion != b.Localizacion {
+			// Los ejemplares sin ubicación van al final
+			if a.Localizacion == "" || b.Localizacion == "" {
+				return b.Localizacion == ""
+			}
+			return a.Localizacion < b.Localizacion
+		}
+		if a.clave != b.clave {
+			return a.clave < b.clave
+		}
+		return a.Codigo < b.Codigo
+	})
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "READ", "Reporte", "Generación de listado topográfico")
+
+	return &ReporteEstanteriaResponse{
+		Localizacion: localizacion,
+		SucursalID:   sucursalID,
+		Total:        len(ejemplares),
+		Ejemplares:   ejemplares,
+		FechaReporte: "SYSDATE",
+	}, nil
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"proyecto-bd-final/internal/config"
+	"proyecto-bd-final/internal/models"
+	"strconv"
+	"time"
+)
+
+// Estados de una reserva
+const (
+	ReservaPendiente  = "PENDIENTE"
+	ReservaEnTransito = "EN_TRANSITO"
+	ReservaLista      = "LISTA"
+	ReservaCumplida   = "CUMPLIDA"
+	ReservaCancelada  = "CANCELADA"
+)
+
+type ReservaService struct {
+	bitacoraService *BitacoraService
+}
+
+func NewReservaService() *ReservaService {
+	return &ReservaService{
+		bitacoraService: NewBitacoraService(),
+	}
+}
+
+const selectReserva = `SELECT idReserva, fechaReserva, estado, Usuario_idUsuario, Libro_ISBN,
+              Sucursal_idRetiro, Ejemplar_codigo
+              FROM Reserva`
+
+// GetByID obtiene una reserva por su ID
+func (s *ReservaService) GetByID(id int) (*models.Reserva, error) {
+	reserva, err := scanReserva(config.DB.QueryRow(selectReserva+` WHERE idReserva = :1`, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("reserva no encontrada")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return reserva, nil
+}
+
+// GetByUsuario obtiene las reservas de un usuario
+func (s *ReservaService) GetByUsuario(usuarioID int) ([]*models.Reserva, error) {
+	return s.listar(selectReserva+` WHERE Usuario_idUsuario = :1 ORDER BY fechaReserva DESC`, usuarioID)
+}
+
+// GetBySucursal obtiene las reservas a retirar en una sucursal (0 = todas),
+// opcionalmente filtradas por estado
+func (s *ReservaService) GetBySucursal(sucursalID int, estado string) ([]*models.Reserva, error) {
+	filtroSucursal := nullSucursal(sucursalID)
+	filtroEstado := nullString(estado)
+	return s.listar(selectReserva+`
+              WHERE (:1 IS NULL OR Sucursal_idRetiro = :2)
+              AND (:3 IS NULL OR estado = :4)
+              ORDER BY fechaReserva, idReserva`,
+		filtroSucursal, filtroSucursal, filtroEstado, filtroEstado)
+}
+
+// Crear registra una reserva para retirar un libro en una sucursal y trata de
+// atenderla de inmediato: si hay un ejemplar en la sucursal se aparta, y si
+// solo lo hay en otra se solicita un traslado automático
+func (s *ReservaService) Crear(usuarioID int, isbn string, sucursalID int) (*models.Reserva, error) {
+	var existe int
+	if err := config.DB.QueryRow(`SELECT COUNT(*) FROM Libro WHERE ISBN = :1`, isbn).Scan(&existe); err != nil {
+		return nil, err
+	}
+	if existe == 0 {
+		return nil, errors.New("libro no encontrado")
+	}
+
+	if err := config.DB.QueryRow(`SELECT COUNT(*) FROM Sucursal WHERE idSucursal = :1`, sucursalID).Scan(&existe); err != nil {
+		return nil, err
+	}
+	if existe == 0 {
+		return nil, errors.New("sucursal no encontrada")
+	}
+
+	var activas int
+	err := config.DB.QueryRow(`SELECT COUNT(*) FROM Reserva
+                               WHERE Usuario_idUsuario = :1 AND Libro_ISBN = :2
+                               AND estado IN (:3, :4, :5)`,
+		usuarioID, isbn, ReservaPendiente, ReservaEnTransito, ReservaLista).Scan(&activas)
+	if err != nil {
+		return nil, err
+	}
+	if activas > 0 {
+		return nil, errors.New("ya tienes una reserva activa para este libro")
+	}
+
+	var id int
+	if err := config.DB.QueryRow("SELECT RESERVA_SEQ.NEXTVAL FROM DUAL").Scan(&id); err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO Reserva (idReserva, fechaReserva, estado, Usuario_idUsuario, Libro_ISBN, Sucursal_idRetiro)
+              VALUES (:1, :2, :3, :4, :5, :6)`
+	if _, err := config.DB.Exec(query, id, time.Now(), ReservaPendiente, usuarioID, isbn, sucursalID); err != nil {
+		return nil, err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(usuarioID, "CREATE", "Reserva",
+		"Reserva "+strconv.Itoa(id)+" del libro ISBN: "+isbn+" en sucursal "+strconv.Itoa(sucursalID))
+
+	reserva, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.atender(reserva, usuarioID); err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(id)
+}
+
+// Cancelar anula una reserva activa del usuario y libera el ejemplar apartado
+func (s *ReservaService) Cancelar(id, usuarioID int) error {
+	reserva, err := s.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if reserva.UsuarioID != usuarioID {
+		return errors.New("no tienes permiso para cancelar esta reserva")
+	}
+	if reserva.Estado != ReservaPendiente && reserva.Estado != ReservaEnTransito && reserva.Estado != ReservaLista {
+		return errors.New("la reserva no está activa")
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// El préstamo pudo cumplir la reserva al mismo tiempo
+	result, err := tx.Exec(`UPDATE Reserva SET estado = :1
+                            WHERE idReserva = :2 AND estado IN (:3, :4, :5)`,
+		ReservaCancelada, id, ReservaPendiente, ReservaEnTransito, ReservaLista)
+	if err != nil {
+		return err
+	}
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		return errors.New("la reserva no está activa")
+	}
+
+	liberado := false
+	if reserva.EjemplarCodigo != nil {
+		// Un traslado aún no enviado se anula; si ya viaja, al recibirlo el
+		// ejemplar queda disponible en el destino
+		_, err = tx.Exec(`UPDATE Traslado SET estado = :1
+                          WHERE Reserva_idReserva = :2 AND estado = :3`,
+			TrasladoCancelado, id, TrasladoSolicitado)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(`UPDATE Ejemplar SET estado = :1 WHERE codigo = :2 AND estado = :3`,
+			EjemplarDisponible, *reserva.EjemplarCodigo, EjemplarReservado)
+		if err != nil {
+			return err
+		}
+		filas, _ := result.RowsAffected()
+		liberado = filas > 0
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(usuarioID, "UPDATE", "Reserva", "Reserva "+strconv.Itoa(id)+" cancelada")
+
+	if liberado {
+		s.AtenderPendientes(reserva.LibroISBN, usuarioID)
+	}
+
+	return nil
+}
+
+// AtenderPendientes asigna los ejemplares disponibles de un libro a sus
+// reservas pendientes, en orden de llegada
+func (s *ReservaService) AtenderPendientes(isbn string, userID int) {
+	pendientes, err := s.listar(selectReserva+`
+              WHERE Libro_ISBN = :1 AND estado = :2
+              ORDER BY fechaReserva, idReserva`, isbn, ReservaPendiente)
+	if err != nil {
+		return
+	}
+
+	for _, reserva := range pendientes {
+		atendida, err := s.atender(reserva, userID)
+		if err != nil || !atendida {
+			return
+		}
+	}
+}
+
+// atender aparta para la reserva un ejemplar disponible, prefiriendo los de la
+// sucursal de retiro. Devuelve false si no hay ejemplares disponibles
+func (s *ReservaService) atender(reserva *models.Reserva, userID int) (bool, error) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Se excluyen los ejemplares con un traslado solicitado
+	query := `SELECT codigo, Sucursal_idUbicacion FROM Ejemplar EJ
+              WHERE Libro_ISBN = :1 AND estado = :2
+              AND NOT EXISTS (SELECT 1 FROM Traslado T
+                              WHERE T.Ejemplar_codigo = EJ.codigo AND T.estado = 'SOLICITADO')
+              ORDER BY CASE WHEN Sucursal_idUbicacion = :3 THEN 0 ELSE 1 END, codigo
+              FETCH FIRST 1 ROW ONLY`
+
+	var codigo, ubicacionID int
+	err = tx.QueryRow(query, reserva.LibroISBN, EjemplarDisponible, reserva.SucursalRetiroID).Scan(&codigo, &ubicacionID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	result, err := tx.Exec(`UPDATE Ejemplar SET estado = :1 WHERE codigo = :2 AND estado = :3`,
+		EjemplarReservado, codigo, EjemplarDisponible)
+	if err != nil {
+		return false, err
+	}
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		// Otro proceso tomó el ejemplar
+		return false, nil
+	}
+
+	estado := ReservaLista
+	trasladoID := 0
+	if ubicacionID != reserva.SucursalRetiroID {
+		estado = ReservaEnTransito
+		trasladoID, err = insertarTraslado(tx, codigo, ubicacionID, reserva.SucursalRetiroID, userID, &reserva.IDReserva)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE Reserva SET estado = :1, Ejemplar_codigo = :2 WHERE idReserva = :3`,
+		estado, codigo, reserva.IDReserva)
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	// Registrar en bitácora
+	if trasladoID > 0 {
+		s.bitacoraService.RegistrarAccion(userID, "SOLICITAR", "Traslado",
+			"Traslado "+strconv.Itoa(trasladoID)+" automático para reserva "+strconv.Itoa(reserva.IDReserva)+
+				": ejemplar "+strconv.Itoa(codigo)+" de sucursal "+strconv.Itoa(ubicacionID)+
+				" a "+strconv.Itoa(reserva.SucursalRetiroID))
+	}
+
+	return true, nil
+}
+
+// tomarReservaLista busca una reserva lista del usuario para el libro y la
+// marca como cumplida dentro de la transacción del préstamo. Devuelve el
+// ejemplar apartado, o 0 si no hay reserva lista
+func tomarReservaLista(tx *sql.Tx, usuarioID int, isbn string, sucursalID int) (int, error) {
+	query := `SELECT idReserva, Ejemplar_codigo FROM Reserva
+              WHERE Usuario_idUsuario = :1 AND Libro_ISBN = :2 AND estado = :3
+              AND (:4 IS NULL OR Sucursal_idRetiro = :5)
+              ORDER BY fechaReserva
+              FETCH FIRST 1 ROW ONLY`
+
+	filtro := nullSucursal(sucursalID)
+	var reservaID, codigo int
+	err := tx.QueryRow(query, usuarioID, isbn, ReservaLista, filtro, filtro).Scan(&reservaID, &codigo)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`UPDATE Reserva SET estado = :1 WHERE idReserva = :2 AND estado = :3`,
+		ReservaCumplida, reservaID, ReservaLista)
+	if err != nil {
+		return 0, err
+	}
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		return 0, errors.New("la reserva ya fue retirada")
+	}
+
+	return codigo, nil
+}
+
+func (s *ReservaService) listar(query string, args ...interface{}) ([]*models.Reserva, error) {
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reservas := []*models.Reserva{}
+	for rows.Next() {
+		reserva, err := scanReserva(rows)
+		if err != nil {
+			return nil, err
+		}
+		reservas = append(reservas, reserva)
+	}
+
+	return reservas, rows.Err()
+}
+
+func scanReserva(row scanner) (*models.Reserva, error) {
+	var reserva models.Reserva
+	var codigo sql.NullInt64
+
+	if err := row.Scan(
+		&reserva.IDReserva,
+		&reserva.FechaReserva,
+		&reserva.Estado,
+		&reserva.UsuarioID,
+		&reserva.LibroISBN,
+		&reserva.SucursalRetiroID,
+		&codigo,
+	); err != nil {
+		return nil, err
+	}
+
+	if codigo.Valid {
+		c := int(codigo.Int64)
+		reserva.EjemplarCodigo = &c
+	}
+
+	return &reserva, nil
+}
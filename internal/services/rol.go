@@ -0,0 +1,415 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"proyecto-bd-final/internal/config"
+	"proyecto-bd-final/internal/models"
+	"strconv"
+	"strings"
+)
+
+// RolAdmin es el rol con acceso a todas las sucursales
+const RolAdmin = "admin"
+
+// rolesDelSistema son los roles a los que el código hace referencia por
+// nombre; no se pueden renombrar ni eliminar
+var rolesDelSistema = map[string]bool{
+	RolAdmin:     true,
+	"estudiante": true,
+	"profesor":   true,
+	"personal":   true,
+}
+
+type RolService struct {
+	bitacoraService     *BitacoraService
+	autorizacionService *AutorizacionService
+}
+
+func NewRolService() *RolService {
+	return &RolService{
+		bitacoraService:     NewBitacoraService(),
+		autorizacionService: NewAutorizacionService(),
+	}
+}
+
+// GetAll obtiene todos los roles con la cantidad de usuarios que los tienen
+func (s *RolService) GetAll() ([]*models.Rol, error) {
+	query := `SELECT R.idRol, R.nombreRol,
+              (SELECT COUNT(*) FROM UsuarioRol UR WHERE UR.Roles_idRol = R.idRol) AS USUARIOS
+              FROM Roles R
+              ORDER BY R.idRol`
+
+	rows, err := config.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*models.Rol{}
+	for rows.Next() {
+		var rol models.Rol
+		if err := rows.Scan(&rol.IDRol, &rol.NombreRol, &rol.Usuarios); err != nil {
+			return nil, err
+		}
+		roles = append(roles, &rol)
+	}
+
+	return roles, rows.Err()
+}
+
+// GetByID obtiene un rol con los permisos que otorga
+func (s *RolService) GetByID(id int) (*models.Rol, error) {
+	var rol models.Rol
+	query := `SELECT R.idRol, R.nombreRol,
+              (SELECT COUNT(*) FROM UsuarioRol UR WHERE UR.Roles_idRol = R.idRol) AS USUARIOS
+              FROM Roles R
+              WHERE R.idRol = :1`
+
+	err := config.DB.QueryRow(query, id).Scan(&rol.IDRol, &rol.NombreRol, &rol.Usuarios)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("rol no encontrado")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := config.DB.Query(`SELECT P.idPermiso, P.descripcion
+                                  FROM Permiso P
+                                  INNER JOIN RolPermiso RP ON RP.Permiso_idPermiso = P.idPermiso
+                                  WHERE RP.Roles_idRol = :1
+                                  ORDER BY P.idPermiso`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rol.Permisos = []*models.Permiso{}
+	for rows.Next() {
+		var permiso models.Permiso
+		if err := rows.Scan(&permiso.IDPermiso, &permiso.Descripcion); err != nil {
+			return nil, err
+		}
+		rol.Permisos = append(rol.Permisos, &permiso)
+	}
+
+	return &rol, rows.Err()
+}
+
+// GetPermisos obtiene todos los permisos del sistema
+func (s *RolService) GetPermisos() ([]*models.Permiso, error) {
+	rows, err := config.DB.Query(`SELECT idPermiso, descripcion FROM Permiso ORDER BY idPermiso`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permisos := []*models.Permiso{}
+	for rows.Next() {
+		var permiso models.Permiso
+		if err := rows.Scan(&permiso.IDPermiso, &permiso.Descripcion); err != nil {
+			return nil, err
+		}
+		permisos = append(permisos, &permiso)
+	}
+
+	return permisos, rows.Err()
+}
+
+// Create crea un rol sin permisos
+func (s *RolService) Create(nombre string, userID int) (*models.Rol, error) {
+	nombre = strings.TrimSpace(nombre)
+	if err := s.validarNombre(nombre, 0); err != nil {
+		return nil, err
+	}
+
+	var id int
+	query := `INSERT INTO Roles (idRol, nombreRol) VALUES (ROLES_SEQ.NEXTVAL, :1)
+              RETURNING idRol INTO :2`
+	if _, err := config.DB.Exec(query, nombre, sql.Out{Dest: &id}); err != nil {
+		return nil, err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "CREATE", "Roles", "Rol creado: "+nombre)
+
+	return s.GetByID(id)
+}
+
+// Update renombra un rol
+func (s *RolService) Update(id int, nombre string, userID int) (*models.Rol, error) {
+	rol, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if rolesDelSistema[rol.NombreRol] {
+		return nil, errors.New("el rol " + rol.NombreRol + " es del sistema y no se puede renombrar")
+	}
+
+	nombre = strings.TrimSpace(nombre)
+	if err := s.validarNombre(nombre, id); err != nil {
+		return nil, err
+	}
+
+	if _, err := config.DB.Exec(`UPDATE Roles SET nombreRol = :1 WHERE idRol = :2`, nombre, id); err != nil {
+		return nil, err
+	}
+
+	// Los usuarios con este rol lo ven con el nombre nuevo
+	s.autorizacionService.InvalidarTodos()
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "UPDATE", "Roles", "Rol "+rol.NombreRol+" renombrado a "+nombre)
+
+	return s.GetByID(id)
+}
+
+// Delete elimina un rol que no esté asignado a ningún usuario
+func (s *RolService) Delete(id int, userID int) error {
+	rol, err := s.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if rolesDelSistema[rol.NombreRol] {
+		return errors.New("el rol " + rol.NombreRol + " es del sistema y no se puede eliminar")
+	}
+	if rol.Usuarios > 0 {
+		return errors.New("el rol está asignado a " + strconv.Itoa(rol.Usuarios) + " usuarios")
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`DELETE FROM RolPermiso WHERE Roles_idRol = :1`, id); err != nil {
+		return err
+	}
+
+	// Solo se elimina si nadie lo recibió mientras tanto
+	result, err := tx.Exec(`DELETE FROM Roles WHERE idRol = :1
+                            AND NOT EXISTS (SELECT 1 FROM UsuarioRol WHERE Roles_idRol = :2)`, id, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.New("el rol fue asignado a un usuario, intente nuevamente")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "DELETE", "Roles", "Rol eliminado: "+rol.NombreRol)
+
+	return nil
+}
+
+// AsignarPermisos reemplaza los permisos que otorga un rol
+func (s *RolService) AsignarPermisos(id int, permisoIDs []int, userID int) (*models.Rol, error) {
+	rol, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	permisos, err := s.GetPermisos()
+	if err != nil {
+		return nil, err
+	}
+	existentes := make(map[int]string)
+	for _, permiso := range permisos {
+		existentes[permiso.IDPermiso] = permiso.Descripcion
+	}
+
+	gestionaRoles := false
+	for _, permisoID := range permisoIDs {
+		descripcion, ok := existentes[permisoID]
+		if !ok {
+			return nil, errors.New("el permiso " + strconv.Itoa(permisoID) + " no existe")
+		}
+		if descripcion == PermisoGestionarRoles {
+			gestionaRoles = true
+		}
+	}
+
+	// Sin este permiso nadie podría volver a administrar los roles
+	if rol.NombreRol == RolAdmin && !gestionaRoles {
+		return nil, errors.New("el rol admin debe conservar el permiso " + PermisoGestionarRoles)
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`DELETE FROM RolPermiso WHERE Roles_idRol = :1`, id); err != nil {
+		return nil, err
+	}
+
+	asignados := make(map[int]bool)
+	var descripciones []string
+	for _, permisoID := range permisoIDs {
+		if asignados[permisoID] {
+			continue
+		}
+		asignados[permisoID] = true
+		descripciones = append(descripciones, existentes[permisoID])
+
+		query := `INSERT INTO RolPermiso (idRolPermiso, Roles_idRol, Permiso_idPermiso)
+                  VALUES (ROLPERMISO_SEQ.NEXTVAL, :1, :2)`
+		if _, err = tx.Exec(query, id, permisoID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.autorizacionService.InvalidarTodos()
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "UPDATE", "RolPermiso",
+		"Permisos del rol "+rol.NombreRol+": "+strings.Join(descripciones, ", "))
+
+	return s.GetByID(id)
+}
+
+// AsignarAUsuario otorga un rol a un usuario que todavía no lo tiene
+func (s *RolService) AsignarAUsuario(usuarioID, rolID int, adminID int) error {
+	rol, err := s.GetByID(rolID)
+	if err != nil {
+		return err
+	}
+
+	var existe int
+	err = config.DB.QueryRow(`SELECT COUNT(*) FROM Usuario WHERE idUsuario = :1`, usuarioID).Scan(&existe)
+	if err != nil {
+		return err
+	}
+	if existe == 0 {
+		return errors.New("usuario no encontrado")
+	}
+
+	query := `INSERT INTO UsuarioRol (idUsuarioRol, Usuario_idUsuario, Roles_idRol)
+              SELECT USUARIOROL_SEQ.NEXTVAL, :1, :2 FROM DUAL
+              WHERE NOT EXISTS (SELECT 1 FROM UsuarioRol WHERE Usuario_idUsuario = :3 AND Roles_idRol = :4)`
+
+	// Dos asignaciones simultáneas pasan el NOT EXISTS; la restricción única
+	// rechaza la segunda
+	insertado := false
+	result, err := config.DB.Exec(query, usuarioID, rolID, usuarioID, rolID)
+	if err != nil && !esDuplicado(err) {
+		return err
+	}
+	if err == nil {
+		filas, _ := result.RowsAffected()
+		insertado = filas > 0
+	}
+
+	if !insertado {
+		// Si el rol lo había otorgado un proveedor de identidad, pasa a ser
+		// asignado a mano para que el proveedor no lo quite
+		result, err = config.DB.Exec(`UPDATE UsuarioRol SET origen = NULL
+		                              WHERE Usuario_idUsuario = :1 AND Roles_idRol = :2 AND origen IS NOT NULL`,
+			usuarioID, rolID)
+		if err != nil {
+			return err
+		}
+		if filas, _ := result.RowsAffected(); filas == 0 {
+			return errors.New("el usuario ya tiene el rol " + rol.NombreRol)
+		}
+	}
+
+	// El cambio se aplica en la próxima petición del usuario
+	s.autorizacionService.InvalidarRoles(usuarioID)
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(adminID, "UPDATE", "UsuarioRol",
+		"Rol "+rol.NombreRol+" asignado al usuario ID: "+strconv.Itoa(usuarioID))
+
+	return nil
+}
+
+// RevocarDeUsuario quita un rol a un usuario; el último administrador no
+// puede perder el rol admin
+func (s *RolService) RevocarDeUsuario(usuarioID, rolID int, adminID int) error {
+	rol, err := s.GetByID(rolID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if rol.NombreRol == RolAdmin {
+		// Bloquear el rol serializa las revocaciones simultáneas: cada una
+		// cuenta los administradores después de que la anterior terminó
+		var bloqueado int
+		if err := tx.QueryRow(`SELECT idRol FROM Roles WHERE idRol = :1 FOR UPDATE`, rolID).Scan(&bloqueado); err != nil {
+			return err
+		}
+
+		var administradores int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM UsuarioRol WHERE Roles_idRol = :1`, rolID).Scan(&administradores)
+		if err != nil {
+			return err
+		}
+		if administradores <= 1 {
+			return errors.New("no se puede quitar el rol al último administrador")
+		}
+	}
+
+	result, err := tx.Exec(`DELETE FROM UsuarioRol WHERE Usuario_idUsuario = :1 AND Roles_idRol = :2`,
+		usuarioID, rolID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.New("el usuario no tiene el rol " + rol.NombreRol)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.autorizacionService.InvalidarRoles(usuarioID)
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(adminID, "DELETE", "UsuarioRol",
+		"Rol "+rol.NombreRol+" revocado al usuario ID: "+strconv.Itoa(usuarioID))
+
+	return nil
+}
+
+// validarNombre verifica que el nombre no esté vacío ni repetido
+func (s *RolService) validarNombre(nombre string, id int) error {
+	if nombre == "" {
+		return errors.New("el nombre del rol es obligatorio")
+	}
+
+	var repetidos int
+	err := config.DB.QueryRow(`SELECT COUNT(*) FROM Roles WHERE UPPER(nombreRol) = UPPER(:1) AND idRol <> :2`,
+		nombre, id).Scan(&repetidos)
+	if err != nil {
+		return err
+	}
+	if repetidos > 0 {
+		return errors.New("ya existe un rol con ese nombre")
+	}
+
+	return nil
+}
+
+// esDuplicado indica si el error es una violación de restricción única de
+// Oracle (ORA-00001)
+func esDuplicado(err error) bool {
+	var oraErr interface{ Code() int }
+	return errors.As(err, &oraErr) && oraErr.Code() == 1
+}
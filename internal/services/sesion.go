@@ -0,0 +1,410 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"proyecto-bd-final/internal/config"
+	"proyecto-bd-final/internal/models"
+	"proyecto-bd-final/pkg/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DuracionRefreshToken es la vigencia de una sesión sin renovar
+const DuracionRefreshToken = 7 * 24 * time.Hour
+
+// intervaloUltimoUso es cada cuánto se registra el uso de una sesión en la
+// base de datos, para no escribir en cada petición
+const intervaloUltimoUso = time.Minute
+
+// usosRegistrados guarda cuándo se registró por última vez el uso de cada
+// sesión
+var usosRegistrados = struct {
+	sync.Mutex
+	ultimo map[int]time.Time
+}{ultimo: make(map[int]time.Time)}
+
+// sesionesRevocadas es la lista de revocación que consulta AuthMiddleware: las
+// sesiones cerradas cuyos tokens de acceso todavía no vencieron, con el momento
+// en que deja de ser necesario recordarlas
+var sesionesRevocadas = struct {
+	sync.RWMutex
+	hasta map[int]time.Time
+}{hasta: make(map[int]time.Time)}
+
+type SesionService struct {
+	bitacoraService *BitacoraService
+}
+
+func NewSesionService() *SesionService {
+	return &SesionService{
+		bitacoraService: NewBitacoraService(),
+	}
+}
+
+// Crear inicia una sesión para el usuario y devuelve su refresh token
+func (s *SesionService) Crear(userID int, cliente models.Cliente) (int, string, error) {
+	refresh, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return 0, "", err
+	}
+
+	var sesionID int
+	ahora := time.Now()
+	query := `INSERT INTO Sesion (idSesion, Usuario_idUsuario, tokenHash, fechaCreacion, fechaExpiracion,
+                                  dispositivo, ip, agenteUsuario, ultimoUso)
+              VALUES (SESION_SEQ.NEXTVAL, :1, :2, :3, :4, :5, :6, :7, :8)
+              RETURNING idSesion INTO :9`
+
+	agente := recortar(cliente.AgenteUsuario, 500)
+	_, err = config.DB.Exec(query, userID, utils.HashToken(refresh), ahora, ahora.Add(DuracionRefreshToken),
+		describirDispositivo(agente), recortar(cliente.IP, 45), agente, ahora,
+		sql.Out{Dest: &sesionID})
+	if err != nil {
+		return 0, "", err
+	}
+
+	return sesionID, refresh, nil
+}
+
+// Rotar canjea un refresh token por uno nuevo. Cada token sirve una sola vez:
+// si se presenta el token ya reemplazado, se asume que fue robado y se revoca
+// la sesión completa
+func (s *SesionService) Rotar(refresh string, cliente models.Cliente) (int, int, string, error) {
+	hash := utils.HashToken(refresh)
+
+	var sesionID, userID int
+	var expiracion time.Time
+	var revocacion sql.NullTime
+
+	query := `SELECT idSesion, Usuario_idUsuario, fechaExpiracion, fechaRevocacion
+              FROM Sesion WHERE tokenHash = :1`
+
+	err := config.DB.QueryRow(query, hash).Scan(&sesionID, &userID, &expiracion, &revocacion)
+	if err == sql.ErrNoRows {
+		s.detectarReutilizacion(hash)
+		return 0, 0, "", errors.New("refresh token inválido")
+	}
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	if revocacion.Valid {
+		return 0, 0, "", errors.New("la sesión fue cerrada")
+	}
+	if time.Now().After(expiracion) {
+		return 0, 0, "", errors.New("la sesión expiró, inicie sesión nuevamente")
+	}
+
+	nuevo, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	// Solo una renovación concurrente puede ganar. Cada renovación actualiza
+	// desde dónde y cuándo se usó la sesión por última vez
+	agente := recortar(cliente.AgenteUsuario, 500)
+	result, err := config.DB.Exec(`UPDATE Sesion SET tokenHash = :1, tokenAnterior = :2,
+                                          dispositivo = :3, ip = :4, agenteUsuario = :5, ultimoUso = :6
+                                   WHERE idSesion = :7 AND tokenHash = :8 AND fechaRevocacion IS NULL`,
+		utils.HashToken(nuevo), hash, describirDispositivo(agente), recortar(cliente.IP, 45), agente, time.Now(),
+		sesionID, hash)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return 0, 0, "", errors.New("refresh token inválido")
+	}
+
+	return sesionID, userID, nuevo, nil
+}
+
+// detectarReutilizacion revoca la sesión si el token presentado es uno ya rotado
+func (s *SesionService) detectarReutilizacion(hash string) {
+	var sesionID, userID int
+	query := `SELECT idSesion, Usuario_idUsuario FROM Sesion
+              WHERE tokenAnterior = :1 AND fechaRevocacion IS NULL`
+
+	if err := config.DB.QueryRow(query, hash).Scan(&sesionID, &userID); err != nil {
+		return
+	}
+
+	if s.revocar(sesionID, userID) == nil {
+		s.bitacoraService.RegistrarAccion(userID, "REVOKE", "Sesion",
+			"Sesión "+strconv.Itoa(sesionID)+" revocada por reutilización de refresh token")
+	}
+}
+
+// Revocar cierra una sesión del usuario; sus tokens de acceso dejan de
+// aceptarse de inmediato
+func (s *SesionService) Revocar(sesionID, userID int) error {
+	if err := s.revocar(sesionID, userID); err != nil {
+		return err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "LOGOUT", "Sesion", "Sesión "+strconv.Itoa(sesionID)+" cerrada")
+
+	return nil
+}
+
+// RegistrarUso actualiza la fecha de último uso de la sesión. Lo llama
+// AuthMiddleware en cada petición, pero escribe como mucho una vez por
+// intervaloUltimoUso, de modo que ultimoUso se atrasa a lo sumo ese tiempo
+func (s *SesionService) RegistrarUso(sesionID int) {
+	ahora := time.Now()
+
+	usosRegistrados.Lock()
+	if ahora.Sub(usosRegistrados.ultimo[sesionID]) < intervaloUltimoUso {
+		usosRegistrados.Unlock()
+		return
+	}
+	for id, ultimo := range usosRegistrados.ultimo {
+		if ahora.Sub(ultimo) >= intervaloUltimoUso {
+			delete(usosRegistrados.ultimo, id)
+		}
+	}
+	usosRegistrados.ultimo[sesionID] = ahora
+	usosRegistrados.Unlock()
+
+	// Si falla, solo se atrasa la fecha mostrada: la petición sigue adelante
+	_, err := config.DB.Exec(`UPDATE Sesion SET ultimoUso = :1 WHERE idSesion = :2 AND fechaRevocacion IS NULL`,
+		ahora, sesionID)
+	if err != nil {
+		log.Printf("⚠️ No se pudo registrar el uso de la sesión %d: %v", sesionID, err)
+	}
+}
+
+// Listar devuelve las sesiones abiertas del usuario, la más reciente primero,
+// marcando la sesión desde la que se consulta (0 = ninguna)
+func (s *SesionService) Listar(userID, actual int) ([]*models.Sesion, error) {
+	query := `SELECT idSesion, Usuario_idUsuario, fechaCreacion, fechaExpiracion,
+                     dispositivo, ip, agenteUsuario, ultimoUso
+              FROM Sesion
+              WHERE Usuario_idUsuario = :1 AND fechaRevocacion IS NULL AND fechaExpiracion > :2
+              ORDER BY NVL(ultimoUso, fechaCreacion) DESC`
+
+	rows, err := config.DB.Query(query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sesiones := []*models.Sesion{}
+	for rows.Next() {
+		sesion := &models.Sesion{}
+		var dispositivo, ip, agente sql.NullString
+		var ultimoUso sql.NullTime
+		if err := rows.Scan(&sesion.IDSesion, &sesion.UsuarioID, &sesion.FechaCreacion, &sesion.FechaExpiracion,
+			&dispositivo, &ip, &agente, &ultimoUso); err != nil {
+			return nil, err
+		}
+		sesion.Dispositivo = dispositivo.String
+		sesion.IP = ip.String
+		sesion.AgenteUsuario = agente.String
+		if ultimoUso.Valid {
+			sesion.UltimoUso = &ultimoUso.Time
+		}
+		sesion.Actual = sesion.IDSesion == actual
+		sesiones = append(sesiones, sesion)
+	}
+
+	return sesiones, rows.Err()
+}
+
+// CerrarOtras cierra todas las sesiones del usuario menos la actual
+func (s *SesionService) CerrarOtras(userID, actual int) (int, error) {
+	cerradas, err := s.RevocarTodas(userID, actual)
+	if err != nil {
+		return 0, err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "LOGOUT", "Sesion",
+		"Otras "+strconv.Itoa(cerradas)+" sesiones cerradas")
+
+	return cerradas, nil
+}
+
+// RevocarComoAdmin cierra una sesión de otro usuario; queda registrada a
+// nombre del administrador
+func (s *SesionService) RevocarComoAdmin(sesionID, userID, adminID int) error {
+	if err := s.revocar(sesionID, userID); err != nil {
+		return err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(adminID, "REVOKE", "Sesion",
+		"Sesión "+strconv.Itoa(sesionID)+" del usuario "+strconv.Itoa(userID)+" cerrada")
+
+	return nil
+}
+
+// RevocarTodasComoAdmin cierra todas las sesiones de otro usuario
+func (s *SesionService) RevocarTodasComoAdmin(userID, adminID int) (int, error) {
+	cerradas, err := s.RevocarTodas(userID, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(adminID, "REVOKE", "Sesion",
+		strconv.Itoa(cerradas)+" sesiones del usuario "+strconv.Itoa(userID)+" cerradas")
+
+	return cerradas, nil
+}
+
+// RevocarTodas cierra las sesiones abiertas del usuario salvo la indicada
+// (0 = todas), por ejemplo tras un cambio de contraseña
+func (s *SesionService) RevocarTodas(userID, excepto int) (int, error) {
+	rows, err := config.DB.Query(`SELECT idSesion FROM Sesion
+                                  WHERE Usuario_idUsuario = :1 AND idSesion <> :2 AND fechaRevocacion IS NULL`,
+		userID, excepto)
+	if err != nil {
+		return 0, err
+	}
+	var sesiones []int
+	for rows.Next() {
+		var sesionID int
+		if err := rows.Scan(&sesionID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		sesiones = append(sesiones, sesionID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, sesionID := range sesiones {
+		if s.revocar(sesionID, userID) == nil {
+			total++
+		}
+	}
+
+	return total, nil
+}
+
+func (s *SesionService) revocar(sesionID, userID int) error {
+	result, err := config.DB.Exec(`UPDATE Sesion SET fechaRevocacion = :1
+                                   WHERE idSesion = :2 AND Usuario_idUsuario = :3 AND fechaRevocacion IS NULL`,
+		time.Now(), sesionID, userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.New("sesión no encontrada o ya cerrada")
+	}
+
+	marcarRevocada(sesionID, time.Now())
+	return nil
+}
+
+// Revocada indica si la sesión figura en la lista de revocación
+func (s *SesionService) Revocada(sesionID int) bool {
+	sesionesRevocadas.RLock()
+	defer sesionesRevocadas.RUnlock()
+
+	hasta, ok := sesionesRevocadas.hasta[sesionID]
+	return ok && time.Now().Before(hasta)
+}
+
+// CargarRevocadas recupera las sesiones cerradas cuyos tokens de acceso
+// pueden seguir vigentes, para no perderlas al reiniciar el servidor
+func (s *SesionService) CargarRevocadas() (int, error) {
+	query := `SELECT idSesion, fechaRevocacion FROM Sesion WHERE fechaRevocacion > :1`
+
+	rows, err := config.DB.Query(query, time.Now().Add(-utils.DuracionAccessToken))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	total := 0
+	for rows.Next() {
+		var sesionID int
+		var revocacion time.Time
+		if err := rows.Scan(&sesionID, &revocacion); err != nil {
+			return total, err
+		}
+		marcarRevocada(sesionID, revocacion)
+		total++
+	}
+
+	return total, rows.Err()
+}
+
+// marcarRevocada agrega la sesión a la lista y descarta las entradas cuyos
+// tokens ya vencieron solos
+func marcarRevocada(sesionID int, revocacion time.Time) {
+	sesionesRevocadas.Lock()
+	defer sesionesRevocadas.Unlock()
+
+	ahora := time.Now()
+	for id, hasta := range sesionesRevocadas.hasta {
+		if ahora.After(hasta) {
+			delete(sesionesRevocadas.hasta, id)
+		}
+	}
+	sesionesRevocadas.hasta[sesionID] = revocacion.Add(utils.DuracionAccessToken)
+}
+
+// describirDispositivo resume el agente de usuario como "Navegador en Sistema"
+// para mostrarlo en la lista de sesiones
+func describirDispositivo(agente string) string {
+	if agente == "" {
+		return "Desconocido"
+	}
+
+	navegador := "Otro navegador"
+	for _, candidato := range []struct{ marca, nombre string }{
+		// El orden importa: Edge y Opera también se anuncian como Chrome, y
+		// Chrome como Safari
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"PostmanRuntime/", "Postman"},
+	} {
+		if strings.Contains(agente, candidato.marca) {
+			navegador = candidato.nombre
+			break
+		}
+	}
+
+	sistema := ""
+	for _, candidato := range []struct{ marca, nombre string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(agente, candidato.marca) {
+			sistema = candidato.nombre
+			break
+		}
+	}
+
+	if sistema == "" {
+		return navegador
+	}
+	return navegador + " en " + sistema
+}
+
+// recortar limita el texto al largo de la columna
+func recortar(texto string, largo int) string {
+	if len(texto) > largo {
+		return strings.ToValidUTF8(texto[:largo], "")
+	}
+	return texto
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Sistemas de clasificación soportados para las signaturas topográficas
+const (
+	SistemaDewey = "DEWEY"
+	SistemaLC    = "LC"
+)
+
+var (
+	patronDewey = regexp.MustCompile(`^(\d{1,3})(?:\.(\d+))?\s*(.*)$`)
+	patronLC    = regexp.MustCompile(`^([A-Z]{1,3})\s*(\d+)(?:\.(\d+))?\s*(.*)$`)
+)
+
+// DetectarSistema deduce el sistema de clasificación a partir de la signatura:
+// Dewey empieza con dígitos y LC con letras
+func DetectarSistema(signatura string) string {
+	signatura = strings.TrimSpace(signatura)
+	if signatura == "" {
+		return ""
+	}
+	if unicode.IsDigit(rune(signatura[0])) {
+		return SistemaDewey
+	}
+	return SistemaLC
+}
+
+// ClaveOrdenSignatura genera una clave que, comparada como texto, respeta el
+// orden de estantería de la signatura. Las partes decimales (clase Dewey,
+// subdivisiones LC y números Cutter) se comparan dígito a dígito, y los
+// números enteros (clase LC, años, volúmenes) por su valor numérico
+func ClaveOrdenSignatura(signatura, sistema string) string {
+	signatura = strings.ToUpper(strings.TrimSpace(signatura))
+	if signatura == "" {
+		// Los ejemplares sin signatura van al final
+		return "~"
+	}
+	if sistema == "" {
+		sistema = DetectarSistema(signatura)
+	}
+
+	switch sistema {
+	case SistemaDewey:
+		if m := patronDewey.FindStringSubmatch(signatura); m != nil {
+			return "D" + rellenarIzq(m[1], 3) + rellenarDer(m[2], 12) + " " + claveCutters(m[3])
+		}
+	case SistemaLC:
+		if m := patronLC.FindStringSubmatch(signatura); m != nil {
+			return "L" + rellenarEspacios(m[1], 3) + rellenarIzq(m[2], 5) + rellenarDer(m[3], 12) + " " + claveCutters(m[4])
+		}
+	}
+
+	return "Z" + signatura
+}
+
+// claveCutters normaliza los números Cutter y demás elementos finales de una
+// signatura ("G63 M37 2018", ".G63", "c.2")
+func claveCutters(resto string) string {
+	tokens := strings.FieldsFunc(resto, func(r rune) bool {
+		return r == ' ' || r == '.'
+	})
+
+	partes := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		i := 0
+		for i < len(token) && unicode.IsLetter(rune(token[i])) {
+			i++
+		}
+		letras := token[:i]
+		j := i
+		for j < len(token) && unicode.IsDigit(rune(token[j])) {
+			j++
+		}
+		digitos := token[i:j]
+
+		switch {
+		case letras == "" && digitos != "":
+			// Números sueltos (años, volúmenes) se comparan por valor
+			partes = append(partes, "#"+rellenarIzq(digitos, 8)+token[j:])
+		case digitos != "":
+			// Cutter: letra inicial seguida de una fracción decimal
+			partes = append(partes, letras+rellenarDer(digitos, 8)+token[j:])
+		default:
+			partes = append(partes, token)
+		}
+	}
+
+	return strings.Join(partes, " ")
+}
+
+func rellenarIzq(valor string, largo int) string {
+	if len(valor) >= largo {
+		return valor
+	}
+	return strings.Repeat("0", largo-len(valor)) + valor
+}
+
+func rellenarDer(valor string, largo int) string {
+	if len(valor) >= largo {
+		return valor
+	}
+	return valor + strings.Repeat("0", largo-len(valor))
+}
+
+func rellenarEspacios(valor string, largo int) string {
+	if len(valor) >= largo {
+		return valor
+	}
+	return valor + strings.Repeat(" ", largo-len(valor))
+}
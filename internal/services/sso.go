@@ -0,0 +1,377 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"os"
+	"proyecto-bd-final/internal/config"
+	"proyecto-bd-final/internal/models"
+	"proyecto-bd-final/internal/oidc"
+	"proyecto-bd-final/internal/repository"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DuracionSolicitudSSO es el plazo para volver del proveedor de identidad
+const DuracionSolicitudSSO = 10 * time.Minute
+
+// ClaveSinContrasenia marca las cuentas creadas por un proveedor externo: no
+// es un hash válido, así que no permiten el inicio de sesión con contraseña
+// hasta que el usuario la restablezca
+const ClaveSinContrasenia = "!"
+
+type solicitudSSO struct {
+	nonce       string
+	verificador string
+	expira      time.Time
+}
+
+// solicitudesSSO guarda los inicios de sesión en curso por su state hasta que
+// el proveedor devuelve al usuario
+var solicitudesSSO = struct {
+	sync.Mutex
+	estados map[string]solicitudSSO
+}{estados: make(map[string]solicitudSSO)}
+
+// identidadExterna son los datos que entrega un proveedor de identidad
+type identidadExterna struct {
+	proveedor        string
+	sujeto           string
+	correo           string
+	correoVerificado bool
+	nombre           string
+	apellido         string
+	roles            []string
+}
+
+type SSOService struct {
+	userRepo            *repository.UserRepository
+	autorizacionService *AutorizacionService
+	bitacoraService     *BitacoraService
+}
+
+func NewSSOService() *SSOService {
+	return &SSOService{
+		userRepo:            repository.NewUserRepository(),
+		autorizacionService: NewAutorizacionService(),
+		bitacoraService:     NewBitacoraService(),
+	}
+}
+
+// Habilitado indica si hay un proveedor OpenID Connect configurado
+func (s *SSOService) Habilitado() bool {
+	return oidc.Actual() != nil
+}
+
+// Iniciar devuelve la dirección del proveedor a la que se redirige al usuario
+// y el state de la solicitud, que debe quedar ligado al navegador que la inició
+func (s *SSOService) Iniciar(ctx context.Context) (string, string, error) {
+	proveedor := oidc.Actual()
+	if proveedor == nil {
+		return "", "", errors.New("inicio de sesión único no configurado")
+	}
+
+	estado, err := oidc.Aleatorio()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oidc.Aleatorio()
+	if err != nil {
+		return "", "", err
+	}
+	verificador, err := oidc.Aleatorio()
+	if err != nil {
+		return "", "", err
+	}
+
+	direccion, err := proveedor.URLAutorizacion(ctx, estado, nonce, verificador)
+	if err != nil {
+		return "", "", err
+	}
+
+	ahora := time.Now()
+	solicitudesSSO.Lock()
+	for clave, solicitud := range solicitudesSSO.estados {
+		if ahora.After(solicitud.expira) {
+			delete(solicitudesSSO.estados, clave)
+		}
+	}
+	solicitudesSSO.estados[estado] = solicitudSSO{
+		nonce:       nonce,
+		verificador: verificador,
+		expira:      ahora.Add(DuracionSolicitudSSO),
+	}
+	solicitudesSSO.Unlock()
+
+	return direccion, estado, nil
+}
+
+// Completar canjea el código devuelto por el proveedor y obtiene el usuario
+// vinculado a la identidad, creándolo si no existe
+func (s *SSOService) Completar(ctx context.Context, estado, codigo string) (*models.Usuario, error) {
+	proveedor := oidc.Actual()
+	if proveedor == nil {
+		return nil, errors.New("inicio de sesión único no configurado")
+	}
+
+	// Cada state sirve una sola vez
+	solicitudesSSO.Lock()
+	solicitud, ok := solicitudesSSO.estados[estado]
+	delete(solicitudesSSO.estados, estado)
+	solicitudesSSO.Unlock()
+
+	if !ok || time.Now().After(solicitud.expira) {
+		return nil, errors.New("el inicio de sesión expiró, intente nuevamente")
+	}
+
+	identidad, err := proveedor.Canjear(ctx, codigo, solicitud.verificador, solicitud.nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.resolver(identidadExterna{
+		proveedor:        proveedor.Emisor(),
+		sujeto:           identidad.Sujeto,
+		correo:           identidad.Correo,
+		correoVerificado: identidad.CorreoVerificado,
+		nombre:           identidad.Nombre,
+		apellido:         identidad.Apellido,
+		roles:            proveedor.Roles(identidad),
+	}, rolPredeterminadoSSO(), autoRegistroSSO())
+}
+
+// URLRetornoAplicacion arma la dirección del frontend a la que vuelve el
+// usuario; los datos van en el fragmento para que no lleguen a ningún servidor
+func (s *SSOService) URLRetornoAplicacion(datos url.Values) string {
+	return urlAplicacion() + "/auth/callback#" + datos.Encode()
+}
+
+// resolver busca el usuario vinculado a la identidad. Si no hay vínculo, lo
+// vincula a la cuenta con el mismo correo (solo si el proveedor lo verificó)
+// o crea una cuenta nueva con el rol predeterminado. Los roles de las reglas
+// de mapeo se sincronizan en cada inicio de sesión; los asignados a mano se conservan
+func (s *SSOService) resolver(externa identidadExterna, rolPredeterminado string, autoRegistro bool) (*models.Usuario, error) {
+	var userID int
+	err := config.DB.QueryRow(`SELECT Usuario_idUsuario FROM IdentidadExterna
+	                           WHERE proveedor = :1 AND sujeto = :2`,
+		externa.proveedor, externa.sujeto).Scan(&userID)
+
+	switch {
+	case err == nil:
+		_, err = config.DB.Exec(`UPDATE IdentidadExterna SET ultimoAcceso = :1
+		                         WHERE proveedor = :2 AND sujeto = :3`,
+			time.Now(), externa.proveedor, externa.sujeto)
+		if err != nil {
+			return nil, err
+		}
+
+	case err == sql.ErrNoRows:
+		if externa.correo == "" {
+			return nil, errors.New("el proveedor de identidad no entregó un correo")
+		}
+
+		existente, _ := s.userRepo.GetByEmail(externa.correo)
+		if userID, err = vincularPorCorreo(existente, externa, autoRegistro); err != nil {
+			return nil, err
+		}
+		if userID == 0 {
+			if userID, err = s.crearUsuario(externa, rolPredeterminado); err != nil {
+				return nil, err
+			}
+		}
+
+		_, err = config.DB.Exec(`INSERT INTO IdentidadExterna
+		                         (idIdentidad, Usuario_idUsuario, proveedor, sujeto, fechaCreacion, ultimoAcceso)
+		                         VALUES (IDENTIDADEXTERNA_SEQ.NEXTVAL, :1, :2, :3, :4, :5)`,
+			userID, externa.proveedor, externa.sujeto, time.Now(), time.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		// Registrar en bitácora
+		s.bitacoraService.RegistrarAccion(userID, "SSO_LINK", "Usuario",
+			"Cuenta vinculada a "+externa.proveedor)
+
+	default:
+		return nil, err
+	}
+
+	if err := s.sincronizarRoles(userID, externa.proveedor, externa.roles); err != nil {
+		return nil, err
+	}
+
+	return s.userRepo.GetByID(userID)
+}
+
+// vincularPorCorreo decide qué cuenta corresponde a una identidad externa
+// nueva: la existente con el mismo correo, o 0 si hay que crear una
+func vincularPorCorreo(existente *models.Usuario, externa identidadExterna, autoRegistro bool) (int, error) {
+	if existente != nil {
+		// Sin verificación del proveedor, cualquiera podría reclamar la cuenta
+		if !externa.correoVerificado {
+			return 0, errors.New("el correo ya está registrado; inicie sesión con su contraseña")
+		}
+		return existente.IDUsuario, nil
+	}
+	if !autoRegistro {
+		return 0, errors.New("no existe una cuenta para " + externa.correo)
+	}
+	return 0, nil
+}
+
+// crearUsuario registra la cuenta de una identidad externa nueva
+func (s *SSOService) crearUsuario(externa identidadExterna, rolPredeterminado string) (int, error) {
+	if err := DominioPermitido(externa.correo); err != nil {
+		return 0, err
+	}
+
+	nombre := externa.nombre
+	if nombre == "" {
+		nombre = externa.correo[:strings.Index(externa.correo+"@", "@")]
+	}
+
+	// Las consultas de Usuario no admiten apellido nulo
+	apellido := externa.apellido
+	if apellido == "" {
+		apellido = "-"
+	}
+
+	user := &models.Usuario{
+		Nombre:      nombre,
+		Apellido:    apellido,
+		Correo:      externa.correo,
+		Contrasenia: ClaveSinContrasenia,
+	}
+	if err := s.userRepo.Create(user); err != nil {
+		return 0, err
+	}
+
+	// El proveedor ya comprobó el correo
+	if externa.correoVerificado {
+		_, err := config.DB.Exec(`UPDATE Usuario SET fechaVerificacion = :1 WHERE idUsuario = :2`,
+			time.Now(), user.IDUsuario)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// El rol predeterminado queda como asignado a mano: no depende del proveedor
+	if _, err := s.asignarRol(user.IDUsuario, rolPredeterminado, ""); err != nil {
+		return 0, err
+	}
+	s.autorizacionService.InvalidarRoles(user.IDUsuario)
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(user.IDUsuario, "REGISTRO", "Usuario",
+		"Usuario creado desde "+externa.proveedor)
+
+	return user.IDUsuario, nil
+}
+
+// sincronizarRoles deja al usuario con los roles que el proveedor le otorga
+// hoy: agrega los que faltan y quita los que el mismo proveedor había otorgado
+// y ya no corresponden (por ejemplo, al salir de un grupo). Los roles asignados
+// a mano no se modifican; los nombres que no corresponden a un rol se ignoran
+func (s *SSOService) sincronizarRoles(userID int, proveedor string, roles []string) error {
+	deseados := make(map[string]bool)
+	for _, rol := range roles {
+		if rol != "" {
+			deseados[rol] = true
+		}
+	}
+
+	rows, err := config.DB.Query(`SELECT UR.idUsuarioRol, R.nombreRol
+	                              FROM UsuarioRol UR
+	                              INNER JOIN Roles R ON R.idRol = UR.Roles_idRol
+	                              WHERE UR.Usuario_idUsuario = :1 AND UR.origen = :2`, userID, proveedor)
+	if err != nil {
+		return err
+	}
+	vigentes := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var nombre string
+		if err := rows.Scan(&id, &nombre); err != nil {
+			rows.Close()
+			return err
+		}
+		vigentes[id] = nombre
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	cambios := 0
+	for id, rol := range vigentes {
+		if deseados[rol] {
+			continue
+		}
+		result, err := config.DB.Exec(`DELETE FROM UsuarioRol WHERE idUsuarioRol = :1 AND origen = :2`, id, proveedor)
+		if err != nil {
+			return err
+		}
+		if filas, _ := result.RowsAffected(); filas > 0 {
+			cambios++
+			s.bitacoraService.RegistrarAccion(userID, "DELETE", "UsuarioRol",
+				"Rol "+rol+" revocado por el proveedor de identidad al usuario ID: "+strconv.Itoa(userID))
+		}
+	}
+
+	for rol := range deseados {
+		asignado, err := s.asignarRol(userID, rol, proveedor)
+		if err != nil {
+			return err
+		}
+		if asignado {
+			cambios++
+			s.bitacoraService.RegistrarAccion(userID, "UPDATE", "UsuarioRol",
+				"Rol "+rol+" asignado por el proveedor de identidad al usuario ID: "+strconv.Itoa(userID))
+		}
+	}
+
+	if cambios > 0 {
+		s.autorizacionService.InvalidarRoles(userID)
+	}
+	return nil
+}
+
+// asignarRol otorga el rol por nombre si el usuario todavía no lo tiene,
+// registrando su origen (vacío = asignado a mano)
+func (s *SSOService) asignarRol(userID int, rol, origen string) (bool, error) {
+	query := `INSERT INTO UsuarioRol (idUsuarioRol, Usuario_idUsuario, Roles_idRol, origen)
+              SELECT USUARIOROL_SEQ.NEXTVAL, :1, R.idRol, :2 FROM Roles R
+              WHERE R.nombreRol = :3
+              AND NOT EXISTS (SELECT 1 FROM UsuarioRol UR WHERE UR.Usuario_idUsuario = :4 AND UR.Roles_idRol = R.idRol)`
+
+	result, err := config.DB.Exec(query, userID, nullString(origen), rol, userID)
+	if esDuplicado(err) {
+		// Un inicio de sesión simultáneo lo asignó primero
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	filas, _ := result.RowsAffected()
+	return filas > 0, nil
+}
+
+// rolPredeterminadoSSO es el rol de las cuentas creadas por inicio de sesión
+// único (OIDC_DEFAULT_ROLE, por defecto estudiante)
+func rolPredeterminadoSSO() string {
+	if rol := strings.TrimSpace(os.Getenv("OIDC_DEFAULT_ROLE")); rol != "" {
+		return rol
+	}
+	return "estudiante"
+}
+
+// autoRegistroSSO indica si se crean cuentas para identidades nuevas
+// (OIDC_AUTO_PROVISION, activado por defecto)
+func autoRegistroSSO() bool {
+	activo, err := strconv.ParseBool(os.Getenv("OIDC_AUTO_PROVISION"))
+	return err != nil || activo
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"proyecto-bd-final/internal/models"
+	"testing"
+)
+
+func TestVincularPorCorreo(t *testing.T) {
+	existente := &models.Usuario{IDUsuario: 42, Correo: "ana@example.edu"}
+
+	casos := []struct {
+		nombre       string
+		existente    *models.Usuario
+		verificado   bool
+		autoRegistro bool
+		userID       int
+		falla        bool
+	}{
+		{"correo sin verificar no reclama la cuenta", existente, false, true, 0, true},
+		{"correo verificado vincula la cuenta", existente, true, false, 42, false},
+		{"sin cuenta y con autorregistro se crea", nil, false, true, 0, false},
+		{"sin cuenta y sin autorregistro se rechaza", nil, true, false, 0, true},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			externa := identidadExterna{
+				proveedor:        "https://idp.example.edu",
+				sujeto:           "atacante",
+				correo:           "ana@example.edu",
+				correoVerificado: caso.verificado,
+			}
+
+			userID, err := vincularPorCorreo(caso.existente, externa, caso.autoRegistro)
+			if (err != nil) != caso.falla {
+				t.Fatalf("error = %v, se esperaba falla = %v", err, caso.falla)
+			}
+			if userID != caso.userID {
+				t.Errorf("userID = %d, se esperaba %d", userID, caso.userID)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"proyecto-bd-final/internal/config"
+	"proyecto-bd-final/internal/models"
+	"strconv"
+)
+
+// SucursalCentral es la sucursal dueña por defecto de los ejemplares
+const SucursalCentral = 1
+
+type SucursalService struct {
+	bitacoraService *BitacoraService
+}
+
+func NewSucursalService() *SucursalService {
+	return &SucursalService{
+		bitacoraService: NewBitacoraService(),
+	}
+}
+
+// GetAll obtiene todas las sucursales
+func (s *SucursalService) GetAll() ([]*models.Sucursal, error) {
+	query := `SELECT idSucursal, codigo, nombre, direccion
+              FROM Sucursal
+              ORDER BY idSucursal`
+
+	rows, err := config.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sucursales := []*models.Sucursal{}
+	for rows.Next() {
+		var sucursal models.Sucursal
+		var direccion sql.NullString
+		if err := rows.Scan(&sucursal.IDSucursal, &sucursal.Codigo, &sucursal.Nombre, &direccion); err != nil {
+			return nil, err
+		}
+		sucursal.Direccion = direccion.String
+		sucursales = append(sucursales, &sucursal)
+	}
+
+	return sucursales, rows.Err()
+}
+
+// GetByID obtiene una sucursal por su ID
+func (s *SucursalService) GetByID(id int) (*models.Sucursal, error) {
+	query := `SELECT idSucursal, codigo, nombre, direccion
+              FROM Sucursal
+              WHERE idSucursal = :1`
+
+	var sucursal models.Sucursal
+	var direccion sql.NullString
+	err := config.DB.QueryRow(query, id).Scan(&sucursal.IDSucursal, &sucursal.Codigo, &sucursal.Nombre, &direccion)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("sucursal no encontrada")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sucursal.Direccion = direccion.String
+	return &sucursal, nil
+}
+
+// Create crea una nueva sucursal
+func (s *SucursalService) Create(sucursal *models.Sucursal, userID int) error {
+	query := `INSERT INTO Sucursal (idSucursal, codigo, nombre, direccion)
+              VALUES (SUCURSAL_SEQ.NEXTVAL, :1, :2, :3)
+              RETURNING idSucursal INTO :4`
+
+	_, err := config.DB.Exec(query,
+		sucursal.Codigo,
+		sucursal.Nombre,
+		nullString(sucursal.Direccion),
+		sql.Out{Dest: &sucursal.IDSucursal},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "CREATE", "Sucursal", "Sucursal creada: "+sucursal.Nombre)
+
+	return nil
+}
+
+// Update actualiza los datos de una sucursal
+func (s *SucursalService) Update(sucursal *models.Sucursal, userID int) error {
+	query := `UPDATE Sucursal
+              SET codigo = :1, nombre = :2, direccion = :3
+              WHERE idSucursal = :4`
+
+	result, err := config.DB.Exec(query,
+		sucursal.Codigo,
+		sucursal.Nombre,
+		nullString(sucursal.Direccion),
+		sucursal.IDSucursal,
+	)
+	if err != nil {
+		return err
+	}
+
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		return errors.New("sucursal no encontrada")
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "UPDATE", "Sucursal", "Sucursal actualizada: "+sucursal.Nombre)
+
+	return nil
+}
+
+// GetSucursalPersonal obtiene la sucursal asignada a un miembro del personal;
+// devuelve 0 si el usuario no es personal o no tiene sucursal
+func (s *SucursalService) GetSucursalPersonal(userID int) (int, error) {
+	query := `SELECT Sucursal_idSucursal FROM Personal WHERE Usuario_idUsuario = :1`
+
+	var sucursalID sql.NullInt64
+	err := config.DB.QueryRow(query, userID).Scan(&sucursalID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return int(sucursalID.Int64), nil
+}
+
+// AsignarPersonal asigna la sucursal en la que trabaja un miembro del personal
+func (s *SucursalService) AsignarPersonal(usuarioID, sucursalID, adminID int) error {
+	if _, err := s.GetByID(sucursalID); err != nil {
+		return err
+	}
+
+	query := `UPDATE Personal SET Sucursal_idSucursal = :1 WHERE Usuario_idUsuario = :2`
+
+	result, err := config.DB.Exec(query, sucursalID, usuarioID)
+	if err != nil {
+		return err
+	}
+
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		return errors.New("el usuario no está registrado como personal")
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(adminID, "UPDATE", "Personal",
+		"Usuario ID "+strconv.Itoa(usuarioID)+" asignado a sucursal ID: "+strconv.Itoa(sucursalID))
+
+	return nil
+}
+
+// GetDisponibilidad obtiene los ejemplares totales y disponibles de un libro en
+// cada sucursal según su ubicación actual
+func (s *SucursalService) GetDisponibilidad(isbn string) ([]*models.DisponibilidadSucursal, error) {
+	query := `SELECT S.idSucursal, S.nombre,
+              COUNT(EJ.codigo) AS TOTAL,
+              COUNT(CASE WHEN EJ.estado = 'DISPONIBLE' THEN 1 END) AS DISPONIBLES
+              FROM Sucursal S
+              INNER JOIN Ejemplar EJ ON EJ.Sucursal_idUbicacion = S.idSucursal
+              WHERE EJ.Libro_ISBN = :1 AND EJ.estado <> 'BAJA'
+              GROUP BY S.idSucursal, S.nombre
+              ORDER BY S.idSucursal`
+
+	rows, err := config.DB.Query(query, isbn)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	disponibilidad := []*models.DisponibilidadSucursal{}
+	for rows.Next() {
+		var d models.DisponibilidadSucursal
+		if err := rows.Scan(&d.SucursalID, &d.Sucursal, &d.Total, &d.Disponibles); err != nil {
+			return nil, err
+		}
+		disponibilidad = append(disponibilidad, &d)
+	}
+
+	return disponibilidad, rows.Err()
+}
@@ -0,0 +1,400 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"proyecto-bd-final/internal/config"
+	"proyecto-bd-final/internal/models"
+	"strconv"
+	"time"
+)
+
+// Estados de un traslado entre sucursales
+const (
+	TrasladoSolicitado = "SOLICITADO"
+	TrasladoEnTransito = "EN_TRANSITO"
+	TrasladoRecibido   = "RECIBIDO"
+	TrasladoCancelado  = "CANCELADO"
+)
+
+// Estados de un ejemplar
+const (
+	EjemplarDisponible = "DISPONIBLE"
+	EjemplarPrestado   = "PRESTADO"
+	EjemplarEnTransito = "EN_TRANSITO"
+	EjemplarReservado  = "RESERVADO"
+	EjemplarPerdido    = "PERDIDO"
+	EjemplarDadoDeBaja = "BAJA"
+)
+
+type TrasladoService struct {
+	bitacoraService *BitacoraService
+	reservaService  *ReservaService
+}
+
+func NewTrasladoService() *TrasladoService {
+	return &TrasladoService{
+		bitacoraService: NewBitacoraService(),
+		reservaService:  NewReservaService(),
+	}
+}
+
+const selectTraslado = `SELECT T.idTraslado, T.estado, T.fechaSolicitud, T.fechaEnvio, T.fechaRecepcion,
+              T.Ejemplar_codigo, L.ISBN, L.titulo, T.Sucursal_idOrigen, T.Sucursal_idDestino,
+              T.Usuario_idSolicita, T.Reserva_idReserva
+              FROM Traslado T
+              INNER JOIN Ejemplar EJ ON T.Ejemplar_codigo = EJ.codigo
+              INNER JOIN Libro L ON EJ.Libro_ISBN = L.ISBN`
+
+// GetByID obtiene un traslado por su ID
+func (s *TrasladoService) GetByID(id int) (*models.Traslado, error) {
+	traslado, err := scanTraslado(config.DB.QueryRow(selectTraslado+` WHERE T.idTraslado = :1`, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("traslado no encontrado")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return traslado, nil
+}
+
+// GetTraslados obtiene los traslados que salen o llegan a una sucursal (0 =
+// todas), opcionalmente filtrados por estado
+func (s *TrasladoService) GetTraslados(sucursalID int, estado string) ([]*models.Traslado, error) {
+	query := selectTraslado + `
+              WHERE (:1 IS NULL OR T.Sucursal_idOrigen = :2 OR T.Sucursal_idDestino = :3)
+              AND (:4 IS NULL OR T.estado = :5)
+              ORDER BY T.fechaSolicitud DESC, T.idTraslado DESC`
+
+	filtroSucursal := nullSucursal(sucursalID)
+	filtroEstado := nullString(estado)
+	rows, err := config.DB.Query(query, filtroSucursal, filtroSucursal, filtroSucursal, filtroEstado, filtroEstado)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	traslados := []*models.Traslado{}
+	for rows.Next() {
+		traslado, err := scanTraslado(rows)
+		if err != nil {
+			return nil, err
+		}
+		traslados = append(traslados, traslado)
+	}
+
+	return traslados, rows.Err()
+}
+
+// Solicitar crea una solicitud de traslado de un ejemplar disponible hacia la
+// sucursal de destino. sucursalID es la sucursal de quien opera (0 para el
+// administrador) y debe ser el origen o el destino
+func (s *TrasladoService) Solicitar(codigo, destinoID, sucursalID, userID int) (*models.Traslado, error) {
+	var estado string
+	var origenID int
+	err := config.DB.QueryRow(`SELECT estado, Sucursal_idUbicacion FROM Ejemplar WHERE codigo = :1`, codigo).
+		Scan(&estado, &origenID)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("ejemplar no encontrado")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if estado != EjemplarDisponible {
+		return nil, errors.New("el ejemplar no está disponible para traslado")
+	}
+	if origenID == destinoID {
+		return nil, errors.New("el ejemplar ya está en la sucursal de destino")
+	}
+	if sucursalID > 0 && origenID != sucursalID && destinoID != sucursalID {
+		return nil, errors.New("solo se pueden solicitar traslados desde o hacia tu sucursal")
+	}
+
+	var existe int
+	if err := config.DB.QueryRow(`SELECT COUNT(*) FROM Sucursal WHERE idSucursal = :1`, destinoID).Scan(&existe); err != nil {
+		return nil, err
+	}
+	if existe == 0 {
+		return nil, errors.New("sucursal de destino no encontrada")
+	}
+
+	var abiertos int
+	err = config.DB.QueryRow(`SELECT COUNT(*) FROM Traslado WHERE Ejemplar_codigo = :1 AND estado IN (:2, :3)`,
+		codigo, TrasladoSolicitado, TrasladoEnTransito).Scan(&abiertos)
+	if err != nil {
+		return nil, err
+	}
+	if abiertos > 0 {
+		return nil, errors.New("el ejemplar ya tiene un traslado en curso")
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	id, err := insertarTraslado(tx, codigo, origenID, destinoID, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "SOLICITAR", "Traslado",
+		"Traslado "+strconv.Itoa(id)+": ejemplar "+strconv.Itoa(codigo)+
+			" de sucursal "+strconv.Itoa(origenID)+" a "+strconv.Itoa(destinoID))
+
+	return s.GetByID(id)
+}
+
+// Enviar despacha el ejemplar desde la sucursal de origen; el ejemplar queda
+// EN_TRANSITO hasta que se confirme su recepción. sucursalID es la sucursal de
+// quien opera (0 para el administrador)
+func (s *TrasladoService) Enviar(id, sucursalID, userID int) error {
+	traslado, err := s.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if sucursalID > 0 && traslado.SucursalOrigenID != sucursalID {
+		return errors.New("solo la sucursal de origen puede enviar el traslado")
+	}
+	if traslado.Estado != TrasladoSolicitado {
+		return errors.New("el traslado no está pendiente de envío")
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// El ejemplar debe seguir en la estantería (o apartado para la reserva)
+	result, err := tx.Exec(`UPDATE Ejemplar SET estado = :1
+                            WHERE codigo = :2 AND estado IN (:3, :4)`,
+		EjemplarEnTransito, traslado.EjemplarCodigo, EjemplarDisponible, EjemplarReservado)
+	if err != nil {
+		return err
+	}
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		return errors.New("el ejemplar ya no está disponible para enviar")
+	}
+
+	// Una cancelación concurrente pudo ganarle al envío
+	result, err = tx.Exec(`UPDATE Traslado SET estado = :1, fechaEnvio = :2
+                           WHERE idTraslado = :3 AND estado = :4`,
+		TrasladoEnTransito, time.Now(), id, TrasladoSolicitado)
+	if err != nil {
+		return err
+	}
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		return errors.New("el traslado no está pendiente de envío")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "ENVIAR", "Traslado",
+		"Traslado "+strconv.Itoa(id)+": ejemplar "+strconv.Itoa(traslado.EjemplarCodigo)+" en tránsito")
+
+	return nil
+}
+
+// Recibir confirma la llegada del ejemplar a la sucursal de destino. Si el
+// traslado atiende una reserva, el ejemplar queda apartado para el lector
+func (s *TrasladoService) Recibir(id, sucursalID, userID int) error {
+	traslado, err := s.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if sucursalID > 0 && traslado.SucursalDestinoID != sucursalID {
+		return errors.New("solo la sucursal de destino puede recibir el traslado")
+	}
+	if traslado.Estado != TrasladoEnTransito {
+		return errors.New("el traslado no está en tránsito")
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	estadoEjemplar := EjemplarDisponible
+	if traslado.ReservaID != nil {
+		// La reserva pudo cancelarse mientras el ejemplar viajaba
+		result, err := tx.Exec(`UPDATE Reserva SET estado = :1
+                                WHERE idReserva = :2 AND estado = :3`,
+			ReservaLista, *traslado.ReservaID, ReservaEnTransito)
+		if err != nil {
+			return err
+		}
+		if filas, _ := result.RowsAffected(); filas > 0 {
+			estadoEjemplar = EjemplarReservado
+		}
+	}
+
+	// Solo una recepción concurrente puede ganar
+	result, err := tx.Exec(`UPDATE Traslado SET estado = :1, fechaRecepcion = :2
+                            WHERE idTraslado = :3 AND estado = :4`,
+		TrasladoRecibido, time.Now(), id, TrasladoEnTransito)
+	if err != nil {
+		return err
+	}
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		return errors.New("el traslado no está en tránsito")
+	}
+
+	result, err = tx.Exec(`UPDATE Ejemplar SET estado = :1, Sucursal_idUbicacion = :2
+                           WHERE codigo = :3 AND estado = :4`,
+		estadoEjemplar, traslado.SucursalDestinoID, traslado.EjemplarCodigo, EjemplarEnTransito)
+	if err != nil {
+		return err
+	}
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		return errors.New("el ejemplar ya no está en tránsito")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "RECIBIR", "Traslado",
+		"Traslado "+strconv.Itoa(id)+": ejemplar "+strconv.Itoa(traslado.EjemplarCodigo)+
+			" recibido en sucursal "+strconv.Itoa(traslado.SucursalDestinoID))
+
+	if estadoEjemplar == EjemplarDisponible {
+		s.reservaService.AtenderPendientes(traslado.LibroISBN, userID)
+	}
+
+	return nil
+}
+
+// Cancelar anula un traslado que todavía no se envió. Si atendía una reserva,
+// la reserva vuelve a quedar pendiente
+func (s *TrasladoService) Cancelar(id, sucursalID, userID int) error {
+	traslado, err := s.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if sucursalID > 0 && traslado.SucursalOrigenID != sucursalID && traslado.SucursalDestinoID != sucursalID {
+		return errors.New("no tienes permiso para cancelar este traslado")
+	}
+	if traslado.Estado != TrasladoSolicitado {
+		return errors.New("solo se pueden cancelar traslados no enviados")
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Si ya se envió, el ejemplar está en tránsito y no se puede cancelar
+	result, err := tx.Exec(`UPDATE Traslado SET estado = :1 WHERE idTraslado = :2 AND estado = :3`,
+		TrasladoCancelado, id, TrasladoSolicitado)
+	if err != nil {
+		return err
+	}
+	if filas, _ := result.RowsAffected(); filas == 0 {
+		return errors.New("solo se pueden cancelar traslados no enviados")
+	}
+
+	if traslado.ReservaID != nil {
+		_, err = tx.Exec(`UPDATE Ejemplar SET estado = :1 WHERE codigo = :2 AND estado = :3`,
+			EjemplarDisponible, traslado.EjemplarCodigo, EjemplarReservado)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE Reserva SET estado = :1, Ejemplar_codigo = NULL
+                          WHERE idReserva = :2 AND estado = :3`,
+			ReservaPendiente, *traslado.ReservaID, ReservaEnTransito)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Registrar en bitácora
+	s.bitacoraService.RegistrarAccion(userID, "CANCELAR", "Traslado",
+		"Traslado "+strconv.Itoa(id)+" cancelado")
+
+	// El ejemplar apartado quedó libre para la siguiente reserva
+	if traslado.ReservaID != nil {
+		s.reservaService.AtenderPendientes(traslado.LibroISBN, userID)
+	}
+
+	return nil
+}
+
+// insertarTraslado registra una solicitud de traslado dentro de una transacción
+func insertarTraslado(tx *sql.Tx, codigo, origenID, destinoID, userID int, reservaID *int) (int, error) {
+	var id int
+	err := tx.QueryRow("SELECT TRASLADO_SEQ.NEXTVAL FROM DUAL").Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `INSERT INTO Traslado (idTraslado, estado, fechaSolicitud, Ejemplar_codigo,
+              Sucursal_idOrigen, Sucursal_idDestino, Usuario_idSolicita, Reserva_idReserva)
+              VALUES (:1, :2, :3, :4, :5, :6, :7, :8)`
+
+	_, err = tx.Exec(query, id, TrasladoSolicitado, time.Now(), codigo, origenID, destinoID, userID, nullInt(reservaID))
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func scanTraslado(row scanner) (*models.Traslado, error) {
+	var traslado models.Traslado
+	var fechaEnvio, fechaRecepcion sql.NullTime
+	var reservaID sql.NullInt64
+
+	if err := row.Scan(
+		&traslado.IDTraslado,
+		&traslado.Estado,
+		&traslado.FechaSolicitud,
+		&fechaEnvio,
+		&fechaRecepcion,
+		&traslado.EjemplarCodigo,
+		&traslado.LibroISBN,
+		&traslado.LibroTitulo,
+		&traslado.SucursalOrigenID,
+		&traslado.SucursalDestinoID,
+		&traslado.UsuarioID,
+		&reservaID,
+	); err != nil {
+		return nil, err
+	}
+
+	if fechaEnvio.Valid {
+		t := fechaEnvio.Time
+		traslado.FechaEnvio = &t
+	}
+	if fechaRecepcion.Valid {
+		t := fechaRecepcion.Time
+		traslado.FechaRecepcion = &t
+	}
+	if reservaID.Valid {
+		id := int(reservaID.Int64)
+		traslado.ReservaID = &id
+	}
+
+	return &traslado, nil
+}
@@ -0,0 +1,102 @@
+// Package totp implementa contraseñas de un solo uso basadas en tiempo
+// (RFC 6238) compatibles con las aplicaciones autenticadoras habituales
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parámetros de los códigos; son los predeterminados de las aplicaciones
+const (
+	Digitos = 6
+	Periodo = 30 * time.Second
+	// Tolerancia son los pasos aceptados antes y después del actual, para
+	// compensar la desincronización del reloj del teléfono
+	Tolerancia = 1
+)
+
+var codificacion = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerarSecreto crea un secreto aleatorio de 160 bits codificado en base32
+func GenerarSecreto() (string, error) {
+	secreto := make([]byte, 20)
+	if _, err := rand.Read(secreto); err != nil {
+		return "", err
+	}
+	return codificacion.EncodeToString(secreto), nil
+}
+
+// URI arma el enlace otpauth:// que se muestra como código QR para registrar
+// la cuenta en la aplicación autenticadora
+func URI(emisor, cuenta, secreto string) string {
+	parametros := url.Values{}
+	parametros.Set("secret", secreto)
+	parametros.Set("issuer", emisor)
+	parametros.Set("algorithm", "SHA1")
+	parametros.Set("digits", fmt.Sprint(Digitos))
+	parametros.Set("period", fmt.Sprint(int(Periodo.Seconds())))
+
+	etiqueta := url.PathEscape(emisor + ":" + cuenta)
+	return "otpauth://totp/" + etiqueta + "?" + parametros.Encode()
+}
+
+// Paso devuelve el número de periodo correspondiente al instante
+func Paso(t time.Time) int64 {
+	return t.Unix() / int64(Periodo.Seconds())
+}
+
+// Codigo calcula el código del paso indicado
+func Codigo(secreto string, paso int64) (string, error) {
+	clave, err := codificacion.DecodeString(strings.ToUpper(strings.TrimRight(secreto, "=")))
+	if err != nil {
+		return "", errors.New("secreto TOTP inválido")
+	}
+
+	var mensaje [8]byte
+	binary.BigEndian.PutUint64(mensaje[:], uint64(paso))
+
+	mac := hmac.New(sha1.New, clave)
+	mac.Write(mensaje[:])
+	suma := mac.Sum(nil)
+
+	// Truncamiento dinámico (RFC 4226, sección 5.3)
+	desplazamiento := suma[len(suma)-1] & 0x0f
+	valor := binary.BigEndian.Uint32(suma[desplazamiento:desplazamiento+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < Digitos; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", Digitos, valor%modulo), nil
+}
+
+// Validar verifica el código contra los pasos cercanos al instante y devuelve
+// el paso que coincidió, para impedir que el mismo código se use dos veces
+func Validar(secreto, codigo string, t time.Time) (int64, bool) {
+	codigo = strings.ReplaceAll(strings.TrimSpace(codigo), " ", "")
+	if len(codigo) != Digitos {
+		return 0, false
+	}
+
+	actual := Paso(t)
+	for paso := actual - Tolerancia; paso <= actual+Tolerancia; paso++ {
+		esperado, err := Codigo(secreto, paso)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(esperado), []byte(codigo)) == 1 {
+			return paso, true
+		}
+	}
+	return 0, false
+}
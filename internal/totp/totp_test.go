@@ -0,0 +1,128 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// secretoRFC es la clave SHA-1 del apéndice B de RFC 6238
+// ("12345678901234567890") codificada en base32
+const secretoRFC = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Vectores SHA-1 del apéndice B de RFC 6238. El RFC publica códigos de 8
+// dígitos; con 6 dígitos son sus últimos seis
+var vectoresRFC = []struct {
+	segundos int64
+	paso     int64
+	codigo   string
+}{
+	{59, 0x1, "94287082"},
+	{1111111109, 0x23523EC, "07081804"},
+	{1111111111, 0x23523ED, "14050471"},
+	{1234567890, 0x273EF07, "89005924"},
+	{2000000000, 0x3F940AA, "69279037"},
+	{20000000000, 0x27BC86AA, "65353130"},
+}
+
+func TestCodigoRFC6238(t *testing.T) {
+	for _, v := range vectoresRFC {
+		instante := time.Unix(v.segundos, 0)
+		if paso := Paso(instante); paso != v.paso {
+			t.Errorf("Paso(%d) = %X, se esperaba %X", v.segundos, paso, v.paso)
+		}
+
+		codigo, err := Codigo(secretoRFC, v.paso)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if esperado := v.codigo[len(v.codigo)-Digitos:]; codigo != esperado {
+			t.Errorf("Codigo(paso %X) = %s, se esperaba %s", v.paso, codigo, esperado)
+		}
+	}
+}
+
+func TestCodigoSecreto(t *testing.T) {
+	// Las aplicaciones muestran el secreto en minúsculas o con relleno
+	for _, secreto := range []string{strings.ToLower(secretoRFC), secretoRFC + "===="} {
+		codigo, err := Codigo(secreto, 1)
+		if err != nil || codigo != "287082" {
+			t.Errorf("Codigo(%q) = %q, %v", secreto, codigo, err)
+		}
+	}
+
+	if _, err := Codigo("no es base32!", 1); err == nil {
+		t.Error("se esperaba un error con un secreto inválido")
+	}
+}
+
+func TestValidarTolerancia(t *testing.T) {
+	instante := time.Unix(1111111111, 0)
+	actual := Paso(instante)
+
+	for desfase := int64(-Tolerancia); desfase <= Tolerancia; desfase++ {
+		codigo, _ := Codigo(secretoRFC, actual+desfase)
+		paso, ok := Validar(secretoRFC, codigo, instante)
+		if !ok || paso != actual+desfase {
+			t.Errorf("desfase %d: Validar = %d, %v", desfase, paso, ok)
+		}
+	}
+
+	for _, desfase := range []int64{-Tolerancia - 1, Tolerancia + 1} {
+		codigo, _ := Codigo(secretoRFC, actual+desfase)
+		if _, ok := Validar(secretoRFC, codigo, instante); ok {
+			t.Errorf("desfase %d: el código fuera de la ventana no debería aceptarse", desfase)
+		}
+	}
+}
+
+func TestValidarFormato(t *testing.T) {
+	instante := time.Unix(59, 0)
+
+	// Se toleran espacios, como los que muestran las aplicaciones
+	for _, codigo := range []string{"287082", " 287 082 "} {
+		if _, ok := Validar(secretoRFC, codigo, instante); !ok {
+			t.Errorf("Validar(%q) debería aceptarse", codigo)
+		}
+	}
+
+	for _, codigo := range []string{"", "28708", "2870820", "94287082", "28708a", "287083"} {
+		if _, ok := Validar(secretoRFC, codigo, instante); ok {
+			t.Errorf("Validar(%q) no debería aceptarse", codigo)
+		}
+	}
+}
+
+func TestURI(t *testing.T) {
+	direccion, err := url.Parse(URI("Biblioteca", "ana@uni.edu", secretoRFC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if direccion.Scheme != "otpauth" || direccion.Host != "totp" || direccion.Path != "/Biblioteca:ana@uni.edu" {
+		t.Errorf("URI inesperada: %s", direccion)
+	}
+	esperados := map[string]string{
+		"secret": secretoRFC, "issuer": "Biblioteca", "algorithm": "SHA1", "digits": "6", "period": "30",
+	}
+	for parametro, valor := range esperados {
+		if obtenido := direccion.Query().Get(parametro); obtenido != valor {
+			t.Errorf("%s = %q, se esperaba %q", parametro, obtenido, valor)
+		}
+	}
+}
+
+func TestGenerarSecreto(t *testing.T) {
+	secreto, err := GenerarSecreto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 160 bits en base32 sin relleno son 32 caracteres
+	if len(secreto) != 32 {
+		t.Errorf("longitud = %d, se esperaba 32", len(secreto))
+	}
+	if _, err := Codigo(secreto, 0); err != nil {
+		t.Errorf("el secreto generado no es utilizable: %v", err)
+	}
+}
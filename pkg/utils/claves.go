@@ -0,0 +1,209 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// claveFirma es una clave del conjunto; las que no tienen parte privada solo
+// verifican tokens emitidos antes de retirarlas
+type claveFirma struct {
+	kid     string
+	metodo  jwt.SigningMethod
+	privada crypto.Signer
+	publica crypto.PublicKey
+}
+
+var conjuntoClaves = struct {
+	sync.RWMutex
+	activa *claveFirma
+	claves map[string]*claveFirma
+}{claves: make(map[string]*claveFirma)}
+
+// CargarClaves lee las claves de JWT_KEYS_DIR. Cada archivo .pem es una clave
+// cuyo kid es el nombre del archivo sin extensión: las privadas (RSA o
+// Ed25519) firman y verifican, las públicas solo verifican. Firma la indicada
+// en JWT_ACTIVE_KID o, sin ella, la privada de kid mayor en orden alfabético.
+//
+// Para rotar se agrega la clave nueva y se deja la anterior (o solo su parte
+// pública) al menos DuracionAccessToken, hasta que venzan sus tokens
+func CargarClaves() (int, error) {
+	directorio := os.Getenv("JWT_KEYS_DIR")
+	if directorio == "" {
+		return 0, errors.New("JWT_KEYS_DIR no configurado")
+	}
+
+	archivos, err := filepath.Glob(filepath.Join(directorio, "*.pem"))
+	if err != nil {
+		return 0, err
+	}
+
+	claves := make(map[string]*claveFirma)
+	for _, archivo := range archivos {
+		clave, err := leerClave(archivo)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", filepath.Base(archivo), err)
+		}
+		claves[clave.kid] = clave
+	}
+
+	activa, err := elegirActiva(claves, os.Getenv("JWT_ACTIVE_KID"))
+	if err != nil {
+		return 0, err
+	}
+
+	conjuntoClaves.Lock()
+	conjuntoClaves.claves = claves
+	conjuntoClaves.activa = activa
+	conjuntoClaves.Unlock()
+
+	return len(claves), nil
+}
+
+// KidActivo devuelve el kid con el que se firman los tokens nuevos
+func KidActivo() string {
+	if clave := claveActiva(); clave != nil {
+		return clave.kid
+	}
+	return ""
+}
+
+// JWKS devuelve las claves públicas en formato JSON Web Key Set, para que
+// otros servicios verifiquen los tokens
+func JWKS() map[string]interface{} {
+	conjuntoClaves.RLock()
+	defer conjuntoClaves.RUnlock()
+
+	kids := make([]string, 0, len(conjuntoClaves.claves))
+	for kid := range conjuntoClaves.claves {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	claves := make([]map[string]string, 0, len(kids))
+	for _, kid := range kids {
+		clave := conjuntoClaves.claves[kid]
+		jwk := map[string]string{
+			"kid": kid,
+			"use": "sig",
+			"alg": clave.metodo.Alg(),
+		}
+		switch publica := clave.publica.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(publica.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publica.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(publica)
+		}
+		claves = append(claves, jwk)
+	}
+
+	return map[string]interface{}{"keys": claves}
+}
+
+func claveActiva() *claveFirma {
+	conjuntoClaves.RLock()
+	defer conjuntoClaves.RUnlock()
+	return conjuntoClaves.activa
+}
+
+func buscarClave(kid string) *claveFirma {
+	conjuntoClaves.RLock()
+	defer conjuntoClaves.RUnlock()
+	return conjuntoClaves.claves[kid]
+}
+
+func elegirActiva(claves map[string]*claveFirma, kid string) (*claveFirma, error) {
+	if kid != "" {
+		clave, ok := claves[kid]
+		if !ok {
+			return nil, errors.New("JWT_ACTIVE_KID " + kid + " no está en JWT_KEYS_DIR")
+		}
+		if clave.privada == nil {
+			return nil, errors.New("la clave " + kid + " es pública y no puede firmar")
+		}
+		return clave, nil
+	}
+
+	var activa *claveFirma
+	for _, clave := range claves {
+		if clave.privada != nil && (activa == nil || clave.kid > activa.kid) {
+			activa = clave
+		}
+	}
+	if activa == nil {
+		return nil, errors.New("no hay claves privadas en JWT_KEYS_DIR para firmar tokens")
+	}
+	return activa, nil
+}
+
+// leerClave interpreta un archivo PEM con una clave privada PKCS#8 o PKCS#1,
+// o una clave pública PKIX
+func leerClave(archivo string) (*claveFirma, error) {
+	contenido, err := os.ReadFile(archivo)
+	if err != nil {
+		return nil, err
+	}
+
+	bloque, _ := pem.Decode(contenido)
+	if bloque == nil {
+		return nil, errors.New("no contiene un bloque PEM")
+	}
+
+	clave := &claveFirma{kid: strings.TrimSuffix(filepath.Base(archivo), filepath.Ext(archivo))}
+
+	var parseada interface{}
+	switch bloque.Type {
+	case "PRIVATE KEY":
+		parseada, err = x509.ParsePKCS8PrivateKey(bloque.Bytes)
+	case "RSA PRIVATE KEY":
+		parseada, err = x509.ParsePKCS1PrivateKey(bloque.Bytes)
+	case "PUBLIC KEY":
+		parseada, err = x509.ParsePKIXPublicKey(bloque.Bytes)
+	default:
+		return nil, errors.New("tipo de bloque PEM no soportado: " + bloque.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parseada.(type) {
+	case *rsa.PrivateKey:
+		clave.privada, clave.publica = k, &k.PublicKey
+	case ed25519.PrivateKey:
+		clave.privada, clave.publica = k, k.Public()
+	case *rsa.PublicKey, ed25519.PublicKey:
+		clave.publica = k
+	default:
+		return nil, errors.New("solo se admiten claves RSA y Ed25519")
+	}
+
+	switch publica := clave.publica.(type) {
+	case *rsa.PublicKey:
+		if publica.N.BitLen() < 2048 {
+			return nil, errors.New("las claves RSA deben tener al menos 2048 bits")
+		}
+		clave.metodo = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		clave.metodo = jwt.SigningMethodEdDSA
+	}
+
+	return clave, nil
+}
@@ -1,15 +1,211 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 
-// HashPassword genera un hash de la contraseña
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algoritmos de hash de contraseñas
+const (
+	AlgoritmoArgon2id = "argon2id"
+	AlgoritmoBcrypt   = "bcrypt"
+)
+
+// ConfigHash son el algoritmo y los parámetros con que se generan los hashes
+// nuevos; los hashes existentes con otros valores se actualizan al iniciar sesión
+type ConfigHash struct {
+	Algoritmo     string
+	CostoBcrypt   int
+	MemoriaArgon  uint32 // KiB
+	TiempoArgon   uint32 // iteraciones
+	HilosArgon    uint8
+	LongitudSal   int
+	LongitudClave uint32
+}
+
+var (
+	onceHash   sync.Once
+	configHash ConfigHash
+)
+
+// Límites de los parámetros de argon2id; fuera de ellos se usan los valores
+// predeterminados
+const (
+	memoriaArgonMaxima     = 4 * 1024 * 1024 // KiB
+	iteracionesArgonMaxima = 100
+	hilosArgonMaximo       = 255
+)
+
+// ConfiguracionHash devuelve la configuración leída de PASSWORD_HASH_ALGORITHM
+// (argon2id o bcrypt), BCRYPT_COST, ARGON2_MEMORY (KiB), ARGON2_ITERATIONS y
+// ARGON2_PARALLELISM
+func ConfiguracionHash() ConfigHash {
+	onceHash.Do(func() {
+		configHash = leerConfigHash()
+	})
+	return configHash
+}
+
+// leerConfigHash lee la configuración del entorno; los valores fuera de rango
+// se reemplazan por los predeterminados con una advertencia
+func leerConfigHash() ConfigHash {
+	config := ConfigHash{
+		Algoritmo:     AlgoritmoArgon2id,
+		CostoBcrypt:   enteroEntorno("BCRYPT_COST", 12),
+		LongitudSal:   16,
+		LongitudClave: 32,
+	}
+
+	switch algoritmo := strings.ToLower(os.Getenv("PASSWORD_HASH_ALGORITHM")); algoritmo {
+	case "", AlgoritmoArgon2id:
+	case AlgoritmoBcrypt:
+		config.Algoritmo = AlgoritmoBcrypt
+	default:
+		log.Printf("⚠️ PASSWORD_HASH_ALGORITHM %q no soportado, se usará argon2id", algoritmo)
+	}
+
+	if config.CostoBcrypt < bcrypt.MinCost || config.CostoBcrypt > bcrypt.MaxCost {
+		log.Printf("⚠️ BCRYPT_COST %d fuera de rango, se usará 12", config.CostoBcrypt)
+		config.CostoBcrypt = 12
+	}
+
+	// Se validan antes de convertirlos: un valor grande desbordaría el tipo y
+	// argon2 entraría en pánico con cero hilos o cero iteraciones
+	hilos := enteroEntorno("ARGON2_PARALLELISM", 2)
+	if hilos > hilosArgonMaximo {
+		log.Printf("⚠️ ARGON2_PARALLELISM %d fuera de rango (1-%d), se usará 2", hilos, hilosArgonMaximo)
+		hilos = 2
+	}
+	config.HilosArgon = uint8(hilos)
+
+	iteraciones := enteroEntorno("ARGON2_ITERATIONS", 3)
+	if iteraciones > iteracionesArgonMaxima {
+		log.Printf("⚠️ ARGON2_ITERATIONS %d fuera de rango (1-%d), se usará 3", iteraciones, iteracionesArgonMaxima)
+		iteraciones = 3
+	}
+	config.TiempoArgon = uint32(iteraciones)
+
+	// argon2 necesita al menos 8 KiB por hilo
+	memoria := enteroEntorno("ARGON2_MEMORY", 64*1024)
+	if memoria < 8*hilos || memoria > memoriaArgonMaxima {
+		log.Printf("⚠️ ARGON2_MEMORY %d fuera de rango (%d-%d KiB), se usará 65536", memoria, 8*hilos, memoriaArgonMaxima)
+		memoria = 64 * 1024
+	}
+	config.MemoriaArgon = uint32(memoria)
+
+	return config
+}
+
+// HashPassword genera un hash de la contraseña con el algoritmo configurado
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+	config := ConfiguracionHash()
+
+	if config.Algoritmo == AlgoritmoBcrypt {
+		bytes, err := bcrypt.GenerateFromPassword([]byte(password), config.CostoBcrypt)
+		return string(bytes), err
+	}
+
+	sal := make([]byte, config.LongitudSal)
+	if _, err := rand.Read(sal); err != nil {
+		return "", err
+	}
+	clave := argon2.IDKey([]byte(password), sal, config.TiempoArgon, config.MemoriaArgon, config.HilosArgon, config.LongitudClave)
+
+	// Formato PHC, el mismo que usan las demás implementaciones de argon2
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, config.MemoriaArgon, config.TiempoArgon, config.HilosArgon,
+		base64.RawStdEncoding.EncodeToString(sal), base64.RawStdEncoding.EncodeToString(clave)), nil
 }
 
-// CheckPasswordHash verifica si la contraseña coincide con el hash
+// CheckPasswordHash verifica si la contraseña coincide con el hash, sea
+// argon2id o bcrypt
 func CheckPasswordHash(password, hash string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		parametros, sal, esperada, err := leerArgon2id(hash)
+		if err != nil {
+			return false
+		}
+		clave := argon2.IDKey([]byte(password), sal, parametros.TiempoArgon, parametros.MemoriaArgon,
+			parametros.HilosArgon, uint32(len(esperada)))
+		return subtle.ConstantTimeCompare(clave, esperada) == 1
+	}
+
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// NeedsRehash indica si el hash se generó con otro algoritmo o con parámetros
+// distintos de los configurados
+func NeedsRehash(hash string) bool {
+	config := ConfiguracionHash()
+
+	if strings.HasPrefix(hash, "$argon2id$") {
+		if config.Algoritmo != AlgoritmoArgon2id {
+			return true
+		}
+		parametros, sal, clave, err := leerArgon2id(hash)
+		if err != nil {
+			return true
+		}
+		return parametros.MemoriaArgon != config.MemoriaArgon ||
+			parametros.TiempoArgon != config.TiempoArgon ||
+			parametros.HilosArgon != config.HilosArgon ||
+			len(sal) != config.LongitudSal ||
+			uint32(len(clave)) != config.LongitudClave
+	}
+
+	if config.Algoritmo != AlgoritmoBcrypt {
+		return true
+	}
+	costo, err := bcrypt.Cost([]byte(hash))
+	return err != nil || costo != config.CostoBcrypt
+}
+
+// leerArgon2id interpreta un hash $argon2id$v=19$m=..,t=..,p=..$sal$clave
+func leerArgon2id(hash string) (ConfigHash, []byte, []byte, error) {
+	var parametros ConfigHash
+
+	partes := strings.Split(hash, "$")
+	if len(partes) != 6 {
+		return parametros, nil, nil, errors.New("hash argon2id inválido")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(partes[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return parametros, nil, nil, errors.New("versión de argon2 no soportada")
+	}
+
+	_, err := fmt.Sscanf(partes[3], "m=%d,t=%d,p=%d", &parametros.MemoriaArgon, &parametros.TiempoArgon, &parametros.HilosArgon)
+	if err != nil || parametros.TiempoArgon == 0 || parametros.HilosArgon == 0 {
+		return parametros, nil, nil, errors.New("parámetros de argon2id inválidos")
+	}
+
+	sal, err := base64.RawStdEncoding.DecodeString(partes[4])
+	if err != nil {
+		return parametros, nil, nil, err
+	}
+	clave, err := base64.RawStdEncoding.DecodeString(partes[5])
+	if err != nil {
+		return parametros, nil, nil, err
+	}
+
+	return parametros, sal, clave, nil
+}
+
+func enteroEntorno(variable string, predeterminado int) int {
+	if n, err := strconv.Atoi(os.Getenv(variable)); err == nil && n > 0 {
+		return n
+	}
+	return predeterminado
+}
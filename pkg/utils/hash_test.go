@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// usarConfigHash reemplaza la configuración de hash durante la prueba, con
+// parámetros bajos para que sea rápida
+func usarConfigHash(t *testing.T, config ConfigHash) {
+	t.Helper()
+
+	onceHash.Do(func() {})
+	anterior := configHash
+	configHash = config
+	t.Cleanup(func() { configHash = anterior })
+}
+
+func configArgonPrueba() ConfigHash {
+	return ConfigHash{
+		Algoritmo:     AlgoritmoArgon2id,
+		CostoBcrypt:   bcrypt.MinCost,
+		MemoriaArgon:  64,
+		TiempoArgon:   1,
+		HilosArgon:    1,
+		LongitudSal:   16,
+		LongitudClave: 32,
+	}
+}
+
+func TestHashPasswordArgon2id(t *testing.T) {
+	usarConfigHash(t, configArgonPrueba())
+
+	hash, err := HashPassword("Biblioteca2024!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("formato inesperado: %s", hash)
+	}
+	if !CheckPasswordHash("Biblioteca2024!", hash) {
+		t.Error("la contraseña correcta no coincide")
+	}
+	if CheckPasswordHash("biblioteca2024!", hash) {
+		t.Error("una contraseña distinta coincide")
+	}
+
+	otro, _ := HashPassword("Biblioteca2024!")
+	if otro == hash {
+		t.Error("dos hashes de la misma contraseña deberían tener sal distinta")
+	}
+}
+
+func TestHashPasswordBcrypt(t *testing.T) {
+	config := configArgonPrueba()
+	config.Algoritmo = AlgoritmoBcrypt
+	usarConfigHash(t, config)
+
+	hash, err := HashPassword("Biblioteca2024!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$2a$04$") {
+		t.Errorf("formato inesperado: %s", hash)
+	}
+	if !CheckPasswordHash("Biblioteca2024!", hash) {
+		t.Error("la contraseña correcta no coincide")
+	}
+	if CheckPasswordHash("Biblioteca2025!", hash) {
+		t.Error("una contraseña distinta coincide")
+	}
+}
+
+func TestCheckPasswordHashInvalido(t *testing.T) {
+	usarConfigHash(t, configArgonPrueba())
+
+	for _, hash := range []string{
+		"",
+		"texto plano",
+		"$argon2id$v=19$m=64,t=1,p=1$sal",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsMTIzNDU2Nzg5MDEy$Y2xhdmU",
+		// Sin hilos ni iteraciones argon2 entraría en pánico
+		"$argon2id$v=19$m=64,t=1,p=0$c2FsMTIzNDU2Nzg5MDEy$Y2xhdmU",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsMTIzNDU2Nzg5MDEy$Y2xhdmU",
+	} {
+		if CheckPasswordHash("Biblioteca2024!", hash) {
+			t.Errorf("el hash %q no debería coincidir", hash)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	config := configArgonPrueba()
+	usarConfigHash(t, config)
+
+	argon, err := HashPassword("Biblioteca2024!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NeedsRehash(argon) {
+		t.Error("un hash con la configuración vigente no necesita rehash")
+	}
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("Biblioteca2024!"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !NeedsRehash(string(bcryptHash)) {
+		t.Error("con argon2id configurado, un hash bcrypt necesita rehash")
+	}
+
+	casos := []struct {
+		nombre  string
+		cambiar func(*ConfigHash)
+	}{
+		{"memoria", func(c *ConfigHash) { c.MemoriaArgon = 128 }},
+		{"iteraciones", func(c *ConfigHash) { c.TiempoArgon = 2 }},
+		{"hilos", func(c *ConfigHash) { c.HilosArgon = 2 }},
+		{"sal", func(c *ConfigHash) { c.LongitudSal = 32 }},
+		{"clave", func(c *ConfigHash) { c.LongitudClave = 64 }},
+		{"algoritmo", func(c *ConfigHash) { c.Algoritmo = AlgoritmoBcrypt }},
+	}
+	for _, caso := range casos {
+		nueva := config
+		caso.cambiar(&nueva)
+		configHash = nueva
+		if !NeedsRehash(argon) {
+			t.Errorf("%s: un hash con otros parámetros necesita rehash", caso.nombre)
+		}
+	}
+
+	configHash = config
+	configHash.Algoritmo = AlgoritmoBcrypt
+	if NeedsRehash(string(bcryptHash)) {
+		t.Error("un hash bcrypt con el costo vigente no necesita rehash")
+	}
+	configHash.CostoBcrypt = bcrypt.MinCost + 1
+	if !NeedsRehash(string(bcryptHash)) {
+		t.Error("un hash bcrypt con otro costo necesita rehash")
+	}
+	if !NeedsRehash("hash inválido") {
+		t.Error("un hash ilegible necesita rehash")
+	}
+}
+
+func TestLeerConfigHash(t *testing.T) {
+	casos := []struct {
+		nombre  string
+		entorno map[string]string
+		memoria uint32
+		tiempo  uint32
+		hilos   uint8
+		costo   int
+	}{
+		{"predeterminados", nil, 64 * 1024, 3, 2, 12},
+		{"válidos", map[string]string{
+			"ARGON2_MEMORY": "19456", "ARGON2_ITERATIONS": "2", "ARGON2_PARALLELISM": "1", "BCRYPT_COST": "10",
+		}, 19456, 2, 1, 10},
+		{"hilos desbordados", map[string]string{"ARGON2_PARALLELISM": "256"}, 64 * 1024, 3, 2, 12},
+		{"memoria desbordada", map[string]string{"ARGON2_MEMORY": "4294967297"}, 64 * 1024, 3, 2, 12},
+		{"memoria insuficiente para los hilos", map[string]string{
+			"ARGON2_MEMORY": "16", "ARGON2_PARALLELISM": "4",
+		}, 64 * 1024, 3, 4, 12},
+		{"iteraciones excesivas", map[string]string{"ARGON2_ITERATIONS": "1000000"}, 64 * 1024, 3, 2, 12},
+		{"costo bcrypt", map[string]string{"BCRYPT_COST": "40"}, 64 * 1024, 3, 2, 12},
+		{"no numéricos", map[string]string{
+			"ARGON2_MEMORY": "mucha", "ARGON2_ITERATIONS": "-1", "ARGON2_PARALLELISM": "0",
+		}, 64 * 1024, 3, 2, 12},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			for _, variable := range []string{"ARGON2_MEMORY", "ARGON2_ITERATIONS", "ARGON2_PARALLELISM", "BCRYPT_COST", "PASSWORD_HASH_ALGORITHM"} {
+				t.Setenv(variable, caso.entorno[variable])
+			}
+
+			config := leerConfigHash()
+			if config.MemoriaArgon != caso.memoria || config.TiempoArgon != caso.tiempo ||
+				config.HilosArgon != caso.hilos || config.CostoBcrypt != caso.costo {
+				t.Errorf("configuración = %+v", config)
+			}
+		})
+	}
+}
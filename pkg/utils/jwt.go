@@ -8,34 +8,66 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// DuracionAccessToken es la vigencia del JWT de acceso; la sesión se
+// extiende con el refresh token
+const DuracionAccessToken = 15 * time.Minute
+
 type Claims struct {
-	UserID int      `json:"user_id"`
-	Email  string   `json:"email"`
-	Roles  []string `json:"roles"`
+	UserID   int      `json:"user_id"`
+	Email    string   `json:"email"`
+	Roles    []string `json:"roles"`
+	SesionID int      `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken genera un nuevo JWT token
-func GenerateToken(userID int, email string, roles []string) (string, error) {
+// GenerateToken genera un nuevo JWT token de acceso para la sesión indicada,
+// firmado con la clave activa e identificada con su kid
+func GenerateToken(userID int, email string, roles []string, sesionID int) (string, error) {
+	clave := claveActiva()
+	if clave == nil {
+		return "", errors.New("no hay clave de firma configurada")
+	}
+
 	claims := Claims{
-		UserID: userID,
-		Email:  email,
-		Roles:  roles,
+		UserID:   userID,
+		Email:    email,
+		Roles:    roles,
+		SesionID: sesionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			Issuer:    os.Getenv("JWT_ISSUER"),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(DuracionAccessToken)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	token := jwt.NewWithClaims(clave.metodo, claims)
+	token.Header["kid"] = clave.kid
+	return token.SignedString(clave.privada)
 }
 
-// ValidateToken valida un JWT token y retorna los claims
+// ValidateToken valida un JWT token y retorna los claims. Se acepta cualquier
+// clave del conjunto, para que los tokens firmados con una clave retirada
+// sigan sirviendo hasta vencer
 func ValidateToken(tokenString string) (*Claims, error) {
+	opciones := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithExpirationRequired(),
+	}
+	if emisor := os.Getenv("JWT_ISSUER"); emisor != "" {
+		opciones = append(opciones, jwt.WithIssuer(emisor))
+	}
+
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		clave := buscarClave(kid)
+		if clave == nil {
+			return nil, errors.New("clave de firma desconocida")
+		}
+		if token.Method.Alg() != clave.metodo.Alg() {
+			return nil, errors.New("algoritmo de firma inesperado")
+		}
+		return clave.publica, nil
+	}, opciones...)
 
 	if err != nil {
 		return nil, err
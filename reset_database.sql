@@ -22,6 +22,8 @@ END;
 /
 
 -- Eliminar tablas hijas primero (las que tienen FKs)
+BEGIN EXECUTE IMMEDIATE 'DROP TABLE LibroCategoria CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
 BEGIN EXECUTE IMMEDIATE 'DROP TABLE UsuarioRol CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
 /
 BEGIN EXECUTE IMMEDIATE 'DROP TABLE RolPermiso CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
@@ -54,6 +56,32 @@ BEGIN EXECUTE IMMEDIATE 'DROP TABLE Autor CASCADE CONSTRAINTS'; EXCEPTION WHEN O
 /
 BEGIN EXECUTE IMMEDIATE 'DROP TABLE Editorial CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
 /
+BEGIN EXECUTE IMMEDIATE 'DROP TABLE Categoria CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP TABLE IdentidadExterna CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP TABLE CodigoRecuperacion CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP TABLE TokenUsuario CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP TABLE Sesion CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP TABLE BajaEjemplar CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP TABLE Baja CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP TABLE InventarioDiscrepancia CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP TABLE InventarioLectura CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP TABLE Inventario CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP TABLE Traslado CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP TABLE Reserva CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP TABLE Sucursal CASCADE CONSTRAINTS'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
 
 -- ============================================================================
 -- PASO 2: ELIMINAR SECUENCIAS EXISTENTES
@@ -93,6 +121,34 @@ BEGIN EXECUTE IMMEDIATE 'DROP SEQUENCE PRESTAMO_SEQ'; EXCEPTION WHEN OTHERS THEN
 /
 BEGIN EXECUTE IMMEDIATE 'DROP SEQUENCE BITACORA_SEQ'; EXCEPTION WHEN OTHERS THEN NULL; END;
 /
+BEGIN EXECUTE IMMEDIATE 'DROP SEQUENCE CATEGORIA_SEQ'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP SEQUENCE LIBROCATEGORIA_SEQ'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP SEQUENCE SUCURSAL_SEQ'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP SEQUENCE RESERVA_SEQ'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP SEQUENCE TRASLADO_SEQ'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP SEQUENCE INVENTARIO_SEQ'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP SEQUENCE INVENTARIOLECTURA_SEQ'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP SEQUENCE INVENTARIODISCREPANCIA_SEQ'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP SEQUENCE BAJA_SEQ'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP SEQUENCE BAJAEJEMPLAR_SEQ'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP SEQUENCE SESION_SEQ'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP SEQUENCE TOKENUSUARIO_SEQ'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP SEQUENCE CODIGORECUPERACION_SEQ'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
+BEGIN EXECUTE IMMEDIATE 'DROP SEQUENCE IDENTIDADEXTERNA_SEQ'; EXCEPTION WHEN OTHERS THEN NULL; END;
+/
 
 -- ============================================================================
 -- PASO 3: CREAR TABLAS
@@ -102,6 +158,16 @@ BEGIN
 END;
 /
 
+-- Tabla Sucursal (bibliotecas de cada campus)
+CREATE TABLE Sucursal (
+    idSucursal INTEGER       NOT NULL,
+    codigo     VARCHAR2(20)  NOT NULL,
+    nombre     VARCHAR2(100) NOT NULL,
+    direccion  VARCHAR2(200),
+    CONSTRAINT Sucursal_PK PRIMARY KEY (idSucursal),
+    CONSTRAINT Sucursal_Codigo_UK UNIQUE (codigo)
+);
+
 -- Tabla Usuario (tabla principal)
 CREATE TABLE Usuario (
     idUsuario     INTEGER      NOT NULL,
@@ -111,6 +177,12 @@ CREATE TABLE Usuario (
     correo        VARCHAR2(200),
     telefono      INTEGER,
     fechaRegistro DATE,
+    fechaVerificacion DATE,
+    intentosFallidos  INTEGER      DEFAULT 0 NOT NULL,
+    bloqueadoHasta    DATE,
+    totpSecreto       VARCHAR2(64),
+    totpActivacion    DATE,
+    totpUltimoPaso    INTEGER,
     CONSTRAINT Usuario_PK PRIMARY KEY (idUsuario)
 );
 
@@ -133,7 +205,9 @@ CREATE TABLE UsuarioRol (
     idUsuarioRol      INTEGER NOT NULL,
     Usuario_idUsuario INTEGER NOT NULL,
     Roles_idRol       INTEGER NOT NULL,
+    origen            VARCHAR2(200), -- proveedor de identidad que otorgó el rol; NULL = asignado a mano
     CONSTRAINT UsuarioRol_PK PRIMARY KEY (idUsuarioRol),
+    CONSTRAINT UsuarioRol_UK UNIQUE (Usuario_idUsuario, Roles_idRol),
     CONSTRAINT UsuarioRol_Usuario_FK FOREIGN KEY (Usuario_idUsuario) REFERENCES Usuario(idUsuario),
     CONSTRAINT UsuarioRol_Roles_FK FOREIGN KEY (Roles_idRol) REFERENCES Roles(idRol)
 );
@@ -144,6 +218,7 @@ CREATE TABLE RolPermiso (
     Roles_idRol       INTEGER NOT NULL,
     Permiso_idPermiso INTEGER NOT NULL,
     CONSTRAINT RolPermiso_PK PRIMARY KEY (idRolPermiso),
+    CONSTRAINT RolPermiso_UK UNIQUE (Roles_idRol, Permiso_idPermiso),
     CONSTRAINT RolPermiso_Roles_FK FOREIGN KEY (Roles_idRol) REFERENCES Roles(idRol),
     CONSTRAINT RolPermiso_Permiso_FK FOREIGN KEY (Permiso_idPermiso) REFERENCES Permiso(idPermiso)
 );
@@ -169,11 +244,13 @@ CREATE TABLE Profesor (
 
 -- Tabla Personal
 CREATE TABLE Personal (
-    codigoEmpleado    INTEGER       NOT NULL,
-    puesto            VARCHAR2(100),
-    Usuario_idUsuario INTEGER       NOT NULL,
+    codigoEmpleado      INTEGER       NOT NULL,
+    puesto              VARCHAR2(100),
+    Usuario_idUsuario   INTEGER       NOT NULL,
+    Sucursal_idSucursal INTEGER,
     CONSTRAINT Personal_PK PRIMARY KEY (codigoEmpleado),
-    CONSTRAINT Personal_Usuario_FK FOREIGN KEY (Usuario_idUsuario) REFERENCES Usuario(idUsuario)
+    CONSTRAINT Personal_Usuario_FK FOREIGN KEY (Usuario_idUsuario) REFERENCES Usuario(idUsuario),
+    CONSTRAINT Personal_Sucursal_FK FOREIGN KEY (Sucursal_idSucursal) REFERENCES Sucursal(idSucursal)
 );
 
 -- Tabla Autor
@@ -199,6 +276,8 @@ CREATE TABLE Libro (
     titulo                VARCHAR2(200),
     anioEdicion           DATE,
     Editorial_idEditorial INTEGER       NOT NULL,
+    signatura             VARCHAR2(60),
+    sistemaClasificacion  VARCHAR2(10),
     CONSTRAINT Libro_PK PRIMARY KEY (ISBN),
     CONSTRAINT Libro_Editorial_FK FOREIGN KEY (Editorial_idEditorial) REFERENCES Editorial(idEditorial)
 );
@@ -223,8 +302,13 @@ CREATE TABLE Prestamo (
     estado                  VARCHAR2(50),
     Usuario_idUsuario       INTEGER     NOT NULL,
     Devolucion_idDevolucion INTEGER,
+    Sucursal_idPrestamo     INTEGER,
+    Sucursal_idDevolucion   INTEGER,
+    Ejemplar_codigo         INTEGER,
     CONSTRAINT Prestamo_PK PRIMARY KEY (idPrestamo),
-    CONSTRAINT Prestamo_Usuario_FK FOREIGN KEY (Usuario_idUsuario) REFERENCES Usuario(idUsuario)
+    CONSTRAINT Prestamo_Usuario_FK FOREIGN KEY (Usuario_idUsuario) REFERENCES Usuario(idUsuario),
+    CONSTRAINT Prestamo_SucPrestamo_FK FOREIGN KEY (Sucursal_idPrestamo) REFERENCES Sucursal(idSucursal),
+    CONSTRAINT Prestamo_SucDevolucion_FK FOREIGN KEY (Sucursal_idDevolucion) REFERENCES Sucursal(idSucursal)
 );
 
 -- Tabla Ejemplar
@@ -233,11 +317,21 @@ CREATE TABLE Ejemplar (
     estado              VARCHAR2(50),
     Libro_ISBN          INTEGER     NOT NULL,
     Prestamo_idPrestamo INTEGER,
+    localizacion        VARCHAR2(50),
+    Sucursal_idPropietaria INTEGER DEFAULT 1 NOT NULL,
+    Sucursal_idUbicacion   INTEGER DEFAULT 1 NOT NULL,
+    fechaAlta           DATE        DEFAULT SYSDATE NOT NULL,
     CONSTRAINT Ejemplar_PK PRIMARY KEY (codigo),
     CONSTRAINT Ejemplar_Libro_FK FOREIGN KEY (Libro_ISBN) REFERENCES Libro(ISBN),
-    CONSTRAINT Ejemplar_Prestamo_FK FOREIGN KEY (Prestamo_idPrestamo) REFERENCES Prestamo(idPrestamo)
+    CONSTRAINT Ejemplar_Prestamo_FK FOREIGN KEY (Prestamo_idPrestamo) REFERENCES Prestamo(idPrestamo),
+    CONSTRAINT Ejemplar_SucPropietaria_FK FOREIGN KEY (Sucursal_idPropietaria) REFERENCES Sucursal(idSucursal),
+    CONSTRAINT Ejemplar_SucUbicacion_FK FOREIGN KEY (Sucursal_idUbicacion) REFERENCES Sucursal(idSucursal)
 );
 
+-- Ejemplar prestado en cada préstamo (histórico; Ejemplar.Prestamo_idPrestamo
+-- solo apunta al préstamo en curso)
+ALTER TABLE Prestamo ADD CONSTRAINT Prestamo_Ejemplar_FK FOREIGN KEY (Ejemplar_codigo) REFERENCES Ejemplar(codigo);
+
 -- Tabla Bitacora
 CREATE TABLE Bitacora (
     idBitacora        INTEGER       NOT NULL,
@@ -245,11 +339,215 @@ CREATE TABLE Bitacora (
     fechaHora         DATE,
     detalle           VARCHAR2(500),
     entidad           VARCHAR2(50),
-    Usuario_idUsuario INTEGER       NOT NULL,
+    Usuario_idUsuario INTEGER,
     CONSTRAINT Bitacora_PK PRIMARY KEY (idBitacora),
     CONSTRAINT Bitacora_Usuario_FK FOREIGN KEY (Usuario_idUsuario) REFERENCES Usuario(idUsuario)
 );
 
+-- Tabla Categoria (taxonomía jerárquica de materias)
+CREATE TABLE Categoria (
+    idCategoria      INTEGER       NOT NULL,
+    nombre           VARCHAR2(100) NOT NULL,
+    descripcion      VARCHAR2(300),
+    Categoria_idPadre INTEGER,
+    CONSTRAINT Categoria_PK PRIMARY KEY (idCategoria),
+    CONSTRAINT Categoria_Padre_FK FOREIGN KEY (Categoria_idPadre) REFERENCES Categoria(idCategoria)
+);
+
+-- Tabla LibroCategoria (N:M entre Libro y Categoria)
+CREATE TABLE LibroCategoria (
+    idLibroCategoria      INTEGER NOT NULL,
+    Libro_ISBN            INTEGER NOT NULL,
+    Categoria_idCategoria INTEGER NOT NULL,
+    CONSTRAINT LibroCategoria_PK PRIMARY KEY (idLibroCategoria),
+    CONSTRAINT LibroCategoria_UK UNIQUE (Libro_ISBN, Categoria_idCategoria),
+    CONSTRAINT LibroCategoria_Libro_FK FOREIGN KEY (Libro_ISBN) REFERENCES Libro(ISBN),
+    CONSTRAINT LibroCategoria_Categoria_FK FOREIGN KEY (Categoria_idCategoria) REFERENCES Categoria(idCategoria)
+);
+
+-- Tabla Reserva (solicitud de un libro para retirar en una sucursal)
+-- estado: PENDIENTE, EN_TRANSITO, LISTA, CUMPLIDA, CANCELADA
+CREATE TABLE Reserva (
+    idReserva           INTEGER      NOT NULL,
+    fechaReserva        DATE         NOT NULL,
+    estado              VARCHAR2(20) NOT NULL,
+    Usuario_idUsuario   INTEGER      NOT NULL,
+    Libro_ISBN          INTEGER      NOT NULL,
+    Sucursal_idRetiro   INTEGER      NOT NULL,
+    Ejemplar_codigo     INTEGER,
+    CONSTRAINT Reserva_PK PRIMARY KEY (idReserva),
+    CONSTRAINT Reserva_Usuario_FK FOREIGN KEY (Usuario_idUsuario) REFERENCES Usuario(idUsuario),
+    CONSTRAINT Reserva_Libro_FK FOREIGN KEY (Libro_ISBN) REFERENCES Libro(ISBN),
+    CONSTRAINT Reserva_Sucursal_FK FOREIGN KEY (Sucursal_idRetiro) REFERENCES Sucursal(idSucursal),
+    CONSTRAINT Reserva_Ejemplar_FK FOREIGN KEY (Ejemplar_codigo) REFERENCES Ejemplar(codigo)
+);
+
+-- Tabla Traslado (movimiento de un ejemplar entre sucursales)
+-- estado: SOLICITADO, EN_TRANSITO, RECIBIDO, CANCELADO
+CREATE TABLE Traslado (
+    idTraslado          INTEGER      NOT NULL,
+    estado              VARCHAR2(20) NOT NULL,
+    fechaSolicitud      DATE         NOT NULL,
+    fechaEnvio          DATE,
+    fechaRecepcion      DATE,
+    Ejemplar_codigo     INTEGER      NOT NULL,
+    Sucursal_idOrigen   INTEGER      NOT NULL,
+    Sucursal_idDestino  INTEGER      NOT NULL,
+    Usuario_idSolicita  INTEGER      NOT NULL,
+    Reserva_idReserva   INTEGER,
+    CONSTRAINT Traslado_PK PRIMARY KEY (idTraslado),
+    CONSTRAINT Traslado_Ejemplar_FK FOREIGN KEY (Ejemplar_codigo) REFERENCES Ejemplar(codigo),
+    CONSTRAINT Traslado_Origen_FK FOREIGN KEY (Sucursal_idOrigen) REFERENCES Sucursal(idSucursal),
+    CONSTRAINT Traslado_Destino_FK FOREIGN KEY (Sucursal_idDestino) REFERENCES Sucursal(idSucursal),
+    CONSTRAINT Traslado_Usuario_FK FOREIGN KEY (Usuario_idSolicita) REFERENCES Usuario(idUsuario),
+    CONSTRAINT Traslado_Reserva_FK FOREIGN KEY (Reserva_idReserva) REFERENCES Reserva(idReserva)
+);
+
+-- Tabla Inventario (sesión de recuento de estantería en una sucursal)
+-- estado: ABIERTO, CERRADO, CANCELADO
+-- localizacion: prefijo de las ubicaciones revisadas (NULL = toda la sucursal)
+CREATE TABLE Inventario (
+    idInventario          INTEGER      NOT NULL,
+    estado                VARCHAR2(20) NOT NULL,
+    fechaInicio           DATE         NOT NULL,
+    fechaCierre           DATE,
+    localizacion          VARCHAR2(50),
+    Sucursal_idSucursal   INTEGER      NOT NULL,
+    Usuario_idResponsable INTEGER      NOT NULL,
+    totalEsperados        INTEGER,
+    totalEncontrados      INTEGER,
+    CONSTRAINT Inventario_PK PRIMARY KEY (idInventario),
+    CONSTRAINT Inventario_Sucursal_FK FOREIGN KEY (Sucursal_idSucursal) REFERENCES Sucursal(idSucursal),
+    CONSTRAINT Inventario_Usuario_FK FOREIGN KEY (Usuario_idResponsable) REFERENCES Usuario(idUsuario)
+);
+
+-- Tabla InventarioLectura (código escaneado durante un inventario; sin FK a
+-- Ejemplar porque se puede leer un código que no existe)
+CREATE TABLE InventarioLectura (
+    idLectura               INTEGER     NOT NULL,
+    Inventario_idInventario INTEGER     NOT NULL,
+    codigoLeido             INTEGER     NOT NULL,
+    localizacion            VARCHAR2(50) NOT NULL,
+    fechaLectura            DATE        NOT NULL,
+    Usuario_idUsuario       INTEGER     NOT NULL,
+    CONSTRAINT InventarioLectura_PK PRIMARY KEY (idLectura),
+    CONSTRAINT InventarioLectura_UK UNIQUE (Inventario_idInventario, codigoLeido),
+    CONSTRAINT InventarioLectura_Inv_FK FOREIGN KEY (Inventario_idInventario) REFERENCES Inventario(idInventario),
+    CONSTRAINT InventarioLectura_Usuario_FK FOREIGN KEY (Usuario_idUsuario) REFERENCES Usuario(idUsuario)
+);
+
+-- Tabla InventarioDiscrepancia (reporte guardado al cerrar un inventario)
+-- tipo: FALTANTE, MAL_UBICADO, INESPERADO
+CREATE TABLE InventarioDiscrepancia (
+    idDiscrepancia          INTEGER      NOT NULL,
+    Inventario_idInventario INTEGER      NOT NULL,
+    tipo                    VARCHAR2(20) NOT NULL,
+    codigo                  INTEGER      NOT NULL,
+    estadoEjemplar          VARCHAR2(50),
+    localizacionRegistrada  VARCHAR2(50),
+    localizacionLeida       VARCHAR2(50),
+    motivo                  VARCHAR2(200) NOT NULL,
+    CONSTRAINT InventarioDiscrepancia_PK PRIMARY KEY (idDiscrepancia),
+    CONSTRAINT InventarioDiscrepancia_Inv_FK FOREIGN KEY (Inventario_idInventario) REFERENCES Inventario(idInventario)
+);
+
+-- Tabla Baja (solicitud de retiro de un ejemplar o, sin ejemplar, de un libro completo)
+-- estado: PENDIENTE, APROBADA, RECHAZADA
+-- motivo: DETERIORADO, DESACTUALIZADO, PERDIDO, DONADO
+CREATE TABLE Baja (
+    idBaja               INTEGER       NOT NULL,
+    estado               VARCHAR2(20)  NOT NULL,
+    motivo               VARCHAR2(20)  NOT NULL,
+    observaciones        VARCHAR2(300),
+    Libro_ISBN           INTEGER       NOT NULL,
+    Ejemplar_codigo      INTEGER,
+    fechaSolicitud       DATE          NOT NULL,
+    Usuario_idSolicita   INTEGER       NOT NULL,
+    fechaResolucion      DATE,
+    Usuario_idResuelve   INTEGER,
+    comentarioResolucion VARCHAR2(300),
+    CONSTRAINT Baja_PK PRIMARY KEY (idBaja),
+    CONSTRAINT Baja_Libro_FK FOREIGN KEY (Libro_ISBN) REFERENCES Libro(ISBN),
+    CONSTRAINT Baja_Ejemplar_FK FOREIGN KEY (Ejemplar_codigo) REFERENCES Ejemplar(codigo),
+    CONSTRAINT Baja_Solicita_FK FOREIGN KEY (Usuario_idSolicita) REFERENCES Usuario(idUsuario),
+    CONSTRAINT Baja_Resuelve_FK FOREIGN KEY (Usuario_idResuelve) REFERENCES Usuario(idUsuario)
+);
+
+-- Tabla BajaEjemplar (registro permanente de cada ejemplar retirado)
+CREATE TABLE BajaEjemplar (
+    idBajaEjemplar       INTEGER      NOT NULL,
+    Baja_idBaja          INTEGER      NOT NULL,
+    Ejemplar_codigo      INTEGER      NOT NULL,
+    estadoAnterior       VARCHAR2(50),
+    Sucursal_idSucursal  INTEGER      NOT NULL,
+    localizacionAnterior VARCHAR2(50),
+    CONSTRAINT BajaEjemplar_PK PRIMARY KEY (idBajaEjemplar),
+    CONSTRAINT BajaEjemplar_UK UNIQUE (Ejemplar_codigo),
+    CONSTRAINT BajaEjemplar_Baja_FK FOREIGN KEY (Baja_idBaja) REFERENCES Baja(idBaja),
+    CONSTRAINT BajaEjemplar_Ejemplar_FK FOREIGN KEY (Ejemplar_codigo) REFERENCES Ejemplar(codigo),
+    CONSTRAINT BajaEjemplar_Sucursal_FK FOREIGN KEY (Sucursal_idSucursal) REFERENCES Sucursal(idSucursal)
+);
+
+-- Tabla Sesion (sesión iniciada con un refresh token rotativo; solo se guarda
+-- el hash SHA-256 del token vigente y del anterior para detectar reutilización)
+CREATE TABLE Sesion (
+    idSesion          INTEGER      NOT NULL,
+    Usuario_idUsuario INTEGER      NOT NULL,
+    tokenHash         VARCHAR2(64) NOT NULL,
+    tokenAnterior     VARCHAR2(64),
+    fechaCreacion     DATE         NOT NULL,
+    fechaExpiracion   DATE         NOT NULL,
+    fechaRevocacion   DATE,
+    dispositivo       VARCHAR2(100),
+    ip                VARCHAR2(45),
+    agenteUsuario     VARCHAR2(500),
+    ultimoUso         DATE,
+    CONSTRAINT Sesion_PK PRIMARY KEY (idSesion),
+    CONSTRAINT Sesion_Token_UK UNIQUE (tokenHash),
+    CONSTRAINT Sesion_Usuario_FK FOREIGN KEY (Usuario_idUsuario) REFERENCES Usuario(idUsuario)
+);
+
+-- Tabla TokenUsuario (tokens de un solo uso enviados por correo; solo se guarda su hash)
+-- tipo: RESTABLECER, VERIFICAR
+CREATE TABLE TokenUsuario (
+    idToken           INTEGER      NOT NULL,
+    Usuario_idUsuario INTEGER      NOT NULL,
+    tipo              VARCHAR2(20) NOT NULL,
+    tokenHash         VARCHAR2(64) NOT NULL,
+    fechaCreacion     DATE         NOT NULL,
+    fechaExpiracion   DATE         NOT NULL,
+    fechaUso          DATE,
+    CONSTRAINT TokenUsuario_PK PRIMARY KEY (idToken),
+    CONSTRAINT TokenUsuario_Hash_UK UNIQUE (tokenHash),
+    CONSTRAINT TokenUsuario_Usuario_FK FOREIGN KEY (Usuario_idUsuario) REFERENCES Usuario(idUsuario)
+);
+
+-- Tabla CodigoRecuperacion (códigos de un solo uso para entrar sin la
+-- aplicación autenticadora; solo se guarda su hash)
+CREATE TABLE CodigoRecuperacion (
+    idCodigo          INTEGER      NOT NULL,
+    Usuario_idUsuario INTEGER      NOT NULL,
+    codigoHash        VARCHAR2(64) NOT NULL,
+    fechaCreacion     DATE         NOT NULL,
+    fechaUso          DATE,
+    CONSTRAINT CodigoRecuperacion_PK PRIMARY KEY (idCodigo),
+    CONSTRAINT CodigoRecup_Usuario_FK FOREIGN KEY (Usuario_idUsuario) REFERENCES Usuario(idUsuario)
+);
+
+-- Tabla IdentidadExterna (cuentas de proveedores de identidad externos
+-- vinculadas a un usuario; proveedor es el emisor OIDC)
+CREATE TABLE IdentidadExterna (
+    idIdentidad       INTEGER       NOT NULL,
+    Usuario_idUsuario INTEGER       NOT NULL,
+    proveedor         VARCHAR2(200) NOT NULL,
+    sujeto            VARCHAR2(255) NOT NULL,
+    fechaCreacion     DATE          NOT NULL,
+    ultimoAcceso      DATE,
+    CONSTRAINT IdentidadExterna_PK PRIMARY KEY (idIdentidad),
+    CONSTRAINT IdentidadExterna_UK UNIQUE (proveedor, sujeto),
+    CONSTRAINT IdentidadExt_Usuario_FK FOREIGN KEY (Usuario_idUsuario) REFERENCES Usuario(idUsuario)
+);
+
 -- ============================================================================
 -- PASO 4: CREAR SECUENCIAS
 -- ============================================================================
@@ -262,10 +560,10 @@ CREATE SEQUENCE USUARIO_SEQ START WITH 1 INCREMENT BY 1 NOCACHE;
 CREATE SEQUENCE ESTUDIANTE_SEQ START WITH 2024001 INCREMENT BY 1 NOCACHE;
 CREATE SEQUENCE PROFESOR_SEQ START WITH 3001 INCREMENT BY 1 NOCACHE;
 CREATE SEQUENCE PERSONAL_SEQ START WITH 4001 INCREMENT BY 1 NOCACHE;
-CREATE SEQUENCE ROLES_SEQ START WITH 1 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE ROLES_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
 CREATE SEQUENCE PERMISO_SEQ START WITH 1 INCREMENT BY 1 NOCACHE;
-CREATE SEQUENCE USUARIOROL_SEQ START WITH 1 INCREMENT BY 1 NOCACHE;
-CREATE SEQUENCE ROLPERMISO_SEQ START WITH 1 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE USUARIOROL_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE ROLPERMISO_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
 CREATE SEQUENCE LIBRO_SEQ START WITH 1000 INCREMENT BY 1 NOCACHE;
 CREATE SEQUENCE AUTOR_SEQ START WITH 1 INCREMENT BY 1 NOCACHE;
 CREATE SEQUENCE EDITORIAL_SEQ START WITH 1 INCREMENT BY 1 NOCACHE;
@@ -273,6 +571,20 @@ CREATE SEQUENCE LIBROAUTOR_SEQ START WITH 1 INCREMENT BY 1 NOCACHE;
 CREATE SEQUENCE EJEMPLAR_SEQ START WITH 1 INCREMENT BY 1 NOCACHE;
 CREATE SEQUENCE PRESTAMO_SEQ START WITH 1 INCREMENT BY 1 NOCACHE;
 CREATE SEQUENCE BITACORA_SEQ START WITH 1 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE CATEGORIA_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE LIBROCATEGORIA_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE SUCURSAL_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE RESERVA_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE TRASLADO_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE INVENTARIO_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE INVENTARIOLECTURA_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE INVENTARIODISCREPANCIA_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE BAJA_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE BAJAEJEMPLAR_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE SESION_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE TOKENUSUARIO_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE CODIGORECUPERACION_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
+CREATE SEQUENCE IDENTIDADEXTERNA_SEQ START WITH 100 INCREMENT BY 1 NOCACHE;
 
 -- ============================================================================
 -- PASO 5: INSERTAR DATOS INICIALES - ROLES
@@ -287,6 +599,10 @@ INSERT INTO Roles (idRol, nombreRol) VALUES (2, 'estudiante');
 INSERT INTO Roles (idRol, nombreRol) VALUES (3, 'profesor');
 INSERT INTO Roles (idRol, nombreRol) VALUES (4, 'personal');
 
+-- Sucursales (la 1 es la biblioteca central, dueña por defecto de los ejemplares)
+INSERT INTO Sucursal (idSucursal, codigo, nombre, direccion) VALUES (1, 'CENTRAL', 'Biblioteca Central', 'Campus Central, Edificio A');
+INSERT INTO Sucursal (idSucursal, codigo, nombre, direccion) VALUES (2, 'NORTE', 'Biblioteca Campus Norte', 'Campus Norte, Edificio C');
+
 -- ============================================================================
 -- PASO 6: INSERTAR DATOS INICIALES - PERMISOS
 -- ============================================================================
@@ -302,6 +618,9 @@ INSERT INTO Permiso (idPermiso, descripcion) VALUES (4, 'Ver bitácora');
 INSERT INTO Permiso (idPermiso, descripcion) VALUES (5, 'Gestionar roles');
 INSERT INTO Permiso (idPermiso, descripcion) VALUES (6, 'Solicitar préstamos');
 INSERT INTO Permiso (idPermiso, descripcion) VALUES (7, 'Ver catálogo');
+INSERT INTO Permiso (idPermiso, descripcion) VALUES (8, 'Gestionar ejemplares');
+INSERT INTO Permiso (idPermiso, descripcion) VALUES (9, 'Ver reportes');
+INSERT INTO Permiso (idPermiso, descripcion) VALUES (10, 'Gestionar sucursales');
 
 -- ============================================================================
 -- PASO 7: ASIGNAR PERMISOS A ROLES
@@ -319,6 +638,9 @@ INSERT INTO RolPermiso (idRolPermiso, Roles_idRol, Permiso_idPermiso) VALUES (4,
 INSERT INTO RolPermiso (idRolPermiso, Roles_idRol, Permiso_idPermiso) VALUES (5, 1, 5);
 INSERT INTO RolPermiso (idRolPermiso, Roles_idRol, Permiso_idPermiso) VALUES (6, 1, 6);
 INSERT INTO RolPermiso (idRolPermiso, Roles_idRol, Permiso_idPermiso) VALUES (7, 1, 7);
+INSERT INTO RolPermiso (idRolPermiso, Roles_idRol, Permiso_idPermiso) VALUES (14, 1, 8);
+INSERT INTO RolPermiso (idRolPermiso, Roles_idRol, Permiso_idPermiso) VALUES (15, 1, 9);
+INSERT INTO RolPermiso (idRolPermiso, Roles_idRol, Permiso_idPermiso) VALUES (16, 1, 10);
 
 -- Estudiante y Profesor pueden solicitar préstamos y ver catálogo
 INSERT INTO RolPermiso (idRolPermiso, Roles_idRol, Permiso_idPermiso) VALUES (8, 2, 6);
@@ -326,9 +648,11 @@ INSERT INTO RolPermiso (idRolPermiso, Roles_idRol, Permiso_idPermiso) VALUES (9,
 INSERT INTO RolPermiso (idRolPermiso, Roles_idRol, Permiso_idPermiso) VALUES (10, 3, 6);
 INSERT INTO RolPermiso (idRolPermiso, Roles_idRol, Permiso_idPermiso) VALUES (11, 3, 7);
 
--- Personal puede gestionar préstamos y ver catálogo
+-- Personal puede gestionar préstamos y ejemplares de su sucursal, ver catálogo y reportes
 INSERT INTO RolPermiso (idRolPermiso, Roles_idRol, Permiso_idPermiso) VALUES (12, 4, 3);
 INSERT INTO RolPermiso (idRolPermiso, Roles_idRol, Permiso_idPermiso) VALUES (13, 4, 7);
+INSERT INTO RolPermiso (idRolPermiso, Roles_idRol, Permiso_idPermiso) VALUES (17, 4, 8);
+INSERT INTO RolPermiso (idRolPermiso, Roles_idRol, Permiso_idPermiso) VALUES (18, 4, 9);
 
 -- ============================================================================
 -- PASO 8: INSERTAR USUARIOS DE PRUEBA
@@ -796,6 +1120,108 @@ UPDATE Libro SET cantidadDisponible =
     (SELECT COUNT(*) FROM Ejemplar WHERE Ejemplar.Libro_ISBN = Libro.ISBN AND estado = 'DISPONIBLE')
 WHERE ISBN IN (1001, 1002, 1003, 1004, 1005, 1006, 1007, 1008, 1009, 1010);
 
+-- ============================================================================
+-- PASO 24: CATEGORÍAS DE MATERIAS
+-- ============================================================================
+BEGIN
+    DBMS_OUTPUT.PUT_LINE('=== PASO 24: Insertando categorías de materias ===');
+END;
+/
+
+INSERT INTO Categoria (idCategoria, nombre, descripcion, Categoria_idPadre) VALUES (1, 'Informática', 'Ciencias de la computación', NULL);
+INSERT INTO Categoria (idCategoria, nombre, descripcion, Categoria_idPadre) VALUES (2, 'Bases de Datos', NULL, 1);
+INSERT INTO Categoria (idCategoria, nombre, descripcion, Categoria_idPadre) VALUES (3, 'Sistemas Operativos', NULL, 1);
+INSERT INTO Categoria (idCategoria, nombre, descripcion, Categoria_idPadre) VALUES (4, 'Ingeniería de Software', NULL, 1);
+INSERT INTO Categoria (idCategoria, nombre, descripcion, Categoria_idPadre) VALUES (5, 'Algoritmos y Programación', NULL, 1);
+INSERT INTO Categoria (idCategoria, nombre, descripcion, Categoria_idPadre) VALUES (6, 'Redes', NULL, 1);
+INSERT INTO Categoria (idCategoria, nombre, descripcion, Categoria_idPadre) VALUES (7, 'Literatura', 'Obras literarias', NULL);
+INSERT INTO Categoria (idCategoria, nombre, descripcion, Categoria_idPadre) VALUES (8, 'Novela Latinoamericana', NULL, 7);
+
+INSERT INTO LibroCategoria (idLibroCategoria, Libro_ISBN, Categoria_idCategoria) VALUES (1, 1001, 2);
+INSERT INTO LibroCategoria (idLibroCategoria, Libro_ISBN, Categoria_idCategoria) VALUES (2, 1002, 3);
+INSERT INTO LibroCategoria (idLibroCategoria, Libro_ISBN, Categoria_idCategoria) VALUES (3, 1003, 4);
+INSERT INTO LibroCategoria (idLibroCategoria, Libro_ISBN, Categoria_idCategoria) VALUES (4, 1004, 4);
+INSERT INTO LibroCategoria (idLibroCategoria, Libro_ISBN, Categoria_idCategoria) VALUES (5, 1005, 4);
+INSERT INTO LibroCategoria (idLibroCategoria, Libro_ISBN, Categoria_idCategoria) VALUES (6, 1006, 5);
+INSERT INTO LibroCategoria (idLibroCategoria, Libro_ISBN, Categoria_idCategoria) VALUES (7, 1007, 5);
+INSERT INTO LibroCategoria (idLibroCategoria, Libro_ISBN, Categoria_idCategoria) VALUES (8, 1008, 4);
+INSERT INTO LibroCategoria (idLibroCategoria, Libro_ISBN, Categoria_idCategoria) VALUES (9, 1009, 8);
+INSERT INTO LibroCategoria (idLibroCategoria, Libro_ISBN, Categoria_idCategoria) VALUES (10, 1010, 8);
+INSERT INTO LibroCategoria (idLibroCategoria, Libro_ISBN, Categoria_idCategoria) VALUES (11, 1011, 5);
+INSERT INTO LibroCategoria (idLibroCategoria, Libro_ISBN, Categoria_idCategoria) VALUES (12, 1012, 6);
+
+-- ============================================================================
+-- PASO 25: SIGNATURAS TOPOGRÁFICAS Y UBICACIÓN DE EJEMPLARES
+-- ============================================================================
+BEGIN
+    DBMS_OUTPUT.PUT_LINE('=== PASO 25: Asignando signaturas y ubicaciones ===');
+END;
+/
+
+UPDATE Libro SET signatura = '005.74 E48', sistemaClasificacion = 'DEWEY' WHERE ISBN = 1001;
+UPDATE Libro SET signatura = '005.43 T164', sistemaClasificacion = 'DEWEY' WHERE ISBN = 1002;
+UPDATE Libro SET signatura = '005.1 M379c', sistemaClasificacion = 'DEWEY' WHERE ISBN = 1003;
+UPDATE Libro SET signatura = '005.16 F787', sistemaClasificacion = 'DEWEY' WHERE ISBN = 1004;
+UPDATE Libro SET signatura = '005.1 E93', sistemaClasificacion = 'DEWEY' WHERE ISBN = 1005;
+UPDATE Libro SET signatura = '005.1 K74 v.1', sistemaClasificacion = 'DEWEY' WHERE ISBN = 1006;
+UPDATE Libro SET signatura = '005.133 K39', sistemaClasificacion = 'DEWEY' WHERE ISBN = 1007;
+UPDATE Libro SET signatura = '005.12 D457', sistemaClasificacion = 'DEWEY' WHERE ISBN = 1008;
+UPDATE Libro SET signatura = '863 G216c', sistemaClasificacion = 'DEWEY' WHERE ISBN = 1009;
+UPDATE Libro SET signatura = '863 A424c', sistemaClasificacion = 'DEWEY' WHERE ISBN = 1010;
+UPDATE Libro SET signatura = 'QA76.6 .I5858 2009', sistemaClasificacion = 'LC' WHERE ISBN = 1011;
+UPDATE Libro SET signatura = 'TK5105.5 .T36 2011', sistemaClasificacion = 'LC' WHERE ISBN = 1012;
+
+-- Colección general en la sala A, literatura en la sala B
+UPDATE Ejemplar SET localizacion = 'SALA-A-EST-01'
+WHERE Libro_ISBN IN (1001, 1002, 1003, 1004, 1005, 1006, 1007, 1008);
+UPDATE Ejemplar SET localizacion = 'SALA-B-EST-03' WHERE Libro_ISBN IN (1009, 1010);
+UPDATE Ejemplar SET localizacion = 'SALA-A-EST-02' WHERE Libro_ISBN IN (1011, 1012);
+
+-- ============================================================================
+-- PASO 26: SUCURSALES DE EJEMPLARES Y PERSONAL
+-- ============================================================================
+BEGIN
+    DBMS_OUTPUT.PUT_LINE('=== PASO 26: Asignando ejemplares y personal a sucursales ===');
+END;
+/
+
+-- Los libros de literatura pertenecen y están en el Campus Norte
+UPDATE Ejemplar SET Sucursal_idPropietaria = 2, Sucursal_idUbicacion = 2 WHERE Libro_ISBN IN (1009, 1010);
+
+-- El bibliotecario trabaja en la biblioteca central
+UPDATE Personal SET Sucursal_idSucursal = 1 WHERE codigoEmpleado = 4001;
+
+-- Los préstamos existentes se registran en la sucursal del ejemplar prestado
+UPDATE Prestamo P SET Sucursal_idPrestamo = NVL(
+    (SELECT E.Sucursal_idUbicacion FROM Ejemplar E WHERE E.Prestamo_idPrestamo = P.idPrestamo), 1);
+UPDATE Prestamo SET Sucursal_idDevolucion = Sucursal_idPrestamo WHERE estado = 'DEVUELTO';
+
+-- ============================================================================
+-- PASO 27: HISTORIAL DE EJEMPLARES PARA EXPURGO
+-- ============================================================================
+BEGIN
+    DBMS_OUTPUT.PUT_LINE('=== PASO 27: Registrando fechas de alta y ejemplares prestados ===');
+END;
+/
+
+-- Los ejemplares de la carga inicial ingresaron hace cinco años
+UPDATE Ejemplar SET fechaAlta = ADD_MONTHS(SYSDATE, -60);
+
+-- Los préstamos en curso registran el ejemplar prestado
+UPDATE Prestamo P SET Ejemplar_codigo =
+    (SELECT E.codigo FROM Ejemplar E WHERE E.Prestamo_idPrestamo = P.idPrestamo)
+WHERE EXISTS (SELECT 1 FROM Ejemplar E WHERE E.Prestamo_idPrestamo = P.idPrestamo);
+
+-- ============================================================================
+-- PASO 28: CORREOS VERIFICADOS
+-- ============================================================================
+BEGIN
+    DBMS_OUTPUT.PUT_LINE('=== PASO 28: Marcando como verificados los usuarios de prueba ===');
+END;
+/
+
+UPDATE Usuario SET fechaVerificacion = NVL(fechaRegistro, SYSDATE);
+
 -- ============================================================================
 -- COMMIT FINAL
 -- ============================================================================
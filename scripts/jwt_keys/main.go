@@ -0,0 +1,61 @@
+// Genera una clave de firma para los tokens JWT.
+//
+// Uso:
+//
+//	go run ./scripts/jwt_keys -dir keys                  # Ed25519, kid con la fecha
+//	go run ./scripts/jwt_keys -dir keys -alg RS256 -kid 2026-01
+//
+// Para rotar, genera una clave nueva en JWT_KEYS_DIR y deja la anterior al
+// menos 15 minutos (la vigencia del token de acceso) antes de borrarla.
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func main() {
+	directorio := flag.String("dir", "keys", "directorio de claves (JWT_KEYS_DIR)")
+	algoritmo := flag.String("alg", "EdDSA", "algoritmo: EdDSA o RS256")
+	kid := flag.String("kid", time.Now().Format("2006-01-02-150405"), "identificador de la clave")
+	flag.Parse()
+
+	var privada interface{}
+	var err error
+	switch *algoritmo {
+	case "EdDSA":
+		_, privada, err = ed25519.GenerateKey(rand.Reader)
+	case "RS256":
+		privada, err = rsa.GenerateKey(rand.Reader, 3072)
+	default:
+		log.Fatalf("❌ Algoritmo no soportado: %s", *algoritmo)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privada)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.MkdirAll(*directorio, 0o700); err != nil {
+		log.Fatal(err)
+	}
+
+	archivo := filepath.Join(*directorio, *kid+".pem")
+	contenido := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(archivo, contenido, 0o600); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("✅ Clave %s (%s) guardada en %s", *kid, *algoritmo, archivo)
+}
@@ -0,0 +1,259 @@
+// Proveedor OpenID Connect de prueba para el inicio de sesión único.
+//
+// Uso:
+//
+//	go run ./scripts/mock_idp
+//
+// y en el .env del backend:
+//
+//	OIDC_ISSUER=http://localhost:9000
+//	OIDC_CLIENT_ID=biblioteca
+//	OIDC_CLIENT_SECRET=secreto
+//	OIDC_REDIRECT_URL=http://localhost:8080/api/auth/oidc/callback
+//	OIDC_ROLE_RULES=groups=biblioteca-staff:personal
+//
+// La página de autorización permite elegir el sujeto, el correo y los grupos
+// del usuario simulado; no valida contraseñas.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const kid = "mock-1"
+
+type autorizacion struct {
+	clienteID   string
+	redirectURI string
+	nonce       string
+	desafio     string
+	claims      jwt.MapClaims
+	expira      time.Time
+}
+
+var (
+	emisor         = entorno("MOCK_IDP_ISSUER", "http://localhost:9000")
+	clienteID      = entorno("MOCK_IDP_CLIENT_ID", "biblioteca")
+	clienteSecreto = entorno("MOCK_IDP_CLIENT_SECRET", "secreto")
+
+	clave *rsa.PrivateKey
+
+	mu      sync.Mutex
+	codigos = make(map[string]autorizacion)
+)
+
+var formulario = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Proveedor de identidad de prueba</title></head>
+<body>
+<h1>Proveedor de identidad de prueba</h1>
+<form method="post" action="/authorize">
+{{range $k, $v := .Parametros}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}">
+{{end}}
+<p><label>Sujeto <input name="sub" value="u-1001"></label></p>
+<p><label>Correo <input name="email" value="ana.perez@universidad.edu"></label></p>
+<p><label><input type="checkbox" name="email_verified" value="true" checked> Correo verificado</label></p>
+<p><label>Nombre <input name="given_name" value="Ana"></label></p>
+<p><label>Apellido <input name="family_name" value="Pérez"></label></p>
+<p><label>Grupos (separados por comas) <input name="groups" value="estudiantes"></label></p>
+<p><button type="submit">Iniciar sesión</button></p>
+</form>
+</body></html>`))
+
+func main() {
+	var err error
+	clave, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	http.HandleFunc("/.well-known/openid-configuration", descubrimiento)
+	http.HandleFunc("/authorize", autorizar)
+	http.HandleFunc("/token", token)
+	http.HandleFunc("/jwks", jwks)
+
+	direccion := entorno("MOCK_IDP_ADDR", ":9000")
+	log.Printf("🔐 Proveedor de identidad de prueba en %s (emisor %s)", direccion, emisor)
+	log.Fatal(http.ListenAndServe(direccion, nil))
+}
+
+func descubrimiento(w http.ResponseWriter, r *http.Request) {
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                emisor,
+		"authorization_endpoint":                emisor + "/authorize",
+		"token_endpoint":                        emisor + "/token",
+		"jwks_uri":                              emisor + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// autorizar muestra el formulario (GET) y emite el código de autorización (POST)
+func autorizar(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Form.Get("client_id") != clienteID || r.Form.Get("response_type") != "code" {
+		http.Error(w, "client_id o response_type inválidos", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("code_challenge_method") != "S256" || r.Form.Get("code_challenge") == "" {
+		http.Error(w, "se requiere PKCE S256", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		parametros := url.Values{}
+		for _, k := range []string{"client_id", "response_type", "redirect_uri", "scope", "state", "nonce", "code_challenge", "code_challenge_method"} {
+			parametros.Set(k, r.Form.Get(k))
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		formulario.Execute(w, map[string]interface{}{"Parametros": parametros})
+		return
+	}
+
+	var grupos []string
+	for _, g := range strings.Split(r.Form.Get("groups"), ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			grupos = append(grupos, g)
+		}
+	}
+
+	codigo := aleatorio()
+	mu.Lock()
+	codigos[codigo] = autorizacion{
+		clienteID:   r.Form.Get("client_id"),
+		redirectURI: r.Form.Get("redirect_uri"),
+		nonce:       r.Form.Get("nonce"),
+		desafio:     r.Form.Get("code_challenge"),
+		expira:      time.Now().Add(time.Minute),
+		claims: jwt.MapClaims{
+			"sub":            r.Form.Get("sub"),
+			"email":          r.Form.Get("email"),
+			"email_verified": r.Form.Get("email_verified") == "true",
+			"given_name":     r.Form.Get("given_name"),
+			"family_name":    r.Form.Get("family_name"),
+			"groups":         grupos,
+		},
+	}
+	mu.Unlock()
+
+	destino, err := url.Parse(r.Form.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "redirect_uri inválida", http.StatusBadRequest)
+		return
+	}
+	q := destino.Query()
+	q.Set("code", codigo)
+	q.Set("state", r.Form.Get("state"))
+	destino.RawQuery = q.Encode()
+
+	http.Redirect(w, r, destino.String(), http.StatusFound)
+}
+
+// token canjea el código por el ID token tras verificar el cliente y PKCE
+func token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		responderJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	id, secreto, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secreto, _ = url.QueryUnescape(secreto)
+	} else {
+		id, secreto = r.Form.Get("client_id"), r.Form.Get("client_secret")
+	}
+	if id != clienteID || secreto != clienteSecreto {
+		responderJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	mu.Lock()
+	a, existe := codigos[r.Form.Get("code")]
+	delete(codigos, r.Form.Get("code"))
+	mu.Unlock()
+
+	suma := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !existe || time.Now().After(a.expira) || a.clienteID != id ||
+		a.redirectURI != r.Form.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(suma[:]) != a.desafio {
+		responderJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	ahora := time.Now()
+	claims := a.claims
+	claims["iss"] = emisor
+	claims["aud"] = clienteID
+	claims["iat"] = ahora.Unix()
+	claims["exp"] = ahora.Add(5 * time.Minute).Unix()
+	claims["nonce"] = a.nonce
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = kid
+	firmado, err := idToken.SignedString(clave)
+	if err != nil {
+		responderJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": aleatorio(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     firmado,
+	})
+}
+
+func jwks(w http.ResponseWriter, r *http.Request) {
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(clave.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(clave.E)).Bytes()),
+		}},
+	})
+}
+
+func responderJSON(w http.ResponseWriter, estado int, cuerpo interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(estado)
+	json.NewEncoder(w).Encode(cuerpo)
+}
+
+func aleatorio() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func entorno(variable, predeterminado string) string {
+	if valor := os.Getenv(variable); valor != "" {
+		return valor
+	}
+	return predeterminado
+}
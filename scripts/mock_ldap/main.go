@@ -0,0 +1,39 @@
+// Directorio LDAP de prueba para el inicio de sesión con cuentas del campus;
+// el servidor está en internal/directorio/prueba.
+//
+// Uso:
+//
+//	go run ./scripts/mock_ldap
+//
+// y en el .env del backend:
+//
+//	LDAP_URL=ldap://localhost:3389
+//	LDAP_BIND_DN=cn=servicio,dc=uni,dc=edu
+//	LDAP_BIND_PASSWORD=servicio
+//	LDAP_BASE_DN=ou=personas,dc=uni,dc=edu
+//	LDAP_DOMAINS=uni.edu
+//	LDAP_GROUP_ROLES=biblioteca-staff:personal;docentes:profesor
+//
+// Usuarios: carlos.ruiz@uni.edu / Campus2024 (biblioteca-staff) y
+// maria.lopez@uni.edu / Campus2024 (docentes).
+package main
+
+import (
+	"log"
+	"os"
+	"proyecto-bd-final/internal/directorio/prueba"
+)
+
+func main() {
+	direccion := os.Getenv("MOCK_LDAP_ADDR")
+	if direccion == "" {
+		direccion = ":3389"
+	}
+
+	if _, err := prueba.Iniciar(direccion); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("📒 Directorio LDAP de prueba en %s", direccion)
+
+	select {}
+}
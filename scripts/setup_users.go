@@ -6,16 +6,12 @@ import (
 	"log"
 	"os"
 
+	"proyecto-bd-final/pkg/utils"
+
 	_ "github.com/godror/godror"
 	"github.com/joho/godotenv"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
-}
-
 func main() {
 	// Configuración directa del archivo .env
 	envPath := "E:/S6/BD/go-backend-proyecto-final-db/.env"
@@ -89,8 +85,8 @@ func main() {
 	var notFoundCount int
 
 	for _, user := range usersToUpdate {
-		// Hash de contraseña
-		hashedPassword, err := hashPassword(user.Password)
+		// Hash de contraseña, con el mismo algoritmo y parámetros que el servidor
+		hashedPassword, err := utils.HashPassword(user.Password)
 		if err != nil {
 			log.Printf("❌ Error al hashear contraseña para %s: %v", user.Email, err)
 			continue
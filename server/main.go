@@ -3,9 +3,14 @@ package main
 import (
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"proyecto-bd-final/internal/config"
+	"proyecto-bd-final/internal/mail"
 	"proyecto-bd-final/internal/routes"
+	"proyecto-bd-final/internal/services"
+	"proyecto-bd-final/pkg/utils"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -18,21 +23,74 @@ func main() {
 		log.Println("No se encontró archivo .env, usando variables de entorno del sistema")
 	}
 
+	// Cargar las claves de firma de los tokens; sin ellas no se puede autenticar
+	total, err := utils.CargarClaves()
+	if err != nil {
+		log.Fatalf("❌ Error al cargar las claves JWT: %v", err)
+	}
+	log.Printf("🔑 %d claves JWT cargadas, firmando con %s", total, utils.KidActivo())
+
+	// Recargar las claves periódicamente para aplicar rotaciones sin reiniciar
+	go func() {
+		for range time.Tick(5 * time.Minute) {
+			if _, err := utils.CargarClaves(); err != nil {
+				log.Printf("⚠️ No se pudieron recargar las claves JWT, se mantienen las anteriores: %v", err)
+			}
+		}
+	}()
+
 	// Inicializar base de datos
 	if err := config.InitDB(); err != nil {
 		log.Fatalf("❌ Error al conectar a la base de datos: %v", err)
 	}
 	defer config.CloseDB()
 
+	// Construir índice de búsqueda del catálogo
+	if total, err := services.NewBookService().RebuildSearchIndex(); err != nil {
+		log.Printf("⚠️ No se pudo construir el índice de búsqueda, se usará búsqueda SQL: %v", err)
+	} else {
+		log.Printf("🔎 Índice de búsqueda construido con %d libros", total)
+	}
+
+	// Recuperar la lista de sesiones revocadas
+	if total, err := services.NewSesionService().CargarRevocadas(); err != nil {
+		log.Printf("⚠️ No se pudo cargar la lista de sesiones revocadas: %v", err)
+	} else if total > 0 {
+		log.Printf("🔒 %d sesiones revocadas en vigencia", total)
+	}
+
+	// Configurar envío de correos
+	remitente, err := mail.Configurar()
+	if err != nil {
+		log.Fatalf("❌ Error al configurar el envío de correos: %v", err)
+	}
+	if _, ok := remitente.(mail.LogSender); ok {
+		log.Println("⚠️ ATENCIÓN: SMTP_HOST no configurado, los correos (con enlaces de restablecimiento " +
+			"y verificación vigentes) se escribirán en el log. Usar solo en desarrollo")
+	}
+
 	// Configurar Gin
 	router := gin.Default()
 
+	// Solo los proxies de TRUSTED_PROXIES pueden indicar la IP del cliente con
+	// X-Forwarded-For; sin ellos se usa la dirección de la conexión, de lo
+	// contrario cualquiera podría falsear la IP que limitan los intentos de login
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		log.Fatalf("❌ TRUSTED_PROXIES inválido: %v", err)
+	}
+
 	// Configurar CORS
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173"}, // Vite dev server
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "X-Total-Count"},
 		AllowCredentials: true,
 	}))
 